@@ -18,6 +18,7 @@ package commands
 
 import (
 	"github.com/napptive/catalog-manager/internal/app/cli"
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
 	"github.com/spf13/cobra"
 )
 
@@ -73,11 +74,222 @@ var deleteAppCmd = &cobra.Command{
 	},
 }
 
+var quotaCmdLongHelp = `Manage the namespace quotas. The namespaces without quota use the default one defined when launching the service`
+var quotaCmdShortHelp = `Manage the namespace quotas`
+
+var quotaCmd = &cobra.Command{
+	Use:   "quota",
+	Long:  quotaCmdLongHelp,
+	Short: quotaCmdShortHelp,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+// quota with the values of the quota set command
+var quota entities.Quota
+
+var setQuotaCmdLongHelp = `Override the default quota of a namespace. A zero value means unlimited`
+var setQuotaCmdShortHelp = `Override the quota of a namespace`
+
+var setQuotaCmd = &cobra.Command{
+	Use:   "set <namespace>",
+	Long:  setQuotaCmdLongHelp,
+	Short: setQuotaCmdShortHelp,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		op, err := cli.NewApplicationCli(cfg.AdminGRPCPort)
+		if err != nil {
+			return err
+		}
+		return op.SetQuota(args[0], quota)
+	},
+}
+
+var removeQuotaCmdLongHelp = `Remove the quota override of a namespace, so the default quota is applied`
+var removeQuotaCmdShortHelp = `Remove the quota override of a namespace`
+
+var removeQuotaCmd = &cobra.Command{
+	Use:     "remove <namespace>",
+	Long:    removeQuotaCmdLongHelp,
+	Short:   removeQuotaCmdShortHelp,
+	Aliases: []string{"rm", "delete"},
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		op, err := cli.NewApplicationCli(cfg.AdminGRPCPort)
+		if err != nil {
+			return err
+		}
+		return op.RemoveQuota(args[0])
+	},
+}
+
+var usageCmdLongHelp = `Show the storage and number of applications used by a namespace and its quota. All the namespaces are shown if no namespace is indicated`
+var usageCmdShortHelp = `Show the usage of the namespaces`
+
+var usageCmd = &cobra.Command{
+	Use:   "usage [namespace]",
+	Long:  usageCmdLongHelp,
+	Short: usageCmdShortHelp,
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		namespace := ""
+		if len(args) > 0 {
+			namespace = args[0]
+		}
+		op, err := cli.NewApplicationCli(cfg.AdminGRPCPort)
+		if err != nil {
+			return err
+		}
+		return op.Usage(namespace)
+	},
+}
+
+// repair with the inconsistencies to repair by the fsck command
+var repair entities.RepairOptions
+
+var fsckCmdLongHelp = `Check the consistency between the application metadata and the repository storage.
+It reports the applications stored without metadata (orphan directories), the metadata of the applications
+that are not stored (orphan metadata), and the metadata that cannot be read or is not valid (invalid metadata).
+With storage deduplication, it also reports the blobs whose reference counter does not match the manifests (leaked
+blobs) and the blobs referenced but not stored (missing blobs). Each class of inconsistency is only repaired if its flag is set.
+The orphan metadata updated during the last hour is not removed, it may belong to a push in progress.`
+var fsckCmdShortHelp = `Check the consistency between metadata and storage`
+
+var fsckCmd = &cobra.Command{
+	Use:   "fsck",
+	Long:  fsckCmdLongHelp,
+	Short: fsckCmdShortHelp,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		op, err := cli.NewApplicationCli(cfg.AdminGRPCPort)
+		if err != nil {
+			return err
+		}
+		return op.Fsck(repair)
+	},
+}
+
+// reindexOptions with the options of the reindex command
+var reindexOptions entities.ReindexOptions
+
+var reindexCmdLongHelp = `Rebuild the application metadata from the files stored in the repository.
+The metadata file and the readme of each tag are read as in a push, and the visibility is read from the
+visibility file stored with each application. Use --dryRun to check the result without storing the metadata.`
+var reindexCmdShortHelp = `Rebuild the application metadata from the storage`
+
+var reindexCmd = &cobra.Command{
+	Use:   "reindex [namespace]",
+	Long:  reindexCmdLongHelp,
+	Short: reindexCmdShortHelp,
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 0 {
+			reindexOptions.Namespace = args[0]
+		}
+		op, err := cli.NewApplicationCli(cfg.AdminGRPCPort)
+		if err != nil {
+			return err
+		}
+		return op.Reindex(reindexOptions)
+	},
+}
+
+var rotateKeysCmdLongHelp = `Rotate the encryption keys of the private applications.
+A new data key is created for the namespace (or for all of them if it is not set), the private applications are
+encrypted again with it and the previous keys are removed. The data keys are wrapped again with the first key of
+the master key file, so the previous master keys can be removed from the file once all the namespaces are rotated.`
+var rotateKeysCmdShortHelp = `Rotate the encryption keys of the private applications`
+
+var rotateKeysCmd = &cobra.Command{
+	Use:   "rotate-keys [namespace]",
+	Long:  rotateKeysCmdLongHelp,
+	Short: rotateKeysCmdShortHelp,
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		namespace := ""
+		if len(args) > 0 {
+			namespace = args[0]
+		}
+		op, err := cli.NewApplicationCli(cfg.AdminGRPCPort)
+		if err != nil {
+			return err
+		}
+		return op.RotateEncryptionKeys(namespace)
+	},
+}
+
+var backupCmdLongHelp = `Write in a file a backup with the files and the metadata of all the application tags of the catalog,
+or of the namespaces indicated. The backup includes the digest of each file, they are verified when it is restored.`
+var backupCmdShortHelp = `Back up the catalog applications`
+
+var backupCmd = &cobra.Command{
+	Use:   "backup <file> [namespace...]",
+	Long:  backupCmdLongHelp,
+	Short: backupCmdShortHelp,
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		op, err := cli.NewApplicationCli(cfg.AdminGRPCPort)
+		if err != nil {
+			return err
+		}
+		return op.Backup(args[0], entities.BackupOptions{Namespaces: args[1:]})
+	},
+}
+
+// restoreOptions with the options of the restore command
+var restoreOptions entities.RestoreOptions
+
+var restoreCmdLongHelp = `Restore the application tags of a backup, or the ones of the namespaces indicated.
+The files of each tag are verified with the digests of the backup before storing it. The tags that already
+exist in the catalog are skipped unless --overwrite is set. Use --dryRun to verify the backup without restoring it.`
+var restoreCmdShortHelp = `Restore the catalog applications from a backup`
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <file> [namespace...]",
+	Long:  restoreCmdLongHelp,
+	Short: restoreCmdShortHelp,
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		restoreOptions.Namespaces = args[1:]
+		op, err := cli.NewApplicationCli(cfg.AdminGRPCPort)
+		if err != nil {
+			return err
+		}
+		return op.Restore(args[0], restoreOptions)
+	},
+}
+
 func init() {
 	rootCmd.AddCommand(adminCmd)
 
 	adminCmd.AddCommand(deleteAppCmd)
 	adminCmd.AddCommand(listCmd)
+	adminCmd.AddCommand(usageCmd)
+	adminCmd.AddCommand(quotaCmd)
+	adminCmd.AddCommand(fsckCmd)
+	adminCmd.AddCommand(reindexCmd)
+	adminCmd.AddCommand(rotateKeysCmd)
+	adminCmd.AddCommand(backupCmd)
+	adminCmd.AddCommand(restoreCmd)
+
+	quotaCmd.AddCommand(setQuotaCmd)
+	quotaCmd.AddCommand(removeQuotaCmd)
+	setQuotaCmd.Flags().Int64Var(&quota.MaxBytes, "maxBytes", 0, "Maximum size of the application files of the namespace")
+	setQuotaCmd.Flags().IntVar(&quota.MaxApplications, "maxApplications", 0, "Maximum number of applications of the namespace")
+	setQuotaCmd.Flags().IntVar(&quota.MaxTagsPerApplication, "maxTags", 0, "Maximum number of tags of each application")
+	setQuotaCmd.Flags().Int64Var(&quota.MaxFileSize, "maxFileSize", 0, "Maximum size of an application file")
+
+	fsckCmd.Flags().BoolVar(&repair.OrphanDirectories, "repairOrphanDirectories", false, "Remove the applications stored without metadata")
+	fsckCmd.Flags().BoolVar(&repair.OrphanMetadata, "repairOrphanMetadata", false, "Remove the metadata of the applications that are not stored")
+	fsckCmd.Flags().BoolVar(&repair.InvalidMetadata, "repairInvalidMetadata", false, "Remove the metadata documents that are not valid")
+	fsckCmd.Flags().BoolVar(&repair.LeakedBlobs, "repairLeakedBlobs", false, "Fix the reference counters of the blobs and remove the unreferenced ones")
+
+	reindexCmd.Flags().BoolVar(&reindexOptions.DryRun, "dryRun", false, "Report the metadata that would be rebuilt without storing it")
+	reindexCmd.Flags().BoolVar(&reindexOptions.DefaultPrivate, "defaultPrivate", true, "Visibility of the applications stored without visibility file")
+
+	restoreCmd.Flags().BoolVar(&restoreOptions.Overwrite, "overwrite", false, "Replace the application tags that already exist")
+	restoreCmd.Flags().BoolVar(&restoreOptions.DryRun, "dryRun", false, "Verify the backup without restoring the applications")
 
 	adminCmd.PersistentFlags().IntVar(&cfg.CatalogManager.AdminGRPCPort, "adminGRPCPort", 7062, "gRPC Port to connect the Catalog-manager admin API")
 }
@@ -20,12 +20,15 @@ import (
 	"time"
 
 	"github.com/napptive/catalog-manager/internal/app/catalog-manager"
+	"github.com/napptive/catalog-manager/internal/pkg/config"
 	"github.com/spf13/cobra"
 )
 
 var runCmdLongHelp = "Launch the catalog-manager service"
 var runCmdShortHelp = "Launch the service"
-var runCmdExample = `$ catalog-manager run`
+var runCmdExample = `$ catalog-manager run
+$ catalog-manager run --dev
+$ catalog-manager run --metadataBackend=embedded`
 var runCmdUse = "run"
 
 var runCmd = &cobra.Command{
@@ -46,9 +49,41 @@ func init() {
 	runCmd.Flags().IntVar(&cfg.CatalogManager.HTTPPort, "httpPort", 7061, "HTTP Port to launch the Catalog-manager")
 	runCmd.Flags().IntVar(&cfg.CatalogManager.AdminGRPCPort, "adminGRPCPort", 7062, "gRPC Port to launch the Catalog-manager admin API")
 	runCmd.Flags().BoolVar(&cfg.CatalogManager.AdminAPI, "adminAPIEnabled", false, "Enable administration API")
-	runCmd.Flags().StringVar(&cfg.ElasticAddress, "elasticAddress", "http://localhost:9200", "address to connect to Elastic Search")
+	runCmd.Flags().StringVar(&cfg.MetadataBackend, "metadataBackend", config.ElasticMetadataBackend, "Backend for the application metadata (elastic, postgres or embedded)")
+	runCmd.Flags().StringVar(&cfg.PostgresConnString, "postgresConnString", "host=postgres user=postgres password=postgres port=5432", "Connection string of the PostgreSQL database used by the postgres metadata backend")
+	runCmd.Flags().StringVar(&cfg.EmbeddedMetadataPath, "embeddedMetadataPath", "/napptive/repository/.metadata.db", "Path of the file used by the embedded metadata backend")
+	runCmd.Flags().StringSliceVar(&cfg.ElasticAddresses, "elasticAddress", []string{"http://localhost:9200"}, "Addresses of the Elastic Search nodes, separated by commas")
+	runCmd.Flags().StringVar(&cfg.ElasticUsername, "elasticUsername", "", "User to connect to Elastic Search with basic authentication")
+	runCmd.Flags().StringVar(&cfg.ElasticPassword, "elasticPassword", "", "Password of the Elastic Search user")
+	runCmd.Flags().StringVar(&cfg.ElasticAPIKey, "elasticAPIKey", "", "Base64 encoded API key (id:api_key) to connect to Elastic Search")
+	runCmd.Flags().StringVar(&cfg.ElasticCACertPath, "elasticCACertPath", "", "PEM bundle of the CAs that sign the Elastic Search certificates (the system CAs are used if it is empty)")
+	runCmd.Flags().StringVar(&cfg.ElasticClientCertPath, "elasticClientCertPath", "", "PEM client certificate to connect to Elastic Search")
+	runCmd.Flags().StringVar(&cfg.ElasticClientKeyPath, "elasticClientKeyPath", "", "PEM private key of the Elastic Search client certificate")
+	runCmd.Flags().IntVar(&cfg.ResilienceConfig.MaxRetries, "metadataMaxRetries", 3, "Number of times a read of the Elastic metadata is retried while Elastic is unavailable")
+	runCmd.Flags().DurationVar(&cfg.ResilienceConfig.InitialBackoff, "metadataRetryBackoff", 100*time.Millisecond, "Wait before the first retry of an Elastic metadata read, it doubles on each retry")
+	runCmd.Flags().DurationVar(&cfg.ResilienceConfig.MaxBackoff, "metadataMaxRetryBackoff", 2*time.Second, "Maximum wait between two retries of an Elastic metadata read")
+	runCmd.Flags().DurationVar(&cfg.ResilienceConfig.StartupTimeout, "metadataStartupTimeout", 2*time.Minute, "Time to wait for Elastic to be available when the service starts")
+	runCmd.Flags().IntVar(&cfg.ResilienceConfig.BreakerThreshold, "metadataBreakerThreshold", 5, "Number of consecutive failed Elastic calls that make the next ones fail fast")
+	runCmd.Flags().DurationVar(&cfg.ResilienceConfig.BreakerOpenTime, "metadataBreakerOpenTime", 30*time.Second, "Time the Elastic calls fail fast before trying Elastic again")
 	runCmd.Flags().StringVar(&cfg.Index, "index", "napptive", "Elastic Index to store the repositories")
 	runCmd.Flags().StringVar(&cfg.RepositoryPath, "repositoryPath", "/napptive/repository/", "base path to store the repositories")
+	runCmd.Flags().StringVar(&cfg.StorageBackend, "storageBackend", config.FilesystemStorageBackend, "Storage backend for the application files (filesystem or s3)")
+	runCmd.Flags().BoolVar(&cfg.StorageDeduplication, "storageDeduplication", false, "Store the application files once by content digest (several replicas can only share the volume on Linux, where the blobs are protected with a file lock)")
+	runCmd.Flags().BoolVar(&cfg.CatalogManager.DevMode, "dev", false, "Keep the applications and their metadata in memory, without Elastic or storage (the data is lost when the service stops)")
+	runCmd.Flags().StringVar(&cfg.S3Config.Endpoint, "s3Endpoint", "", "Endpoint of the S3 compatible object storage")
+	runCmd.Flags().StringVar(&cfg.S3Config.Region, "s3Region", "us-east-1", "Region of the S3 bucket")
+	runCmd.Flags().StringVar(&cfg.S3Config.Bucket, "s3Bucket", "", "Bucket to store the repositories")
+	runCmd.Flags().StringVar(&cfg.S3Config.Prefix, "s3Prefix", "", "Prefix of the keys of all the stored objects")
+	runCmd.Flags().StringVar(&cfg.S3Config.AccessKeyID, "s3AccessKeyID", "", "Access key to connect to the S3 compatible object storage")
+	runCmd.Flags().StringVar(&cfg.S3Config.SecretAccessKey, "s3SecretAccessKey", "", "Secret key to connect to the S3 compatible object storage")
+	runCmd.Flags().BoolVar(&cfg.S3Config.UsePathStyle, "s3UsePathStyle", true, "Include the bucket name in the path instead of in the host name")
+	runCmd.Flags().Int64Var(&cfg.QuotaConfig.MaxBytes, "quotaMaxBytes", 0, "Maximum size of the application files of a namespace (0 means unlimited)")
+	runCmd.Flags().IntVar(&cfg.QuotaConfig.MaxApplications, "quotaMaxApplications", 0, "Maximum number of applications of a namespace (0 means unlimited)")
+	runCmd.Flags().IntVar(&cfg.QuotaConfig.MaxTagsPerApplication, "quotaMaxTags", 0, "Maximum number of tags of each application (0 means unlimited)")
+	runCmd.Flags().Int64Var(&cfg.QuotaConfig.MaxFileSize, "quotaMaxFileSize", 0, "Maximum size of an application file (0 means unlimited)")
+	runCmd.Flags().BoolVar(&cfg.EncryptionConfig.Enabled, "encryptionEnabled", false, "Encrypt the files of the private applications")
+	runCmd.Flags().StringVar(&cfg.EncryptionConfig.MasterKeyPath, "encryptionMasterKeyPath", "/napptive/keys/master.key", "File with the base64 encoded master keys, one per line, the first one is the active key")
+	runCmd.Flags().StringVar(&cfg.EncryptionConfig.KeysPath, "encryptionKeysPath", "/napptive/repository/.encryption-keys.json", "Legacy file with the data keys of the namespaces, imported if the repository storage has no keys")
 	runCmd.Flags().StringVar(&cfg.CatalogUrl, "repositoryUrl", "", "Repository URL")
 	runCmd.Flags().BoolVar(&cfg.JWTConfig.AuthEnabled, "authEnabled", false, "Enable Authentication")
 	runCmd.Flags().StringVar(&cfg.JWTConfig.Header, "authHeader", "authorization", "Authorization header name")
@@ -17,12 +17,22 @@
 package catalog_manager
 
 import (
+	"context"
+	"time"
+
 	analytics "github.com/napptive/analytics/pkg/provider"
 	"github.com/napptive/catalog-manager/internal/pkg/config"
+	"github.com/napptive/catalog-manager/internal/pkg/connection"
 	"github.com/napptive/catalog-manager/internal/pkg/provider/metadata"
+	"github.com/napptive/catalog-manager/internal/pkg/provider/quota"
 	"github.com/napptive/catalog-manager/internal/pkg/storage"
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/napptive/rdbms/v2/pkg/rdbms"
 )
 
+// postgresTimeout with the timeout of the queries of the postgres metadata backend
+const postgresTimeout = time.Second * 10
+
 // Providers with all the providers needed
 type Providers struct {
 	// elasticProvider with a elastic provider to store metadata
@@ -31,19 +41,28 @@ type Providers struct {
 	repoStorage storage.StorageManager
 	// analyticsProvider to store operation metrics
 	analyticsProvider analytics.Provider
+	// quotaProvider with the quotas of the namespaces
+	quotaProvider quota.QuotaProvider
+	// metadataHealth with the availability of the Elastic metadata backend, nil for the other backends
+	metadataHealth *metadata.ResilientProvider
 }
 
 // GetProviders creates and initializes all the providers
 func GetProviders(cfg *config.Config) (*Providers, error) {
-	pr, err := metadata.NewElasticProvider(cfg.Index, cfg.ElasticAddress, cfg.AuthEnabled)
+	pr, err := getMetadataProvider(cfg)
 	if err != nil {
 		return nil, err
 	}
-	err = pr.Init()
+
+	repoStorage, err := getStorageManager(cfg)
 	if err != nil {
 		return nil, err
 	}
 
+	// the overrides are stored with the applications, so they are shared by all the replicas
+	quotaProvider := quota.NewStorageQuotaProvider(repoStorage, cfg.QuotaConfig.ToQuota())
+	metadataHealth, _ := pr.(*metadata.ResilientProvider)
+
 	if cfg.BQConfig.Enabled {
 		provider, err := analytics.NewBigQueryProvider(cfg.BQConfig.Config)
 		if err != nil {
@@ -51,11 +70,74 @@ func GetProviders(cfg *config.Config) (*Providers, error) {
 		}
 		return &Providers{
 			elasticProvider:   pr,
-			repoStorage:       storage.NewStorageManager(cfg.RepositoryPath),
-			analyticsProvider: provider}, nil
+			repoStorage:       repoStorage,
+			analyticsProvider: provider,
+			quotaProvider:     quotaProvider,
+			metadataHealth:    metadataHealth}, nil
 	}
 	// ! s.cfg.BQConfig.Enabled
 	return &Providers{elasticProvider: pr,
-		repoStorage: storage.NewStorageManager(cfg.RepositoryPath)}, nil
+		repoStorage:    repoStorage,
+		quotaProvider:  quotaProvider,
+		metadataHealth: metadataHealth}, nil
 
 }
+
+// getMetadataProvider creates and initializes the metadata provider, in dev mode the metadata is kept in memory. The
+// Elastic provider is decorated with retries and a circuit breaker.
+func getMetadataProvider(cfg *config.Config) (metadata.MetadataProvider, error) {
+	if cfg.DevMode {
+		return metadata.NewMemoryProvider(cfg.AuthEnabled), nil
+	}
+	switch cfg.MetadataBackend {
+	case config.PostgresMetadataBackend:
+		conn, err := rdbms.NewRDBMS().PoolConnect(context.Background(), cfg.PostgresConnString)
+		if err != nil {
+			return nil, nerrors.NewUnavailableErrorFrom(err, "unable to connect to the metadata database")
+		}
+		return metadata.NewPostgresProvider(conn, postgresTimeout, cfg.AuthEnabled), nil
+	case config.EmbeddedMetadataBackend:
+		return metadata.NewBoltProvider(cfg.EmbeddedMetadataPath, cfg.AuthEnabled)
+	}
+	elasticConfig, err := connection.GetElasticConfig(&cfg.CatalogManager)
+	if err != nil {
+		return nil, err
+	}
+	pr, err := metadata.NewElasticProvider(cfg.Index, *elasticConfig, cfg.AuthEnabled)
+	if err != nil {
+		return nil, err
+	}
+	// Wait for the cluster instead of failing if it is not up yet
+	resilient := metadata.NewResilientProvider(pr, cfg.ResilienceConfig)
+	if err := resilient.WaitForBackend(pr.Init); err != nil {
+		return nil, err
+	}
+	return resilient, nil
+}
+
+// getStorageManager creates the storage manager of the configured backend, encrypting the private
+// applications if the encryption at rest is enabled
+func getStorageManager(cfg *config.Config) (storage.StorageManager, error) {
+	manager, err := getBackendStorageManager(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.EncryptionConfig.Enabled {
+		return storage.NewEncryptedStorageManager(manager, cfg.EncryptionConfig.MasterKeyPath, cfg.EncryptionConfig.KeysPath)
+	}
+	return manager, nil
+}
+
+// getBackendStorageManager creates the storage manager of the configured backend
+func getBackendStorageManager(cfg *config.Config) (storage.StorageManager, error) {
+	if cfg.DevMode {
+		return storage.NewMemoryStorageManager(), nil
+	}
+	if cfg.StorageBackend == config.S3StorageBackend {
+		return storage.NewS3StorageManager(cfg.S3Config)
+	}
+	if cfg.StorageDeduplication {
+		return storage.NewContentAddressableStorageManager(cfg.RepositoryPath), nil
+	}
+	return storage.NewStorageManager(cfg.RepositoryPath), nil
+}
@@ -18,6 +18,7 @@ package catalog_manager
 
 import (
 	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
@@ -44,11 +45,19 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/reflection"
 )
 
 const ZoneSecretCacheTTL = 5 * time.Minute
 
+const (
+	// downloadFormatQueryParam with the query parameter used to select the download format in the HTTP gateway
+	downloadFormatQueryParam = "format"
+	// downloadFormatHeader with the header used to select the download format in the HTTP gateway
+	downloadFormatHeader = "X-Download-Format"
+)
+
 // Service structure in charge of launching the application.
 type Service struct {
 	cfg config.Config
@@ -84,7 +93,7 @@ func (s *Service) Run() {
 	s.registerShutdownListener(providers)
 
 	// launch services
-	go s.LaunchHTTPService()
+	go s.LaunchHTTPService(providers)
 	if s.cfg.AdminAPI {
 		go s.LaunchGRPCAdminService(providers)
 	}
@@ -93,13 +102,14 @@ func (s *Service) Run() {
 
 // LaunchGRPCAdminService launches the admin interface of the service.
 func (s *Service) LaunchGRPCAdminService(providers *Providers) {
-	manager := admin.NewManager(providers.repoStorage, providers.elasticProvider)
+	manager := admin.NewManager(providers.repoStorage, providers.elasticProvider, providers.quotaProvider)
 	handler := admin.NewHandler(manager)
 
 	// No analytics exported for the administration service.
 	gRPCServer := grpc.NewServer()
 
 	grpc_catalog_go.RegisterNamespaceAdministrationServer(gRPCServer, handler)
+	admin.RegisterExtendedAdministrationServer(gRPCServer, handler)
 
 	if s.cfg.Debug {
 		// Register reflection service on gRPC server.
@@ -158,7 +168,7 @@ func (s *Service) LaunchGRPCService(providers *Providers, clients *Clients) {
 
 	permissionResolver := resolver.NewPermissionResolver(s.cfg.AuthEnabled, s.cfg.TeamConfig)
 
-	manager := catalog_manager.NewManager(providers.repoStorage, providers.elasticProvider, s.cfg.CatalogUrl)
+	manager := catalog_manager.NewManager(providers.repoStorage, providers.elasticProvider, providers.quotaProvider, s.cfg.CatalogUrl)
 	handler := catalog_manager.NewHandler(manager, s.cfg.AuthEnabled, s.cfg.TeamConfig, *permissionResolver)
 
 	appManager := apps.NewManager(&s.cfg, manager)
@@ -180,6 +190,7 @@ func (s *Service) LaunchGRPCService(providers *Providers, clients *Clients) {
 	}
 	grpc_catalog_go.RegisterCatalogServer(gRPCServer, handler)
 	grpc_catalog_go.RegisterApplicationsServer(gRPCServer, appHandler)
+	catalog_manager.RegisterExtendedCatalogServer(gRPCServer, handler)
 
 	if s.cfg.Debug {
 		// Register reflection service on gRPC server.
@@ -193,9 +204,37 @@ func (s *Service) LaunchGRPCService(providers *Providers, clients *Clients) {
 	}
 }
 
-// HealthzHandler to return 200 if called.
-func (s *Service) HealthzHandler(w http.ResponseWriter, _ *http.Request, pathParams map[string]string) {
-	w.WriteHeader(http.StatusOK)
+// HealthzHandler returns a handler that returns 200 if called, with the availability of the Elastic metadata
+// backend in the body.
+func (s *Service) HealthzHandler(providers *Providers) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request, pathParams map[string]string) {
+		writeHealth(w, providers, http.StatusOK)
+	}
+}
+
+// ReadyzHandler returns a handler that returns 503 while the Elastic metadata backend is unavailable and 200
+// otherwise.
+func (s *Service) ReadyzHandler(providers *Providers) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request, pathParams map[string]string) {
+		status := http.StatusOK
+		if providers.metadataHealth != nil && !providers.metadataHealth.Health().Ready {
+			status = http.StatusServiceUnavailable
+		}
+		writeHealth(w, providers, status)
+	}
+}
+
+// writeHealth writes the status code and the availability of the Elastic metadata backend, if it is used.
+func writeHealth(w http.ResponseWriter, providers *Providers, status int) {
+	if providers.metadataHealth == nil {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"metadata": providers.metadataHealth.Health()}); err != nil {
+		log.Warn().Err(err).Msg("unable to write the health status")
+	}
 }
 
 // withCORSSupport creates a handler that supports CORS related preflights.
@@ -204,16 +243,29 @@ func (s *Service) withCORSSupport(handler http.Handler) http.Handler {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		if r.Method == "OPTIONS" {
 			w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-			w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+			w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, "+downloadFormatHeader)
 			return
 		}
 		handler.ServeHTTP(w, r)
 	})
 }
 
+// downloadFormatMetadata forwards the download format selected in the HTTP request to the gRPC server. The format
+// can be set with the format query parameter or with the X-Download-Format header.
+func downloadFormatMetadata(_ context.Context, req *http.Request) metadata.MD {
+	format := req.URL.Query().Get(downloadFormatQueryParam)
+	if format == "" {
+		format = req.Header.Get(downloadFormatHeader)
+	}
+	if format == "" {
+		return nil
+	}
+	return metadata.Pairs(catalog_manager.DownloadFormatMetadataKey, format)
+}
+
 // LaunchHTTPService launches a server for HTTP requests.
-func (s *Service) LaunchHTTPService() {
-	mux := runtime.NewServeMux()
+func (s *Service) LaunchHTTPService(providers *Providers) {
+	mux := runtime.NewServeMux(runtime.WithMetadata(downloadFormatMetadata))
 	grpcAddress := fmt.Sprintf(":%d", s.cfg.GRPCPort)
 	var grpcOptions []grpc.DialOption
 	if s.cfg.TLSConfig.LaunchSecureService {
@@ -235,10 +287,18 @@ func (s *Service) LaunchHTTPService() {
 		log.Fatal().Err(err).Msg("failed to start applications handler")
 	}
 
-	if err := mux.HandlePath("GET", "/healthz", s.HealthzHandler); err != nil {
+	if err := catalog_manager.RegisterExtendedCatalogHandlerFromEndpoint(context.Background(), mux, grpcAddress, grpcOptions); err != nil {
+		log.Fatal().Err(err).Msg("failed to start extended catalog handler")
+	}
+
+	if err := mux.HandlePath("GET", "/healthz", s.HealthzHandler(providers)); err != nil {
 		log.Fatal().Err(err).Msg("unable to register healthz handler")
 	}
 
+	if err := mux.HandlePath("GET", "/readyz", s.ReadyzHandler(providers)); err != nil {
+		log.Fatal().Err(err).Msg("unable to register readyz handler")
+	}
+
 	server := &http.Server{
 		Addr:    fmt.Sprintf(":%d", s.cfg.HTTPPort),
 		Handler: s.withCORSSupport(mux),
@@ -18,9 +18,13 @@ package cli
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"strings"
 	"time"
 
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/catalog-manager/internal/pkg/server/admin"
 	"github.com/napptive/grpc-catalog-go"
 	"github.com/napptive/nerrors/pkg/nerrors"
 	"github.com/rs/zerolog/log"
@@ -32,6 +36,8 @@ import (
 type ApplicationCli struct {
 	// adminClient to connect to Admin interface
 	adminClient grpc_catalog_go.NamespaceAdministrationClient
+	// extendedClient to connect to the extended Admin interface
+	extendedClient admin.ExtendedAdministrationClient
 }
 
 func NewApplicationCli(adminPort int) (*ApplicationCli, error) {
@@ -43,7 +49,8 @@ func NewApplicationCli(adminPort int) (*ApplicationCli, error) {
 	}
 	client := grpc_catalog_go.NewNamespaceAdministrationClient(conn)
 	return &ApplicationCli{
-		adminClient: client,
+		adminClient:    client,
+		extendedClient: admin.NewExtendedAdministrationClient(conn),
 	}, nil
 }
 
@@ -84,3 +91,156 @@ func (ac *ApplicationCli) List(namespace string) error {
 
 	return nil
 }
+
+// SetQuota overrides the default quota of a namespace
+func (ac *ApplicationCli) SetQuota(namespace string, quota entities.Quota) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	response, err := ac.extendedClient.SetNamespaceQuota(ctx, &admin.SetNamespaceQuotaRequest{Namespace: namespace, Quota: quota})
+	PrintResultOrError(response, err)
+
+	return nil
+}
+
+// RemoveQuota removes the quota override of a namespace
+func (ac *ApplicationCli) RemoveQuota(namespace string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	response, err := ac.extendedClient.RemoveNamespaceQuota(ctx, &admin.NamespaceRequest{Namespace: namespace})
+	PrintResultOrError(response, err)
+
+	return nil
+}
+
+// Usage prints the usage of a namespace, or of all of them if namespace is empty
+func (ac *ApplicationCli) Usage(namespace string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	response, err := ac.extendedClient.GetNamespaceUsage(ctx, &admin.NamespaceRequest{Namespace: namespace})
+	PrintResultOrError(response, err)
+
+	return nil
+}
+
+// Fsck checks the consistency between the metadata and the storage, repairing the inconsistencies requested
+func (ac *ApplicationCli) Fsck(repair entities.RepairOptions) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*10)
+	defer cancel()
+
+	response, err := ac.extendedClient.Fsck(ctx, &admin.FsckRequest{Repair: repair})
+	PrintResultOrError(response, err)
+
+	return nil
+}
+
+// Reindex rebuilds the application metadata from the files stored in the repository
+func (ac *ApplicationCli) Reindex(options entities.ReindexOptions) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*30)
+	defer cancel()
+
+	response, err := ac.extendedClient.Reindex(ctx, &admin.ReindexRequest{Options: options})
+	PrintResultOrError(response, err)
+
+	return nil
+}
+
+// RotateEncryptionKeys encrypts the private applications of a namespace, or of all of them if it is empty,
+// with a new data key
+func (ac *ApplicationCli) RotateEncryptionKeys(namespace string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*30)
+	defer cancel()
+
+	response, err := ac.extendedClient.RotateEncryptionKeys(ctx, &admin.NamespaceRequest{Namespace: namespace})
+	PrintResultOrError(response, err)
+
+	return nil
+}
+
+// Backup writes in path an archive with the metadata and the files of the applications
+func (ac *ApplicationCli) Backup(path string, options entities.BackupOptions) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour*2)
+	defer cancel()
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nerrors.NewInternalErrorFrom(err, "unable to create the backup file")
+	}
+	report, err := ac.receiveBackup(ctx, file, options)
+	if cErr := file.Close(); err == nil && cErr != nil {
+		err = nerrors.NewInternalErrorFrom(cErr, "unable to write the backup file")
+	}
+	if err != nil {
+		// an incomplete backup is not valid
+		_ = os.Remove(path)
+		return err
+	}
+	PrintResultOrError(report, nil)
+
+	return nil
+}
+
+// receiveBackup writes in w the archive received from the Backup stream returning its report
+func (ac *ApplicationCli) receiveBackup(ctx context.Context, w io.Writer, options entities.BackupOptions) (*entities.BackupReport, error) {
+	stream, err := ac.extendedClient.Backup(ctx, &admin.BackupRequest{Options: options})
+	if err != nil {
+		return nil, err
+	}
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			return nil, nerrors.NewInternalError("the backup has finished without report")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if chunk.Report != nil {
+			return chunk.Report, nil
+		}
+		if _, err = w.Write(chunk.Data); err != nil {
+			return nil, nerrors.NewInternalErrorFrom(err, "unable to write the backup file")
+		}
+	}
+}
+
+// Restore sends the archive stored in path to restore its applications
+func (ac *ApplicationCli) Restore(path string, options entities.RestoreOptions) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour*2)
+	defer cancel()
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nerrors.NewInternalErrorFrom(err, "unable to open the backup file")
+	}
+	defer file.Close()
+
+	stream, err := ac.extendedClient.Restore(ctx)
+	if err != nil {
+		return err
+	}
+	if err = stream.Send(&admin.RestoreChunk{Options: &options}); err != nil {
+		return err
+	}
+	buffer := make([]byte, 1024*1024)
+	for {
+		n, err := file.Read(buffer)
+		if n > 0 {
+			if sErr := stream.Send(&admin.RestoreChunk{Data: buffer[:n]}); sErr != nil {
+				// the server has closed the stream, the error is returned by CloseAndRecv
+				break
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nerrors.NewInternalErrorFrom(err, "unable to read the backup file")
+		}
+	}
+	report, err := stream.CloseAndRecv()
+	PrintResultOrError(report, err)
+
+	return nil
+}
@@ -17,10 +17,25 @@
 package config
 
 import (
+	"net/url"
+
 	"github.com/napptive/nerrors/pkg/nerrors"
 	"github.com/rs/zerolog/log"
 )
 
+const (
+	// FilesystemStorageBackend stores the applications in RepositoryPath
+	FilesystemStorageBackend = "filesystem"
+	// S3StorageBackend stores the applications in an S3 compatible object storage
+	S3StorageBackend = "s3"
+	// ElasticMetadataBackend stores the application metadata in an Elastic index
+	ElasticMetadataBackend = "elastic"
+	// PostgresMetadataBackend stores the application metadata in the catalog.applications table of PostgreSQL
+	PostgresMetadataBackend = "postgres"
+	// EmbeddedMetadataBackend stores the application metadata in a local bbolt file
+	EmbeddedMetadataBackend = "embedded"
+)
+
 // CatalogManager with the catalog-manager configuration
 type CatalogManager struct {
 	// GRPCPort with the port on which the service will be listening
@@ -31,12 +46,35 @@ type CatalogManager struct {
 	AdminAPI bool
 	// AdminGRPCPort with the port on which the administration interface will be listening.
 	AdminGRPCPort int
-	// ElasticAddress with the address to connect to Elastic
-	ElasticAddress string
+	// MetadataBackend with the service used to store the application metadata (elastic, postgres or embedded)
+	MetadataBackend string
+	// PostgresConnString with the connection string of the PostgreSQL database used by the postgres metadata backend
+	PostgresConnString string
+	// EmbeddedMetadataPath with the path of the file used by the embedded metadata backend
+	EmbeddedMetadataPath string
+	// ElasticAddresses with the addresses of the Elastic nodes
+	ElasticAddresses []string
+	// ElasticUsername with the user to connect to Elastic with basic authentication
+	ElasticUsername string
+	// ElasticPassword with the password of the ElasticUsername
+	ElasticPassword string
+	// ElasticAPIKey with the base64 encoded API key (id:api_key) to connect to Elastic, instead of the username
+	ElasticAPIKey string
+	// ElasticCACertPath with the path of the PEM bundle of the CAs that sign the Elastic certificates, the
+	// system CAs are used if it is empty
+	ElasticCACertPath string
+	// ElasticClientCertPath with the path of the PEM client certificate to connect to Elastic
+	ElasticClientCertPath string
+	// ElasticClientKeyPath with the path of the PEM private key of the ElasticClientCertPath
+	ElasticClientKeyPath string
 	// Index with the name of the elastic index
 	Index string
 	// RepositoryPath with the path of the repository
 	RepositoryPath string
+	// StorageBackend with the storage used to store the applications (filesystem or s3)
+	StorageBackend string
+	// StorageDeduplication determines if the application files are stored once by content digest
+	StorageDeduplication bool
 	//CatalogUrl with the url of the repository (napptive repository must be nil)
 	CatalogUrl string
 	// UseZoneAwareInterceptors determines if the service will be using an interceptor that uses
@@ -44,6 +82,9 @@ type CatalogManager struct {
 	UseZoneAwareInterceptors bool
 	// SecretsProviderAddress with the address of the service providing JWT signing secrets.
 	SecretsProviderAddress string
+	// DevMode determines if the applications and their metadata are kept in memory, without external
+	// services. The data is lost when the service stops.
+	DevMode bool
 }
 
 // IsValid checks if the configuration options are valid.
@@ -54,14 +95,10 @@ func (c *CatalogManager) IsValid() error {
 	if c.HTTPPort <= 0 {
 		return nerrors.NewFailedPreconditionError("invalid HTTP port number")
 	}
-	if c.ElasticAddress == "" {
-		return nerrors.NewFailedPreconditionError("ElasticAddress must be filled")
-	}
-	if c.Index == "" {
-		return nerrors.NewFailedPreconditionError("Index must be filled")
-	}
-	if c.RepositoryPath == "" {
-		return nerrors.NewFailedPreconditionError("RepositoryPath must be filled")
+	if !c.DevMode {
+		if err := c.isBackendValid(); err != nil {
+			return err
+		}
 	}
 	if c.AdminAPI {
 		if c.AdminGRPCPort <= 0 {
@@ -76,6 +113,87 @@ func (c *CatalogManager) IsValid() error {
 	return nil
 }
 
+// isBackendValid checks the configuration of the metadata and storage backends, not used in dev mode.
+func (c *CatalogManager) isBackendValid() error {
+	switch c.MetadataBackend {
+	case ElasticMetadataBackend:
+		if err := c.isElasticValid(); err != nil {
+			return err
+		}
+	case PostgresMetadataBackend:
+		if c.PostgresConnString == "" {
+			return nerrors.NewFailedPreconditionError("PostgresConnString must be filled")
+		}
+	case EmbeddedMetadataBackend:
+		if c.EmbeddedMetadataPath == "" {
+			return nerrors.NewFailedPreconditionError("EmbeddedMetadataPath must be filled")
+		}
+	default:
+		return nerrors.NewFailedPreconditionError("invalid metadata backend [%s]", c.MetadataBackend)
+	}
+	switch c.StorageBackend {
+	case FilesystemStorageBackend:
+		if c.RepositoryPath == "" {
+			return nerrors.NewFailedPreconditionError("RepositoryPath must be filled")
+		}
+	case S3StorageBackend:
+		if c.StorageDeduplication {
+			return nerrors.NewFailedPreconditionError("storageDeduplication is only supported by the filesystem backend")
+		}
+	default:
+		return nerrors.NewFailedPreconditionError("invalid storage backend [%s]", c.StorageBackend)
+	}
+	return nil
+}
+
+// isElasticValid checks the options of the connection with Elastic
+func (c *CatalogManager) isElasticValid() error {
+	if len(c.ElasticAddresses) == 0 {
+		return nerrors.NewFailedPreconditionError("ElasticAddress must be filled")
+	}
+	secure := true
+	for _, address := range c.ElasticAddresses {
+		parsed, err := url.Parse(address)
+		if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return nerrors.NewFailedPreconditionError("invalid Elastic address [%s], it must be an http or https URL", address)
+		}
+		secure = secure && parsed.Scheme == "https"
+	}
+	if c.Index == "" {
+		return nerrors.NewFailedPreconditionError("Index must be filled")
+	}
+	if (c.ElasticUsername == "") != (c.ElasticPassword == "") {
+		return nerrors.NewFailedPreconditionError("elasticUsername and elasticPassword must be filled together")
+	}
+	if c.ElasticUsername != "" && c.ElasticAPIKey != "" {
+		return nerrors.NewFailedPreconditionError("elasticUsername and elasticAPIKey cannot be used together")
+	}
+	if (c.ElasticClientCertPath == "") != (c.ElasticClientKeyPath == "") {
+		return nerrors.NewFailedPreconditionError("elasticClientCertPath and elasticClientKeyPath must be filled together")
+	}
+	if !secure && (c.ElasticCACertPath != "" || c.ElasticClientCertPath != "") {
+		return nerrors.NewFailedPreconditionError("the Elastic TLS options require https addresses")
+	}
+	return nil
+}
+
+// redacted hides a secret value, an empty value is printed as it is to show that it is not set
+func redacted(value string) string {
+	if value == "" {
+		return ""
+	}
+	return "[redacted]"
+}
+
+// printElastic prints the options of the connection with Elastic without the secrets
+func (c *CatalogManager) printElastic() {
+	log.Info().Strs("ElasticAddresses", c.ElasticAddresses).Str("Index", c.Index).
+		Str("ElasticUsername", c.ElasticUsername).Str("ElasticPassword", redacted(c.ElasticPassword)).
+		Str("ElasticAPIKey", redacted(c.ElasticAPIKey)).Str("ElasticCACertPath", c.ElasticCACertPath).
+		Str("ElasticClientCertPath", c.ElasticClientCertPath).Str("ElasticClientKeyPath", c.ElasticClientKeyPath).
+		Msg("Elastic Search Address")
+}
+
 // Print the configuration using the application logger.
 func (c *CatalogManager) Print() {
 	log.Info().Int("gRPC", c.GRPCPort).Int("HTTP", c.HTTPPort).Msg("ports")
@@ -84,8 +202,19 @@ func (c *CatalogManager) Print() {
 		adminLog.Int("gRPC", c.AdminGRPCPort)
 	}
 	adminLog.Msg("admin API")
-	log.Info().Str("ElasticAddress", c.ElasticAddress).Str("Index", c.Index).Msg("Elastic Search Address")
+	if c.DevMode {
+		log.Warn().Msg("dev mode, the applications and their metadata are kept in memory and lost when the service stops")
+	} else {
+		switch c.MetadataBackend {
+		case PostgresMetadataBackend:
+			log.Info().Str("MetadataBackend", c.MetadataBackend).Msg("Application metadata")
+		case EmbeddedMetadataBackend:
+			log.Info().Str("MetadataBackend", c.MetadataBackend).Str("EmbeddedMetadataPath", c.EmbeddedMetadataPath).Msg("Application metadata")
+		default:
+			c.printElastic()
+		}
+		log.Info().Str("StorageBackend", c.StorageBackend).Str("RepositoryPath", c.RepositoryPath).Bool("StorageDeduplication", c.StorageDeduplication).Msg("Repository storage")
+	}
 	log.Info().Str("CatalogUrl", c.CatalogUrl).Msg("Catalog URL")
-	log.Info().Str("RepositoryPath", c.RepositoryPath).Msg("Repository base path")
 	log.Info().Bool("useZoneAwareInterceptors", c.UseZoneAwareInterceptors).Str("secretsProviderAddress", c.SecretsProviderAddress).Msg("JWT interceptors")
 }
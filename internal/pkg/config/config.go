@@ -34,6 +34,14 @@ type Config struct {
 	TLSConfig
 	// Playground connection configuration.
 	PlaygroundConnection
+	// S3Config with the configuration of the S3 storage backend
+	S3Config
+	// QuotaConfig with the default quota of the namespaces
+	QuotaConfig
+	// EncryptionConfig with the encryption at rest of the private applications
+	EncryptionConfig
+	// ResilienceConfig with the retries and the circuit breaker of the calls to Elastic
+	ResilienceConfig
 	// Version of the application.
 	Version string
 	// Commit related to this built.
@@ -62,6 +70,22 @@ func (c *Config) IsValid() error {
 	if err := c.PlaygroundConnection.IsValid(); err != nil {
 		return err
 	}
+	if !c.DevMode && c.StorageBackend == S3StorageBackend {
+		if err := c.S3Config.IsValid(); err != nil {
+			return err
+		}
+	}
+	if err := c.QuotaConfig.IsValid(); err != nil {
+		return err
+	}
+	if err := c.EncryptionConfig.IsValid(); err != nil {
+		return err
+	}
+	if c.usesElastic() {
+		if err := c.ResilienceConfig.IsValid(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -75,4 +99,17 @@ func (c *Config) Print() {
 	c.BQConfig.Print()
 	c.TLSConfig.Print()
 	c.PlaygroundConnection.Print()
+	if !c.DevMode && c.StorageBackend == S3StorageBackend {
+		c.S3Config.Print()
+	}
+	c.QuotaConfig.Print()
+	c.EncryptionConfig.Print()
+	if c.usesElastic() {
+		c.ResilienceConfig.Print()
+	}
+}
+
+// usesElastic checks if the application metadata is stored in Elastic
+func (c *Config) usesElastic() bool {
+	return !c.DevMode && c.MetadataBackend == ElasticMetadataBackend
 }
@@ -16,6 +16,8 @@
 package config
 
 import (
+	"time"
+
 	"github.com/onsi/ginkgo"
 	"github.com/onsi/gomega"
 )
@@ -28,4 +30,86 @@ var _ = ginkgo.Describe("Config tests", func() {
 		gomega.Expect(cfg.IsValid()).NotTo(gomega.Succeed())
 	})
 
+	ginkgo.Context("Connecting to Elastic", func() {
+		var elastic CatalogManager
+
+		ginkgo.BeforeEach(func() {
+			elastic = CatalogManager{
+				MetadataBackend:  ElasticMetadataBackend,
+				ElasticAddresses: []string{"https://node1:9200", "https://node2:9200"},
+				Index:            "napptive",
+			}
+		})
+
+		ginkgo.It("should accept several nodes with credentials and certificates", func() {
+			elastic.ElasticUsername = "catalog"
+			elastic.ElasticPassword = "secret"
+			elastic.ElasticCACertPath = "/certs/ca.pem"
+			elastic.ElasticClientCertPath = "/certs/client.pem"
+			elastic.ElasticClientKeyPath = "/certs/client.key"
+			gomega.Expect(elastic.isElasticValid()).To(gomega.Succeed())
+		})
+
+		ginkgo.It("should reject invalid addresses", func() {
+			for _, addresses := range [][]string{nil, {"node1:9200"}, {"https://node1:9200", "ftp://node2"}} {
+				elastic.ElasticAddresses = addresses
+				gomega.Expect(elastic.isElasticValid()).NotTo(gomega.Succeed())
+			}
+		})
+
+		ginkgo.It("should reject incomplete or conflicting credentials", func() {
+			elastic.ElasticUsername = "catalog"
+			gomega.Expect(elastic.isElasticValid()).NotTo(gomega.Succeed())
+			elastic.ElasticPassword = "secret"
+			elastic.ElasticAPIKey = "a2V5OnNlY3JldA=="
+			gomega.Expect(elastic.isElasticValid()).NotTo(gomega.Succeed())
+		})
+
+		ginkgo.It("should reject the TLS options with http addresses", func() {
+			elastic.ElasticClientCertPath = "/certs/client.pem"
+			gomega.Expect(elastic.isElasticValid()).NotTo(gomega.Succeed())
+			elastic.ElasticClientKeyPath = "/certs/client.key"
+			gomega.Expect(elastic.isElasticValid()).To(gomega.Succeed())
+			elastic.ElasticAddresses = append(elastic.ElasticAddresses, "http://node3:9200")
+			gomega.Expect(elastic.isElasticValid()).NotTo(gomega.Succeed())
+		})
+
+		ginkgo.It("should not print the secrets", func() {
+			gomega.Expect(redacted("secret")).NotTo(gomega.ContainSubstring("secret"))
+			gomega.Expect(redacted("")).To(gomega.BeEmpty())
+		})
+	})
+
+	ginkgo.Context("Retrying the Elastic calls", func() {
+		var resilience ResilienceConfig
+
+		ginkgo.BeforeEach(func() {
+			resilience = ResilienceConfig{
+				MaxRetries:       3,
+				InitialBackoff:   100 * time.Millisecond,
+				MaxBackoff:       2 * time.Second,
+				StartupTimeout:   2 * time.Minute,
+				BreakerThreshold: 5,
+				BreakerOpenTime:  30 * time.Second,
+			}
+		})
+
+		ginkgo.It("should accept the default options", func() {
+			gomega.Expect(resilience.IsValid()).To(gomega.Succeed())
+		})
+
+		ginkgo.It("should reject an initial backoff greater than the maximum", func() {
+			resilience.InitialBackoff = 3 * time.Second
+			gomega.Expect(resilience.IsValid()).NotTo(gomega.Succeed())
+		})
+
+		ginkgo.It("should reject a breaker that never opens or never closes", func() {
+			resilience.BreakerThreshold = 0
+			gomega.Expect(resilience.IsValid()).NotTo(gomega.Succeed())
+			resilience.BreakerThreshold = 5
+			resilience.BreakerOpenTime = 0
+			gomega.Expect(resilience.IsValid()).NotTo(gomega.Succeed())
+		})
+	})
+
 })
@@ -0,0 +1,49 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog/log"
+)
+
+// EncryptionConfig with the configuration of the encryption at rest of the private applications
+type EncryptionConfig struct {
+	// Enabled determines if the files of the private applications are encrypted
+	Enabled bool
+	// MasterKeyPath with the path of the file with the master keys that wrap the data keys
+	MasterKeyPath string
+	// KeysPath with the path of the legacy file with the data keys of the namespaces. The data keys are stored with the
+	// applications, this file is only imported if the storage has no keys.
+	KeysPath string
+}
+
+// IsValid checks if the configuration options are valid.
+func (e *EncryptionConfig) IsValid() error {
+	if !e.Enabled {
+		return nil
+	}
+	if e.MasterKeyPath == "" {
+		return nerrors.NewFailedPreconditionError("encryptionMasterKeyPath must be filled")
+	}
+	return nil
+}
+
+// Print the configuration using the application logger.
+func (e *EncryptionConfig) Print() {
+	log.Info().Bool("enabled", e.Enabled).Str("masterKeyPath", e.MasterKeyPath).Str("keysPath", e.KeysPath).Msg("Encryption at rest")
+}
@@ -0,0 +1,59 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog/log"
+)
+
+// QuotaConfig with the default quota of the namespaces. A zero value means unlimited.
+type QuotaConfig struct {
+	// MaxBytes with the maximum size of all the application files of a namespace
+	MaxBytes int64
+	// MaxApplications with the maximum number of applications of a namespace
+	MaxApplications int
+	// MaxTagsPerApplication with the maximum number of tags of each application
+	MaxTagsPerApplication int
+	// MaxFileSize with the maximum size of an application file
+	MaxFileSize int64
+}
+
+// IsValid checks if the configuration options are valid.
+func (q *QuotaConfig) IsValid() error {
+	if q.MaxBytes < 0 || q.MaxApplications < 0 || q.MaxTagsPerApplication < 0 || q.MaxFileSize < 0 {
+		return nerrors.NewFailedPreconditionError("quota limits cannot be negative")
+	}
+	return nil
+}
+
+// ToQuota returns the default quota
+func (q *QuotaConfig) ToQuota() entities.Quota {
+	return entities.Quota{
+		MaxBytes:              q.MaxBytes,
+		MaxApplications:       q.MaxApplications,
+		MaxTagsPerApplication: q.MaxTagsPerApplication,
+		MaxFileSize:           q.MaxFileSize,
+	}
+}
+
+// Print the configuration using the application logger.
+func (q *QuotaConfig) Print() {
+	log.Info().Int64("maxBytes", q.MaxBytes).Int("maxApplications", q.MaxApplications).
+		Int("maxTagsPerApplication", q.MaxTagsPerApplication).Int64("maxFileSize", q.MaxFileSize).Msg("Namespace quotas")
+}
@@ -0,0 +1,68 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"time"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog/log"
+)
+
+// ResilienceConfig with the retries and the circuit breaker of the calls to the Elastic metadata backend
+type ResilienceConfig struct {
+	// MaxRetries with the number of times a read is retried while the backend is unavailable
+	MaxRetries int
+	// InitialBackoff with the wait before the first retry, it doubles on each retry
+	InitialBackoff time.Duration
+	// MaxBackoff with the maximum wait between two retries
+	MaxBackoff time.Duration
+	// StartupTimeout with the time to wait for the backend to be available when the service starts
+	StartupTimeout time.Duration
+	// BreakerThreshold with the number of consecutive failed calls that open the circuit breaker
+	BreakerThreshold int
+	// BreakerOpenTime with the time the open circuit breaker rejects the calls before trying the backend again
+	BreakerOpenTime time.Duration
+}
+
+// IsValid checks if the configuration options are valid.
+func (r *ResilienceConfig) IsValid() error {
+	if r.MaxRetries < 0 {
+		return nerrors.NewFailedPreconditionError("metadataMaxRetries cannot be negative")
+	}
+	if r.InitialBackoff <= 0 || r.MaxBackoff < r.InitialBackoff {
+		return nerrors.NewFailedPreconditionError("metadataRetryBackoff must be positive and not greater than metadataMaxRetryBackoff")
+	}
+	if r.StartupTimeout < 0 {
+		return nerrors.NewFailedPreconditionError("metadataStartupTimeout cannot be negative")
+	}
+	if r.BreakerThreshold <= 0 {
+		return nerrors.NewFailedPreconditionError("metadataBreakerThreshold must be positive")
+	}
+	if r.BreakerOpenTime <= 0 {
+		return nerrors.NewFailedPreconditionError("metadataBreakerOpenTime must be positive")
+	}
+	return nil
+}
+
+// Print the configuration using the application logger.
+func (r *ResilienceConfig) Print() {
+	log.Info().Int("maxRetries", r.MaxRetries).Str("initialBackoff", r.InitialBackoff.String()).
+		Str("maxBackoff", r.MaxBackoff.String()).Str("startupTimeout", r.StartupTimeout.String()).
+		Int("breakerThreshold", r.BreakerThreshold).Str("breakerOpenTime", r.BreakerOpenTime.String()).
+		Msg("Metadata backend resilience")
+}
@@ -0,0 +1,63 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package config
+
+import (
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog/log"
+)
+
+// S3Config with the configuration to store the applications in an S3 compatible object storage
+type S3Config struct {
+	// Endpoint with the URL of the S3 API (p.e. https://s3.eu-west-1.amazonaws.com or http://minio:9000)
+	Endpoint string
+	// Region with the region used to sign the requests
+	Region string
+	// Bucket with the name of the bucket where the applications are stored
+	Bucket string
+	// Prefix with an optional key prefix for all the objects
+	Prefix string
+	// AccessKeyID with the access key to sign the requests
+	AccessKeyID string
+	// SecretAccessKey with the secret key to sign the requests
+	SecretAccessKey string
+	// UsePathStyle determines if the bucket is included in the path instead of the host name
+	UsePathStyle bool
+}
+
+// IsValid checks if the configuration options are valid.
+func (s *S3Config) IsValid() error {
+	if s.Endpoint == "" {
+		return nerrors.NewFailedPreconditionError("s3Endpoint must be filled")
+	}
+	if s.Region == "" {
+		return nerrors.NewFailedPreconditionError("s3Region must be filled")
+	}
+	if s.Bucket == "" {
+		return nerrors.NewFailedPreconditionError("s3Bucket must be filled")
+	}
+	if s.AccessKeyID == "" || s.SecretAccessKey == "" {
+		return nerrors.NewFailedPreconditionError("s3AccessKeyID and s3SecretAccessKey must be filled")
+	}
+	return nil
+}
+
+// Print the configuration using the application logger.
+func (s *S3Config) Print() {
+	log.Info().Str("endpoint", s.Endpoint).Str("region", s.Region).Str("bucket", s.Bucket).
+		Str("prefix", s.Prefix).Str("accessKeyID", s.AccessKeyID).Bool("usePathStyle", s.UsePathStyle).Msg("S3 storage")
+}
@@ -0,0 +1,65 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package connection
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"os"
+
+	"github.com/elastic/go-elasticsearch/v7"
+	"github.com/napptive/catalog-manager/internal/pkg/config"
+	"github.com/napptive/nerrors/pkg/nerrors"
+)
+
+// GetElasticConfig returns the configuration of the Elastic client with the credentials and the TLS options
+func GetElasticConfig(cfg *config.CatalogManager) (*elasticsearch.Config, error) {
+	conf := &elasticsearch.Config{
+		Addresses: cfg.ElasticAddresses,
+		Username:  cfg.ElasticUsername,
+		Password:  cfg.ElasticPassword,
+		APIKey:    cfg.ElasticAPIKey,
+	}
+	if cfg.ElasticCACertPath == "" && cfg.ElasticClientCertPath == "" {
+		return conf, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.ElasticCACertPath != "" {
+		ca, err := os.ReadFile(cfg.ElasticCACertPath)
+		if err != nil {
+			return nil, nerrors.NewFailedPreconditionErrorFrom(err, "unable to read the Elastic CA bundle")
+		}
+		cp := x509.NewCertPool()
+		if !cp.AppendCertsFromPEM(ca) {
+			return nil, nerrors.NewFailedPreconditionError("the Elastic CA bundle does not contain PEM certificates")
+		}
+		tlsConfig.RootCAs = cp
+	}
+	if cfg.ElasticClientCertPath != "" {
+		certificate, err := tls.LoadX509KeyPair(cfg.ElasticClientCertPath, cfg.ElasticClientKeyPath)
+		if err != nil {
+			return nil, nerrors.NewFailedPreconditionErrorFrom(err, "unable to load the Elastic client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	conf.Transport = transport
+	return conf, nil
+}
@@ -0,0 +1,75 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+// BackupOptions with the applications to include in a backup
+type BackupOptions struct {
+	// Namespaces to back up, all the namespaces are included if it is empty
+	Namespaces []string
+}
+
+// BackedUpApplication with the result of including an application tag in a backup
+type BackedUpApplication struct {
+	// ApplicationID with the application tag
+	ApplicationID *ApplicationID
+	// Files with the number of files included
+	Files int
+	// Bytes with the size of the files included
+	Bytes int64
+	// Error with the error found reading the application, the application is not included in the backup
+	Error string
+}
+
+// BackupReport with the applications included in a backup
+type BackupReport struct {
+	// Namespaces with the namespaces included in the backup
+	Namespaces []string
+	// Applications with the result of each application tag
+	Applications []*BackedUpApplication
+}
+
+// RestoreOptions with the options to restore a backup
+type RestoreOptions struct {
+	// Namespaces to restore, all the namespaces of the backup are restored if it is empty
+	Namespaces []string
+	// Overwrite to replace the application tags that already exist, they are skipped otherwise
+	Overwrite bool
+	// DryRun to verify the backup without restoring the applications
+	DryRun bool
+}
+
+// RestoredApplication with the result of restoring an application tag
+type RestoredApplication struct {
+	// ApplicationID with the application tag
+	ApplicationID *ApplicationID
+	// Files with the number of files of the application
+	Files int
+	// Restored with a flag to indicate if the application has been stored
+	Restored bool
+	// Skipped with a flag to indicate that the application already exists and has not been overwritten
+	Skipped bool
+	// Error with the error found verifying or storing the application
+	Error string
+}
+
+// RestoreReport with the result of restoring a backup
+type RestoreReport struct {
+	// DryRun with a flag to indicate that the applications have not been stored
+	DryRun bool
+	// Applications with the result of each application tag of the restored namespaces
+	Applications []*RestoredApplication
+}
@@ -0,0 +1,72 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"strings"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+)
+
+// DownloadFormat with the format of the applications downloaded
+type DownloadFormat string
+
+const (
+	// DownloadFormatNone to download each application file
+	DownloadFormatNone DownloadFormat = "none"
+	// DownloadFormatTgz to download the application in a tar file compressed with gzip
+	DownloadFormatTgz DownloadFormat = "tgz"
+	// DownloadFormatZip to download the application in a zip file
+	DownloadFormatZip DownloadFormat = "zip"
+	// DownloadFormatTarZstd to download the application in a tar file compressed with zstd
+	DownloadFormatTarZstd DownloadFormat = "tar.zst"
+)
+
+// downloadFormatExtensions with the extension of the file downloaded in each format
+var downloadFormatExtensions = map[DownloadFormat]string{
+	DownloadFormatTgz:     ".tgz",
+	DownloadFormatZip:     ".zip",
+	DownloadFormatTarZstd: ".tar.zst",
+}
+
+// ParseDownloadFormat returns the download format with the given name
+func ParseDownloadFormat(name string) (DownloadFormat, error) {
+	format := DownloadFormat(strings.ToLower(strings.TrimSpace(name)))
+	switch format {
+	case DownloadFormatNone, DownloadFormatTgz, DownloadFormatZip, DownloadFormatTarZstd:
+		return format, nil
+	}
+	return "", nerrors.NewInvalidArgumentError("invalid download format [%s], must be one of none, tgz, zip or tar.zst", name)
+}
+
+// NewDownloadFormat returns the download format of a request that only indicates if the application is compressed
+func NewDownloadFormat(compressed bool) DownloadFormat {
+	if compressed {
+		return DownloadFormatTgz
+	}
+	return DownloadFormatNone
+}
+
+// IsArchive checks if the application is downloaded in a single file
+func (f DownloadFormat) IsArchive() bool {
+	return f != DownloadFormatNone
+}
+
+// FileName returns the name of the file downloaded with the application
+func (f DownloadFormat) FileName(applicationName string) string {
+	return "./" + applicationName + downloadFormatExtensions[f]
+}
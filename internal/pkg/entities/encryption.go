@@ -0,0 +1,37 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+// NamespaceKeyRotation with the result of rotating the data key of a namespace
+type NamespaceKeyRotation struct {
+	// Namespace with the name of the namespace
+	Namespace string
+	// KeyID with the identifier of the new data key of the namespace
+	KeyID string
+	// Applications with the number of application tags encrypted again with the new data key
+	Applications int
+	// Error with the error found rotating the key, the previous keys are kept if it is not empty
+	Error string
+}
+
+// KeyRotationReport with the result of rotating the encryption keys of the private applications
+type KeyRotationReport struct {
+	// MasterKeyID with the identifier of the master key that wraps the data keys
+	MasterKeyID string
+	// Namespaces with the result of each namespace
+	Namespaces []*NamespaceKeyRotation
+}
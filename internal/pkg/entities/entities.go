@@ -18,6 +18,8 @@ package entities
 
 import (
 	"fmt"
+	"io"
+	"time"
 
 	"github.com/napptive/grpc-catalog-go"
 )
@@ -34,6 +36,10 @@ type AppSummary struct {
 	MetadataLogo map[string][]ApplicationLogo
 	// Private indicate the application scope indexed by tag
 	Private bool
+	// LastUpdated with the time the last tag was added
+	LastUpdated time.Time
+	// Downloads with the number of downloads of all the tags
+	Downloads int64
 }
 
 // ToApplicationSummary converts the ApplicationSummary to grpc_catalog_go.ApplicationSummary
@@ -101,6 +107,10 @@ type ApplicationInfo struct {
 	MetadataName string
 	// Private with a flag to indicate the application Scope
 	Private bool
+	// LastUpdated with the time the tag was added
+	LastUpdated time.Time
+	// Downloads with the number of times the tag has been downloaded
+	Downloads int64
 }
 
 // ToApplicationID converts ApplicationSummary to ApplicationID
@@ -267,6 +277,14 @@ type FileInfo struct {
 	Data []byte
 }
 
+// FileStream represents a file whose content is read incrementally
+type FileStream struct {
+	// Path with the File path
+	Path string
+	// Reader with the content of the file, it must be closed after reading it
+	Reader io.ReadCloser
+}
+
 // NewFileInfo creates FileInfo from *grpc_catalog_go.FileInfo
 func NewFileInfo(info *grpc_catalog_go.FileInfo) *FileInfo {
 	if info == nil {
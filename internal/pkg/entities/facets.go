@@ -0,0 +1,199 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import "sort"
+
+// ApplicationFacets with the structured fields of the application metadata used to filter and count the applications
+type ApplicationFacets struct {
+	// Keywords with the keywords of the application
+	Keywords []string
+	// License with the license of the application
+	License string
+	// Traits with the traits required by the application
+	Traits []string
+	// Scopes with the scopes required by the application
+	Scopes []string
+	// K8sKinds with the kinds of the Kubernetes entities required by the application
+	K8sKinds []string
+}
+
+// NewApplicationFacets returns the facets of the application metadata, the values are not repeated
+func NewApplicationFacets(metadata *ApplicationMetadata) *ApplicationFacets {
+	if metadata == nil {
+		return &ApplicationFacets{}
+	}
+	kinds := make([]string, 0, len(metadata.Requires.K8s))
+	for _, entity := range metadata.Requires.K8s {
+		kinds = append(kinds, entity.Kind)
+	}
+	return &ApplicationFacets{
+		Keywords: uniqueValues(metadata.Keywords),
+		License:  metadata.License,
+		Traits:   uniqueValues(metadata.Requires.Traits),
+		Scopes:   uniqueValues(metadata.Requires.Scopes),
+		K8sKinds: uniqueValues(kinds),
+	}
+}
+
+// uniqueValues returns the non-empty values without repetitions, keeping their order
+func uniqueValues(values []string) []string {
+	unique := make([]string, 0, len(values))
+	found := make(map[string]bool, len(values))
+	for _, value := range values {
+		if value != "" && !found[value] {
+			found[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+// FacetFilter with the facet values of the applications to return. An application matches if it has any of the
+// values of each facet that is set.
+type FacetFilter struct {
+	// Keywords with the accepted keywords
+	Keywords []string
+	// Licenses with the accepted licenses
+	Licenses []string
+	// Traits with the accepted required traits
+	Traits []string
+	// Scopes with the accepted required scopes
+	Scopes []string
+	// K8sKinds with the accepted kinds of the required Kubernetes entities
+	K8sKinds []string
+}
+
+// IsEmpty checks if the filter does not set any facet
+func (f *FacetFilter) IsEmpty() bool {
+	return f == nil || len(f.Keywords)+len(f.Licenses)+len(f.Traits)+len(f.Scopes)+len(f.K8sKinds) == 0
+}
+
+// containsAny checks if any of the values is accepted, all the values are accepted if accepted is empty
+func containsAny(accepted []string, values ...string) bool {
+	if len(accepted) == 0 {
+		return true
+	}
+	for _, value := range values {
+		for _, candidate := range accepted {
+			if value == candidate {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Matches checks if the application facets match the filter
+func (f *FacetFilter) Matches(facets *ApplicationFacets) bool {
+	if f.IsEmpty() {
+		return true
+	}
+	return containsAny(f.Keywords, facets.Keywords...) && containsAny(f.Licenses, facets.License) &&
+		containsAny(f.Traits, facets.Traits...) && containsAny(f.Scopes, facets.Scopes...) &&
+		containsAny(f.K8sKinds, facets.K8sKinds...)
+}
+
+// FacetCount with the number of application tags that have a facet value
+type FacetCount struct {
+	// Value with the facet value
+	Value string
+	// Count with the number of application tags
+	Count int
+}
+
+// Facets with the most common values of each facet in a list of application tags
+type Facets struct {
+	// Keywords with the counts per keyword
+	Keywords []*FacetCount
+	// Licenses with the counts per license
+	Licenses []*FacetCount
+	// Traits with the counts per required trait
+	Traits []*FacetCount
+	// Scopes with the counts per required scope
+	Scopes []*FacetCount
+	// K8sKinds with the counts per kind of the required Kubernetes entities
+	K8sKinds []*FacetCount
+}
+
+// FacetCounter counts the facet values of a list of application tags
+type FacetCounter struct {
+	keywords map[string]int
+	licenses map[string]int
+	traits   map[string]int
+	scopes   map[string]int
+	k8sKinds map[string]int
+}
+
+// NewFacetCounter returns an empty FacetCounter
+func NewFacetCounter() *FacetCounter {
+	return &FacetCounter{
+		keywords: make(map[string]int),
+		licenses: make(map[string]int),
+		traits:   make(map[string]int),
+		scopes:   make(map[string]int),
+		k8sKinds: make(map[string]int),
+	}
+}
+
+// Add counts the facet values of an application tag
+func (c *FacetCounter) Add(facets *ApplicationFacets) {
+	for _, keyword := range facets.Keywords {
+		c.keywords[keyword]++
+	}
+	if facets.License != "" {
+		c.licenses[facets.License]++
+	}
+	for _, trait := range facets.Traits {
+		c.traits[trait]++
+	}
+	for _, scope := range facets.Scopes {
+		c.scopes[scope]++
+	}
+	for _, kind := range facets.K8sKinds {
+		c.k8sKinds[kind]++
+	}
+}
+
+// sortedCounts returns the maxValues values with more tags, sorted by count and value
+func sortedCounts(counts map[string]int, maxValues int) []*FacetCount {
+	result := make([]*FacetCount, 0, len(counts))
+	for value, count := range counts {
+		result = append(result, &FacetCount{Value: value, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Value < result[j].Value
+	})
+	if len(result) > maxValues {
+		result = result[:maxValues]
+	}
+	return result
+}
+
+// Build returns the maxValues most common values of each facet
+func (c *FacetCounter) Build(maxValues int) *Facets {
+	return &Facets{
+		Keywords: sortedCounts(c.keywords, maxValues),
+		Licenses: sortedCounts(c.licenses, maxValues),
+		Traits:   sortedCounts(c.traits, maxValues),
+		Scopes:   sortedCounts(c.scopes, maxValues),
+		K8sKinds: sortedCounts(c.k8sKinds, maxValues),
+	}
+}
@@ -0,0 +1,75 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+// InconsistencyType with the classes of inconsistencies between the metadata and the storage
+type InconsistencyType string
+
+const (
+	// OrphanDirectory with an application stored without metadata
+	OrphanDirectory InconsistencyType = "OrphanDirectory"
+	// OrphanMetadata with an application metadata without files in the storage
+	OrphanMetadata InconsistencyType = "OrphanMetadata"
+	// InvalidMetadata with a metadata document that cannot be read or does not describe a valid application
+	InvalidMetadata InconsistencyType = "InvalidMetadata"
+	// LeakedBlob with a deduplicated file content whose reference counter does not match the manifests
+	LeakedBlob InconsistencyType = "LeakedBlob"
+	// MissingBlob with a deduplicated file content referenced by a manifest that is not stored
+	MissingBlob InconsistencyType = "MissingBlob"
+)
+
+// RepairOptions with the classes of inconsistencies that must be repaired
+type RepairOptions struct {
+	// OrphanDirectories to remove the applications stored without metadata
+	OrphanDirectories bool
+	// OrphanMetadata to remove the metadata of the applications without files
+	OrphanMetadata bool
+	// InvalidMetadata to remove the metadata documents that cannot be read
+	InvalidMetadata bool
+	// LeakedBlobs to fix the reference counters of the deduplicated blobs and remove the unreferenced ones
+	LeakedBlobs bool
+}
+
+// Inconsistency found between the metadata and the storage
+type Inconsistency struct {
+	// Type with the class of inconsistency
+	Type InconsistencyType
+	// DocumentID with the identifier of the metadata document, empty for orphan directories
+	DocumentID string
+	// ApplicationID with the application affected, nil if the metadata document cannot be read
+	ApplicationID *ApplicationID
+	// Digest with the digest of the blob affected, empty for the metadata inconsistencies
+	Digest string
+	// Reason with a description of the inconsistency
+	Reason string
+	// Repaired with a flag to indicate if the inconsistency has been repaired
+	Repaired bool
+	// RepairError with the error found repairing the inconsistency
+	RepairError string
+}
+
+// FsckReport with the result of checking the consistency between the metadata and the storage
+type FsckReport struct {
+	// Repositories with the number of repositories found in the storage
+	Repositories int
+	// StoredApplications with the number of application tags found in the storage
+	StoredApplications int
+	// Documents with the number of metadata documents found
+	Documents int
+	// Inconsistencies with the inconsistencies found
+	Inconsistencies []*Inconsistency
+}
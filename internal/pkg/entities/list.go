@@ -0,0 +1,67 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"strings"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+)
+
+// ListSort with the order of the applications in a list
+type ListSort string
+
+const (
+	// ListSortName sorts the applications by name and namespace
+	ListSortName ListSort = "name"
+	// ListSortNamespace sorts the applications by namespace and name
+	ListSortNamespace ListSort = "namespace"
+	// ListSortLastUpdated sorts the applications by the time their last tag was added, the newest first
+	ListSortLastUpdated ListSort = "last_updated"
+	// ListSortPopularity sorts the applications by their number of downloads, the most downloaded first
+	ListSortPopularity ListSort = "popularity"
+)
+
+// ParseListSort returns the list order with the given name, the applications are sorted by namespace by default
+func ParseListSort(name string) (ListSort, error) {
+	sort := ListSort(strings.ToLower(strings.TrimSpace(name)))
+	switch sort {
+	case "":
+		return ListSortNamespace, nil
+	case ListSortName, ListSortNamespace, ListSortLastUpdated, ListSortPopularity:
+		return sort, nil
+	}
+	return "", nerrors.NewInvalidArgumentError("invalid sort [%s], must be one of name, namespace, last_updated or popularity", name)
+}
+
+// PageRequest with the order and the page of a list of applications
+type PageRequest struct {
+	// Sort with the order of the applications
+	Sort ListSort
+	// PageSize with the maximum number of applications to return, all of them if it is not set
+	PageSize int
+	// PageToken with the NextPageToken of the previous page, empty to request the first one
+	PageToken string
+}
+
+// ApplicationPage with a page of a list of applications
+type ApplicationPage struct {
+	// Applications with the applications of the page
+	Applications []*AppSummary
+	// NextPageToken with the token to request the next page, empty if it is the last one
+	NextPageToken string
+}
@@ -0,0 +1,91 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+import (
+	"sort"
+)
+
+// Quota with the limits of a namespace. A zero value means unlimited.
+type Quota struct {
+	// MaxBytes with the maximum size of all the application files of the namespace
+	MaxBytes int64
+	// MaxApplications with the maximum number of applications
+	MaxApplications int
+	// MaxTagsPerApplication with the maximum number of tags of each application
+	MaxTagsPerApplication int
+	// MaxFileSize with the maximum size of an application file
+	MaxFileSize int64
+}
+
+// TagUsage with the storage used by an application tag
+type TagUsage struct {
+	// ApplicationName with the name of the application
+	ApplicationName string
+	// Tag with the tag of the application
+	Tag string
+	// Bytes with the size of the application files
+	Bytes int64
+}
+
+// NamespaceUsage with the resources used by a namespace
+type NamespaceUsage struct {
+	// Namespace with the name of the namespace
+	Namespace string
+	// Bytes with the size of all the application files of the namespace
+	Bytes int64
+	// Applications with the number of applications
+	Applications int
+	// Tags with the number of tags indexed by application name
+	Tags map[string]int
+	// TagUsage with the size of each application tag
+	TagUsage []*TagUsage
+	// Quota with the quota applied to the namespace
+	Quota Quota
+}
+
+// NewNamespaceUsage creates the usage of a namespace from the usage of its tags
+func NewNamespaceUsage(namespace string, tags []*TagUsage, quota Quota) *NamespaceUsage {
+	usage := &NamespaceUsage{
+		Namespace: namespace,
+		Tags:      make(map[string]int),
+		TagUsage:  tags,
+		Quota:     quota,
+	}
+	for _, tag := range tags {
+		usage.Bytes += tag.Bytes
+		usage.Tags[tag.ApplicationName]++
+	}
+	usage.Applications = len(usage.Tags)
+	sort.Slice(usage.TagUsage, func(i, j int) bool {
+		if usage.TagUsage[i].ApplicationName != usage.TagUsage[j].ApplicationName {
+			return usage.TagUsage[i].ApplicationName < usage.TagUsage[j].ApplicationName
+		}
+		return usage.TagUsage[i].Tag < usage.TagUsage[j].Tag
+	})
+	return usage
+}
+
+// GetTagUsage returns the usage of an application tag or nil if it is not stored
+func (n *NamespaceUsage) GetTagUsage(applicationName string, tag string) *TagUsage {
+	for _, usage := range n.TagUsage {
+		if usage.ApplicationName == applicationName && usage.Tag == tag {
+			return usage
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+// ReindexOptions with the options to rebuild the application metadata from the storage
+type ReindexOptions struct {
+	// Namespace to rebuild only the metadata of a namespace, all the namespaces are rebuilt if it is empty
+	Namespace string
+	// DryRun to report the metadata that would be rebuilt without storing it
+	DryRun bool
+	// DefaultPrivate with the visibility of the applications stored without visibility file
+	DefaultPrivate bool
+}
+
+// ReindexedApplication with the result of rebuilding the metadata of an application tag
+type ReindexedApplication struct {
+	// ApplicationID with the application tag
+	ApplicationID *ApplicationID
+	// MetadataName with the name defined in the metadata file
+	MetadataName string
+	// Private with the visibility of the application
+	Private bool
+	// VisibilityStored with a flag to indicate if the visibility was read from the storage or is the default one
+	VisibilityStored bool
+	// Indexed with a flag to indicate if the metadata has been stored
+	Indexed bool
+	// Error with the error found rebuilding the metadata
+	Error string
+}
+
+// ReindexReport with the result of rebuilding the application metadata from the storage
+type ReindexReport struct {
+	// DryRun with a flag to indicate that the metadata has not been stored
+	DryRun bool
+	// Applications with the result of each application tag found in the storage
+	Applications []*ReindexedApplication
+}
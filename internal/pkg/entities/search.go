@@ -0,0 +1,41 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package entities
+
+// SearchHit with an application that matches a full-text search
+type SearchHit struct {
+	// Application with the summary of the application, including all its visible tags
+	Application *AppSummary
+	// Score with the relevance of the application, higher is better
+	Score float64
+	// Highlights with the fragments of the fields that match the text indexed by field name. The matching
+	// terms are enclosed in <em></em>
+	Highlights map[string][]string
+}
+
+// SearchResult with a page of the applications that match a full-text search
+type SearchResult struct {
+	// Total with the number of applications that match the search
+	Total int
+	// Hits with the applications of the page sorted by relevance
+	Hits []*SearchHit
+	// Facets with the number of tags per facet value of all the applications that match the search
+	Facets *Facets
+	// Truncated is set if the search matched more tags than the provider considers. The hits are the most
+	// relevant ones, but Total and Facets only count the considered tags.
+	Truncated bool
+}
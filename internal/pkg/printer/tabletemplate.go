@@ -19,6 +19,8 @@ package printer
 import (
 	"reflect"
 
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/catalog-manager/internal/pkg/server/admin"
 	"github.com/napptive/grpc-catalog-common-go"
 	"github.com/napptive/grpc-catalog-go"
 	"github.com/napptive/nerrors/pkg/nerrors"
@@ -32,10 +34,52 @@ const OpResponseTemplate = `STATUS	INFO
 {{.StatusName}}	{{.UserInfo}}
 `
 
+// NamespaceUsageListTemplate with the table representation of a NamespaceUsageList.
+const NamespaceUsageListTemplate = `NAMESPACE	BYTES	MAX_BYTES	APPLICATIONS	MAX_APPLICATIONS	MAX_TAGS	MAX_FILE_SIZE
+{{range $other, $usage := .Usage}}{{$usage.Namespace}}	{{$usage.Bytes}}	{{$usage.Quota.MaxBytes}}	{{$usage.Applications}}	{{$usage.Quota.MaxApplications}}	{{$usage.Quota.MaxTagsPerApplication}}	{{$usage.Quota.MaxFileSize}}
+{{end}}`
+
+// FsckReportTemplate with the table representation of a FsckReport.
+const FsckReportTemplate = `REPOSITORIES	STORED_APPLICATIONS	DOCUMENTS	INCONSISTENCIES
+{{.Repositories}}	{{.StoredApplications}}	{{.Documents}}	{{len .Inconsistencies}}
+{{if .Inconsistencies}}
+TYPE	APPLICATION	DOCUMENT	REASON	REPAIRED	REPAIR_ERROR
+{{range $other, $inc := .Inconsistencies}}{{$inc.Type}}	{{if $inc.ApplicationID}}{{$inc.ApplicationID.String}}{{else}}-{{end}}	{{if $inc.DocumentID}}{{$inc.DocumentID}}{{else}}-{{end}}	{{$inc.Reason}}	{{$inc.Repaired}}	{{$inc.RepairError}}
+{{end}}{{end}}`
+
+// ReindexReportTemplate with the table representation of a ReindexReport.
+const ReindexReportTemplate = `{{if .DryRun}}DRY RUN, the metadata has not been stored
+{{end}}APPLICATION	METADATA_NAME	PRIVATE	VISIBILITY_STORED	INDEXED	ERROR
+{{range $other, $app := .Applications}}{{$app.ApplicationID.String}}	{{$app.MetadataName}}	{{$app.Private}}	{{$app.VisibilityStored}}	{{$app.Indexed}}	{{$app.Error}}
+{{end}}`
+
+// KeyRotationReportTemplate with the table representation of a KeyRotationReport.
+const KeyRotationReportTemplate = `MASTER_KEY: {{.MasterKeyID}}
+NAMESPACE	DATA_KEY	APPLICATIONS	ERROR
+{{range $other, $ns := .Namespaces}}{{$ns.Namespace}}	{{$ns.KeyID}}	{{$ns.Applications}}	{{$ns.Error}}
+{{end}}`
+
+// BackupReportTemplate with the table representation of a BackupReport.
+const BackupReportTemplate = `APPLICATION	FILES	BYTES	ERROR
+{{range $other, $app := .Applications}}{{$app.ApplicationID.String}}	{{$app.Files}}	{{$app.Bytes}}	{{$app.Error}}
+{{end}}`
+
+// RestoreReportTemplate with the table representation of a RestoreReport.
+const RestoreReportTemplate = `{{if .DryRun}}DRY RUN, the applications have not been restored
+{{end}}APPLICATION	FILES	RESTORED	SKIPPED	ERROR
+{{range $other, $app := .Applications}}{{$app.ApplicationID.String}}	{{$app.Files}}	{{$app.Restored}}	{{$app.Skipped}}	{{$app.Error}}
+{{end}}`
+
 // structTemplates map associating type and template to print it.
 var structTemplates = map[reflect.Type]string{
 	reflect.TypeOf(&grpc_catalog_go.ApplicationList{}):   ApplicationListTemplate,
 	reflect.TypeOf(&grpc_catalog_common_go.OpResponse{}): OpResponseTemplate,
+	reflect.TypeOf(&admin.NamespaceUsageList{}):          NamespaceUsageListTemplate,
+	reflect.TypeOf(&entities.FsckReport{}):               FsckReportTemplate,
+	reflect.TypeOf(&entities.ReindexReport{}):            ReindexReportTemplate,
+	reflect.TypeOf(&entities.KeyRotationReport{}):        KeyRotationReportTemplate,
+	reflect.TypeOf(&entities.BackupReport{}):             BackupReportTemplate,
+	reflect.TypeOf(&entities.RestoreReport{}):            RestoreReportTemplate,
 }
 
 // GetTemplate returns a template to print an arbitrary structure in table format.
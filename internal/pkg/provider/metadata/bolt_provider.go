@@ -0,0 +1,348 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metadata
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// boltBucket with the name of the bucket that stores the application metadata
+	boltBucket = "applications"
+	// boltOpenTimeout with the time to wait for the lock of the database file
+	boltOpenTimeout = 10 * time.Second
+)
+
+// errStopIteration is returned by the iteration callbacks to stop iterating
+var errStopIteration = nerrors.NewInternalError("stop iteration")
+
+// BoltProvider stores the application metadata in a single bbolt file, so a self-hosted catalog does not need
+// an external database. The documents are stored as JSON indexed by the same identifier used by the ElasticProvider.
+type BoltProvider struct {
+	// db with the bbolt database
+	db *bolt.DB
+	// authEnable with a flag to indicate if the authorization is enabled
+	authEnable bool
+}
+
+// NewBoltProvider opens or creates the bbolt database stored in path
+func NewBoltProvider(path string, authEnable bool) (*BoltProvider, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "unable to create the metadata directory")
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, nerrors.NewUnavailableErrorFrom(err, "unable to open the metadata database [%s]", path)
+	}
+	if err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(boltBucket))
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, nerrors.NewInternalErrorFrom(err, "unable to create the metadata bucket")
+	}
+	log.Debug().Str("path", path).Msg("metadata database opened")
+	return &BoltProvider{db: db, authEnable: authEnable}, nil
+}
+
+// Close closes the database
+func (b *BoltProvider) Close() error {
+	return b.db.Close()
+}
+
+// forEach calls fn with the applications that match the filter. Documents that cannot be read are skipped.
+func (b *BoltProvider) forEach(tx *bolt.Tx, filter *ListFilter, fn func(application *entities.ApplicationInfo) error) error {
+	return tx.Bucket([]byte(boltBucket)).ForEach(func(k, v []byte) error {
+		var application entities.ApplicationInfo
+		if err := json.Unmarshal(v, &application); err != nil {
+			log.Warn().Err(err).Str("id", string(k)).Msg("skipping invalid metadata document")
+			return nil
+		}
+		if !filter.matches(&application) {
+			return nil
+		}
+		return fn(&application)
+	})
+}
+
+// list returns the applications that match the filter sorted by namespace, application name and tag
+func (b *BoltProvider) list(filter *ListFilter) ([]*entities.ApplicationInfo, error) {
+	applications := make([]*entities.ApplicationInfo, 0)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return b.forEach(tx, filter, func(application *entities.ApplicationInfo) error {
+			applications = append(applications, application)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error listing applications")
+	}
+	sortApplications(applications)
+	return applications, nil
+}
+
+// Add stores new application metadata or updates it if it exists
+func (b *BoltProvider) Add(metadata *entities.ApplicationInfo) (*entities.ApplicationInfo, error) {
+	// Fill Internal ID
+	metadata.CatalogID = generateCatalogID(metadata.Namespace, metadata.ApplicationName, metadata.Tag)
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error marshalling application metadata")
+	}
+	id := generateDocumentID(metadata.Namespace, metadata.ApplicationName, metadata.Tag)
+	if err = b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(boltBucket)).Put([]byte(id), data)
+	}); err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error storing application metadata")
+	}
+	return metadata, nil
+}
+
+// Get returns the application metadata requested or an error if it does not exist
+func (b *BoltProvider) Get(appID *entities.ApplicationID) (*entities.ApplicationInfo, error) {
+	var data []byte
+	_ = b.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket([]byte(boltBucket)).Get([]byte(generateDocumentID(appID.Namespace, appID.ApplicationName, appID.Tag)))
+		if value != nil {
+			// the value is only valid during the transaction
+			data = append([]byte{}, value...)
+		}
+		return nil
+	})
+	if data == nil {
+		return nil, nerrors.NewNotFoundError("Error getting application: [application not found]")
+	}
+	var application entities.ApplicationInfo
+	if err := json.Unmarshal(data, &application); err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error unmarshalling application metadata")
+	}
+	return &application, nil
+}
+
+// Exists checks if an application metadata exists
+func (b *BoltProvider) Exists(appID *entities.ApplicationID) (bool, error) {
+	exists := false
+	_ = b.db.View(func(tx *bolt.Tx) error {
+		exists = tx.Bucket([]byte(boltBucket)).Get([]byte(generateDocumentID(appID.Namespace, appID.ApplicationName, appID.Tag))) != nil
+		return nil
+	})
+	return exists, nil
+}
+
+// Remove removes an application metadata
+func (b *BoltProvider) Remove(appID *entities.ApplicationID) error {
+	return b.RemoveDocument(generateDocumentID(appID.Namespace, appID.ApplicationName, appID.Tag))
+}
+
+// RemoveDocument removes a document by its internal identifier
+func (b *BoltProvider) RemoveDocument(id string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(boltBucket))
+		if bucket.Get([]byte(id)) == nil {
+			return nerrors.NewNotFoundError("Error removing application: [application not found]")
+		}
+		if err := bucket.Delete([]byte(id)); err != nil {
+			return nerrors.NewInternalErrorFrom(err, "error removing application")
+		}
+		return nil
+	})
+}
+
+// List returns the applications stored (public and privates)
+func (b *BoltProvider) List(namespace string) ([]*entities.ApplicationInfo, error) {
+	return b.list(&ListFilter{Namespace: &namespace})
+}
+
+// ListDocuments returns all the documents stored, including the ones that cannot be read as application metadata
+func (b *BoltProvider) ListDocuments() ([]*Document, error) {
+	documents := make([]*Document, 0)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(boltBucket)).ForEach(func(k, v []byte) error {
+			document := &Document{ID: string(k)}
+			var application entities.ApplicationInfo
+			if err := json.Unmarshal(v, &application); err != nil {
+				document.Error = nerrors.NewInternalErrorFrom(err, "error unmarshalling application metadata")
+			} else {
+				document.Application = &application
+				if document.ID != generateDocumentID(application.Namespace, application.ApplicationName, application.Tag) {
+					document.Error = nerrors.NewInternalError("document identifier does not match the application [%s]",
+						application.ToApplicationID().String())
+				}
+			}
+			documents = append(documents, document)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error listing documents")
+	}
+	return documents, nil
+}
+
+// summarize returns the summary of the applications that match the filter
+func (b *BoltProvider) summarize(filter *ListFilter) ([]*entities.AppSummary, *entities.Summary, error) {
+	applications, err := b.list(filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	builder := newSummaryBuilder()
+	for _, application := range applications {
+		builder.Add(application)
+	}
+	summaryList, summary := builder.Build()
+	return summaryList, summary, nil
+}
+
+// GetSummary returns the catalog summary (public apps summary)
+func (b *BoltProvider) GetSummary() (*entities.Summary, error) {
+	_, summary, err := b.summarize(getCacheFilter(b.authEnable))
+	return summary, err
+}
+
+// ListSummaryWithFilter returns the requested page of the summaries of the applications that match a filter. As in
+// the ElasticProvider, the applications of the catalog summary are returned when the filter requests the public
+// applications of all the namespaces. The summaries of all the applications are sorted and sliced in memory.
+func (b *BoltProvider) ListSummaryWithFilter(filter *ListFilter, page *entities.PageRequest) (*entities.ApplicationPage, error) {
+	summaryList, _, err := b.summarize(getSummaryFilter(filter, b.authEnable))
+	if err != nil {
+		return nil, err
+	}
+	return PageSummaries(summaryList, page)
+}
+
+// Search returns the applications that contain the text in their names, metadata or readme sorted by relevance
+func (b *BoltProvider) Search(request *SearchRequest) (*entities.SearchResult, error) {
+	applications, err := b.list(nil)
+	if err != nil {
+		return nil, err
+	}
+	return searchApplications(applications, request), nil
+}
+
+// ListTags returns the tags of an application sorted by name, it is empty if the application does not exist
+func (b *BoltProvider) ListTags(namespace string, applicationName string) ([]string, error) {
+	tags := make([]string, 0)
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return b.forEach(tx, &ListFilter{Namespace: &namespace}, func(application *entities.ApplicationInfo) error {
+			if application.ApplicationName == applicationName {
+				tags = append(tags, application.Tag)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error listing application tags")
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+// GetApplicationVisibility returns the application visibility or error if the application does not exist
+func (b *BoltProvider) GetApplicationVisibility(namespace string, applicationName string) (*bool, error) {
+	var private *bool
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return b.forEach(tx, &ListFilter{Namespace: &namespace}, func(application *entities.ApplicationInfo) error {
+			if application.ApplicationName != applicationName {
+				return nil
+			}
+			private = &application.Private
+			return errStopIteration
+		})
+	})
+	if err != nil && err != errStopIteration {
+		return nil, nerrors.NewInternalErrorFrom(err, "error getting application visibility")
+	}
+	if private == nil {
+		return nil, nerrors.NewNotFoundError("application not found")
+	}
+	return private, nil
+}
+
+// UpdateApplicationVisibility changes the visibility of all the tags of an application in a single transaction
+func (b *BoltProvider) UpdateApplicationVisibility(namespace string, applicationName string, isPrivate bool) (int, error) {
+	updated := 0
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		// the bucket cannot be modified while it is iterated
+		tags := make([]*entities.ApplicationInfo, 0)
+		found := false
+		if err := b.forEach(tx, &ListFilter{Namespace: &namespace}, func(application *entities.ApplicationInfo) error {
+			if application.ApplicationName == applicationName {
+				found = true
+				if application.Private != isPrivate {
+					tags = append(tags, application)
+				}
+			}
+			return nil
+		}); err != nil {
+			return nerrors.NewInternalErrorFrom(err, "error updating application visibility")
+		}
+		if !found {
+			return nerrors.NewNotFoundError("unable to update application visibility. Application not found")
+		}
+		bucket := tx.Bucket([]byte(boltBucket))
+		for _, tag := range tags {
+			tag.Private = isPrivate
+			data, err := json.Marshal(tag)
+			if err != nil {
+				return nerrors.NewInternalErrorFrom(err, "error marshalling application metadata")
+			}
+			if err = bucket.Put([]byte(generateDocumentID(tag.Namespace, tag.ApplicationName, tag.Tag)), data); err != nil {
+				return nerrors.NewInternalErrorFrom(err, "error updating application visibility")
+			}
+		}
+		updated = len(tags)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return updated, nil
+}
+
+// IncrementDownloads adds a download to the counter of an application tag
+func (b *BoltProvider) IncrementDownloads(appID *entities.ApplicationID) error {
+	id := []byte(generateDocumentID(appID.Namespace, appID.ApplicationName, appID.Tag))
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(boltBucket))
+		value := bucket.Get(id)
+		if value == nil {
+			return nerrors.NewNotFoundError("Error counting download: [application not found]")
+		}
+		var application entities.ApplicationInfo
+		if err := json.Unmarshal(value, &application); err != nil {
+			return nerrors.NewInternalErrorFrom(err, "error unmarshalling application metadata")
+		}
+		application.Downloads++
+		data, err := json.Marshal(&application)
+		if err != nil {
+			return nerrors.NewInternalErrorFrom(err, "error marshalling application metadata")
+		}
+		if err = bucket.Put(id, data); err != nil {
+			return nerrors.NewInternalErrorFrom(err, "error counting download")
+		}
+		return nil
+	})
+}
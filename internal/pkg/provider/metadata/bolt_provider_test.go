@@ -0,0 +1,100 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metadata
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/napptive/catalog-manager/internal/pkg/utils"
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Bolt provider test", func() {
+
+	dir, err := os.MkdirTemp("", "bolt-provider")
+	gomega.Expect(err).Should(gomega.Succeed())
+	provider, err := NewBoltProvider(filepath.Join(dir, "metadata", "catalog.db"), false)
+	gomega.Expect(err).Should(gomega.Succeed())
+
+	ginkgo.AfterEach(func() {
+		documents, err := provider.ListDocuments()
+		gomega.Expect(err).Should(gomega.Succeed())
+		for _, document := range documents {
+			gomega.Expect(provider.RemoveDocument(document.ID)).Should(gomega.Succeed())
+		}
+	})
+
+	ginkgo.AfterSuite(func() {
+		gomega.Expect(provider.Close()).Should(gomega.Succeed())
+		os.RemoveAll(dir)
+	})
+
+	RunTests(provider)
+
+	ginkgo.Context("Changing the visibility", func() {
+		ginkgo.It("should change the visibility of all the tags", func() {
+			app := utils.CreateTestApplicationInfo()
+			for _, tag := range []string{"v1", "v2"} {
+				app.Tag = tag
+				_, err := provider.Add(app)
+				gomega.Expect(err).Should(gomega.Succeed())
+			}
+
+			updated, err := provider.UpdateApplicationVisibility(app.Namespace, app.ApplicationName, true)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(updated).Should(gomega.Equal(2))
+			private, err := provider.GetApplicationVisibility(app.Namespace, app.ApplicationName)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(*private).Should(gomega.BeTrue())
+			applications, err := provider.List(app.Namespace)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(len(applications)).Should(gomega.Equal(2))
+			for _, application := range applications {
+				gomega.Expect(application.Private).Should(gomega.BeTrue())
+			}
+		})
+
+		ginkgo.It("should not change the visibility of a missing application", func() {
+			_, err := provider.UpdateApplicationVisibility("namespace", "missing", true)
+			gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.NotFound))
+			_, err = provider.GetApplicationVisibility("namespace", "missing")
+			gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.NotFound))
+		})
+	})
+
+	ginkgo.Context("Reopening the database", func() {
+		ginkgo.It("should keep the metadata", func() {
+			path := filepath.Join(dir, "reopen.db")
+			first, err := NewBoltProvider(path, false)
+			gomega.Expect(err).Should(gomega.Succeed())
+			app := utils.CreateTestApplicationInfo()
+			_, err = first.Add(app)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(first.Close()).Should(gomega.Succeed())
+
+			second, err := NewBoltProvider(path, false)
+			gomega.Expect(err).Should(gomega.Succeed())
+			defer second.Close()
+			retrieved, err := second.Get(app.ToApplicationID())
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(retrieved.Readme).Should(gomega.Equal(app.Readme))
+		})
+	})
+})
@@ -0,0 +1,601 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// MappingVersion with the version of the index mapping. It must be increased when the mapping changes so the
+	// indices created with the previous one are reindexed.
+	MappingVersion = 2
+	// reindexBatchSize with the number of documents copied in each bulk request of a reindex
+	reindexBatchSize = 500
+	// reindexScrollTime with the time the scroll of a reindex is kept between two batches
+	reindexScrollTime = time.Minute
+)
+
+// physicalIndexName returns the name of the index that stores the documents of an alias for a mapping version
+func physicalIndexName(alias string, version int) string {
+	return fmt.Sprintf("%s_v%d", alias, version)
+}
+
+// physicalIndexPattern returns the pattern that matches the indices of all the mapping versions of an alias
+func physicalIndexPattern(alias string) string {
+	return fmt.Sprintf("%s_v*", alias)
+}
+
+// indexState with the physical index the documents are read from
+type indexState struct {
+	// Index with the name of the physical index
+	Index string
+	// Version with the mapping version of the index, 0 if it has been created without version
+	Version int
+	// IsAlias with a flag to indicate if the index is behind the alias, the indices created by previous
+	// versions of the catalog use the alias name
+	IsAlias bool
+}
+
+// aliasResponse is a struct used to load the indices of an alias
+type aliasResponse map[string]struct {
+	Aliases map[string]interface{} `json:"aliases"`
+}
+
+// mappingResponse is a struct used to load the mapping version of an index
+type mappingResponse map[string]struct {
+	Mappings struct {
+		Meta struct {
+			Version int `json:"version"`
+		} `json:"_meta"`
+	} `json:"mappings"`
+}
+
+// bulkResponse is a struct used to load the result of a bulk request
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		ID     string          `json:"_id"`
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+// getIndexState returns the physical index behind the alias, or nil if there is no index
+func (e *ElasticProvider) getIndexState() (*indexState, error) {
+	res, err := e.client.Indices.GetAlias(e.client.Indices.GetAlias.WithName(e.indexName),
+		e.client.Indices.GetAlias.WithContext(context.Background()))
+	if err != nil {
+		return nil, requestError(err, "getting the index alias")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == 404 {
+		exists, err := e.IndexExists(e.indexName)
+		if err != nil || !exists {
+			return nil, err
+		}
+		version, err := e.getMappingVersion(e.indexName)
+		if err != nil {
+			return nil, err
+		}
+		return &indexState{Index: e.indexName, Version: version}, nil
+	}
+	if err = e.checkElasticError(res, "getting alias"); err != nil {
+		return nil, err
+	}
+
+	var indices aliasResponse
+	if err := json.NewDecoder(res.Body).Decode(&indices); err != nil {
+		return nil, nerrors.FromError(err)
+	}
+	// the alias is swapped atomically, so it only points to one index
+	for index := range indices {
+		version, err := e.getMappingVersion(index)
+		if err != nil {
+			return nil, err
+		}
+		return &indexState{Index: index, Version: version, IsAlias: true}, nil
+	}
+	return nil, nil
+}
+
+// getMappingVersion returns the version stored in the mapping of an index
+func (e *ElasticProvider) getMappingVersion(index string) (int, error) {
+	res, err := e.client.Indices.GetMapping(e.client.Indices.GetMapping.WithIndex(index),
+		e.client.Indices.GetMapping.WithContext(context.Background()))
+	if err != nil {
+		return 0, requestError(err, "getting the index mapping")
+	}
+	defer res.Body.Close()
+
+	if err = e.checkElasticError(res, "getting mapping"); err != nil {
+		return 0, err
+	}
+
+	var mappings mappingResponse
+	if err := json.NewDecoder(res.Body).Decode(&mappings); err != nil {
+		return 0, nerrors.FromError(err)
+	}
+	return mappings[index].Mappings.Meta.Version, nil
+}
+
+// updateAliases performs the alias actions received in a single atomic operation
+func (e *ElasticProvider) updateAliases(actions ...map[string]interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"actions": actions})
+	if err != nil {
+		return nerrors.NewInternalErrorFrom(err, "error creating alias actions")
+	}
+	res, err := e.client.Indices.UpdateAliases(bytes.NewReader(body),
+		e.client.Indices.UpdateAliases.WithContext(context.Background()))
+	if err != nil {
+		return requestError(err, "updating the index aliases")
+	}
+	defer res.Body.Close()
+
+	if res.IsError() {
+		log.Warn().Str("err", res.String()).Msg("error updating aliases")
+		return nerrors.NewInternalError("error updating aliases")
+	}
+	return nil
+}
+
+// createVersionedIndex creates the index of the current mapping version and points the alias to it
+func (e *ElasticProvider) createVersionedIndex() error {
+	index := physicalIndexName(e.indexName, MappingVersion)
+	if err := e.CreateIndex(index, mapping); err != nil {
+		return err
+	}
+	return e.updateAliases(map[string]interface{}{"add": map[string]interface{}{"index": index, "alias": e.indexName}})
+}
+
+// startReindex copies the documents of the previous index into a new index of the current mapping version in
+// the background. Only the instance that acquires the lease of the reindex runs it, the others check it
+// periodically to take it over if it is abandoned.
+func (e *ElasticProvider) startReindex(source *indexState) error {
+	started, err := e.tryReindex(source)
+	if err != nil {
+		return err
+	}
+	if !started {
+		log.Info().Str("source", source.Index).Msg("the catalog is being reindexed by another instance")
+		go e.watchReindex()
+	}
+	return nil
+}
+
+// watchReindex waits until the alias points to an index of the current mapping version, and takes over the
+// reindex if its owner stops renewing the lease
+func (e *ElasticProvider) watchReindex() {
+	for {
+		time.Sleep(reindexLeaseTimeout)
+		state, err := e.getIndexState()
+		if err != nil {
+			log.Warn().Err(err).Msg("error checking the reindex of the catalog")
+			continue
+		}
+		if state == nil || state.Version >= MappingVersion {
+			return
+		}
+		started, err := e.tryReindex(state)
+		if err != nil {
+			log.Warn().Err(err).Msg("error taking over the reindex of the catalog")
+			continue
+		}
+		if started {
+			return
+		}
+	}
+}
+
+// tryReindex starts the reindex of the source index if the lease is acquired. The target index is created again,
+// as it may have been left by an interrupted reindex.
+func (e *ElasticProvider) tryReindex(source *indexState) (bool, error) {
+	target := physicalIndexName(e.indexName, MappingVersion)
+	lease, err := e.acquireReindexLease(source.Index, target)
+	if err != nil || lease == nil {
+		return false, err
+	}
+	// the previous owner releases the lease after swapping the alias
+	state, err := e.getIndexState()
+	if err == nil && (state == nil || state.Index != source.Index) {
+		return false, e.releaseReindexLease(lease)
+	}
+	if err == nil {
+		err = e.resetReindexTarget(source.Index, target)
+	}
+	if err != nil {
+		if releaseErr := e.releaseReindexLease(lease); releaseErr != nil {
+			log.Error().Err(releaseErr).Str("target", target).Msg("error releasing the reindex lease")
+		}
+		return false, err
+	}
+
+	log.Info().Str("source", source.Index).Int("version", source.Version).Str("target", target).
+		Int("target version", MappingVersion).Msg("reindexing the catalog")
+	go e.reindex(source, lease)
+	return true, nil
+}
+
+// resetReindexTarget creates an empty target index. The writes of the source are allowed again, as they may
+// have been blocked by an interrupted reindex.
+func (e *ElasticProvider) resetReindexTarget(source string, target string) error {
+	if err := e.blockWrites(source, false); err != nil {
+		return err
+	}
+	exists, err := e.IndexExists(target)
+	if err != nil {
+		return err
+	}
+	if exists {
+		log.Warn().Str("index", target).Msg("removing the target of an interrupted reindex")
+		if err = e.deletePhysicalIndex(target); err != nil {
+			return err
+		}
+	}
+	return e.CreateIndex(target, mapping)
+}
+
+// reindex copies the documents of the source index into the target one and swaps the alias. The writes are allowed
+// during the copy, then the documents changed or removed since they were copied are synchronized: once with the
+// writes allowed, and once more with the writes of the source blocked, so the changes made by any instance are not
+// lost when the alias is swapped. Only the last delta is copied with the writes blocked, the writes rejected
+// meanwhile can be retried once the alias is swapped.
+func (e *ElasticProvider) reindex(source *indexState, lease *reindexLease) {
+	start := time.Now()
+	target := lease.Target
+	versions, err := e.copyDocuments(source.Index, lease)
+	if err == nil {
+		err = e.syncDocuments(source.Index, versions, lease)
+	}
+	blocked := false
+	var blockedAt time.Time
+	if err == nil {
+		err = e.blockWrites(source.Index, true)
+		blocked, blockedAt = err == nil, time.Now()
+	}
+	if err == nil {
+		err = e.syncDocuments(source.Index, versions, lease)
+	}
+	if err == nil {
+		// the lease is renewed just before the swap, so the alias is not swapped if another instance has taken it over
+		err = e.renewReindexLease(lease)
+	}
+	if err == nil {
+		err = e.swapAlias(source, target)
+	}
+
+	if err != nil {
+		log.Error().Err(err).Str("source", source.Index).Str("target", target).Msg("error reindexing the catalog")
+		if lease.lost {
+			// the indices belong to the new owner
+			return
+		}
+		if blocked {
+			if err = e.blockWrites(source.Index, false); err != nil {
+				log.Error().Err(err).Str("index", source.Index).Msg("error allowing the writes of the previous index")
+			}
+		}
+		if err = e.deletePhysicalIndex(target); err != nil {
+			log.Error().Err(err).Str("index", target).Msg("error removing the reindex target")
+		}
+		if err = e.releaseReindexLease(lease); err != nil {
+			log.Error().Err(err).Str("target", target).Msg("error releasing the reindex lease")
+		}
+		return
+	}
+	log.Info().Str("index", target).Str("duration", time.Since(start).String()).
+		Str("blocked", time.Since(blockedAt).String()).Msg("catalog reindexed")
+
+	if err = e.releaseReindexLease(lease); err != nil {
+		log.Error().Err(err).Str("target", target).Msg("error releasing the reindex lease")
+	}
+	if source.IsAlias {
+		if err = e.deletePhysicalIndex(source.Index); err != nil {
+			log.Error().Err(err).Str("index", source.Index).Msg("error removing the previous index")
+		}
+	}
+	e.invalidateCache()
+}
+
+// blockWrites sets or removes the write block of an index. The writes rejected by the block fail with an
+// Aborted error.
+func (e *ElasticProvider) blockWrites(index string, blocked bool) error {
+	body := fmt.Sprintf(`{"index": {"blocks": {"write": %t}}}`, blocked)
+	res, err := e.client.Indices.PutSettings(strings.NewReader(body),
+		e.client.Indices.PutSettings.WithIndex(index),
+		e.client.Indices.PutSettings.WithContext(context.Background()))
+	if err != nil {
+		return requestError(err, "blocking the index writes")
+	}
+	defer res.Body.Close()
+	return e.checkElasticError(res, "blocking the writes of")
+}
+
+// reindexedSource returns the source of a document as it is stored with the current mapping. The documents
+// that are not valid application metadata are copied unchanged.
+func reindexedSource(source json.RawMessage) ([]byte, error) {
+	var application entities.ApplicationInfo
+	if err := json.Unmarshal(source, &application); err != nil {
+		return source, nil
+	}
+	return json.Marshal(newElasticDocument(&application))
+}
+
+// scrollDocuments reads all the documents of an index in batches of reindexBatchSize, with their sequence numbers.
+// The source of the documents is only read if withSource is set.
+func (e *ElasticProvider) scrollDocuments(index string, withSource bool, process func(r *responseWrapper) error) error {
+	res, err := e.client.Search(
+		e.client.Search.WithContext(context.Background()),
+		e.client.Search.WithIndex(index),
+		e.client.Search.WithSize(reindexBatchSize),
+		e.client.Search.WithSort("_doc"),
+		e.client.Search.WithSource(strconv.FormatBool(withSource)),
+		e.client.Search.WithSeqNoPrimaryTerm(true),
+		e.client.Search.WithScroll(reindexScrollTime))
+	if err != nil {
+		return nerrors.FromError(err)
+	}
+	r, err := e.readResponse(res, "reindexing")
+	if err != nil {
+		return err
+	}
+	scrollID := r.ScrollID
+	defer func() {
+		e.clearScroll(scrollID)
+	}()
+
+	for len(r.Hits.Hits) > 0 {
+		if err = process(r); err != nil {
+			return err
+		}
+		res, err = e.client.Scroll(
+			e.client.Scroll.WithContext(context.Background()),
+			e.client.Scroll.WithScrollID(scrollID),
+			e.client.Scroll.WithScroll(reindexScrollTime))
+		if err != nil {
+			return nerrors.FromError(err)
+		}
+		if r, err = e.readResponse(res, "reindexing"); err != nil {
+			return err
+		}
+		scrollID = r.ScrollID
+	}
+	return nil
+}
+
+// documentVersion identifies a change of a document, its sequence number changes on each write
+type documentVersion struct {
+	seqNo       int64
+	primaryTerm int64
+}
+
+// copyDocuments copies all the documents of the source index into the target of the lease and returns the version
+// copied of each one. The lease is renewed after each batch.
+func (e *ElasticProvider) copyDocuments(source string, lease *reindexLease) (map[string]documentVersion, error) {
+	versions := make(map[string]documentVersion)
+	err := e.scrollDocuments(source, true, func(r *responseWrapper) error {
+		if err := e.indexDocuments(lease.Target, r, versions); err != nil {
+			return err
+		}
+		log.Debug().Int("copied", len(versions)).Int("total", r.Hits.Total.Value).Msg("reindexing the catalog")
+		lease.Copied = len(versions)
+		return e.renewReindexLease(lease)
+	})
+	return versions, err
+}
+
+// indexDocuments writes the documents of a search response in the target index, overwriting the ones that already
+// exist, and records their versions
+func (e *ElasticProvider) indexDocuments(target string, r *responseWrapper, versions map[string]documentVersion) error {
+	var body bytes.Buffer
+	for _, hit := range r.Hits.Hits {
+		document, err := reindexedSource(hit.Source)
+		if err != nil {
+			return nerrors.NewInternalErrorFrom(err, "error converting document %s", hit.ID)
+		}
+		body.WriteString(fmt.Sprintf(`{"index":{"_id":%q}}`, hit.ID))
+		body.WriteByte('\n')
+		body.Write(document)
+		body.WriteByte('\n')
+	}
+	if body.Len() == 0 {
+		return nil
+	}
+	if err := e.bulk(target, &body); err != nil {
+		return err
+	}
+	for _, hit := range r.Hits.Hits {
+		versions[hit.ID] = documentVersion{seqNo: hit.SeqNo, primaryTerm: hit.PrimaryTerm}
+	}
+	return nil
+}
+
+// syncDocuments copies the documents of the source index written since their version was copied, and removes from
+// the target the ones removed from the source. Only the identifiers and versions of the source are read, so the
+// cost of a sync is proportional to the changes.
+func (e *ElasticProvider) syncDocuments(source string, versions map[string]documentVersion, lease *reindexLease) error {
+	if err := e.refreshIndex(source); err != nil {
+		return err
+	}
+	changed := make([]string, 0)
+	present := make(map[string]bool, len(versions))
+	if err := e.scrollDocuments(source, false, func(r *responseWrapper) error {
+		for _, hit := range r.Hits.Hits {
+			present[hit.ID] = true
+			if version, copied := versions[hit.ID]; !copied || version != (documentVersion{seqNo: hit.SeqNo, primaryTerm: hit.PrimaryTerm}) {
+				changed = append(changed, hit.ID)
+			}
+		}
+		return e.renewReindexLease(lease)
+	}); err != nil {
+		return err
+	}
+
+	for start := 0; start < len(changed); start += reindexBatchSize {
+		end := start + reindexBatchSize
+		if end > len(changed) {
+			end = len(changed)
+		}
+		r, err := e.getDocuments(source, changed[start:end])
+		if err != nil {
+			return err
+		}
+		if err = e.indexDocuments(lease.Target, r, versions); err != nil {
+			return err
+		}
+	}
+
+	var body bytes.Buffer
+	removed := 0
+	for id := range versions {
+		if !present[id] {
+			body.WriteString(fmt.Sprintf(`{"delete":{"_id":%q}}`, id))
+			body.WriteByte('\n')
+			delete(versions, id)
+			removed++
+		}
+	}
+	if body.Len() > 0 {
+		if err := e.bulk(lease.Target, &body); err != nil {
+			return err
+		}
+	}
+	log.Debug().Int("changed", len(changed)).Int("removed", removed).Msg("reindex synchronized")
+	return e.renewReindexLease(lease)
+}
+
+// getDocuments returns the documents of an index with the given identifiers and their versions
+func (e *ElasticProvider) getDocuments(index string, ids []string) (*responseWrapper, error) {
+	query, err := json.Marshal(map[string]interface{}{
+		"query": map[string]interface{}{"ids": map[string]interface{}{"values": ids}}})
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error creating the documents query")
+	}
+	res, err := e.client.Search(
+		e.client.Search.WithContext(context.Background()),
+		e.client.Search.WithIndex(index),
+		e.client.Search.WithBody(bytes.NewReader(query)),
+		e.client.Search.WithSize(len(ids)),
+		e.client.Search.WithSeqNoPrimaryTerm(true))
+	if err != nil {
+		return nil, nerrors.FromError(err)
+	}
+	return e.readResponse(res, "reindexing")
+}
+
+// bulk performs the operations of the body in the index. The documents to remove that do not exist are skipped.
+func (e *ElasticProvider) bulk(index string, body *bytes.Buffer) error {
+	res, err := e.client.Bulk(body, e.client.Bulk.WithIndex(index), e.client.Bulk.WithContext(context.Background()))
+	if err != nil {
+		return nerrors.FromError(err)
+	}
+	defer res.Body.Close()
+
+	if err = e.checkElasticError(res, "copying"); err != nil {
+		return err
+	}
+	var r bulkResponse
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return nerrors.FromError(err)
+	}
+	if !r.Errors {
+		return nil
+	}
+	for _, item := range r.Items {
+		for _, result := range item {
+			if result.Status >= 300 && result.Status != http.StatusNotFound {
+				return nerrors.NewInternalError("error copying document %s: %s", result.ID, string(result.Error))
+			}
+		}
+	}
+	return nil
+}
+
+// refreshIndex makes the documents written in an index visible to the searches
+func (e *ElasticProvider) refreshIndex(index string) error {
+	res, err := e.client.Indices.Refresh(e.client.Indices.Refresh.WithIndex(index),
+		e.client.Indices.Refresh.WithContext(context.Background()))
+	if err != nil {
+		return nerrors.FromError(err)
+	}
+	defer res.Body.Close()
+	return e.checkElasticError(res, "refreshing")
+}
+
+// swapAlias points the alias to the target index in a single operation. The index created without alias
+// is removed in the same operation as it has the name of the alias.
+func (e *ElasticProvider) swapAlias(source *indexState, target string) error {
+	if err := e.refreshIndex(target); err != nil {
+		return err
+	}
+
+	add := map[string]interface{}{"add": map[string]interface{}{"index": target, "alias": e.indexName}}
+	if !source.IsAlias {
+		return e.updateAliases(add, map[string]interface{}{"remove_index": map[string]interface{}{"index": source.Index}})
+	}
+	return e.updateAliases(map[string]interface{}{"remove": map[string]interface{}{"index": source.Index, "alias": e.indexName}}, add)
+}
+
+// readResponse checks and loads the response of a search request
+func (e *ElasticProvider) readResponse(res *esapi.Response, operation string) (*responseWrapper, error) {
+	defer res.Body.Close()
+
+	if err := e.checkElasticError(res, operation); err != nil {
+		return nil, err
+	}
+	var r responseWrapper
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return nil, nerrors.FromError(err)
+	}
+	return &r, nil
+}
+
+// clearScroll releases the resources of a scroll
+func (e *ElasticProvider) clearScroll(scrollID string) {
+	if scrollID == "" {
+		return
+	}
+	res, err := e.client.ClearScroll(e.client.ClearScroll.WithScrollID(scrollID))
+	if err != nil {
+		log.Warn().Err(err).Msg("error clearing scroll")
+		return
+	}
+	res.Body.Close()
+}
+
+// deletePhysicalIndex removes an index that is not behind the alias
+func (e *ElasticProvider) deletePhysicalIndex(index string) error {
+	res, err := e.client.Indices.Delete([]string{index}, e.client.Indices.Delete.WithContext(context.Background()))
+	if err != nil {
+		return nerrors.FromError(err)
+	}
+	defer res.Body.Close()
+	return e.checkElasticError(res, "removing index")
+}
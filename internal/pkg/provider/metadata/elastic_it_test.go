@@ -1,6 +1,13 @@
 package metadata
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7"
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
 	"github.com/napptive/catalog-manager/internal/pkg/utils"
 	"github.com/onsi/ginkgo"
 	"github.com/onsi/gomega"
@@ -20,7 +27,7 @@ var _ = ginkgo.Describe("Elastic Provider test", func() {
 	index := strings.ToLower(faker.App().Name())
 	index = strings.Replace(index, " ", "", -1)
 	log.Debug().Str("index", index).Msg("Elastic index")
-	provider, err := NewElasticProvider(index, "http://localhost:9200", false)
+	provider, err := NewElasticProvider(index, elasticsearch.Config{Addresses: []string{"http://localhost:9200"}}, false)
 	gomega.Expect(err).Should(gomega.Succeed())
 
 	ginkgo.BeforeEach(func() {
@@ -34,4 +41,210 @@ var _ = ginkgo.Describe("Elastic Provider test", func() {
 
 	RunTests(provider)
 
+	ginkgo.Context("Listing more than one page of applications", func() {
+		ginkgo.It("Should list all the tags of an application in order", func() {
+			app := utils.CreateTestApplicationInfo()
+			var body bytes.Buffer
+			for i := 0; i <= listPageSize; i++ {
+				app.Tag = fmt.Sprintf("v%05d", i)
+				app.CatalogID = provider.GenerateCatalogID(app.Namespace, app.ApplicationName, app.Tag)
+				source, err := json.Marshal(app)
+				gomega.Expect(err).Should(gomega.Succeed())
+				body.WriteString(fmt.Sprintf(`{"create":{"_id":%q}}`+"\n", provider.GenerateID(app)))
+				body.Write(source)
+				body.WriteByte('\n')
+			}
+			gomega.Expect(provider.bulk(index, &body)).Should(gomega.Succeed())
+			res, err := provider.client.Indices.Refresh(provider.client.Indices.Refresh.WithIndex(index))
+			gomega.Expect(err).Should(gomega.Succeed())
+			res.Body.Close()
+
+			applications, err := provider.List(app.Namespace)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(len(applications)).Should(gomega.Equal(listPageSize + 1))
+			for i, application := range applications {
+				gomega.Expect(application.Tag).Should(gomega.Equal(fmt.Sprintf("v%05d", i)))
+			}
+
+			tags, err := provider.getApplicationTags(app.Namespace, app.ApplicationName)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(len(tags)).Should(gomega.Equal(listPageSize + 1))
+		})
+	})
+
+	ginkgo.Context("Keeping the cache up to date", func() {
+		var cached *ElasticProvider
+
+		ginkgo.BeforeEach(func() {
+			var err error
+			cached, err = NewElasticProvider(index+"-cache", elasticsearch.Config{Addresses: []string{"http://localhost:9200"}}, true)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(cached.Init()).Should(gomega.Succeed())
+		})
+		ginkgo.AfterEach(func() {
+			gomega.Expect(cached.DeleteIndex()).Should(gomega.Succeed())
+			cached.Finish()
+		})
+
+		// expectCached checks the cached summaries without waiting for a refresh, and compares them with the listed ones
+		expectCached := func(app *entities.ApplicationInfo, tags int) {
+			public := false
+			page, err := cached.ListSummaryWithFilter(&ListFilter{Private: &public}, nil)
+			gomega.Expect(err).Should(gomega.Succeed())
+			summaries := page.Applications
+			summary, err := cached.GetSummary()
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(summary.NumTags).Should(gomega.Equal(tags))
+			if tags > 0 {
+				gomega.Expect(summaries).Should(gomega.HaveLen(1))
+				gomega.Expect(summaries[0].ApplicationName).Should(gomega.Equal(app.ApplicationName))
+			}
+			listed, listedSummary, err := cached.listSummaryWithFilter(getCacheFilter(true))
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(summaries).Should(gomega.Equal(listed))
+			gomega.Expect(summary).Should(gomega.Equal(listedSummary))
+		}
+
+		ginkgo.It("Should apply the changes of the public applications to the cache", func() {
+			app := utils.CreateTestApplicationInfo()
+			for _, tag := range []string{"v1", "v2"} {
+				app.Tag = tag
+				_, err := cached.Add(app)
+				gomega.Expect(err).Should(gomega.Succeed())
+			}
+			expectCached(app, 2)
+
+			gomega.Expect(cached.UpdateApplicationVisibility(app.Namespace, app.ApplicationName, true)).Should(gomega.Equal(2))
+			expectCached(app, 0)
+			gomega.Expect(cached.UpdateApplicationVisibility(app.Namespace, app.ApplicationName, false)).Should(gomega.Equal(2))
+			expectCached(app, 2)
+
+			gomega.Expect(cached.Remove(app.ToApplicationID())).Should(gomega.Succeed())
+			expectCached(app, 1)
+		})
+	})
+
+	ginkgo.Context("Reindexing the catalog", func() {
+		ginkgo.It("Should reindex an index created without version behind the alias", func() {
+			gomega.Expect(provider.DeleteIndex()).Should(gomega.Succeed())
+			gomega.Expect(provider.CreateIndex(index, `{"mappings": {"properties": {"Namespace": {"type": "keyword"}}}}`)).Should(gomega.Succeed())
+			app := utils.CreateTestApplicationInfo()
+			app.CatalogID = provider.GenerateCatalogID(app.Namespace, app.ApplicationName, app.Tag)
+			source, err := json.Marshal(app)
+			gomega.Expect(err).Should(gomega.Succeed())
+			res, err := provider.client.Index(index, bytes.NewReader(source),
+				provider.client.Index.WithDocumentID(provider.GenerateID(app)), provider.client.Index.WithRefresh("true"))
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(res.IsError()).Should(gomega.BeFalse())
+			res.Body.Close()
+
+			gomega.Expect(provider.Init()).Should(gomega.Succeed())
+			gomega.Eventually(func() bool {
+				state, err := provider.getIndexState()
+				return err == nil && state != nil && state.IsAlias && state.Version == MappingVersion
+			}, "30s", "500ms").Should(gomega.BeTrue())
+
+			retrieved, err := provider.Get(app.ToApplicationID())
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(retrieved.ApplicationName).Should(gomega.Equal(app.ApplicationName))
+			result, err := provider.Search(&SearchRequest{Facets: &entities.FacetFilter{Keywords: []string{"storage"}}})
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(result.Total).Should(gomega.Equal(1))
+		})
+
+		ginkgo.It("Should recreate the target left by an interrupted reindex", func() {
+			gomega.Expect(provider.DeleteIndex()).Should(gomega.Succeed())
+			gomega.Expect(provider.CreateIndex(index, `{"mappings": {"properties": {"Namespace": {"type": "keyword"}}}}`)).Should(gomega.Succeed())
+			app := utils.CreateTestApplicationInfo()
+			app.CatalogID = provider.GenerateCatalogID(app.Namespace, app.ApplicationName, app.Tag)
+			source, err := json.Marshal(app)
+			gomega.Expect(err).Should(gomega.Succeed())
+			res, err := provider.client.Index(index, bytes.NewReader(source),
+				provider.client.Index.WithDocumentID(provider.GenerateID(app)), provider.client.Index.WithRefresh("true"))
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(res.IsError()).Should(gomega.BeFalse())
+			res.Body.Close()
+
+			// the target and the lease of an instance stopped in the middle of the reindex
+			target := physicalIndexName(index, MappingVersion)
+			gomega.Expect(provider.CreateIndex(target, mapping)).Should(gomega.Succeed())
+			gomega.Expect(provider.createLeaseIndex()).Should(gomega.Succeed())
+			stored, err := provider.storeReindexLease(&reindexLease{Owner: "stopped", Source: index, Target: target,
+				Heartbeat: time.Now().Add(-reindexLeaseTimeout)})
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(stored).Should(gomega.BeTrue())
+
+			gomega.Expect(provider.Init()).Should(gomega.Succeed())
+			gomega.Eventually(func() bool {
+				state, err := provider.getIndexState()
+				return err == nil && state != nil && state.IsAlias && state.Version == MappingVersion
+			}, "30s", "500ms").Should(gomega.BeTrue())
+
+			retrieved, err := provider.Get(app.ToApplicationID())
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(retrieved.ApplicationName).Should(gomega.Equal(app.ApplicationName))
+			lease, err := provider.getReindexLease(target)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(lease).Should(gomega.BeNil())
+		})
+
+		ginkgo.It("Should synchronize the documents changed after they are copied", func() {
+			changed := utils.CreateTestApplicationInfo()
+			removed := utils.CreateTestApplicationInfo()
+			added := utils.CreateTestApplicationInfo()
+			for _, app := range []*entities.ApplicationInfo{changed, removed} {
+				_, err := provider.Add(app)
+				gomega.Expect(err).Should(gomega.Succeed())
+			}
+
+			source := physicalIndexName(index, MappingVersion)
+			target := physicalIndexName(index, MappingVersion+1)
+			gomega.Expect(provider.CreateIndex(target, mapping)).Should(gomega.Succeed())
+			defer provider.deletePhysicalIndex(target)
+			gomega.Expect(provider.createLeaseIndex()).Should(gomega.Succeed())
+			lease, err := provider.acquireReindexLease(source, target)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(lease).ShouldNot(gomega.BeNil())
+			gomega.Expect(provider.refreshIndex(source)).Should(gomega.Succeed())
+			versions, err := provider.copyDocuments(source, lease)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(len(versions)).Should(gomega.Equal(2))
+
+			// the writes made during the copy
+			changed.Readme = "changed readme"
+			_, err = provider.Add(changed)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(provider.Remove(removed.ToApplicationID())).Should(gomega.Succeed())
+			_, err = provider.Add(added)
+			gomega.Expect(err).Should(gomega.Succeed())
+
+			gomega.Expect(provider.syncDocuments(source, versions, lease)).Should(gomega.Succeed())
+			gomega.Expect(provider.refreshIndex(target)).Should(gomega.Succeed())
+			r, err := provider.getDocuments(target, []string{provider.GenerateID(changed), provider.GenerateID(removed), provider.GenerateID(added)})
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(len(r.Hits.Hits)).Should(gomega.Equal(2))
+			for _, hit := range r.Hits.Hits {
+				gomega.Expect(hit.ID).ShouldNot(gomega.Equal(provider.GenerateID(removed)))
+				if hit.ID == provider.GenerateID(changed) {
+					gomega.Expect(string(hit.Source)).Should(gomega.ContainSubstring("changed readme"))
+				}
+			}
+			gomega.Expect(provider.releaseReindexLease(lease)).Should(gomega.Succeed())
+		})
+
+		ginkgo.It("Should not take over a reindex whose lease is renewed", func() {
+			target := physicalIndexName(index, MappingVersion+1)
+			lease, err := provider.acquireReindexLease(index, target)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(lease).ShouldNot(gomega.BeNil())
+
+			other, err := provider.acquireReindexLease(index, target)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(other).Should(gomega.BeNil())
+
+			gomega.Expect(provider.renewReindexLease(lease)).Should(gomega.Succeed())
+			gomega.Expect(provider.releaseReindexLease(lease)).Should(gomega.Succeed())
+		})
+	})
+
 })
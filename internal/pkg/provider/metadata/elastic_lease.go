@@ -0,0 +1,219 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esapi"
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// reindexLeaseTimeout with the time after which a reindex lease that has not been renewed is abandoned. The
+	// owner renews it after copying each batch of documents.
+	reindexLeaseTimeout = 5 * time.Minute
+	// reindexLeaseMapping with the mapping of the index of the reindex leases, they are only read by identifier
+	reindexLeaseMapping = `{"mappings": {"enabled": false}}`
+)
+
+// reindexLeaseIndexName returns the name of the index that stores the reindex leases of an alias
+func reindexLeaseIndexName(alias string) string {
+	return fmt.Sprintf("%s_reindex", alias)
+}
+
+// newInstanceID returns the identifier of an instance, made of the host name and a random suffix
+func newInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return fmt.Sprintf("%s-%x", host, suffix)
+}
+
+// reindexLease with the owner and the progress of a reindex. It is stored in the cluster with the target index as
+// identifier, so all the instances know if the target is being written or has been left by an interrupted reindex.
+type reindexLease struct {
+	// Owner with the identifier of the instance running the reindex
+	Owner string `json:"owner"`
+	// Source with the index the documents are copied from
+	Source string `json:"source"`
+	// Target with the index the documents are copied to
+	Target string `json:"target"`
+	// Copied with the number of documents copied in the current pass
+	Copied int `json:"copied"`
+	// Heartbeat with the last time the owner renewed the lease
+	Heartbeat time.Time `json:"heartbeat"`
+	// seqNo and primaryTerm with the version of the stored lease, it is only updated if it has not changed
+	seqNo       int
+	primaryTerm int
+	// stored is set if the lease exists in the cluster
+	stored bool
+	// lost is set if another instance has taken over the lease
+	lost bool
+}
+
+// leaseVersion is a struct used to load the version of a stored lease
+type leaseVersion struct {
+	SeqNo       int `json:"_seq_no"`
+	PrimaryTerm int `json:"_primary_term"`
+}
+
+// createLeaseIndex creates the index of the reindex leases if it does not exist
+func (e *ElasticProvider) createLeaseIndex() error {
+	index := reindexLeaseIndexName(e.indexName)
+	if err := e.CreateIndex(index, reindexLeaseMapping); err != nil {
+		// the index may have been created by another instance at the same time
+		exists, existsErr := e.IndexExists(index)
+		if existsErr != nil || !exists {
+			return err
+		}
+	}
+	return nil
+}
+
+// getReindexLease returns the lease of the reindex into a target index, or nil if there is none
+func (e *ElasticProvider) getReindexLease(target string) (*reindexLease, error) {
+	res, err := e.client.Get(reindexLeaseIndexName(e.indexName), target, e.client.Get.WithContext(context.Background()))
+	if err != nil {
+		return nil, requestError(err, "getting the reindex lease")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err = e.checkElasticError(res, "getting the reindex lease of"); err != nil {
+		return nil, err
+	}
+	var r struct {
+		leaseVersion
+		Source reindexLease `json:"_source"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return nil, nerrors.FromError(err)
+	}
+	lease := r.Source
+	lease.seqNo, lease.primaryTerm, lease.stored = r.SeqNo, r.PrimaryTerm, true
+	return &lease, nil
+}
+
+// storeReindexLease creates the lease, or updates it if it has not changed since it was read. It returns false
+// if the lease has been written by another instance.
+func (e *ElasticProvider) storeReindexLease(lease *reindexLease) (bool, error) {
+	body, err := json.Marshal(lease)
+	if err != nil {
+		return false, nerrors.NewInternalErrorFrom(err, "error creating the reindex lease")
+	}
+	index := reindexLeaseIndexName(e.indexName)
+	var res *esapi.Response
+	if lease.stored {
+		res, err = e.client.Index(index, bytes.NewReader(body),
+			e.client.Index.WithContext(context.Background()),
+			e.client.Index.WithDocumentID(lease.Target),
+			e.client.Index.WithIfSeqNo(lease.seqNo),
+			e.client.Index.WithIfPrimaryTerm(lease.primaryTerm))
+	} else {
+		res, err = e.client.Create(index, lease.Target, bytes.NewReader(body),
+			e.client.Create.WithContext(context.Background()))
+	}
+	if err != nil {
+		return false, requestError(err, "storing the reindex lease")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusConflict {
+		return false, nil
+	}
+	if err = e.checkElasticError(res, "storing the reindex lease of"); err != nil {
+		return false, err
+	}
+	var version leaseVersion
+	if err := json.NewDecoder(res.Body).Decode(&version); err != nil {
+		return false, nerrors.FromError(err)
+	}
+	lease.seqNo, lease.primaryTerm, lease.stored = version.SeqNo, version.PrimaryTerm, true
+	return true, nil
+}
+
+// acquireReindexLease returns the lease of the reindex of the source index into the target one, or nil if it is
+// owned by another instance. The lease is taken over if it has expired.
+func (e *ElasticProvider) acquireReindexLease(source string, target string) (*reindexLease, error) {
+	if err := e.createLeaseIndex(); err != nil {
+		return nil, err
+	}
+	current, err := e.getReindexLease(target)
+	if err != nil {
+		return nil, err
+	}
+	lease := &reindexLease{Owner: e.instanceID, Source: source, Target: target, Heartbeat: time.Now()}
+	if current != nil {
+		if time.Since(current.Heartbeat) < reindexLeaseTimeout {
+			return nil, nil
+		}
+		log.Warn().Str("owner", current.Owner).Str("target", target).Int("copied", current.Copied).
+			Time("heartbeat", current.Heartbeat).Msg("taking over an abandoned reindex")
+		lease.seqNo, lease.primaryTerm, lease.stored = current.seqNo, current.primaryTerm, true
+	}
+	acquired, err := e.storeReindexLease(lease)
+	if err != nil || !acquired {
+		return nil, err
+	}
+	return lease, nil
+}
+
+// renewReindexLease stores the progress of the reindex and extends the lease. It returns an Aborted error if the
+// lease has been taken over by another instance.
+func (e *ElasticProvider) renewReindexLease(lease *reindexLease) error {
+	lease.Heartbeat = time.Now()
+	renewed, err := e.storeReindexLease(lease)
+	if err != nil {
+		return err
+	}
+	if !renewed {
+		lease.lost = true
+		return nerrors.NewAbortedError("the reindex into %s has been taken over by another instance", lease.Target)
+	}
+	return nil
+}
+
+// releaseReindexLease removes the lease if it has not been taken over by another instance
+func (e *ElasticProvider) releaseReindexLease(lease *reindexLease) error {
+	res, err := e.client.Delete(reindexLeaseIndexName(e.indexName), lease.Target,
+		e.client.Delete.WithContext(context.Background()),
+		e.client.Delete.WithIfSeqNo(lease.seqNo),
+		e.client.Delete.WithIfPrimaryTerm(lease.primaryTerm))
+	if err != nil {
+		return requestError(err, "releasing the reindex lease")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusConflict {
+		return nil
+	}
+	return e.checkElasticError(res, "releasing the reindex lease of")
+}
@@ -0,0 +1,318 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metadata
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog/log"
+)
+
+// applicationsFilter struct to filter the tags of some applications that match a ListFilter
+type applicationsFilter struct {
+	filter       *ListFilter
+	applications []entities.ApplicationID
+}
+
+// ToElasticQuery returns the search query for an applicationsFilter. Required to implement ElasticFilter interface
+func (af *applicationsFilter) ToElasticQuery() map[string]interface{} {
+	should := make([]interface{}, 0, len(af.applications))
+	for _, application := range af.applications {
+		should = append(should, map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					map[string]interface{}{"term": map[string]interface{}{NamespaceField: application.Namespace}},
+					map[string]interface{}{"term": map[string]interface{}{ApplicationField: application.ApplicationName}},
+				},
+			},
+		})
+	}
+	filters := []interface{}{
+		map[string]interface{}{"bool": map[string]interface{}{"should": should, "minimum_should_match": 1}},
+	}
+	if query, exists := af.filter.ToElasticQuery()["query"]; exists {
+		filters = append(filters, query)
+	}
+	return map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{"filter": filters},
+		},
+	}
+}
+
+func (af *applicationsFilter) ToString() string {
+	return fmt.Sprintf("ApplicationsFilter. %s - Applications [%d]", af.filter.ToString(), len(af.applications))
+}
+
+// getSummaries returns the summaries of the applications that match the filter, indexed by application
+func (e *ElasticProvider) getSummaries(filter *ListFilter, applications []entities.ApplicationID) (map[entities.ApplicationID]*entities.AppSummary, error) {
+	summaries := make(map[entities.ApplicationID]*entities.AppSummary, len(applications))
+	if len(applications) == 0 {
+		return summaries, nil
+	}
+	builder := newSummaryBuilder()
+	err := e.listWithFilter(&applicationsFilter{filter: filter, applications: applications}, func(r *responseWrapper) error {
+		for _, app := range r.Hits.Hits {
+			var application entities.ApplicationInfo
+			if err := json.Unmarshal(app.Source, &application); err != nil {
+				return nerrors.NewInternalErrorFrom(err, "error unmarshalling application metadata")
+			}
+			builder.Add(&application)
+		}
+		return nil
+	}, summaryFields...)
+	if err != nil {
+		return nil, err
+	}
+	summaryList, _ := builder.Build()
+	for _, summary := range summaryList {
+		summaries[entities.ApplicationID{Namespace: summary.Namespace, ApplicationName: summary.ApplicationName}] = summary
+	}
+	return summaries, nil
+}
+
+// pageSort returns the sort of the documents in which the first tag found of each application is in the order of
+// the list, as summaryLess. The latest tag of an application is the first one found when they are sorted by date.
+func pageSort(order entities.ListSort) []interface{} {
+	switch order {
+	case entities.ListSortName:
+		return []interface{}{
+			map[string]interface{}{ApplicationField: "asc"},
+			map[string]interface{}{NamespaceField: "asc"},
+			map[string]interface{}{TagField: "asc"},
+		}
+	case entities.ListSortLastUpdated:
+		return []interface{}{
+			map[string]interface{}{LastUpdatedField: "desc"},
+			map[string]interface{}{NamespaceField: "asc"},
+			map[string]interface{}{ApplicationField: "asc"},
+			map[string]interface{}{TagField: "asc"},
+		}
+	}
+	return []interface{}{
+		map[string]interface{}{NamespaceField: "asc"},
+		map[string]interface{}{ApplicationField: "asc"},
+		map[string]interface{}{TagField: "asc"},
+	}
+}
+
+// pageSearchAfter returns the sort values of pageSort the documents of a page are read after. The tags of the
+// application the page starts after are read, and skipped as the application is not included in the page.
+func pageSearchAfter(order entities.ListSort, after *entities.AppSummary) []interface{} {
+	switch order {
+	case entities.ListSortName:
+		return []interface{}{after.ApplicationName, after.Namespace, ""}
+	case entities.ListSortLastUpdated:
+		// the dates are sorted with millisecond precision
+		return []interface{}{after.LastUpdated.Truncate(time.Millisecond).UnixMilli(), after.Namespace, after.ApplicationName, ""}
+	}
+	return []interface{}{after.Namespace, after.ApplicationName, ""}
+}
+
+// pageSummaries returns a page of the summaries of the applications that match the filter. The applications are
+// sorted by downloads as described in pageMostDownloaded. Otherwise, the documents are read with search_after on
+// the sort keys from the token, so the applications are found in the order of the list and only the ones of the
+// page are read. Only the namespace and name of the documents are read, and the tags of the applications found are
+// read to build their summaries. The applications found that are not sorted after the token are skipped, such as
+// the ones found by an old tag that were returned in a previous page by their latest one.
+func (e *ElasticProvider) pageSummaries(filter *ListFilter, query *pageQuery) (*entities.ApplicationPage, error) {
+	if query.order == entities.ListSortPopularity {
+		return e.pageMostDownloaded(filter, query)
+	}
+	var after []interface{}
+	if query.after != nil {
+		after = pageSearchAfter(query.order, query.after)
+	}
+
+	// one more application than the page size is read to know if there is a next page
+	found := make([]*entities.AppSummary, 0, query.size+1)
+	seen := make(map[entities.ApplicationID]bool)
+	pending := make([]entities.ApplicationID, 0)
+	// summarize reads the summaries of the pending applications and keeps the ones included in the page
+	summarize := func() error {
+		summaries, err := e.getSummaries(filter, pending)
+		if err != nil {
+			return err
+		}
+		for _, application := range pending {
+			if summary, exists := summaries[application]; exists && query.includes(summary) {
+				found = append(found, summary)
+			}
+		}
+		pending = pending[:0]
+		return nil
+	}
+
+	err := e.searchAfter(filter, pageSort(query.order), after, func(r *responseWrapper) (bool, error) {
+		for _, hit := range r.Hits.Hits {
+			var application entities.ApplicationID
+			if err := json.Unmarshal(hit.Source, &application); err != nil {
+				return false, nerrors.NewInternalErrorFrom(err, "error unmarshalling application metadata")
+			}
+			if seen[application] {
+				continue
+			}
+			seen[application] = true
+			pending = append(pending, application)
+			if len(found)+len(pending) > query.size {
+				if err := summarize(); err != nil {
+					return false, err
+				}
+				if len(found) > query.size {
+					return false, nil
+				}
+			}
+		}
+		if err := summarize(); err != nil {
+			return false, err
+		}
+		return len(found) <= query.size, nil
+	}, NamespaceField, ApplicationField)
+	if err != nil {
+		return nil, err
+	}
+	return query.page(found, false), nil
+}
+
+// downloadsAggregation is a struct used to load the result of the aggregation of the downloads of the applications
+type downloadsAggregation struct {
+	AfterKey map[string]interface{} `json:"after_key"`
+	Buckets  []struct {
+		Key       entities.ApplicationID `json:"key"`
+		Downloads struct {
+			Value float64 `json:"value"`
+		} `json:"downloads"`
+	} `json:"buckets"`
+}
+
+// pageMostDownloaded returns a page of the summaries of the applications that match the filter sorted by downloads.
+// The downloads of an application are the sum of the ones of its tags, so they are aggregated for all the
+// applications with a composite aggregation, but only the ones of the page are kept and only their tags are read.
+func (e *ElasticProvider) pageMostDownloaded(filter *ListFilter, query *pageQuery) (*entities.ApplicationPage, error) {
+	// one more application than the page size is kept to know if there is a next page
+	candidates := make([]*entities.AppSummary, 0, 2*(query.size+1))
+	more := false
+	keepFirst := func() {
+		sort.Slice(candidates, func(i, j int) bool {
+			return query.less(candidates[i], candidates[j])
+		})
+		if len(candidates) > query.size+1 {
+			candidates = candidates[:query.size+1]
+			more = true
+		}
+	}
+
+	var after map[string]interface{}
+	for {
+		aggregation := map[string]interface{}{
+			"size": listPageSize,
+			"sources": []interface{}{
+				map[string]interface{}{NamespaceField: map[string]interface{}{"terms": map[string]interface{}{"field": NamespaceField}}},
+				map[string]interface{}{ApplicationField: map[string]interface{}{"terms": map[string]interface{}{"field": ApplicationField}}},
+			},
+		}
+		if after != nil {
+			aggregation["after"] = after
+		}
+		request := map[string]interface{}{
+			"size": 0,
+			"aggs": map[string]interface{}{
+				"applications": map[string]interface{}{
+					"composite": aggregation,
+					"aggs": map[string]interface{}{
+						"downloads": map[string]interface{}{"sum": map[string]interface{}{"field": DownloadsField}},
+					},
+				},
+			},
+		}
+		for key, value := range filter.ToElasticQuery() {
+			request[key] = value
+		}
+
+		var buf bytes.Buffer
+		if err := json.NewEncoder(&buf).Encode(request); err != nil {
+			log.Err(err).Msg("Error encoding downloads query")
+			return nil, nerrors.NewInternalErrorFrom(err, "error creating query to list applications")
+		}
+		res, err := e.client.Search(
+			e.client.Search.WithContext(context.Background()),
+			e.client.Search.WithIndex(e.indexName),
+			e.client.Search.WithBody(&buf))
+		if err != nil {
+			log.Err(err).Msg("Error getting response")
+			return nil, requestError(err, "listing the applications")
+		}
+		var r struct {
+			Aggregations struct {
+				Applications downloadsAggregation `json:"applications"`
+			} `json:"aggregations"`
+		}
+		err = func() error {
+			defer res.Body.Close()
+			if err := e.checkElasticError(res, "listing"); err != nil {
+				return err
+			}
+			if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+				return nerrors.FromError(err)
+			}
+			return nil
+		}()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, bucket := range r.Aggregations.Applications.Buckets {
+			candidate := &entities.AppSummary{
+				Namespace:       bucket.Key.Namespace,
+				ApplicationName: bucket.Key.ApplicationName,
+				Downloads:       int64(bucket.Downloads.Value),
+			}
+			if query.includes(candidate) {
+				candidates = append(candidates, candidate)
+			}
+		}
+		if len(candidates) > 2*(query.size+1) {
+			keepFirst()
+		}
+		if len(r.Aggregations.Applications.Buckets) < listPageSize || r.Aggregations.Applications.AfterKey == nil {
+			break
+		}
+		after = r.Aggregations.Applications.AfterKey
+	}
+	keepFirst()
+
+	applications := make([]entities.ApplicationID, 0, len(candidates))
+	for _, candidate := range candidates {
+		applications = append(applications, entities.ApplicationID{Namespace: candidate.Namespace, ApplicationName: candidate.ApplicationName})
+	}
+	summaries, err := e.getSummaries(filter, applications)
+	if err != nil {
+		return nil, err
+	}
+	found := make([]*entities.AppSummary, 0, len(summaries))
+	for _, summary := range summaries {
+		found = append(found, summary)
+	}
+	return query.page(found, more), nil
+}
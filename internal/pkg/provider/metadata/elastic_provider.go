@@ -22,6 +22,8 @@ import (
 	"crypto/md5"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
 	"strings"
 	"sync"
 	"time"
@@ -45,17 +47,44 @@ const (
 	MetadataNameField = "MetadataName"
 	// MetadataField with the name of the field where we store the application metadata
 	MetadataField = "Metadata"
+	// ReadmeField with the name of the field where we store the application readme
+	ReadmeField = "Readme"
+	// DescriptionField with the name of the field where we store the description in the metadata
+	DescriptionField = "Description"
+	// KeywordsField with the name of the field where we store the keywords in the metadata
+	KeywordsField = "Keywords"
+	// LicenseField with the name of the field where we store the license in the metadata
+	LicenseField = "License"
+	// TraitsField with the name of the field where we store the traits required in the metadata
+	TraitsField = "Traits"
+	// ScopesField with the name of the field where we store the scopes required in the metadata
+	ScopesField = "Scopes"
+	// K8sKindsField with the name of the field where we store the kinds of the Kubernetes entities required in the metadata
+	K8sKindsField = "K8sKinds"
 	// CatalogIDField with the name of the field where we store the internal ID
 	CatalogIDField = "CatalogID"
 	// PrivateField with the name of the field where we store the application scope
 	PrivateField = "Private"
+	// LastUpdatedField with the name of the field where we store the time the tag was added
+	LastUpdatedField = "LastUpdated"
+	// DownloadsField with the name of the field where we store the number of downloads of the tag
+	DownloadsField = "Downloads"
 	// CacheRefreshTime ick duration to update cache
 	CacheRefreshTime = time.Minute * 5
+	// listPageSize with the number of documents requested in each page of a list
+	listPageSize = 1000
+	// pointInTimeKeepAlive with the time a point in time is kept between two pages of a list
+	pointInTimeKeepAlive = "1m"
 )
 
-// mapping with the elastic-schema
-var mapping = `{
+// summaryFields with the fields of the documents used to build the application summaries
+var summaryFields = []string{NamespaceField, ApplicationField, TagField, MetadataNameField, MetadataField, PrivateField,
+	LastUpdatedField, DownloadsField}
+
+// mapping with the elastic-schema, the version in _meta is used to detect the indices created with a previous mapping
+var mapping = fmt.Sprintf(`{
     "mappings": {
+        "_meta": { "version": %d },
         "properties": {
           "CatalogID":  		{ "type": "keyword" },
           "Namespace":  		{ "type": "keyword" },
@@ -64,25 +93,83 @@ var mapping = `{
           "Readme": 			{ "type": "text" },
           "Metadata":  			{ "type": "text" },
           "MetadataName":		{ "type": "text" },
-          "Private": 			{ "type": "boolean" }
+          "Private": 			{ "type": "boolean" },
+          "Description":		{ "type": "text" },
+          "Keywords":			{ "type": "keyword" },
+          "License":			{ "type": "keyword" },
+          "Traits":				{ "type": "keyword" },
+          "Scopes":				{ "type": "keyword" },
+          "K8sKinds":			{ "type": "keyword" },
+          "LastUpdated":		{ "type": "date" },
+          "Downloads":			{ "type": "long" }
       }
     }
-}`
+}`, MappingVersion)
+
+// elasticDocument with the application metadata as it is stored in the index. The structured fields of the metadata
+// are stored in dedicated fields so the applications can be filtered and aggregated by them.
+type elasticDocument struct {
+	entities.ApplicationInfo
+	// Description with the description in the metadata
+	Description string
+	// Keywords with the keywords in the metadata
+	Keywords []string
+	// License with the license in the metadata
+	License string
+	// Traits with the traits required in the metadata
+	Traits []string
+	// Scopes with the scopes required in the metadata
+	Scopes []string
+	// K8sKinds with the kinds of the Kubernetes entities required in the metadata
+	K8sKinds []string
+}
+
+// newElasticDocument returns the document of an application, an invalid metadata is stored without the structured fields
+func newElasticDocument(application *entities.ApplicationInfo) *elasticDocument {
+	document := &elasticDocument{ApplicationInfo: *application}
+	_, metadata, err := utils.IsMetadata([]byte(application.Metadata))
+	if err != nil {
+		log.Warn().Err(err).Str("catalogID", application.CatalogID).Msg("invalid metadata, the facets are not stored")
+		return document
+	}
+	facets := entities.NewApplicationFacets(metadata)
+	document.Description = metadata.Description
+	document.Keywords = facets.Keywords
+	document.License = facets.License
+	document.Traits = facets.Traits
+	document.Scopes = facets.Scopes
+	document.K8sKinds = facets.K8sKinds
+	return document
+}
 
 // responseWrapper is a struct used to load a search result
 type responseWrapper struct {
-	Took int
-	Hits struct {
+	Took     int
+	ScrollID string `json:"_scroll_id"`
+	PitID    string `json:"pit_id"`
+	Hits     struct {
 		Total struct {
 			Value int
 		}
 		Hits []struct {
-			ID         string          `json:"_id"`
-			Source     json.RawMessage `json:"_source"`
-			Highlights json.RawMessage `json:"highlight"`
-			Sort       []interface{}   `json:"sort"`
+			ID          string          `json:"_id"`
+			SeqNo       int64           `json:"_seq_no"`
+			PrimaryTerm int64           `json:"_primary_term"`
+			Score       float64         `json:"_score"`
+			Source      json.RawMessage `json:"_source"`
+			Highlights  json.RawMessage `json:"highlight"`
+			Sort        []interface{}   `json:"sort"`
 		}
 	}
+	Aggregations map[string]termsAggregation `json:"aggregations"`
+}
+
+// termsAggregation is a struct used to load the result of a terms aggregation
+type termsAggregation struct {
+	Buckets []struct {
+		Key      string `json:"key"`
+		DocCount int    `json:"doc_count"`
+	} `json:"buckets"`
 }
 
 type ElasticFilter interface {
@@ -209,26 +296,26 @@ func (af *ApplicationFilter) ToString() string {
 
 // ElasticProvider a struct to manage elastic storage
 type ElasticProvider struct {
-	client    *elasticsearch.Client
+	client *elasticsearch.Client
+	// indexName with the name of the alias that points to the physical index with the documents
 	indexName string
-	// appCache with a cache that contains all the catalog PUBLIC applications
-	appCache []*entities.AppSummary
-	// summaryCache with a cache that contains the catalog summary (with PUBLIC applications)
-	summaryCache *entities.Summary
-	// Mutex to protect cache access
+	// cache with the summaries of the catalog PUBLIC applications, updated on every change
+	cache *summaryCache
+	// Mutex to avoid concurrent cache refreshes
 	sync.Mutex
-	// invalidateCacheChan with a chan te send/receive message to fill Cache after remove or add an application
+	// invalidateCacheChan with a chan te send/receive message to refill the cache or to stop the refreshes
 	invalidateCacheChan chan bool
+	// stopped is closed when the cache refreshes stop, the channel above is no longer read
+	stopped chan struct{}
 	// authEnable with a flag to indicate if the authorization is enabled
 	authEnable bool
+	// instanceID with the identifier of the instance in the leases of the reindexes
+	instanceID string
 }
 
-// NewElasticProvider returns new Elastic provider
-func NewElasticProvider(index string, address string, authEnable bool) (*ElasticProvider, error) {
+// NewElasticProvider returns new Elastic provider that connects to Elastic with the client configuration
+func NewElasticProvider(index string, conf elasticsearch.Config, authEnable bool) (*ElasticProvider, error) {
 
-	conf := elasticsearch.Config{
-		Addresses: []string{address},
-	}
 	es, err := elasticsearch.NewClient(conf)
 	if err != nil {
 		log.Err(err).Msg("error creating elastic client")
@@ -237,19 +324,36 @@ func NewElasticProvider(index string, address string, authEnable bool) (*Elastic
 	return &ElasticProvider{
 		client:              es,
 		indexName:           index,
-		appCache:            make([]*entities.AppSummary, 0),
+		cache:               newSummaryCache(getCacheFilter(authEnable)),
 		invalidateCacheChan: make(chan bool),
+		stopped:             make(chan struct{}),
 		authEnable:          authEnable,
+		instanceID:          newInstanceID(),
 	}, nil
 }
 
-// Init creates the index and the necessary index
+// Init creates the index and the alias if they do not exist. If the index was created with a previous mapping,
+// its documents are reindexed in the background into a new index and the alias is swapped once they are copied.
+// The reindex is run by the instance that holds its lease, the writes are rejected while the last changes are copied.
 func (e *ElasticProvider) Init() error {
 	log.Info().Msg("Initializing elastic provider")
-	err := e.CreateIndex(mapping)
+	state, err := e.getIndexState()
 	if err != nil {
 		return err
 	}
+	switch {
+	case state == nil:
+		if err = e.createVersionedIndex(); err != nil {
+			return err
+		}
+	case state.Version < MappingVersion:
+		if err = e.startReindex(state); err != nil {
+			return err
+		}
+	case state.Version > MappingVersion:
+		log.Warn().Str("index", state.Index).Int("version", state.Version).Int("supported", MappingVersion).
+			Msg("the index has been created with a newer mapping")
+	}
 
 	e.FillCache()
 
@@ -263,7 +367,8 @@ func (e *ElasticProvider) periodicCacheRefresh() {
 	ticker := time.NewTicker(CacheRefreshTime)
 
 	// Method executed in one thread to fill the cache every "CacheRefreshTime" time
-	// or when a message is received through the "invalidateCacheChan" channel
+	// or when a message is received through the "invalidateCacheChan" channel. The changes are applied
+	// to the cache as they are stored, the refresh only fixes the ones that could not be applied.
 	for {
 		select {
 		case val := <-e.invalidateCacheChan:
@@ -271,7 +376,7 @@ func (e *ElasticProvider) periodicCacheRefresh() {
 				e.FillCache()
 			} else {
 				ticker.Stop()
-				close(e.invalidateCacheChan)
+				close(e.stopped)
 				return
 			}
 		case <-ticker.C:
@@ -280,21 +385,29 @@ func (e *ElasticProvider) periodicCacheRefresh() {
 	}
 }
 
+// invalidateCache requests a refresh of the cache, it is skipped once the refreshes are stopped
+func (e *ElasticProvider) invalidateCache() {
+	select {
+	case e.invalidateCacheChan <- true:
+	case <-e.stopped:
+	}
+}
+
 // Finish method to exist in an orderly way
 func (e *ElasticProvider) Finish() {
 	// send a message to finish th timer and the close the channel
 	e.invalidateCacheChan <- false
 }
 
-// IndexExists check if an index exists
-func (e *ElasticProvider) IndexExists() (bool, error) {
+// IndexExists check if an index or an alias exists
+func (e *ElasticProvider) IndexExists(index string) (bool, error) {
 
 	exists, err := esapi.IndicesExistsRequest{
-		Index: []string{e.indexName},
+		Index: []string{index},
 	}.Do(context.Background(), e.client)
 
 	if err != nil {
-		return false, nerrors.FromError(err)
+		return false, requestError(err, "checking the index")
 	}
 	defer exists.Body.Close()
 
@@ -311,17 +424,17 @@ func (e *ElasticProvider) IndexExists() (bool, error) {
 }
 
 // CreateIndex creates an index with the mapping received
-func (e *ElasticProvider) CreateIndex(mapping string) error {
+func (e *ElasticProvider) CreateIndex(index string, mapping string) error {
 
-	exists, err := e.IndexExists()
+	exists, err := e.IndexExists(index)
 	if err != nil {
 		return err
 	}
 	// if not exist -> create it
 	if !exists {
-		res, err := e.client.Indices.Create(e.indexName, e.client.Indices.Create.WithBody(strings.NewReader(mapping)))
+		res, err := e.client.Indices.Create(index, e.client.Indices.Create.WithBody(strings.NewReader(mapping)))
 		if err != nil {
-			return err
+			return requestError(err, "creating the index")
 		}
 
 		defer res.Body.Close()
@@ -335,9 +448,22 @@ func (e *ElasticProvider) CreateIndex(mapping string) error {
 	return nil
 }
 
-// DeleteIndex removes a elastic index
+// DeleteIndex removes the elastic indices of all the mapping versions and the reindex leases, and the index created
+// without alias
 func (e *ElasticProvider) DeleteIndex() error {
-	resp, err := e.client.Indices.Delete([]string{e.indexName})
+	resp, err := e.client.Indices.Delete([]string{physicalIndexPattern(e.indexName), reindexLeaseIndexName(e.indexName)},
+		e.client.Indices.Delete.WithIgnoreUnavailable(true))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	// once the versioned indices are removed, the name only exists if it is an index created without alias
+	exists, err := e.IndexExists(e.indexName)
+	if err != nil || !exists {
+		return err
+	}
+	resp, err = e.client.Indices.Delete([]string{e.indexName})
 	if err != nil {
 		return err
 	}
@@ -347,38 +473,60 @@ func (e *ElasticProvider) DeleteIndex() error {
 	return nil
 }
 
+// generateCatalogID generates the catalog ID as namespace/appName:tag
+func generateCatalogID(namespace, appName, tag string) string {
+	return fmt.Sprintf("%s/%s:%s", namespace, appName, tag)
+}
+
+// generateDocumentID generates the document identifier as the MD5 of the catalog ID
+func generateDocumentID(namespace, appName, tag string) string {
+	id := md5.Sum([]byte(generateCatalogID(namespace, appName, tag)))
+	return fmt.Sprintf("%x", id)
+}
+
 // GenerateCatalogID generates the catalog ID (field stored in elastic) as namespace/appName:tag
 func (e *ElasticProvider) GenerateCatalogID(namespace, appName, tag string) string {
-	return fmt.Sprintf("%s/%s:%s", namespace, appName, tag)
+	return generateCatalogID(namespace, appName, tag)
 }
 
 // GenerateID generates the document _id
 func (e *ElasticProvider) GenerateID(info *entities.ApplicationInfo) string {
-	catalogID := e.GenerateCatalogID(info.Namespace, info.ApplicationName, info.Tag)
-	id := md5.Sum([]byte(catalogID))
-	return fmt.Sprintf("%x", id)
+	return generateDocumentID(info.Namespace, info.ApplicationName, info.Tag)
 }
 
 // GenerateIDFromAppID generates the document _id
 func (e *ElasticProvider) GenerateIDFromAppID(metadata *entities.ApplicationID) string {
-	catalogID := e.GenerateCatalogID(metadata.Namespace, metadata.ApplicationName, metadata.Tag)
-	id := md5.Sum([]byte(catalogID))
-	return fmt.Sprintf("%x", id)
+	return generateDocumentID(metadata.Namespace, metadata.ApplicationName, metadata.Tag)
 }
 
 func (e *ElasticProvider) checkElasticError(res *esapi.Response, operation string) error {
 
 	if res.IsError() {
 		log.Warn().Str("err", res.Status()).Str("operation", operation).Msg("Elastic error")
-		if res.StatusCode == 404 {
+		switch res.StatusCode {
+		case http.StatusNotFound:
 			return nerrors.NewNotFoundError("Error %s application: [%s]", operation, res.Status())
-		} else {
+		case http.StatusForbidden:
+			// the writes are blocked while the documents are copied to a new index
+			if body, err := io.ReadAll(res.Body); err == nil && bytes.Contains(body, []byte("cluster_block_exception")) {
+				return nerrors.NewAbortedError("Error %s application: the catalog is being reindexed, retry later", operation)
+			}
+			return nerrors.NewInternalError("Error %s application: [%s]", operation, res.Status())
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return nerrors.NewUnavailableError("Error %s application: [%s]", operation, res.Status())
+		default:
 			return nerrors.NewInternalError("Error %s application: [%s]", operation, res.Status())
 		}
 	}
 	return nil
 }
 
+// requestError returns the error of a request that has not been answered by Elastic. The cluster is unavailable,
+// so the request can be retried.
+func requestError(err error, operation string) error {
+	return nerrors.NewUnavailableErrorFrom(err, "unable to reach Elastic %s", operation)
+}
+
 // Add stores new application metadata or updates it if it exists
 func (e *ElasticProvider) Add(metadata *entities.ApplicationInfo) (*entities.ApplicationInfo, error) {
 
@@ -389,13 +537,13 @@ func (e *ElasticProvider) Add(metadata *entities.ApplicationInfo) (*entities.App
 	metadata.CatalogID = e.GenerateCatalogID(metadata.Namespace, metadata.ApplicationName, metadata.Tag)
 
 	// convert the metadata to JSON
-	metadataJSON, err := utils.ApplicationInfoToJSON(*metadata)
+	metadataJSON, err := json.Marshal(newElasticDocument(metadata))
 	if err != nil {
 		log.Error().Err(err).Msg("error converting metadata to JSON")
 		return nil, err
 	}
 
-	res, err := e.client.Index(e.indexName, strings.NewReader(metadataJSON),
+	res, err := e.client.Index(e.indexName, bytes.NewReader(metadataJSON),
 		e.client.Index.WithRefresh("true"),
 		e.client.Index.WithContext(context.Background()),
 		e.client.Index.WithDocumentID(id))
@@ -403,16 +551,14 @@ func (e *ElasticProvider) Add(metadata *entities.ApplicationInfo) (*entities.App
 	// Perform the request with the client.
 	if err != nil {
 		log.Error().Err(err).Msg("error adding metadata")
-		return nil, err
+		return nil, requestError(err, "adding the application")
 	}
 	defer res.Body.Close()
 
 	if err = e.checkElasticError(res, "adding"); err != nil {
 		return nil, err
 	}
-
-	// update the cache
-	e.invalidateCacheChan <- true
+	e.cache.Put(id, metadata)
 
 	return metadata, nil
 }
@@ -424,7 +570,7 @@ func (e *ElasticProvider) Exists(appID *entities.ApplicationID) (bool, error) {
 	res, err := e.client.Exists(e.indexName, id, e.client.Exists.WithContext(context.Background()))
 	if err != nil {
 		log.Err(err).Msg("Error getting response")
-		return false, nerrors.FromError(err)
+		return false, requestError(err, "checking the application")
 	}
 	defer res.Body.Close()
 
@@ -438,7 +584,7 @@ func (e *ElasticProvider) Get(appID *entities.ApplicationID) (*entities.Applicat
 	res, err := e.client.Get(e.indexName, id, e.client.Get.WithContext(context.Background()))
 	if err != nil {
 		log.Err(err).Msg("Error getting response")
-		return nil, nerrors.NewInternalErrorFrom(err, "Error getting application")
+		return nil, requestError(err, "getting the application")
 	}
 
 	defer res.Body.Close()
@@ -473,19 +619,23 @@ func (e *ElasticProvider) Get(appID *entities.ApplicationID) (*entities.Applicat
 func (e *ElasticProvider) Remove(appID *entities.ApplicationID) error {
 	id := e.GenerateIDFromAppID(appID)
 	log.Debug().Str("id", id).Msg("Remove app id")
+	return e.RemoveDocument(id)
+}
+
+// RemoveDocument removes a document by its internal identifier
+func (e *ElasticProvider) RemoveDocument(id string) error {
 	res, err := e.client.Delete(e.indexName, id, e.client.Delete.WithContext(context.Background()), e.client.Delete.WithRefresh("true"))
 
 	if err != nil {
 		log.Error().Str("error", err.Error()).Msg("Error deleting metadata")
-		return nerrors.NewInternalErrorFrom(err, "error deleting metadata by ID")
+		return requestError(err, "removing the application")
 	}
 	defer res.Body.Close()
 
 	if err = e.checkElasticError(res, "removing"); err != nil {
 		return err
 	}
-
-	e.invalidateCacheChan <- true
+	e.cache.Remove(id)
 
 	return nil
 }
@@ -493,8 +643,6 @@ func (e *ElasticProvider) Remove(appID *entities.ApplicationID) error {
 // List returns all the applications stored
 func (e *ElasticProvider) List(namespace string) ([]*entities.ApplicationInfo, error) {
 
-	lastReceived := 0
-	query := true
 	applications := make([]*entities.ApplicationInfo, 0)
 
 	filter := &ListFilter{
@@ -502,214 +650,276 @@ func (e *ElasticProvider) List(namespace string) ([]*entities.ApplicationInfo, e
 		Private:   nil,
 	}
 
-	for query {
-		r, err := e.listFromWithFilter(filter, lastReceived)
-		if err != nil {
-			return nil, err
-		}
-
+	err := e.listWithFilter(filter, func(r *responseWrapper) error {
 		log.Debug().Int("hits received", len(r.Hits.Hits)).Msg("received")
 		for _, app := range r.Hits.Hits {
 			var application entities.ApplicationInfo
 			if err := json.Unmarshal(app.Source, &application); err != nil {
-				return nil, nerrors.NewInternalErrorFrom(err, "error unmarshalling application metadata")
+				return nerrors.NewInternalErrorFrom(err, "error unmarshalling application metadata")
 			}
 			applications = append(applications, &application)
 		}
-		lastReceived += len(r.Hits.Hits)
-		query = r.Hits.Total.Value != len(applications) && len(r.Hits.Hits) != 0
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return applications, nil
 
 }
 
-// FillCache refresh the cache with the applications
-func (e *ElasticProvider) FillCache() {
-	// ListSummary and fillCache
-	var listFilter *ListFilter
-	if e.authEnable {
-		private := false
-		listFilter = &ListFilter{
-			Namespace: nil,
-			Private:   &private,
-		}
-	} else {
-		listFilter = &ListFilter{
-			Namespace: nil,
-			Private:   nil,
+// ListDocuments returns all the documents of the index. The documents that cannot be unmarshalled or whose
+// identifier does not match the application are returned with an error.
+func (e *ElasticProvider) ListDocuments() ([]*Document, error) {
+	documents := make([]*Document, 0)
+
+	err := e.listWithFilter(&ListFilter{}, func(r *responseWrapper) error {
+		for _, hit := range r.Hits.Hits {
+			document := &Document{ID: hit.ID}
+			var application entities.ApplicationInfo
+			if err := json.Unmarshal(hit.Source, &application); err != nil {
+				document.Error = nerrors.NewInternalErrorFrom(err, "error unmarshalling application metadata")
+			} else {
+				document.Application = &application
+				if hit.ID != e.GenerateID(&application) {
+					document.Error = nerrors.NewInternalError("document identifier does not match the application [%s]",
+						application.ToApplicationID().String())
+				}
+			}
+			documents = append(documents, document)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	summaryList, summary, err := e.listSummaryWithFilter(listFilter)
+
+	return documents, nil
+}
+
+// FillCache refresh the cache with the applications. The changes stored while the applications are listed
+// are kept in the cache.
+func (e *ElasticProvider) FillCache() {
+	e.Lock()
+	defer e.Unlock()
+
+	e.cache.StartRefresh()
+	tags := make(map[string]*entities.ApplicationInfo)
+	err := e.listWithFilter(getCacheFilter(e.authEnable), func(r *responseWrapper) error {
+		for _, app := range r.Hits.Hits {
+			var application entities.ApplicationInfo
+			if err := json.Unmarshal(app.Source, &application); err != nil {
+				return nerrors.NewInternalErrorFrom(err, "error unmarshalling application metadata")
+			}
+			tags[app.ID] = &application
+		}
+		return nil
+	}, summaryFields...)
 	if err != nil {
 		log.Error().Str("error", err.Error()).Msg("error filling the cache")
-	} else {
-		e.Lock()
-		defer e.Unlock()
-		e.appCache = summaryList
-		e.summaryCache = summary
-		log.Debug().Int("len", len(e.appCache)).Msg("applications in cache")
-
+		e.cache.CancelRefresh()
+		return
 	}
+	e.cache.Refresh(tags)
+	log.Debug().Int("len", len(tags)).Msg("application tags in cache")
 }
 
 // GetSummary returns the catalog summary
 func (e *ElasticProvider) GetSummary() (*entities.Summary, error) {
-	e.Lock()
-	defer e.Unlock()
-	if e.summaryCache == nil {
+	_, summary := e.cache.Get()
+	if summary == nil {
 		return nil, nerrors.NewInternalError("error getting catalog summary")
 	}
-	return e.summaryCache, nil
+	return summary, nil
 }
 
-// listFromWithFilter search applications in elastic with pagination
-func (e *ElasticProvider) listFromWithFilter(filter ElasticFilter, lastReceived int, getFields ...string) (*responseWrapper, error) {
-	sortedBy := []string{NamespaceField, ApplicationField, TagField}
-	searchFunctions := []func(*esapi.SearchRequest){
-		e.client.Search.WithContext(context.Background()),
-		e.client.Search.WithIndex(e.indexName),
-		e.client.Search.WithTrackTotalHits(true),
-		e.client.Search.WithFrom(lastReceived),
-		e.client.Search.WithSort(sortedBy...),
+// openPointInTime opens a point in time of the index to read consistent pages of documents
+func (e *ElasticProvider) openPointInTime() (string, error) {
+	res, err := e.client.OpenPointInTime([]string{e.indexName}, pointInTimeKeepAlive,
+		e.client.OpenPointInTime.WithContext(context.Background()))
+	if err != nil {
+		log.Err(err).Msg("Error getting response")
+		return "", requestError(err, "opening the point in time")
 	}
+	defer res.Body.Close()
 
-	if len(getFields) > 0 {
-		searchFunctions = append(searchFunctions, e.client.Search.WithSourceIncludes(getFields...))
+	if err = e.checkElasticError(res, "opening point in time"); err != nil {
+		return "", err
 	}
 
-	query := filter.ToElasticQuery()
-	if len(query) > 0 {
-
-		var buf bytes.Buffer
-		if err := json.NewEncoder(&buf).Encode(query); err != nil {
-			log.Err(err).Msg("Error encoding namespaced query")
-			return nil, nerrors.NewInternalErrorFrom(err, "error creating query to list by namespace")
-		}
-		searchFunctions = append(searchFunctions, e.client.Search.WithBody(&buf))
+	var pit struct {
+		ID string `json:"id"`
 	}
+	if err := json.NewDecoder(res.Body).Decode(&pit); err != nil {
+		return "", nerrors.FromError(err)
+	}
+	return pit.ID, nil
+}
 
-	// Perform the search request.
-	res, err := e.client.Search(searchFunctions...)
+// closePointInTime releases the resources of a point in time, it expires anyway after the keep alive
+func (e *ElasticProvider) closePointInTime(id string) {
+	body, err := json.Marshal(map[string]interface{}{"id": id})
 	if err != nil {
-		log.Err(err).Msg("Error getting response")
-		return nil, nerrors.FromError(err)
+		return
 	}
-	defer res.Body.Close()
+	res, err := e.client.ClosePointInTime(e.client.ClosePointInTime.WithBody(bytes.NewReader(body)),
+		e.client.ClosePointInTime.WithContext(context.Background()))
+	if err != nil {
+		log.Warn().Err(err).Msg("error closing point in time")
+		return
+	}
+	res.Body.Close()
+}
 
-	if err = e.checkElasticError(res, "listing"); err != nil {
-		return nil, err
+// listWithFilter search applications in elastic and calls process with each page of results. The pages are read
+// from a point in time with search_after on the namespace, application and tag, so the list is not limited by
+// the max_result_window of the index and the documents changed meanwhile are neither skipped nor repeated.
+func (e *ElasticProvider) listWithFilter(filter ElasticFilter, process func(r *responseWrapper) error, getFields ...string) error {
+	sortedBy := []interface{}{
+		map[string]interface{}{NamespaceField: "asc"},
+		map[string]interface{}{ApplicationField: "asc"},
+		map[string]interface{}{TagField: "asc"},
 	}
+	return e.searchAfter(filter, sortedBy, nil, func(r *responseWrapper) (bool, error) {
+		return true, process(r)
+	}, getFields...)
+}
 
-	var r responseWrapper
-	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
-		return nil, nerrors.FromError(err)
+// searchAfter search applications in elastic sorted by the given fields, starting after the sort values of after
+// if it is set, and calls process with each page of results until it returns false. The pages are read from a
+// point in time with search_after, the sort must identify the documents.
+func (e *ElasticProvider) searchAfter(filter ElasticFilter, sortedBy []interface{}, after []interface{}, process func(r *responseWrapper) (bool, error), getFields ...string) error {
+	pitID, err := e.openPointInTime()
+	if err != nil {
+		return err
 	}
-	// Print the response status, number of results, and request duration.
-	log.Debug().Str("filter", filter.ToString()).Str("Status", res.Status()).Int("total", r.Hits.Total.Value).Int("took(ms)", r.Took).Msg("List operation")
+	defer func() {
+		e.closePointInTime(pitID)
+	}()
 
-	return &r, nil
+	searchAfter := after
+	for {
+		query := map[string]interface{}{
+			"size":             listPageSize,
+			"pit":              map[string]interface{}{"id": pitID, "keep_alive": pointInTimeKeepAlive},
+			"sort":             sortedBy,
+			"track_total_hits": false,
+		}
+		for key, value := range filter.ToElasticQuery() {
+			query[key] = value
+		}
+		if len(getFields) > 0 {
+			query["_source"] = getFields
+		}
+		if searchAfter != nil {
+			query["search_after"] = searchAfter
+		}
+
+		var buf bytes.Buffer
+		if err := json.NewEncoder(&buf).Encode(query); err != nil {
+			log.Err(err).Msg("Error encoding list query")
+			return nerrors.NewInternalErrorFrom(err, "error creating query to list applications")
+		}
+
+		// Perform the search request, the index is the one of the point in time
+		res, err := e.client.Search(
+			e.client.Search.WithContext(context.Background()),
+			e.client.Search.WithBody(&buf))
+		if err != nil {
+			log.Err(err).Msg("Error getting response")
+			return requestError(err, "listing the applications")
+		}
+		r, err := e.readResponse(res, "listing")
+		if err != nil {
+			return err
+		}
+		log.Debug().Str("filter", filter.ToString()).Int("hits", len(r.Hits.Hits)).Int("took(ms)", r.Took).Msg("List operation")
+
+		if r.PitID != "" {
+			pitID = r.PitID
+		}
+		if len(r.Hits.Hits) == 0 {
+			return nil
+		}
+		next, err := process(r)
+		if err != nil {
+			return err
+		}
+		if !next || len(r.Hits.Hits) < listPageSize {
+			return nil
+		}
+		searchAfter = r.Hits.Hits[len(r.Hits.Hits)-1].Sort
+	}
 }
 
-// ListSummaryWithFilter returns entities.AppSummary and entities.Summary applying a filter in the search method
-func (e *ElasticProvider) ListSummaryWithFilter(filter *ListFilter) ([]*entities.AppSummary, *entities.Summary, error) {
+// ListSummaryWithFilter returns the requested page of the summaries of the applications that match a filter.
+// The public applications of all the namespaces are read from the cache, and sorted and sliced in memory.
+// Otherwise, the page is read from the index as described in pageSummaries.
+func (e *ElasticProvider) ListSummaryWithFilter(filter *ListFilter, page *entities.PageRequest) (*entities.ApplicationPage, error) {
+	query, err := newPageQuery(page)
+	if err != nil {
+		return nil, err
+	}
 	// if filtering == (public applications for all namespaces) -> return cache
 	if filter != nil && (filter.Namespace == nil || *filter.Namespace == "") && (filter.Private == nil || !*filter.Private) {
-		e.Lock()
-		defer e.Unlock()
-		return e.appCache, e.summaryCache, nil
-	} else {
-		return e.listSummaryWithFilter(filter)
+		summaryList, _ := e.cache.Get()
+		return query.page(summaryList, false), nil
 	}
+	if query.size == 0 {
+		summaryList, _, err := e.listSummaryWithFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		return query.page(summaryList, false), nil
+	}
+	return e.pageSummaries(filter, query)
 }
 
 // ListSummaryWithFilter returns entities.AppSummary and entities.Summary applying a filter in the search method
 func (e *ElasticProvider) listSummaryWithFilter(filter *ListFilter) ([]*entities.AppSummary, *entities.Summary, error) {
-	lastReceived := 0
-	query := true
-	summaryList := make([]*entities.AppSummary, 0)
-	var summary entities.Summary
-	total := 0
-	getFields := []string{NamespaceField, ApplicationField, TagField, MetadataNameField, MetadataField, PrivateField}
-
-	for query {
-		r, err := e.listFromWithFilter(filter, lastReceived, getFields...)
-		if err != nil {
-			return nil, nil, err
-		}
-
+	builder := newSummaryBuilder()
+	err := e.listWithFilter(filter, func(r *responseWrapper) error {
 		for _, app := range r.Hits.Hits {
-			// var application entities.ExtendedAppSummary
 			var application entities.ApplicationInfo
 			if err := json.Unmarshal(app.Source, &application); err != nil {
-				return nil, nil, nerrors.NewInternalErrorFrom(err, "error unmarshalling application metadata")
-			}
-
-			// new version
-			summary.NumTags++
-
-			var metadataLogo []entities.ApplicationLogo
-			_, metadata, err := utils.IsMetadata([]byte(application.Metadata))
-			if err != nil {
-				// If returns the error, the catalog could be inaccessible. It could be better not return an error and allows to continue listing
-				//return nil, nil, err
-				log.Warn().Str("error", err.Error()).Msg("error getting metadata")
-			} else {
-				metadataLogo = metadata.Logo
+				return nerrors.NewInternalErrorFrom(err, "error unmarshalling application metadata")
 			}
+			builder.Add(&application)
+		}
+		return nil
+	}, summaryFields...)
+	if err != nil {
+		return nil, nil, err
+	}
 
-			// check if the last entry has the same namespace and applicationName as the newer one
-			if len(summaryList) > 0 {
-				last := summaryList[len(summaryList)-1]
-				if last.Namespace != application.Namespace {
-					// new namespace
-					summary.NumNamespaces++
-				}
-				if last.Namespace == application.Namespace && last.ApplicationName == application.ApplicationName {
-					summaryList[len(summaryList)-1].TagMetadataName[application.Tag] = application.MetadataName
-					if metadataLogo != nil {
-						summaryList[len(summaryList)-1].MetadataLogo[application.Tag] = metadataLogo
-					}
-				} else {
-					// new application
-					summary.NumApplications++
-					newAppSummary := &entities.AppSummary{
-						Namespace:       application.Namespace,
-						ApplicationName: application.ApplicationName,
-						TagMetadataName: map[string]string{application.Tag: application.MetadataName},
-						MetadataLogo:    map[string][]entities.ApplicationLogo{},
-						Private:         application.Private,
-					}
-					if metadataLogo != nil {
-						newAppSummary.MetadataLogo[application.Tag] = metadataLogo
-					}
-					summaryList = append(summaryList, newAppSummary)
-				}
-			} else {
-				// new namespace
-				summary.NumNamespaces++
-				// new application (new tag updated above)
-				summary.NumApplications++
-				newAppSummary := &entities.AppSummary{
-					Namespace:       application.Namespace,
-					ApplicationName: application.ApplicationName,
-					TagMetadataName: map[string]string{application.Tag: application.MetadataName},
-					MetadataLogo:    map[string][]entities.ApplicationLogo{},
-					Private:         application.Private,
-				}
-				if metadataLogo != nil {
-					newAppSummary.MetadataLogo[application.Tag] = metadataLogo
-				}
-				summaryList = append(summaryList, newAppSummary)
+	summaryList, summary := builder.Build()
+	return summaryList, summary, nil
+}
 
+// ListTags returns the tags of an application sorted by name, it is empty if the application does not exist.
+// Only the tag field of the documents is read.
+func (e *ElasticProvider) ListTags(namespace string, applicationName string) ([]string, error) {
+	tags := make([]string, 0)
+	filter := &ApplicationFilter{
+		namespace:   namespace,
+		application: applicationName,
+	}
+	// the pages are sorted by namespace, application and tag
+	err := e.listWithFilter(filter, func(r *responseWrapper) error {
+		for _, app := range r.Hits.Hits {
+			var tag entities.ApplicationInfo
+			if err := json.Unmarshal(app.Source, &tag); err != nil {
+				return nerrors.NewInternalErrorFrom(err, "error unmarshalling application metadata")
 			}
-			total++
+			tags = append(tags, tag.Tag)
 		}
-		lastReceived += len(r.Hits.Hits)
-		query = r.Hits.Total.Value != total && len(r.Hits.Hits) != 0
+		return nil
+	}, TagField)
+	if err != nil {
+		return nil, err
 	}
-
-	return summaryList, &summary, nil
+	return tags, nil
 }
 
 // GetApplicationVisibility returns the application visibility or error if the application does not exist
@@ -748,7 +958,7 @@ func (e *ElasticProvider) GetApplicationVisibility(namespace string, application
 	res, err := e.client.Search(searchFunctions...)
 	if err != nil {
 		log.Err(err).Msg("Error getting response")
-		return nil, nerrors.FromError(err)
+		return nil, requestError(err, "getting the application visibility")
 	}
 	defer res.Body.Close()
 
@@ -773,91 +983,372 @@ func (e *ElasticProvider) GetApplicationVisibility(namespace string, application
 
 }
 
-// getApplicationIds returns the internal identifiers of all the tags of an application and the application visibility (if it is private or public)
-func (e *ElasticProvider) getApplicationIds(namespace string, application string) ([]string, error) {
-
-	lastReceived := 0
-	query := true
-	ids := make([]string, 0)
-	for query {
-		r, err := e.listFromWithFilter(&ApplicationFilter{
-			namespace:   namespace,
-			application: application,
-		}, lastReceived)
-		if err != nil {
-			return nil, err
-		}
+// getApplicationTags returns the summary fields of all the tags of an application indexed by internal identifier
+func (e *ElasticProvider) getApplicationTags(namespace string, application string) (map[string]*entities.ApplicationInfo, error) {
 
+	tags := make(map[string]*entities.ApplicationInfo)
+	filter := &ApplicationFilter{
+		namespace:   namespace,
+		application: application,
+	}
+	err := e.listWithFilter(filter, func(r *responseWrapper) error {
 		log.Debug().Int("hits received", len(r.Hits.Hits)).Msg("received")
-		if len(r.Hits.Hits) > 0 {
-			var application entities.ApplicationInfo
-			if err := json.Unmarshal(r.Hits.Hits[0].Source, &application); err != nil {
-				return nil, nerrors.NewInternalErrorFrom(err, "error unmarshalling application metadata")
-			}
-		}
 		for _, app := range r.Hits.Hits {
-			ids = append(ids, app.ID)
+			var tag entities.ApplicationInfo
+			if err := json.Unmarshal(app.Source, &tag); err != nil {
+				return nerrors.NewInternalErrorFrom(err, "error unmarshalling application metadata")
+			}
+			tags[app.ID] = &tag
 		}
-		lastReceived += len(r.Hits.Hits)
-		query = r.Hits.Total.Value != len(ids) && len(r.Hits.Hits) != 0
+		return nil
+	}, summaryFields...)
+	if err != nil {
+		return nil, err
 	}
 
-	return ids, nil
+	return tags, nil
 
 }
 
-// updateVisibilityStruct struct required to update application visibility
-type updateVisibilityStruct struct {
-	Private bool
+// maxVisibilityAttempts with the number of times the visibility update is sent while other writes conflict with it
+const maxVisibilityAttempts = 3
+
+// visibilityScript changes the visibility of a tag. The tags that already have it are not written, so the update
+// applies only the pending changes if it is retried after an interruption.
+var visibilityScript = fmt.Sprintf("if (ctx._source.%s == params.private) { ctx.op = 'noop' } else { ctx._source.%s = params.private }",
+	PrivateField, PrivateField)
+
+// updateByQueryResponse with the result of an update by query request
+type updateByQueryResponse struct {
+	// Total with the number of documents that match the query
+	Total int `json:"total"`
+	// Updated with the number of documents changed
+	Updated int `json:"updated"`
+	// Noops with the number of documents that did not need to be changed
+	Noops int `json:"noops"`
+	// VersionConflicts with the number of documents that were changed by other requests during the update
+	VersionConflicts int `json:"version_conflicts"`
+	// Failures with the documents that could not be updated
+	Failures []json.RawMessage `json:"failures"`
 }
 
-// UpdateApplicationVisibility changes the application visibility
-func (e *ElasticProvider) UpdateApplicationVisibility(namespace string, applicationName string, isPrivate bool) error {
-	// Get all the catalogIDs for namespace, applicationName
-	// Foreach:
-	// update the data
+// updateVisibility sends a single update by query that changes the visibility of all the tags of an application
+func (e *ElasticProvider) updateVisibility(namespace string, applicationName string, isPrivate bool) (*updateByQueryResponse, error) {
+	query := map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					map[string]interface{}{"term": map[string]interface{}{NamespaceField: namespace}},
+					map[string]interface{}{"term": map[string]interface{}{ApplicationField: applicationName}},
+				},
+			},
+		},
+		"script": map[string]interface{}{
+			"source": visibilityScript,
+			"lang":   "painless",
+			"params": map[string]interface{}{"private": isPrivate},
+		},
+	}
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(query); err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error encoding the visibility update")
+	}
 
-	ids, err := e.getApplicationIds(namespace, applicationName)
+	res, err := e.client.UpdateByQuery([]string{e.indexName},
+		e.client.UpdateByQuery.WithContext(context.Background()),
+		e.client.UpdateByQuery.WithBody(&buf),
+		e.client.UpdateByQuery.WithConflicts("proceed"),
+		e.client.UpdateByQuery.WithRefresh(true))
 	if err != nil {
-		log.Error().Err(err).Msg("error getting application tags")
-		return err
+		log.Error().Err(err).Msg("error updating application visibility")
+		return nil, requestError(err, "updating the application visibility")
 	}
+	defer res.Body.Close()
 
-	if len(ids) == 0 {
+	if err = e.checkElasticError(res, "updating visibility"); err != nil {
+		return nil, err
+	}
+	var response updateByQueryResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error decoding the visibility update response")
+	}
+	if len(response.Failures) > 0 {
 		log.Error().Str("namespace", namespace).Str("application", applicationName).
-			Msg("error changing application visibility, no applications found")
-		return nerrors.NewNotFoundError("unable to update application visibility. Application not found")
+			Str("failure", string(response.Failures[0])).Msg("error updating application visibility")
+		return nil, nerrors.NewInternalError("unable to update the visibility of %d tags", len(response.Failures))
 	}
+	return &response, nil
+}
 
-	data := &updateVisibilityStruct{
-		Private: isPrivate,
+// UpdateApplicationVisibility changes the visibility of all the tags of an application and returns the number of
+// tags changed. The update is sent again while other writes conflict with it, and it can be retried if it is
+// interrupted as the tags that already have the visibility are not changed.
+func (e *ElasticProvider) UpdateApplicationVisibility(namespace string, applicationName string, isPrivate bool) (int, error) {
+	updated := 0
+	conflicts := 0
+	for attempt := 0; attempt < maxVisibilityAttempts; attempt++ {
+		response, err := e.updateVisibility(namespace, applicationName, isPrivate)
+		if err != nil {
+			return updated, err
+		}
+		if response.Total == 0 {
+			log.Error().Str("namespace", namespace).Str("application", applicationName).
+				Msg("error changing application visibility, no applications found")
+			return updated, nerrors.NewNotFoundError("unable to update application visibility. Application not found")
+		}
+		updated += response.Updated
+		conflicts = response.VersionConflicts
+		if conflicts == 0 {
+			break
+		}
+		log.Debug().Int("conflicts", conflicts).Int("attempt", attempt+1).Msg("retrying the visibility update")
+	}
+	if updated > 0 {
+		e.updateCachedVisibility(namespace, applicationName)
 	}
+	if conflicts > 0 {
+		return updated, nerrors.NewAbortedError("unable to update the visibility of %d tags changed by other requests, retry later", conflicts)
+	}
+	return updated, nil
+}
 
-	// convert the metadata to JSON
-	metadataJSON, err := json.Marshal(data)
+// updateCachedVisibility stores the tags of an application in the cache after their visibility changes. The whole
+// cache is refreshed if the tags cannot be retrieved.
+func (e *ElasticProvider) updateCachedVisibility(namespace string, applicationName string) {
+	tags, err := e.getApplicationTags(namespace, applicationName)
 	if err != nil {
+		log.Warn().Err(err).Str("namespace", namespace).Str("application", applicationName).
+			Msg("unable to retrieve the updated tags, refreshing the cache")
+		go e.FillCache()
+		return
+	}
+	for id, tag := range tags {
+		e.cache.Put(id, tag)
+	}
+}
+
+// IncrementDownloads adds a download to the counter of an application tag. The cache is not updated on every download, the
+// public applications are sorted by the downloads counted until the last refresh.
+func (e *ElasticProvider) IncrementDownloads(appID *entities.ApplicationID) error {
+	id := e.GenerateIDFromAppID(appID)
+	body := fmt.Sprintf(`{"script": {"source": "ctx._source.%s = (ctx._source.%s == null ? 0 : ctx._source.%s) + 1", "lang": "painless"}}`,
+		DownloadsField, DownloadsField, DownloadsField)
+
+	res, err := e.client.Update(e.indexName, id, strings.NewReader(body),
+		e.client.Update.WithContext(context.Background()),
+		e.client.Update.WithRetryOnConflict(3))
+	if err != nil {
+		log.Error().Err(err).Msg("error counting download")
+		return requestError(err, "counting the download")
+	}
+	defer res.Body.Close()
+
+	if err = e.checkElasticError(res, "counting download"); err != nil {
 		return err
 	}
-	for _, id := range ids {
-		res, err := esapi.UpdateRequest{
-			Refresh:    "true",
-			Index:      "napptive",
-			DocumentID: id,
-			Body:       bytes.NewReader([]byte(fmt.Sprintf(`{"doc":%s}`, string(metadataJSON)))),
-		}.Do(context.Background(), e.client)
-		if err != nil {
-			log.Error().Err(err).Msg("error updating metadata")
-			return err
+	return nil
+}
+
+// visibilityQuery returns the query of the applications that match any of the filters, or nil if all the
+// applications match
+func visibilityQuery(filters []*ListFilter) map[string]interface{} {
+	should := make([]interface{}, 0, len(filters))
+	for _, filter := range filters {
+		must := make([]interface{}, 0)
+		if filter != nil && filter.Namespace != nil && *filter.Namespace != "" {
+			must = append(must, map[string]interface{}{"term": map[string]interface{}{NamespaceField: *filter.Namespace}})
 		}
-		defer res.Body.Close()
+		if filter != nil && filter.Private != nil {
+			must = append(must, map[string]interface{}{"term": map[string]interface{}{PrivateField: *filter.Private}})
+		}
+		if len(must) == 0 {
+			// the filter matches all the applications
+			return nil
+		}
+		should = append(should, map[string]interface{}{"bool": map[string]interface{}{"must": must}})
+	}
+	if len(should) == 0 {
+		return nil
+	}
+	return map[string]interface{}{
+		"bool": map[string]interface{}{"should": should, "minimum_should_match": 1},
+	}
+}
 
-		if err = e.checkElasticError(res, "updating visibility"); err != nil {
-			return err
+// facetFields with the fields of each facet filter
+func facetFields(facets *entities.FacetFilter) map[string][]string {
+	return map[string][]string{
+		KeywordsField: facets.Keywords,
+		LicenseField:  facets.Licenses,
+		TraitsField:   facets.Traits,
+		ScopesField:   facets.Scopes,
+		K8sKindsField: facets.K8sKinds,
+	}
+}
+
+// textQuery returns the query of the applications that contain a text. The text must be found in the application
+// name or, with all its terms, across the metadata name, the description, the metadata and the readme.
+func textQuery(text string) map[string]interface{} {
+	text = strings.ToLower(strings.TrimSpace(text))
+	wildcard := strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`).Replace(text)
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"should": []interface{}{
+				map[string]interface{}{
+					"multi_match": map[string]interface{}{
+						"query":    text,
+						"type":     "cross_fields",
+						"operator": "and",
+						"fields":   []string{MetadataNameField + "^3", DescriptionField + "^2", MetadataField, ReadmeField},
+					},
+				},
+				map[string]interface{}{
+					"wildcard": map[string]interface{}{
+						ApplicationField: map[string]interface{}{
+							"value":            fmt.Sprintf("*%s*", wildcard),
+							"case_insensitive": true,
+							"boost":            4,
+						},
+					},
+				},
+			},
+			"minimum_should_match": 1,
+		},
+	}
+}
+
+// searchQuery returns the body of a search request. The applications are filtered by visibility and facets, and
+// the number of tags per facet value is returned in the aggregations. If there is no text, all the applications
+// match and they are sorted by namespace and application name.
+/*
+curl -X GET "localhost:9200/napptive/_search?pretty" -H 'Content-Type: application/json' -d'
+
+	{
+	  "query": {
+	    "bool" : {
+	      "must" : <text query>,
+	      "filter": [ <visibility filters>, { "terms": { "Keywords": [<keyword>] } }, ... ]
+	    }
+	  },
+	  "aggs": { "Keywords": { "terms": { "field": "Keywords", "size": 50 } }, ... },
+	  "highlight": { "fields": { "ApplicationName": {}, "MetadataName": {}, "Metadata": {}, "Readme": {} } }
+	}
+
+'
+*/
+func searchQuery(request *SearchRequest) map[string]interface{} {
+	boolQuery := map[string]interface{}{}
+	if len(searchTerms(request.Text)) > 0 {
+		boolQuery["must"] = textQuery(request.Text)
+	}
+	filters := make([]interface{}, 0)
+	if filter := visibilityQuery(request.Filters); filter != nil {
+		filters = append(filters, filter)
+	}
+	if !request.Facets.IsEmpty() {
+		for field, values := range facetFields(request.Facets) {
+			if len(values) > 0 {
+				filters = append(filters, map[string]interface{}{"terms": map[string]interface{}{field: values}})
+			}
 		}
 	}
+	if len(filters) > 0 {
+		boolQuery["filter"] = filters
+	}
 
-	// update the cache
-	e.invalidateCacheChan <- true
+	aggregations := make(map[string]interface{})
+	for field := range facetFields(&entities.FacetFilter{}) {
+		aggregations[field] = map[string]interface{}{
+			"terms": map[string]interface{}{"field": field, "size": maxFacetValues},
+		}
+	}
+	highlightFields := make(map[string]interface{}, len(searchFields))
+	for _, field := range searchFields {
+		highlightFields[field.name] = map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"query": map[string]interface{}{"bool": boolQuery},
+		"aggs":  aggregations,
+		"highlight": map[string]interface{}{
+			"pre_tags":            []string{highlightPreTag},
+			"post_tags":           []string{highlightPostTag},
+			"fragment_size":       highlightFragmentSize,
+			"number_of_fragments": 1,
+			"fields":              highlightFields,
+		},
+	}
+}
 
-	return nil
+// facetCounts returns the counts of a terms aggregation
+func facetCounts(aggregation termsAggregation) []*entities.FacetCount {
+	counts := make([]*entities.FacetCount, 0, len(aggregation.Buckets))
+	for _, bucket := range aggregation.Buckets {
+		counts = append(counts, &entities.FacetCount{Value: bucket.Key, Count: bucket.DocCount})
+	}
+	return counts
+}
+
+// Search returns the applications that contain the text in their names, metadata or readme sorted by relevance.
+// The most relevant tags are grouped by application, so an application is as relevant as its best tag.
+func (e *ElasticProvider) Search(request *SearchRequest) (*entities.SearchResult, error) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(searchQuery(request)); err != nil {
+		log.Err(err).Msg("Error encoding search query")
+		return nil, nerrors.NewInternalErrorFrom(err, "error creating search query")
+	}
+
+	searchFunctions := []func(*esapi.SearchRequest){
+		e.client.Search.WithContext(context.Background()),
+		e.client.Search.WithIndex(e.indexName),
+		e.client.Search.WithSize(maxSearchDocuments),
+		e.client.Search.WithSourceIncludes(NamespaceField, ApplicationField, TagField, MetadataNameField, MetadataField, PrivateField),
+		e.client.Search.WithBody(&buf),
+	}
+	if len(searchTerms(request.Text)) == 0 {
+		// all the documents have the same score
+		searchFunctions = append(searchFunctions, e.client.Search.WithSort(NamespaceField, ApplicationField, TagField))
+	}
+
+	res, err := e.client.Search(searchFunctions...)
+	if err != nil {
+		log.Err(err).Msg("Error getting response")
+		return nil, requestError(err, "searching the applications")
+	}
+	defer res.Body.Close()
+
+	if err = e.checkElasticError(res, "searching"); err != nil {
+		return nil, err
+	}
+
+	var r responseWrapper
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return nil, nerrors.FromError(err)
+	}
+	log.Debug().Str("text", request.Text).Str("Status", res.Status()).Int("total", r.Hits.Total.Value).Int("took(ms)", r.Took).Msg("Search operation")
+
+	matches := make([]*searchMatch, 0, len(r.Hits.Hits))
+	for _, hit := range r.Hits.Hits {
+		var application entities.ApplicationInfo
+		if err := json.Unmarshal(hit.Source, &application); err != nil {
+			return nil, nerrors.NewInternalErrorFrom(err, "error unmarshalling application metadata")
+		}
+		highlights := make(map[string][]string)
+		if len(hit.Highlights) > 0 {
+			if err := json.Unmarshal(hit.Highlights, &highlights); err != nil {
+				return nil, nerrors.NewInternalErrorFrom(err, "error unmarshalling search highlights")
+			}
+		}
+		matches = append(matches, &searchMatch{application: &application, score: hit.Score, highlights: highlights})
+	}
+	result := buildSearchResult(matches, request.From, request.Size)
+	// the aggregations count all the matching documents, but only the most relevant ones are grouped
+	result.Truncated = r.Hits.Total.Value > len(r.Hits.Hits)
+	result.Facets = &entities.Facets{
+		Keywords: facetCounts(r.Aggregations[KeywordsField]),
+		Licenses: facetCounts(r.Aggregations[LicenseField]),
+		Traits:   facetCounts(r.Aggregations[TraitsField]),
+		Scopes:   facetCounts(r.Aggregations[ScopesField]),
+		K8sKinds: facetCounts(r.Aggregations[K8sKindsField]),
+	}
+	return result, nil
 }
@@ -0,0 +1,253 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metadata
+
+import (
+	"sync"
+
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/nerrors/pkg/nerrors"
+)
+
+// matches checks if an application matches the filter, an empty namespace does not filter the applications
+func (f *ListFilter) matches(application *entities.ApplicationInfo) bool {
+	if f == nil {
+		return true
+	}
+	if f.Namespace != nil && *f.Namespace != "" && *f.Namespace != application.Namespace {
+		return false
+	}
+	if f.Private != nil && *f.Private != application.Private {
+		return false
+	}
+	return true
+}
+
+// MemoryProvider stores the application metadata in memory, so the metadata is lost when the service stops.
+// It behaves as the ElasticProvider, but the summary of the public applications is always up to date.
+type MemoryProvider struct {
+	// documents with the application metadata indexed by document identifier
+	documents map[string]*entities.ApplicationInfo
+	// authEnable with a flag to indicate if the authorization is enabled
+	authEnable bool
+	// Mutex to protect the documents
+	sync.Mutex
+}
+
+// NewMemoryProvider returns an empty MemoryProvider
+func NewMemoryProvider(authEnable bool) *MemoryProvider {
+	return &MemoryProvider{documents: make(map[string]*entities.ApplicationInfo), authEnable: authEnable}
+}
+
+// Clear removes all the metadata
+func (m *MemoryProvider) Clear() {
+	m.Lock()
+	defer m.Unlock()
+	m.documents = make(map[string]*entities.ApplicationInfo)
+}
+
+// list returns a copy of the applications that match the filter sorted by namespace, application name and tag.
+// The caller must hold the lock.
+func (m *MemoryProvider) list(filter *ListFilter) []*entities.ApplicationInfo {
+	applications := make([]*entities.ApplicationInfo, 0)
+	for _, document := range m.documents {
+		if filter.matches(document) {
+			application := *document
+			applications = append(applications, &application)
+		}
+	}
+	sortApplications(applications)
+	return applications
+}
+
+// listApplication returns the tags of an application. The caller must hold the lock.
+func (m *MemoryProvider) listApplication(namespace string, applicationName string) []*entities.ApplicationInfo {
+	tags := make([]*entities.ApplicationInfo, 0)
+	for _, application := range m.list(&ListFilter{Namespace: &namespace}) {
+		if application.ApplicationName == applicationName {
+			tags = append(tags, application)
+		}
+	}
+	return tags
+}
+
+// Add stores new application metadata or updates it if it exists
+func (m *MemoryProvider) Add(metadata *entities.ApplicationInfo) (*entities.ApplicationInfo, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	// Fill Internal ID
+	metadata.CatalogID = generateCatalogID(metadata.Namespace, metadata.ApplicationName, metadata.Tag)
+	stored := *metadata
+	m.documents[generateDocumentID(metadata.Namespace, metadata.ApplicationName, metadata.Tag)] = &stored
+	return metadata, nil
+}
+
+// Get returns the application metadata requested or an error if it does not exist
+func (m *MemoryProvider) Get(appID *entities.ApplicationID) (*entities.ApplicationInfo, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	document, exists := m.documents[generateDocumentID(appID.Namespace, appID.ApplicationName, appID.Tag)]
+	if !exists {
+		return nil, nerrors.NewNotFoundError("Error getting application: [application not found]")
+	}
+	application := *document
+	return &application, nil
+}
+
+// Exists checks if an application metadata exists
+func (m *MemoryProvider) Exists(appID *entities.ApplicationID) (bool, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	_, exists := m.documents[generateDocumentID(appID.Namespace, appID.ApplicationName, appID.Tag)]
+	return exists, nil
+}
+
+// Remove removes an application metadata
+func (m *MemoryProvider) Remove(appID *entities.ApplicationID) error {
+	return m.RemoveDocument(generateDocumentID(appID.Namespace, appID.ApplicationName, appID.Tag))
+}
+
+// RemoveDocument removes a document by its internal identifier
+func (m *MemoryProvider) RemoveDocument(id string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if _, exists := m.documents[id]; !exists {
+		return nerrors.NewNotFoundError("Error removing application: [application not found]")
+	}
+	delete(m.documents, id)
+	return nil
+}
+
+// List returns the applications stored (public and privates)
+func (m *MemoryProvider) List(namespace string) ([]*entities.ApplicationInfo, error) {
+	m.Lock()
+	defer m.Unlock()
+	return m.list(&ListFilter{Namespace: &namespace}), nil
+}
+
+// ListDocuments returns all the documents stored, all of them are valid application metadata
+func (m *MemoryProvider) ListDocuments() ([]*Document, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	documents := make([]*Document, 0, len(m.documents))
+	for _, application := range m.list(nil) {
+		documents = append(documents, &Document{
+			ID:          generateDocumentID(application.Namespace, application.ApplicationName, application.Tag),
+			Application: application,
+		})
+	}
+	return documents, nil
+}
+
+// summarize returns the summary of the applications that match the filter. The caller must hold the lock.
+func (m *MemoryProvider) summarize(filter *ListFilter) ([]*entities.AppSummary, *entities.Summary) {
+	builder := newSummaryBuilder()
+	for _, application := range m.list(filter) {
+		builder.Add(application)
+	}
+	return builder.Build()
+}
+
+// GetSummary returns the catalog summary (public apps summary)
+func (m *MemoryProvider) GetSummary() (*entities.Summary, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	_, summary := m.summarize(getCacheFilter(m.authEnable))
+	return summary, nil
+}
+
+// ListSummaryWithFilter returns the requested page of the summaries of the applications that match a filter. As in
+// the ElasticProvider, the applications of the catalog summary are returned when the filter requests the public
+// applications of all the namespaces. The summaries of all the applications are sorted and sliced in memory.
+func (m *MemoryProvider) ListSummaryWithFilter(filter *ListFilter, page *entities.PageRequest) (*entities.ApplicationPage, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	summaryList, _ := m.summarize(getSummaryFilter(filter, m.authEnable))
+	return PageSummaries(summaryList, page)
+}
+
+// ListTags returns the tags of an application sorted by name, it is empty if the application does not exist
+func (m *MemoryProvider) ListTags(namespace string, applicationName string) ([]string, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	// the applications are listed sorted by tag
+	tags := make([]string, 0)
+	for _, application := range m.listApplication(namespace, applicationName) {
+		tags = append(tags, application.Tag)
+	}
+	return tags, nil
+}
+
+// GetApplicationVisibility returns the application visibility or error if the application does not exist
+func (m *MemoryProvider) GetApplicationVisibility(namespace string, applicationName string) (*bool, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	tags := m.listApplication(namespace, applicationName)
+	if len(tags) == 0 {
+		return nil, nerrors.NewNotFoundError("application not found")
+	}
+	return &tags[0].Private, nil
+}
+
+// UpdateApplicationVisibility changes the visibility of all the tags of an application
+func (m *MemoryProvider) UpdateApplicationVisibility(namespace string, applicationName string, isPrivate bool) (int, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	tags := m.listApplication(namespace, applicationName)
+	if len(tags) == 0 {
+		return 0, nerrors.NewNotFoundError("unable to update application visibility. Application not found")
+	}
+	updated := 0
+	for _, tag := range tags {
+		document := m.documents[generateDocumentID(tag.Namespace, tag.ApplicationName, tag.Tag)]
+		if document.Private != isPrivate {
+			document.Private = isPrivate
+			updated++
+		}
+	}
+	return updated, nil
+}
+
+// IncrementDownloads adds a download to the counter of an application tag
+func (m *MemoryProvider) IncrementDownloads(appID *entities.ApplicationID) error {
+	m.Lock()
+	defer m.Unlock()
+
+	document, exists := m.documents[generateDocumentID(appID.Namespace, appID.ApplicationName, appID.Tag)]
+	if !exists {
+		return nerrors.NewNotFoundError("Error counting download: [application not found]")
+	}
+	document.Downloads++
+	return nil
+}
+
+// Search returns the applications that contain the text in their names, metadata or readme sorted by relevance
+func (m *MemoryProvider) Search(request *SearchRequest) (*entities.SearchResult, error) {
+	m.Lock()
+	defer m.Unlock()
+	return searchApplications(m.list(nil), request), nil
+}
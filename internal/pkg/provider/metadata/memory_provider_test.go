@@ -0,0 +1,94 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metadata
+
+import (
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/catalog-manager/internal/pkg/utils"
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Memory provider test", func() {
+
+	provider := NewMemoryProvider(false)
+
+	ginkgo.AfterEach(func() {
+		provider.Clear()
+	})
+
+	RunTests(provider)
+
+	ginkgo.Context("Changing the visibility", func() {
+		ginkgo.It("should change the visibility of all the tags", func() {
+			app := utils.CreateTestApplicationInfo()
+			for _, tag := range []string{"v1", "v2"} {
+				app.Tag = tag
+				_, err := provider.Add(app)
+				gomega.Expect(err).Should(gomega.Succeed())
+			}
+
+			updated, err := provider.UpdateApplicationVisibility(app.Namespace, app.ApplicationName, true)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(updated).Should(gomega.Equal(2))
+			private, err := provider.GetApplicationVisibility(app.Namespace, app.ApplicationName)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(*private).Should(gomega.BeTrue())
+			applications, err := provider.List(app.Namespace)
+			gomega.Expect(err).Should(gomega.Succeed())
+			for _, application := range applications {
+				gomega.Expect(application.Private).Should(gomega.BeTrue())
+			}
+		})
+
+		ginkgo.It("should not change the visibility of a missing application", func() {
+			_, err := provider.UpdateApplicationVisibility("namespace", "missing", true)
+			gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.NotFound))
+			_, err = provider.GetApplicationVisibility("namespace", "missing")
+			gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.NotFound))
+		})
+	})
+
+	ginkgo.Context("Listing the summary with authorization", func() {
+		authProvider := NewMemoryProvider(true)
+
+		ginkgo.It("should only include the public applications in the catalog summary", func() {
+			public := utils.CreateTestApplicationInfo()
+			private := utils.CreateTestApplicationInfo()
+			private.Private = true
+			for _, app := range []*entities.ApplicationInfo{public, private} {
+				_, err := authProvider.Add(app)
+				gomega.Expect(err).Should(gomega.Succeed())
+			}
+
+			summaryList, err := authProvider.ListSummaryWithFilter(&ListFilter{}, nil)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(len(summaryList.Applications)).Should(gomega.Equal(1))
+			gomega.Expect(summaryList.Applications[0].ApplicationName).Should(gomega.Equal(public.ApplicationName))
+			summary, err := authProvider.GetSummary()
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(summary.NumTags).Should(gomega.Equal(1))
+
+			isPrivate := true
+			summaryList, err = authProvider.ListSummaryWithFilter(&ListFilter{Namespace: &private.Namespace, Private: &isPrivate}, nil)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(len(summaryList.Applications)).Should(gomega.Equal(1))
+			gomega.Expect(summaryList.Applications[0].ApplicationName).Should(gomega.Equal(private.ApplicationName))
+		})
+	})
+})
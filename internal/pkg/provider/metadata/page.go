@@ -0,0 +1,199 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metadata
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/nerrors/pkg/nerrors"
+)
+
+// pageToken with the sort values of the last application of a page. The next page starts after them, so the
+// pages do not skip or repeat applications when the list changes between requests.
+type pageToken struct {
+	// Sort with the order of the list
+	Sort entities.ListSort `json:"s"`
+	// Namespace with the namespace of the last application
+	Namespace string `json:"n"`
+	// ApplicationName with the name of the last application
+	ApplicationName string `json:"a"`
+	// LastUpdated with the last update of the last application
+	LastUpdated time.Time `json:"u"`
+	// Downloads with the downloads of the last application
+	Downloads int64 `json:"d"`
+}
+
+// encodePageToken returns the token of the page that starts after the application
+func encodePageToken(order entities.ListSort, last *entities.AppSummary) string {
+	data, _ := json.Marshal(&pageToken{
+		Sort:            order,
+		Namespace:       last.Namespace,
+		ApplicationName: last.ApplicationName,
+		LastUpdated:     last.LastUpdated,
+		Downloads:       last.Downloads,
+	})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodePageToken returns the application a page starts after, the token must have been created with the same order
+func decodePageToken(order entities.ListSort, token string) (*entities.AppSummary, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, nerrors.NewInvalidArgumentError("invalid page token")
+	}
+	var decoded pageToken
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, nerrors.NewInvalidArgumentError("invalid page token")
+	}
+	if decoded.Sort != order {
+		return nil, nerrors.NewInvalidArgumentError("the page token was created for the %s order", decoded.Sort)
+	}
+	return &entities.AppSummary{
+		Namespace:       decoded.Namespace,
+		ApplicationName: decoded.ApplicationName,
+		LastUpdated:     decoded.LastUpdated,
+		Downloads:       decoded.Downloads,
+	}, nil
+}
+
+// summaryLess returns the function that compares two applications in an order. The applications are
+// identified by their namespace and name, so the order is total. The update times are compared with millisecond
+// precision, the one of the dates stored in elastic, so all the providers sort the applications in the same way.
+func summaryLess(order entities.ListSort) func(a, b *entities.AppSummary) bool {
+	byNamespace := func(a, b *entities.AppSummary) bool {
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.ApplicationName < b.ApplicationName
+	}
+	switch order {
+	case entities.ListSortName:
+		return func(a, b *entities.AppSummary) bool {
+			if a.ApplicationName != b.ApplicationName {
+				return a.ApplicationName < b.ApplicationName
+			}
+			return a.Namespace < b.Namespace
+		}
+	case entities.ListSortLastUpdated:
+		return func(a, b *entities.AppSummary) bool {
+			aUpdated, bUpdated := a.LastUpdated.Truncate(time.Millisecond), b.LastUpdated.Truncate(time.Millisecond)
+			if !aUpdated.Equal(bUpdated) {
+				return aUpdated.After(bUpdated)
+			}
+			return byNamespace(a, b)
+		}
+	case entities.ListSortPopularity:
+		return func(a, b *entities.AppSummary) bool {
+			if a.Downloads != b.Downloads {
+				return a.Downloads > b.Downloads
+			}
+			return byNamespace(a, b)
+		}
+	}
+	return byNamespace
+}
+
+// pageQuery with a validated page request
+type pageQuery struct {
+	// order with the order of the list
+	order entities.ListSort
+	// after with the application the page starts after, nil for the first page
+	after *entities.AppSummary
+	// size with the maximum number of applications of the page, 0 for all of them
+	size int
+	// less compares two applications in the order of the list
+	less func(a, b *entities.AppSummary) bool
+}
+
+// newPageQuery validates a page request, all the applications sorted by namespace are requested if it is nil
+func newPageQuery(request *entities.PageRequest) (*pageQuery, error) {
+	if request == nil {
+		request = &entities.PageRequest{}
+	}
+	if request.PageSize < 0 {
+		return nil, nerrors.NewInvalidArgumentError("page size must not be negative")
+	}
+	order, err := entities.ParseListSort(string(request.Sort))
+	if err != nil {
+		return nil, err
+	}
+	query := &pageQuery{order: order, size: request.PageSize, less: summaryLess(order)}
+	if request.PageToken != "" {
+		if query.after, err = decodePageToken(order, request.PageToken); err != nil {
+			return nil, err
+		}
+	}
+	return query, nil
+}
+
+// includes checks if an application is sorted after the one the page starts after
+func (q *pageQuery) includes(summary *entities.AppSummary) bool {
+	return q.after == nil || q.less(q.after, summary)
+}
+
+// page sorts the summaries and returns the page with the ones after the token. There is a next page if more
+// summaries than the page size are received, or if more is set because some of them were not read.
+func (q *pageQuery) page(summaries []*entities.AppSummary, more bool) *entities.ApplicationPage {
+	sorted := make([]*entities.AppSummary, 0, len(summaries))
+	for _, summary := range summaries {
+		if q.includes(summary) {
+			sorted = append(sorted, summary)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return q.less(sorted[i], sorted[j])
+	})
+
+	page := &entities.ApplicationPage{Applications: sorted}
+	if q.size > 0 && len(sorted) > q.size {
+		page.Applications = sorted[:q.size]
+		more = true
+	}
+	if more && len(page.Applications) > 0 {
+		page.NextPageToken = encodePageToken(q.order, page.Applications[len(page.Applications)-1])
+	}
+	return page
+}
+
+// PageSummaries sorts the application summaries and returns the requested page, the summaries received are not modified
+func PageSummaries(summaries []*entities.AppSummary, request *entities.PageRequest) (*entities.ApplicationPage, error) {
+	query, err := newPageQuery(request)
+	if err != nil {
+		return nil, err
+	}
+	return query.page(summaries, false), nil
+}
+
+// MergePages returns the requested page of the union of several lists, given the same page of each of them. As the
+// token points after the last application returned, the next page of the union is made of the next pages of the lists.
+func MergePages(request *entities.PageRequest, pages ...*entities.ApplicationPage) (*entities.ApplicationPage, error) {
+	query, err := newPageQuery(request)
+	if err != nil {
+		return nil, err
+	}
+	summaries := make([]*entities.AppSummary, 0)
+	more := false
+	for _, page := range pages {
+		summaries = append(summaries, page.Applications...)
+		more = more || page.NextPageToken != ""
+	}
+	return query.page(summaries, more), nil
+}
@@ -0,0 +1,128 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metadata
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Paging application summaries", func() {
+	now := time.Now().UTC()
+	summaries := []*entities.AppSummary{
+		{Namespace: "ns2", ApplicationName: "app1", LastUpdated: now.Add(-time.Hour), Downloads: 5},
+		{Namespace: "ns1", ApplicationName: "app2", LastUpdated: now, Downloads: 1},
+		{Namespace: "ns1", ApplicationName: "app1", LastUpdated: now.Add(-2 * time.Hour), Downloads: 5},
+		{Namespace: "ns3", ApplicationName: "app0", LastUpdated: now.Add(-time.Hour), Downloads: 0},
+	}
+
+	names := func(page *entities.ApplicationPage) []string {
+		result := make([]string, 0, len(page.Applications))
+		for _, app := range page.Applications {
+			result = append(result, app.Namespace+"/"+app.ApplicationName)
+		}
+		return result
+	}
+
+	// readAll returns the applications of all the pages
+	readAll := func(order entities.ListSort, size int) []string {
+		result := make([]string, 0)
+		request := &entities.PageRequest{Sort: order, PageSize: size}
+		for {
+			page, err := PageSummaries(summaries, request)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(len(page.Applications)).Should(gomega.BeNumerically("<=", size))
+			result = append(result, names(page)...)
+			if page.NextPageToken == "" {
+				return result
+			}
+			request.PageToken = page.NextPageToken
+		}
+	}
+
+	ginkgo.It("should sort all the applications by namespace if no page is requested", func() {
+		page, err := PageSummaries(summaries, nil)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(names(page)).Should(gomega.Equal([]string{"ns1/app1", "ns1/app2", "ns2/app1", "ns3/app0"}))
+		gomega.Expect(page.NextPageToken).Should(gomega.BeEmpty())
+	})
+
+	for order, expected := range map[entities.ListSort][]string{
+		entities.ListSortName:        {"ns3/app0", "ns1/app1", "ns2/app1", "ns1/app2"},
+		entities.ListSortNamespace:   {"ns1/app1", "ns1/app2", "ns2/app1", "ns3/app0"},
+		entities.ListSortLastUpdated: {"ns1/app2", "ns2/app1", "ns3/app0", "ns1/app1"},
+		entities.ListSortPopularity:  {"ns1/app1", "ns2/app1", "ns1/app2", "ns3/app0"},
+	} {
+		order, expected := order, expected
+		ginkgo.It(fmt.Sprintf("should return every application once sorted by %s", order), func() {
+			gomega.Expect(readAll(order, 3)).Should(gomega.Equal(expected))
+			gomega.Expect(readAll(order, 1)).Should(gomega.Equal(expected))
+		})
+	}
+
+	ginkgo.It("should not skip applications if the list changes between pages", func() {
+		first, err := PageSummaries(summaries, &entities.PageRequest{PageSize: 2})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(names(first)).Should(gomega.Equal([]string{"ns1/app1", "ns1/app2"}))
+
+		changed := append([]*entities.AppSummary{{Namespace: "ns0", ApplicationName: "new"}}, summaries[1:]...)
+		second, err := PageSummaries(changed, &entities.PageRequest{PageSize: 2, PageToken: first.NextPageToken})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(names(second)).Should(gomega.Equal([]string{"ns3/app0"}))
+	})
+
+	ginkgo.It("should return a next page if any of the merged lists has more applications", func() {
+		request := &entities.PageRequest{PageSize: 3}
+		first, err := PageSummaries(summaries[:2], request)
+		gomega.Expect(err).Should(gomega.Succeed())
+		second := &entities.ApplicationPage{Applications: summaries[2:3], NextPageToken: "more applications"}
+
+		merged, err := MergePages(request, first, second)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(names(merged)).Should(gomega.Equal([]string{"ns1/app1", "ns1/app2", "ns2/app1"}))
+		gomega.Expect(merged.NextPageToken).ShouldNot(gomega.BeEmpty())
+
+		request.PageToken = merged.NextPageToken
+		next, err := MergePages(request, &entities.ApplicationPage{Applications: summaries[3:]})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(names(next)).Should(gomega.Equal([]string{"ns3/app0"}))
+		gomega.Expect(next.NextPageToken).Should(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should not accept a token of a different order", func() {
+		page, err := PageSummaries(summaries, &entities.PageRequest{Sort: entities.ListSortName, PageSize: 1})
+		gomega.Expect(err).Should(gomega.Succeed())
+		_, err = PageSummaries(summaries, &entities.PageRequest{Sort: entities.ListSortPopularity, PageToken: page.NextPageToken})
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.InvalidArgument))
+	})
+
+	ginkgo.It("should not accept an invalid token, order or page size", func() {
+		for _, request := range []*entities.PageRequest{
+			{PageToken: "not a token"},
+			{Sort: "size"},
+			{PageSize: -1},
+		} {
+			_, err := PageSummaries(summaries, request)
+			gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.InvalidArgument))
+		}
+	})
+})
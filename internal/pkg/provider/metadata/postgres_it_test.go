@@ -0,0 +1,112 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+/*
+1.- environment variable:
+RUN_INTEGRATION_TEST=all
+RUN_INTEGRATION_TEST=postgresprovider
+
+2.- run a postgres container
+docker run -d --name local-postgres -e POSTGRES_PASSWORD=Pass2020! -p 5432:5432 postgres:13-alpine
+docker exec -it local-postgres psql -h localhost -U postgres -d postgres -p 5432
+
+3.- create the schema and table
+CREATE SCHEMA IF NOT EXISTS catalog;
+CREATE TABLE IF NOT EXISTS catalog.applications (
+	id VARCHAR(32) PRIMARY KEY NOT NULL,
+	catalog_id TEXT NOT NULL,
+	namespace VARCHAR(256) NOT NULL,
+	application_name VARCHAR(256) NOT NULL,
+	tag VARCHAR(256) NOT NULL,
+	readme TEXT NOT NULL,
+	metadata TEXT NOT NULL,
+	metadata_name VARCHAR(256) NOT NULL,
+	private BOOLEAN NOT NULL,
+	last_updated TIMESTAMPTZ NOT NULL DEFAULT to_timestamp(0),
+	downloads BIGINT NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS applications_namespace_idx ON catalog.applications (namespace, application_name, tag);
+ALTER TABLE catalog.applications ADD COLUMN IF NOT EXISTS last_updated TIMESTAMPTZ NOT NULL DEFAULT to_timestamp(0);
+ALTER TABLE catalog.applications ADD COLUMN IF NOT EXISTS downloads BIGINT NOT NULL DEFAULT 0;
+*/
+
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/napptive/catalog-manager/internal/pkg/utils"
+	"github.com/napptive/rdbms/v2/pkg/rdbms"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog/log"
+)
+
+var _ = ginkgo.Describe("Postgres Provider test", func() {
+
+	if !utils.RunIntegrationTests("postgresprovider") {
+		log.Warn().Msg("postgres provider tests are skipped")
+		return
+	}
+
+	var connString = "host=localhost user=postgres password=Pass2020! port=5432"
+
+	conn, err := rdbms.NewRDBMS().PoolConnect(context.Background(), connString)
+	gomega.Expect(err).Should(gomega.Succeed())
+
+	provider := NewPostgresProvider(conn, time.Second*25, false)
+	gomega.Expect(provider).ShouldNot(gomega.BeNil())
+
+	// empty the table
+	ginkgo.AfterEach(func() {
+		documents, err := provider.ListDocuments()
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		for _, document := range documents {
+			err = provider.RemoveDocument(document.ID)
+			gomega.Expect(err).Should(gomega.Succeed())
+		}
+	})
+
+	RunTests(provider)
+
+	ginkgo.Context("Searching more applications than the considered rows", func() {
+		ginkgo.It("Should return the most relevant applications and mark the result as truncated", func() {
+			for i := 0; i <= maxSearchDocuments; i++ {
+				app := utils.CreateTestApplicationInfo()
+				app.Namespace = "first"
+				app.ApplicationName = fmt.Sprintf("app-%04d", i)
+				app.Readme = "A WordPress installation"
+				_, err := provider.Add(app)
+				gomega.Expect(err).Should(gomega.Succeed())
+			}
+			best := utils.CreateTestApplicationInfo()
+			best.Namespace = "last"
+			best.ApplicationName = "wordpress"
+			_, err := provider.Add(best)
+			gomega.Expect(err).Should(gomega.Succeed())
+
+			result, err := provider.Search(&SearchRequest{Text: "wordpress"})
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(result.Truncated).Should(gomega.BeTrue())
+			gomega.Expect(result.Hits[0].Application.Namespace).Should(gomega.Equal(best.Namespace))
+			gomega.Expect(result.Hits[0].Application.ApplicationName).Should(gomega.Equal(best.ApplicationName))
+		})
+	})
+
+})
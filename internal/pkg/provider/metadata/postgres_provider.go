@@ -0,0 +1,572 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metadata
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	// the postgres dialect generates the prepared statements with numbered placeholders
+	_ "github.com/doug-martin/goqu/v9/dialect/postgres"
+	"github.com/doug-martin/goqu/v9/exp"
+	"github.com/jackc/pgx/v4"
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/napptive/rdbms/v2/pkg/rdbms"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	Schema                string = "catalog"
+	ApplicationTable      string = "applications"
+	IDColumn              string = "id"
+	CatalogIDColumn       string = "catalog_id"
+	NamespaceColumn       string = "namespace"
+	ApplicationNameColumn string = "application_name"
+	TagColumn             string = "tag"
+	ReadmeColumn          string = "readme"
+	MetadataColumn        string = "metadata"
+	MetadataNameColumn    string = "metadata_name"
+	PrivateColumn         string = "private"
+	LastUpdatedColumn     string = "last_updated"
+	DownloadsColumn       string = "downloads"
+)
+
+// postgresDialect with the SQL dialect of the queries
+var postgresDialect = goqu.Dialect("postgres")
+
+// applicationColumns with the columns of an entities.ApplicationInfo in the order they are scanned
+var applicationColumns = []interface{}{CatalogIDColumn, NamespaceColumn, ApplicationNameColumn, TagColumn,
+	ReadmeColumn, MetadataColumn, MetadataNameColumn, PrivateColumn, LastUpdatedColumn, DownloadsColumn}
+
+// PostgresProvider stores the application metadata in the catalog.applications table of PostgreSQL,
+// one row per application tag. The summaries are computed from the table, so they are always up to date.
+type PostgresProvider struct {
+	conn    rdbms.Conn
+	timeout time.Duration
+	// authEnable with a flag to indicate if the authorization is enabled
+	authEnable bool
+}
+
+// NewPostgresProvider returns a new PostgresProvider
+func NewPostgresProvider(conn rdbms.Conn, timeout time.Duration, authEnable bool) *PostgresProvider {
+	return &PostgresProvider{
+		conn:       conn,
+		timeout:    timeout,
+		authEnable: authEnable,
+	}
+}
+
+// table returns the application table
+func (p *PostgresProvider) table() exp.IdentifierExpression {
+	return goqu.T(ApplicationTable).Schema(Schema)
+}
+
+// filterExpression returns the conditions of a ListFilter, an empty namespace does not filter the applications
+func filterExpression(filter *ListFilter) goqu.Ex {
+	where := goqu.Ex{}
+	if filter == nil {
+		return where
+	}
+	if filter.Namespace != nil && *filter.Namespace != "" {
+		where[NamespaceColumn] = *filter.Namespace
+	}
+	if filter.Private != nil {
+		where[PrivateColumn] = *filter.Private
+	}
+	return where
+}
+
+// scanApplication reads an application from a row with the applicationColumns
+func scanApplication(row pgx.Row) (*entities.ApplicationInfo, error) {
+	application := &entities.ApplicationInfo{}
+	err := row.Scan(&application.CatalogID, &application.Namespace, &application.ApplicationName, &application.Tag,
+		&application.Readme, &application.Metadata, &application.MetadataName, &application.Private,
+		&application.LastUpdated, &application.Downloads)
+	if err != nil {
+		return nil, err
+	}
+	application.LastUpdated = application.LastUpdated.UTC()
+	return application, nil
+}
+
+// Add stores new application metadata or updates it if it exists
+func (p *PostgresProvider) Add(metadata *entities.ApplicationInfo) (*entities.ApplicationInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	// Fill Internal ID
+	metadata.CatalogID = generateCatalogID(metadata.Namespace, metadata.ApplicationName, metadata.Tag)
+	record := goqu.Record{
+		CatalogIDColumn:       metadata.CatalogID,
+		NamespaceColumn:       metadata.Namespace,
+		ApplicationNameColumn: metadata.ApplicationName,
+		TagColumn:             metadata.Tag,
+		ReadmeColumn:          metadata.Readme,
+		MetadataColumn:        metadata.Metadata,
+		MetadataNameColumn:    metadata.MetadataName,
+		PrivateColumn:         metadata.Private,
+		LastUpdatedColumn:     metadata.LastUpdated,
+		DownloadsColumn:       metadata.Downloads,
+	}
+	insert := goqu.Record{IDColumn: generateDocumentID(metadata.Namespace, metadata.ApplicationName, metadata.Tag)}
+	for column, value := range record {
+		insert[column] = value
+	}
+
+	sql, args, err := postgresDialect.Insert(p.table()).Prepared(true).Rows(insert).
+		OnConflict(goqu.DoUpdate(IDColumn, record)).ToSQL()
+	if err != nil {
+		log.Err(err).Msg("error inserting application")
+		return nil, nerrors.NewInternalErrorFrom(err, "Error adding application [%s]", metadata.CatalogID)
+	}
+	if _, err = p.conn.Exec(ctx, sql, args...); err != nil {
+		log.Err(err).Str("catalogID", metadata.CatalogID).Msg("error executing insert application")
+		return nil, nerrors.NewInternalErrorFrom(err, "Error adding application [%s]", metadata.CatalogID)
+	}
+	return metadata, nil
+}
+
+// Get returns the application metadata requested or an error if it does not exist
+func (p *PostgresProvider) Get(appID *entities.ApplicationID) (*entities.ApplicationInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	sql, args, err := postgresDialect.From(p.table()).Prepared(true).Select(applicationColumns...).
+		Where(goqu.Ex{IDColumn: generateDocumentID(appID.Namespace, appID.ApplicationName, appID.Tag)}).ToSQL()
+	if err != nil {
+		log.Err(err).Msg("error getting application")
+		return nil, nerrors.NewInternalErrorFrom(err, "Error getting application [%s]", appID.String())
+	}
+	application, err := scanApplication(p.conn.QueryRow(ctx, sql, args...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nerrors.NewNotFoundError("Error getting application: [application not found]")
+		}
+		log.Err(err).Str("appID", appID.String()).Msg("error in scan when getting application")
+		return nil, nerrors.NewInternalErrorFrom(err, "Error getting application [%s]", appID.String())
+	}
+	return application, nil
+}
+
+// Exists checks if an application metadata exists
+func (p *PostgresProvider) Exists(appID *entities.ApplicationID) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	sql, args, err := postgresDialect.From(p.table()).Prepared(true).Select(goqu.COUNT(IDColumn)).
+		Where(goqu.Ex{IDColumn: generateDocumentID(appID.Namespace, appID.ApplicationName, appID.Tag)}).ToSQL()
+	if err != nil {
+		log.Err(err).Msg("error checking application")
+		return false, nerrors.NewInternalErrorFrom(err, "Error checking application [%s]", appID.String())
+	}
+	var count int64
+	if err = p.conn.QueryRow(ctx, sql, args...).Scan(&count); err != nil {
+		log.Err(err).Str("appID", appID.String()).Msg("error in scan when checking application")
+		return false, nerrors.NewInternalErrorFrom(err, "Error checking application [%s]", appID.String())
+	}
+	return count > 0, nil
+}
+
+// Remove removes an application metadata
+func (p *PostgresProvider) Remove(appID *entities.ApplicationID) error {
+	return p.RemoveDocument(generateDocumentID(appID.Namespace, appID.ApplicationName, appID.Tag))
+}
+
+// RemoveDocument removes a row by its identifier
+func (p *PostgresProvider) RemoveDocument(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	sql, args, err := postgresDialect.Delete(p.table()).Prepared(true).Where(goqu.Ex{IDColumn: id}).ToSQL()
+	if err != nil {
+		log.Err(err).Msg("error removing application")
+		return nerrors.NewInternalErrorFrom(err, "Error removing application [%s]", id)
+	}
+	result, err := p.conn.Exec(ctx, sql, args...)
+	if err != nil {
+		log.Err(err).Str("id", id).Msg("error executing remove application")
+		return nerrors.NewInternalErrorFrom(err, "Error removing application [%s]", id)
+	}
+	if result.RowsAffected() == 0 {
+		return nerrors.NewNotFoundError("Error removing application: [application not found]")
+	}
+	return nil
+}
+
+// list returns the applications that match the filter sorted by namespace, application name and tag
+func (p *PostgresProvider) list(filter *ListFilter) ([]*entities.ApplicationInfo, error) {
+	return p.listWhere(filterExpression(filter), 0)
+}
+
+// listWhere returns the applications that match the conditions sorted by the order expressions, and then by
+// namespace, application name and tag. The number of applications is not limited if limit is 0.
+func (p *PostgresProvider) listWhere(where exp.Expression, limit uint, order ...exp.OrderedExpression) ([]*entities.ApplicationInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	order = append(order, goqu.C(NamespaceColumn).Asc(), goqu.C(ApplicationNameColumn).Asc(), goqu.C(TagColumn).Asc())
+	query := postgresDialect.From(p.table()).Prepared(true).Select(applicationColumns...).Where(where).Order(order...)
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	sql, args, err := query.ToSQL()
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "Error listing applications")
+	}
+	rows, err := p.conn.Query(ctx, sql, args...)
+	if err != nil {
+		log.Err(err).Msg("error listing applications")
+		return nil, nerrors.NewInternalErrorFrom(err, "Error listing applications")
+	}
+	defer rows.Close()
+
+	applications := make([]*entities.ApplicationInfo, 0)
+	for rows.Next() {
+		application, err := scanApplication(rows)
+		if err != nil {
+			log.Err(err).Msg("error getting applications when listing them")
+			return nil, nerrors.NewInternalErrorFrom(err, "Error listing applications")
+		}
+		applications = append(applications, application)
+	}
+	if err = rows.Err(); err != nil {
+		log.Err(err).Msg("error listing applications")
+		return nil, nerrors.NewInternalErrorFrom(err, "Error listing applications")
+	}
+	return applications, nil
+}
+
+// List returns the applications stored (public and privates)
+func (p *PostgresProvider) List(namespace string) ([]*entities.ApplicationInfo, error) {
+	return p.list(&ListFilter{Namespace: &namespace})
+}
+
+// ListDocuments returns all the rows of the table, all of them are valid application metadata
+func (p *PostgresProvider) ListDocuments() ([]*Document, error) {
+	applications, err := p.list(nil)
+	if err != nil {
+		return nil, err
+	}
+	documents := make([]*Document, 0, len(applications))
+	for _, application := range applications {
+		documents = append(documents, &Document{
+			ID:          generateDocumentID(application.Namespace, application.ApplicationName, application.Tag),
+			Application: application,
+		})
+	}
+	return documents, nil
+}
+
+// summarize returns the summary of the applications that match the filter
+func (p *PostgresProvider) summarize(filter *ListFilter) ([]*entities.AppSummary, *entities.Summary, error) {
+	applications, err := p.list(filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	builder := newSummaryBuilder()
+	for _, application := range applications {
+		builder.Add(application)
+	}
+	summaryList, summary := builder.Build()
+	return summaryList, summary, nil
+}
+
+// GetSummary returns the catalog summary (public apps summary)
+func (p *PostgresProvider) GetSummary() (*entities.Summary, error) {
+	_, summary, err := p.summarize(getCacheFilter(p.authEnable))
+	if err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// pageApplicationsAlias with the alias of the subquery with an application per row
+const pageApplicationsAlias = "page_applications"
+
+// collated returns a text column compared byte by byte, as the strings are compared in Go
+func collated(column string) exp.LiteralExpression {
+	return goqu.L(`? COLLATE "C"`, goqu.C(column))
+}
+
+// pageOrder returns the order of the applications in a list, as the one of summaryLess
+func pageOrder(order entities.ListSort) []exp.OrderedExpression {
+	byNamespace := []exp.OrderedExpression{collated(NamespaceColumn).Asc(), collated(ApplicationNameColumn).Asc()}
+	switch order {
+	case entities.ListSortName:
+		return []exp.OrderedExpression{collated(ApplicationNameColumn).Asc(), collated(NamespaceColumn).Asc()}
+	case entities.ListSortLastUpdated:
+		return append([]exp.OrderedExpression{goqu.C(LastUpdatedColumn).Desc()}, byNamespace...)
+	case entities.ListSortPopularity:
+		return append([]exp.OrderedExpression{goqu.C(DownloadsColumn).Desc()}, byNamespace...)
+	}
+	return byNamespace
+}
+
+// pageKeyset returns the condition of the applications sorted after the one a page starts after
+func pageKeyset(order entities.ListSort, after *entities.AppSummary) exp.Expression {
+	byNamespace := goqu.L("(?, ?) > (?, ?)", collated(NamespaceColumn), collated(ApplicationNameColumn),
+		after.Namespace, after.ApplicationName)
+	switch order {
+	case entities.ListSortName:
+		return goqu.L("(?, ?) > (?, ?)", collated(ApplicationNameColumn), collated(NamespaceColumn),
+			after.ApplicationName, after.Namespace)
+	case entities.ListSortLastUpdated:
+		updated := after.LastUpdated.Truncate(time.Millisecond)
+		return goqu.Or(goqu.C(LastUpdatedColumn).Lt(updated),
+			goqu.And(goqu.C(LastUpdatedColumn).Eq(updated), byNamespace))
+	case entities.ListSortPopularity:
+		return goqu.Or(goqu.C(DownloadsColumn).Lt(after.Downloads),
+			goqu.And(goqu.C(DownloadsColumn).Eq(after.Downloads), byNamespace))
+	}
+	return byNamespace
+}
+
+// pageApplications returns the query of the namespace and name of the applications of a page. The tags are grouped
+// by application, sorted by the keys of the order, and the applications after the token are read with a limit.
+// One more application than the page size is read to know if there is a next page.
+func pageApplications(table exp.IdentifierExpression, filter *ListFilter, query *pageQuery) *goqu.SelectDataset {
+	applications := postgresDialect.From(table).
+		Select(goqu.C(NamespaceColumn), goqu.C(ApplicationNameColumn),
+			// the update times are compared with millisecond precision as in summaryLess
+			goqu.L("date_trunc('milliseconds', ?)", goqu.MAX(LastUpdatedColumn)).As(LastUpdatedColumn),
+			goqu.SUM(DownloadsColumn).As(DownloadsColumn)).
+		Where(filterExpression(filter)).
+		GroupBy(goqu.C(NamespaceColumn), goqu.C(ApplicationNameColumn))
+
+	page := postgresDialect.From(applications.As(pageApplicationsAlias)).
+		Select(goqu.C(NamespaceColumn), goqu.C(ApplicationNameColumn)).
+		Order(pageOrder(query.order)...)
+	if query.after != nil {
+		page = page.Where(pageKeyset(query.order, query.after))
+	}
+	if query.size > 0 {
+		page = page.Limit(uint(query.size) + 1)
+	}
+	return page
+}
+
+// ListSummaryWithFilter returns the requested page of the summaries of the applications that match a filter. As in
+// the ElasticProvider, the applications of the catalog summary are returned when the filter requests the public
+// applications of all the namespaces. The applications of the page are selected in the database, and only their
+// tags are read to build the summaries.
+func (p *PostgresProvider) ListSummaryWithFilter(filter *ListFilter, page *entities.PageRequest) (*entities.ApplicationPage, error) {
+	query, err := newPageQuery(page)
+	if err != nil {
+		return nil, err
+	}
+	filter = getSummaryFilter(filter, p.authEnable)
+
+	where := goqu.And(filterExpression(filter),
+		goqu.L("(?, ?) IN ?", goqu.C(NamespaceColumn), goqu.C(ApplicationNameColumn), pageApplications(p.table(), filter, query)))
+	applications, err := p.listWhere(where, 0)
+	if err != nil {
+		return nil, err
+	}
+	builder := newSummaryBuilder()
+	for _, application := range applications {
+		builder.Add(application)
+	}
+	summaryList, _ := builder.Build()
+	return query.page(summaryList, false), nil
+}
+
+// likePattern returns the ILIKE pattern that matches the values containing the term
+func likePattern(term string) string {
+	return "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(term) + "%"
+}
+
+// searchColumns with the column of each search field
+var searchColumns = map[string]string{
+	ApplicationField:  ApplicationNameColumn,
+	MetadataNameField: MetadataNameColumn,
+	MetadataField:     MetadataColumn,
+	ReadmeField:       ReadmeColumn,
+}
+
+// scoreExpression returns the score of a row as computed by matchApplication, adding the boost of the fields
+// that contain each term
+func scoreExpression(terms []string) exp.LiteralExpression {
+	scores := make([]interface{}, 0, len(terms)*len(searchFields))
+	for _, term := range terms {
+		pattern := likePattern(term)
+		for _, field := range searchFields {
+			// the boost is a literal so postgres does not need to infer the type of a placeholder
+			scores = append(scores, goqu.Case().
+				When(goqu.C(searchColumns[field.name]).ILike(pattern), goqu.L(strconv.FormatFloat(field.boost, 'f', -1, 64))).
+				Else(goqu.L("0")))
+		}
+	}
+	return goqu.L(strings.TrimSuffix(strings.Repeat("? + ", len(scores)), " + "), scores...)
+}
+
+// Search returns the applications that contain the text in their names, metadata or readme sorted by relevance.
+// The rows that contain all the terms are selected with ILIKE and sorted by their score, so the maxSearchDocuments
+// most relevant rows are read. The facets are read from the metadata and the result is marked as truncated if
+// there are more matching rows.
+func (p *PostgresProvider) Search(request *SearchRequest) (*entities.SearchResult, error) {
+	terms := searchTerms(request.Text)
+	conditions := make([]exp.Expression, 0, len(terms)+1)
+	for _, term := range terms {
+		pattern := likePattern(term)
+		matches := make([]exp.Expression, 0, len(searchFields))
+		for _, field := range searchFields {
+			matches = append(matches, goqu.C(searchColumns[field.name]).ILike(pattern))
+		}
+		conditions = append(conditions, goqu.Or(matches...))
+	}
+	if len(request.Filters) > 0 {
+		filters := make([]exp.Expression, 0, len(request.Filters))
+		for _, filter := range request.Filters {
+			where := filterExpression(filter)
+			if len(where) == 0 {
+				// the filter matches all the applications
+				filters = nil
+				break
+			}
+			filters = append(filters, where)
+		}
+		if len(filters) > 0 {
+			conditions = append(conditions, goqu.Or(filters...))
+		}
+	}
+	order := make([]exp.OrderedExpression, 0, 1)
+	if len(terms) > 0 {
+		order = append(order, scoreExpression(terms).Desc())
+	}
+	// an extra row is read to know if there are more matching rows
+	applications, err := p.listWhere(goqu.And(conditions...), maxSearchDocuments+1, order...)
+	if err != nil {
+		return nil, err
+	}
+	truncated := len(applications) > maxSearchDocuments
+	if truncated {
+		applications = applications[:maxSearchDocuments]
+	}
+	result := searchApplications(applications, request)
+	result.Truncated = truncated
+	return result, nil
+}
+
+// ListTags returns the tags of an application sorted by name, it is empty if the application does not exist
+func (p *PostgresProvider) ListTags(namespace string, applicationName string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	sql, args, err := postgresDialect.From(p.table()).Prepared(true).Select(TagColumn).
+		Where(goqu.Ex{NamespaceColumn: namespace, ApplicationNameColumn: applicationName}).
+		Order(goqu.C(TagColumn).Asc()).ToSQL()
+	if err != nil {
+		log.Err(err).Msg("error listing application tags")
+		return nil, nerrors.NewInternalErrorFrom(err, "Error listing application tags")
+	}
+	rows, err := p.conn.Query(ctx, sql, args...)
+	if err != nil {
+		log.Err(err).Str("namespace", namespace).Str("applicationName", applicationName).Msg("error listing application tags")
+		return nil, nerrors.NewInternalErrorFrom(err, "Error listing application tags")
+	}
+	defer rows.Close()
+
+	tags := make([]string, 0)
+	for rows.Next() {
+		var tag string
+		if err = rows.Scan(&tag); err != nil {
+			log.Err(err).Str("namespace", namespace).Str("applicationName", applicationName).Msg("error in scan when listing application tags")
+			return nil, nerrors.NewInternalErrorFrom(err, "Error listing application tags")
+		}
+		tags = append(tags, tag)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "Error listing application tags")
+	}
+	return tags, nil
+}
+
+// GetApplicationVisibility returns the application visibility or error if the application does not exist
+func (p *PostgresProvider) GetApplicationVisibility(namespace string, applicationName string) (*bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	sql, args, err := postgresDialect.From(p.table()).Prepared(true).Select(PrivateColumn).
+		Where(goqu.Ex{NamespaceColumn: namespace, ApplicationNameColumn: applicationName}).Limit(1).ToSQL()
+	if err != nil {
+		log.Err(err).Msg("error getting application visibility")
+		return nil, nerrors.NewInternalErrorFrom(err, "Error getting application visibility")
+	}
+	var private bool
+	if err = p.conn.QueryRow(ctx, sql, args...).Scan(&private); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nerrors.NewNotFoundError("application not found")
+		}
+		log.Err(err).Str("namespace", namespace).Str("applicationName", applicationName).Msg("error in scan when getting application visibility")
+		return nil, nerrors.NewInternalErrorFrom(err, "Error getting application visibility")
+	}
+	return &private, nil
+}
+
+// UpdateApplicationVisibility changes the visibility of all the tags of an application, only the tags that have
+// a different visibility are updated
+func (p *PostgresProvider) UpdateApplicationVisibility(namespace string, applicationName string, isPrivate bool) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	sql, args, err := postgresDialect.Update(p.table()).Prepared(true).Set(goqu.Record{PrivateColumn: isPrivate}).
+		Where(goqu.Ex{NamespaceColumn: namespace, ApplicationNameColumn: applicationName, PrivateColumn: goqu.Op{"neq": isPrivate}}).ToSQL()
+	if err != nil {
+		log.Err(err).Msg("error updating application visibility")
+		return 0, nerrors.NewInternalErrorFrom(err, "Error updating application visibility")
+	}
+	result, err := p.conn.Exec(ctx, sql, args...)
+	if err != nil {
+		log.Err(err).Str("namespace", namespace).Str("applicationName", applicationName).Msg("error executing update application visibility")
+		return 0, nerrors.NewInternalErrorFrom(err, "Error updating application visibility")
+	}
+	if result.RowsAffected() == 0 {
+		// no tag changed, check if the application exists
+		if _, err := p.GetApplicationVisibility(namespace, applicationName); err != nil {
+			return 0, err
+		}
+	}
+	return int(result.RowsAffected()), nil
+}
+
+// IncrementDownloads adds a download to the counter of an application tag
+func (p *PostgresProvider) IncrementDownloads(appID *entities.ApplicationID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	sql, args, err := postgresDialect.Update(p.table()).Prepared(true).
+		Set(goqu.Record{DownloadsColumn: goqu.L("? + 1", goqu.C(DownloadsColumn))}).
+		Where(goqu.Ex{IDColumn: generateDocumentID(appID.Namespace, appID.ApplicationName, appID.Tag)}).ToSQL()
+	if err != nil {
+		log.Err(err).Msg("error counting download")
+		return nerrors.NewInternalErrorFrom(err, "Error counting download of application [%s]", appID.String())
+	}
+	result, err := p.conn.Exec(ctx, sql, args...)
+	if err != nil {
+		log.Err(err).Str("appID", appID.String()).Msg("error executing count download")
+		return nerrors.NewInternalErrorFrom(err, "Error counting download of application [%s]", appID.String())
+	}
+	if result.RowsAffected() == 0 {
+		return nerrors.NewNotFoundError("Error counting download: [application not found]")
+	}
+	return nil
+}
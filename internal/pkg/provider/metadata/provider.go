@@ -25,6 +25,16 @@ type ListFilter struct {
 	Private   *bool
 }
 
+// Document with a metadata document as it is stored in the provider
+type Document struct {
+	// ID with the internal identifier of the document
+	ID string
+	// Application with the application metadata, nil if the document cannot be read
+	Application *entities.ApplicationInfo
+	// Error with the reason why the document is not a valid application metadata
+	Error error
+}
+
 // MetadataProvider is an interface with the methods of a metadata provider must implement
 type MetadataProvider interface {
 	// Add stores new application metadata or updates it if it exists
@@ -39,10 +49,22 @@ type MetadataProvider interface {
 	List(namespace string) ([]*entities.ApplicationInfo, error)
 	// GetSummary returns the catalog summary (public apps summary)
 	GetSummary() (*entities.Summary, error)
-	// ListSummaryWithFilter returns entities.AppSummary and entities.Summary applying a filter in the search method
-	ListSummaryWithFilter(filter *ListFilter) ([]*entities.AppSummary, *entities.Summary, error)
+	// ListSummaryWithFilter returns the requested page of the summaries of the applications that match a filter,
+	// all of them sorted by namespace if the page is nil
+	ListSummaryWithFilter(filter *ListFilter, page *entities.PageRequest) (*entities.ApplicationPage, error)
+	// ListTags returns the tags of an application sorted by name, it is empty if the application does not exist
+	ListTags(namespace string, applicationName string) ([]string, error)
 	// GetApplicationVisibility returns is an application is private or not or error if the application does not exist
 	GetApplicationVisibility(namespace string, applicationName string) (*bool, error)
-	// UpdateApplicationVisibility changes the application visibility
-	UpdateApplicationVisibility(namespace string, applicationName string, isPrivate bool) error
+	// UpdateApplicationVisibility changes the visibility of all the tags of an application and returns the number of
+	// tags changed, the tags that already have the visibility are not counted
+	UpdateApplicationVisibility(namespace string, applicationName string, isPrivate bool) (int, error)
+	// ListDocuments returns all the documents stored, including the ones that cannot be read as application metadata
+	ListDocuments() ([]*Document, error)
+	// RemoveDocument removes a document by its internal identifier
+	RemoveDocument(id string) error
+	// Search returns the applications that contain the text in their names, metadata or readme sorted by relevance
+	Search(request *SearchRequest) (*entities.SearchResult, error)
+	// IncrementDownloads adds a download to the counter of an application tag
+	IncrementDownloads(appID *entities.ApplicationID) error
 }
@@ -16,8 +16,13 @@
 package metadata
 
 import (
+	"fmt"
+	"strings"
+	"time"
+
 	"github.com/napptive/catalog-manager/internal/pkg/entities"
 	"github.com/napptive/catalog-manager/internal/pkg/utils"
+	"github.com/napptive/nerrors/pkg/nerrors"
 	"github.com/onsi/ginkgo"
 	"github.com/onsi/gomega"
 	"github.com/rs/zerolog/log"
@@ -181,6 +186,51 @@ func RunTests(provider MetadataProvider) {
 		})
 	})
 
+	ginkgo.Context("Listing tags", func() {
+		ginkgo.It("Should list only the tags of an application", func() {
+			namespace := "tags"
+			for _, id := range []entities.ApplicationID{
+				{Namespace: namespace, ApplicationName: "app", Tag: "v2.0.0"},
+				{Namespace: namespace, ApplicationName: "app", Tag: "v1.0.0"},
+				{Namespace: namespace, ApplicationName: "app-2", Tag: "v3.0.0"},
+				{Namespace: "other", ApplicationName: "app", Tag: "v4.0.0"},
+			} {
+				app := utils.CreateTestApplicationInfo()
+				app.Namespace = id.Namespace
+				app.ApplicationName = id.ApplicationName
+				app.Tag = id.Tag
+				_, err := provider.Add(app)
+				gomega.Expect(err).Should(gomega.Succeed())
+			}
+			tags, err := provider.ListTags(namespace, "app")
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(tags).Should(gomega.Equal([]string{"v1.0.0", "v2.0.0"}))
+			tags, err = provider.ListTags(namespace, "missing")
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(tags).Should(gomega.BeEmpty())
+		})
+	})
+
+	ginkgo.Context("Listing documents", func() {
+		ginkgo.It("Should be able to list and remove the documents", func() {
+			app := utils.CreateTestApplicationInfo()
+			_, err := provider.Add(app)
+			gomega.Expect(err).Should(gomega.Succeed())
+
+			documents, err := provider.ListDocuments()
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(len(documents)).Should(gomega.Equal(1))
+			gomega.Expect(documents[0].Error).Should(gomega.BeNil())
+			gomega.Expect(documents[0].Application.ToApplicationID()).Should(gomega.Equal(app.ToApplicationID()))
+
+			err = provider.RemoveDocument(documents[0].ID)
+			gomega.Expect(err).Should(gomega.Succeed())
+			exists, err := provider.Exists(app.ToApplicationID())
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(exists).Should(gomega.BeFalse())
+		})
+	})
+
 	ginkgo.Context("Listing application summary", func() {
 		ginkgo.It("Should be able to list applications", func() {
 			namespace := "Namespace"
@@ -199,12 +249,12 @@ func RunTests(provider MetadataProvider) {
 				gomega.Expect(err).Should(gomega.Succeed())
 				gomega.Expect(returned.CatalogID).ShouldNot(gomega.BeEmpty())
 			}
-			listRetrieved, _, err := provider.ListSummaryWithFilter(&ListFilter{
+			listRetrieved, err := provider.ListSummaryWithFilter(&ListFilter{
 				Namespace: nil,
 				Private:   nil,
-			})
+			}, nil)
 			gomega.Expect(err).Should(gomega.Succeed())
-			gomega.Expect(listRetrieved).ShouldNot(gomega.BeEmpty())
+			gomega.Expect(listRetrieved.Applications).ShouldNot(gomega.BeEmpty())
 
 		})
 		ginkgo.It("Should be able to list applications without logo in metadata", func() {
@@ -222,21 +272,62 @@ func RunTests(provider MetadataProvider) {
 				gomega.Expect(returned.CatalogID).ShouldNot(gomega.BeEmpty())
 			}
 
-			listRetrieved, _, err := provider.ListSummaryWithFilter(&ListFilter{
+			listRetrieved, err := provider.ListSummaryWithFilter(&ListFilter{
 				Namespace: nil,
 				Private:   nil,
-			})
+			}, nil)
 			gomega.Expect(err).Should(gomega.Succeed())
-			gomega.Expect(listRetrieved).ShouldNot(gomega.BeEmpty())
+			gomega.Expect(listRetrieved.Applications).ShouldNot(gomega.BeEmpty())
 
 		})
 		ginkgo.It("Should be able to list an empty list of applications", func() {
-			listRetrieved, _, err := provider.ListSummaryWithFilter(&ListFilter{
+			listRetrieved, err := provider.ListSummaryWithFilter(&ListFilter{
 				Namespace: nil,
 				Private:   nil,
-			})
+			}, nil)
 			gomega.Expect(err).Should(gomega.Succeed())
-			gomega.Expect(listRetrieved).Should(gomega.BeEmpty())
+			gomega.Expect(listRetrieved.Applications).Should(gomega.BeEmpty())
+		})
+		ginkgo.It("Should page the applications of a namespace in every order", func() {
+			namespace := strings.ToLower(faker.Internet().UserName()) + "-paged"
+			now := time.Now().UTC()
+			for i := 0; i < 5; i++ {
+				app := utils.CreateTestApplicationInfo()
+				app.Namespace = namespace
+				app.ApplicationName = fmt.Sprintf("app%d", (i*3)%5)
+				for j, tag := range []string{"v1", "v2"} {
+					app.Tag = tag
+					// the latest tag is not always the last one added
+					app.LastUpdated = now.Add(-time.Duration(i*10+(j*7)%(i+1)) * time.Minute)
+					app.Downloads = int64((i + j) % 3)
+					_, err := provider.Add(app)
+					gomega.Expect(err).Should(gomega.Succeed())
+				}
+			}
+			filter := &ListFilter{Namespace: &namespace}
+			all, err := provider.ListSummaryWithFilter(filter, nil)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(all.Applications).Should(gomega.HaveLen(5))
+
+			for _, order := range []entities.ListSort{entities.ListSortNamespace, entities.ListSortName,
+				entities.ListSortLastUpdated, entities.ListSortPopularity} {
+				expected, err := PageSummaries(all.Applications, &entities.PageRequest{Sort: order})
+				gomega.Expect(err).Should(gomega.Succeed())
+
+				paged := make([]*entities.AppSummary, 0)
+				request := &entities.PageRequest{Sort: order, PageSize: 2}
+				for {
+					page, err := provider.ListSummaryWithFilter(filter, request)
+					gomega.Expect(err).Should(gomega.Succeed())
+					gomega.Expect(len(page.Applications)).Should(gomega.BeNumerically("<=", 2))
+					paged = append(paged, page.Applications...)
+					if page.NextPageToken == "" {
+						break
+					}
+					request.PageToken = page.NextPageToken
+				}
+				gomega.Expect(paged).Should(gomega.Equal(expected.Applications), string(order))
+			}
 		})
 	})
 
@@ -250,7 +341,9 @@ func RunTests(provider MetadataProvider) {
 				gomega.Expect(returned.CatalogID).ShouldNot(gomega.BeEmpty())
 			}
 			// Fill cache
-			provider.(*ElasticProvider).FillCache()
+			if cached, ok := provider.(*ElasticProvider); ok {
+				cached.FillCache()
+			}
 
 			summary, err := provider.GetSummary()
 			gomega.Expect(err).Should(gomega.Succeed())
@@ -276,7 +369,9 @@ func RunTests(provider MetadataProvider) {
 				gomega.Expect(returned.CatalogID).ShouldNot(gomega.BeEmpty())
 			}
 			// Fill cache
-			provider.(*ElasticProvider).FillCache()
+			if cached, ok := provider.(*ElasticProvider); ok {
+				cached.FillCache()
+			}
 
 			summary, err := provider.GetSummary()
 			gomega.Expect(err).Should(gomega.Succeed())
@@ -319,4 +414,142 @@ func RunTests(provider MetadataProvider) {
 		})
 	})
 
+	ginkgo.Context("Counting downloads", func() {
+		ginkgo.It("Should count the downloads of an application tag", func() {
+			app := utils.CreateTestApplicationInfo()
+			_, err := provider.Add(app)
+			gomega.Expect(err).Should(gomega.Succeed())
+
+			appID := &entities.ApplicationID{Namespace: app.Namespace, ApplicationName: app.ApplicationName, Tag: app.Tag}
+			for i := 0; i < 2; i++ {
+				gomega.Expect(provider.IncrementDownloads(appID)).Should(gomega.Succeed())
+			}
+			retrieved, err := provider.Get(appID)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(retrieved.Downloads).Should(gomega.Equal(int64(2)))
+		})
+
+		ginkgo.It("Should not count the downloads of a missing application", func() {
+			err := provider.IncrementDownloads(&entities.ApplicationID{Namespace: "namespace", ApplicationName: "missing", Tag: "latest"})
+			gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.NotFound))
+		})
+	})
+
+	ginkgo.Context("Changing the visibility", func() {
+		ginkgo.It("Should report the tags changed and apply only the pending changes when retried", func() {
+			app := utils.CreateTestApplicationInfo()
+			for _, tag := range []string{"v1", "v2"} {
+				app.Tag = tag
+				_, err := provider.Add(app)
+				gomega.Expect(err).Should(gomega.Succeed())
+			}
+
+			updated, err := provider.UpdateApplicationVisibility(app.Namespace, app.ApplicationName, true)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(updated).Should(gomega.Equal(2))
+			updated, err = provider.UpdateApplicationVisibility(app.Namespace, app.ApplicationName, true)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(updated).Should(gomega.Equal(0))
+			private, err := provider.GetApplicationVisibility(app.Namespace, app.ApplicationName)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(*private).Should(gomega.BeTrue())
+		})
+
+		ginkgo.It("Should not change the visibility of a missing application", func() {
+			_, err := provider.UpdateApplicationVisibility("namespace", "missing", true)
+			gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.NotFound))
+		})
+	})
+
+	ginkgo.Context("Searching applications", func() {
+		var byName, byReadme *entities.ApplicationInfo
+
+		ginkgo.BeforeEach(func() {
+			byName = utils.CreateTestApplicationInfo()
+			byName.ApplicationName = "wordpress-blog"
+			byReadme = utils.CreateTestApplicationInfo()
+			byReadme.Readme = "A WordPress installation with a MySQL database"
+			for _, app := range []*entities.ApplicationInfo{byName, byReadme, utils.CreateTestApplicationInfo()} {
+				_, err := provider.Add(app)
+				gomega.Expect(err).Should(gomega.Succeed())
+			}
+		})
+
+		ginkgo.It("Should find the applications by name and readme ignoring the case", func() {
+			result, err := provider.Search(&SearchRequest{Text: "WordPress"})
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(result.Total).Should(gomega.Equal(2))
+			gomega.Expect(len(result.Hits)).Should(gomega.Equal(2))
+			for _, hit := range result.Hits {
+				gomega.Expect(hit.Score).Should(gomega.BeNumerically(">", 0))
+				if hit.Application.ApplicationName == byReadme.ApplicationName {
+					gomega.Expect(hit.Highlights[ReadmeField]).Should(gomega.ContainElement(gomega.ContainSubstring("<em>WordPress</em>")))
+				}
+			}
+		})
+
+		ginkgo.It("Should only return the applications that contain all the terms", func() {
+			result, err := provider.Search(&SearchRequest{Text: "wordpress mysql"})
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(result.Total).Should(gomega.Equal(1))
+			gomega.Expect(result.Hits[0].Application.ApplicationName).Should(gomega.Equal(byReadme.ApplicationName))
+		})
+
+		ginkgo.It("Should group the tags of an application", func() {
+			byName.Tag = "other"
+			_, err := provider.Add(byName)
+			gomega.Expect(err).Should(gomega.Succeed())
+
+			result, err := provider.Search(&SearchRequest{Text: "wordpress-blog"})
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(result.Total).Should(gomega.Equal(1))
+			gomega.Expect(len(result.Hits[0].Application.TagMetadataName)).Should(gomega.Equal(2))
+		})
+
+		ginkgo.It("Should only return the applications that match the filters", func() {
+			result, err := provider.Search(&SearchRequest{Text: "wordpress", Filters: []*ListFilter{{Namespace: &byName.Namespace}}})
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(result.Total).Should(gomega.Equal(1))
+			gomega.Expect(result.Hits[0].Application.Namespace).Should(gomega.Equal(byName.Namespace))
+		})
+
+		ginkgo.It("Should return the requested page", func() {
+			result, err := provider.Search(&SearchRequest{Text: "wordpress", From: 1, Size: 1})
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(result.Total).Should(gomega.Equal(2))
+			gomega.Expect(len(result.Hits)).Should(gomega.Equal(1))
+		})
+
+		ginkgo.It("Should list all the applications if there is no text", func() {
+			result, err := provider.Search(&SearchRequest{})
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(result.Total).Should(gomega.Equal(3))
+			gomega.Expect(result.Truncated).Should(gomega.BeFalse())
+		})
+
+		ginkgo.It("Should only return the applications that match the facets", func() {
+			byName.Metadata = strings.Replace(byName.Metadata, "storage", "wiki-engine", 1)
+			_, err := provider.Add(byName)
+			gomega.Expect(err).Should(gomega.Succeed())
+
+			result, err := provider.Search(&SearchRequest{Facets: &entities.FacetFilter{Keywords: []string{"wiki-engine"}}})
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(result.Total).Should(gomega.Equal(1))
+			gomega.Expect(result.Hits[0].Application.ApplicationName).Should(gomega.Equal(byName.ApplicationName))
+
+			result, err = provider.Search(&SearchRequest{Text: "wordpress", Facets: &entities.FacetFilter{Keywords: []string{"storage"}}})
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(result.Total).Should(gomega.Equal(1))
+			gomega.Expect(result.Hits[0].Application.ApplicationName).Should(gomega.Equal(byReadme.ApplicationName))
+		})
+
+		ginkgo.It("Should count the facet values of the matching applications", func() {
+			result, err := provider.Search(&SearchRequest{Text: "wordpress"})
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(result.Facets.Keywords).Should(gomega.Equal([]*entities.FacetCount{{Value: "storage", Count: 2}}))
+			gomega.Expect(result.Facets.Licenses).Should(gomega.Equal([]*entities.FacetCount{{Value: "Apache License Version 2.0", Count: 2}}))
+			gomega.Expect(result.Facets.Traits).Should(gomega.BeEmpty())
+		})
+	})
+
 }
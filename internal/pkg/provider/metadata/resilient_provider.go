@@ -0,0 +1,374 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metadata
+
+import (
+	"sync"
+	"time"
+
+	"github.com/napptive/catalog-manager/internal/pkg/config"
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog/log"
+)
+
+// CircuitState with the state of the circuit breaker of a ResilientProvider
+type CircuitState string
+
+const (
+	// CircuitClosed lets all the calls reach the backend
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen rejects the calls without reaching the backend
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen lets one call reach the backend to check if it is available again
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+// HealthStatus with the availability of the metadata backend
+type HealthStatus struct {
+	// State with the state of the circuit breaker
+	State CircuitState `json:"state"`
+	// Ready is true if the calls reach the backend
+	Ready bool `json:"ready"`
+	// ConsecutiveFailures with the number of calls that failed since the last one that reached the backend
+	ConsecutiveFailures int `json:"consecutiveFailures"`
+	// LastError with the last error that made a call fail, empty if the last call reached the backend
+	LastError string `json:"lastError,omitempty"`
+}
+
+// isUnavailable checks if an error is caused by the backend being unavailable
+func isUnavailable(err error) bool {
+	return err != nil && nerrors.FromError(err).Code == nerrors.Unavailable
+}
+
+// circuitBreaker counts the consecutive calls that fail because the backend is unavailable. Once they reach the
+// threshold, the calls are rejected during the open time. Then, one call is sent to the backend and the breaker
+// is closed if it succeeds or opened again if it fails.
+type circuitBreaker struct {
+	// threshold with the number of consecutive failures that open the breaker
+	threshold int
+	// openTime with the time the calls are rejected
+	openTime time.Duration
+	// now returns the current time
+	now func() time.Time
+	// state with the current state
+	state CircuitState
+	// failures with the number of consecutive failures
+	failures int
+	// openedAt with the time the breaker was opened
+	openedAt time.Time
+	// probing is true while the call of the half open state is in progress
+	probing bool
+	// lastError with the last error of a call
+	lastError error
+	// Mutex to protect the state
+	sync.Mutex
+}
+
+// newCircuitBreaker creates a closed circuitBreaker
+func newCircuitBreaker(threshold int, openTime time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, openTime: openTime, now: time.Now, state: CircuitClosed}
+}
+
+// allow returns an Unavailable error if the call must be rejected without reaching the backend
+func (b *circuitBreaker) allow() error {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.state == CircuitOpen && b.now().Sub(b.openedAt) >= b.openTime {
+		b.state = CircuitHalfOpen
+	}
+	switch {
+	case b.state == CircuitOpen:
+		return nerrors.NewUnavailableError("the metadata backend is unavailable, retry later")
+	case b.state == CircuitHalfOpen && b.probing:
+		return nerrors.NewUnavailableError("the metadata backend is being checked, retry later")
+	case b.state == CircuitHalfOpen:
+		b.probing = true
+	}
+	return nil
+}
+
+// record updates the state with the result of a call that reached the backend
+func (b *circuitBreaker) record(err error) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.probing = false
+	if !isUnavailable(err) {
+		if b.state != CircuitClosed {
+			log.Info().Msg("metadata backend available again, closing the circuit breaker")
+		}
+		b.state = CircuitClosed
+		b.failures = 0
+		b.lastError = nil
+		return
+	}
+	b.failures++
+	b.lastError = err
+	if b.state == CircuitHalfOpen || (b.state == CircuitClosed && b.failures >= b.threshold) {
+		log.Warn().Err(err).Int("failures", b.failures).Str("openTime", b.openTime.String()).
+			Msg("metadata backend unavailable, opening the circuit breaker")
+		b.state = CircuitOpen
+		b.openedAt = b.now()
+	}
+}
+
+// status returns the state of the breaker
+func (b *circuitBreaker) status() *HealthStatus {
+	b.Lock()
+	defer b.Unlock()
+
+	state := b.state
+	if state == CircuitOpen && b.now().Sub(b.openedAt) >= b.openTime {
+		state = CircuitHalfOpen
+	}
+	status := &HealthStatus{State: state, Ready: state != CircuitOpen, ConsecutiveFailures: b.failures}
+	if b.lastError != nil {
+		status.LastError = b.lastError.Error()
+	}
+	return status
+}
+
+// ResilientProvider decorates a MetadataProvider so the calls fail fast while the backend is unavailable. The
+// reads and the visibility updates, that are idempotent, are retried with exponential backoff before failing. The
+// other writes are not retried as some of them, like IncrementDownloads, cannot be applied twice.
+type ResilientProvider struct {
+	// provider with the decorated provider
+	provider MetadataProvider
+	// cfg with the retries and the circuit breaker configuration
+	cfg config.ResilienceConfig
+	// breaker with the circuit breaker of the calls
+	breaker *circuitBreaker
+	// sleep waits between two retries
+	sleep func(time.Duration)
+}
+
+// NewResilientProvider creates a ResilientProvider that decorates a provider
+func NewResilientProvider(provider MetadataProvider, cfg config.ResilienceConfig) *ResilientProvider {
+	return &ResilientProvider{
+		provider: provider,
+		cfg:      cfg,
+		breaker:  newCircuitBreaker(cfg.BreakerThreshold, cfg.BreakerOpenTime),
+		sleep:    time.Sleep,
+	}
+}
+
+// Health returns the availability of the backend
+func (r *ResilientProvider) Health() *HealthStatus {
+	return r.breaker.status()
+}
+
+// nextBackoff returns the wait after a retry that waited backoff
+func (r *ResilientProvider) nextBackoff(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if backoff > r.cfg.MaxBackoff {
+		return r.cfg.MaxBackoff
+	}
+	return backoff
+}
+
+// WaitForBackend calls init until the backend is available or the StartupTimeout expires. The errors that are
+// not caused by the backend being unavailable are returned without retrying.
+func (r *ResilientProvider) WaitForBackend(init func() error) error {
+	deadline := time.Now().Add(r.cfg.StartupTimeout)
+	backoff := r.cfg.InitialBackoff
+	for {
+		err := init()
+		if !isUnavailable(err) {
+			return err
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			return nerrors.NewUnavailableErrorFrom(err, "the metadata backend is not available after %s", r.cfg.StartupTimeout)
+		}
+		log.Warn().Err(err).Str("retryIn", backoff.String()).Msg("waiting for the metadata backend")
+		r.sleep(backoff)
+		backoff = r.nextBackoff(backoff)
+	}
+}
+
+// write sends a call to the backend through the circuit breaker
+func (r *ResilientProvider) write(call func() error) error {
+	if err := r.breaker.allow(); err != nil {
+		return err
+	}
+	err := call()
+	r.breaker.record(err)
+	return err
+}
+
+// read sends an idempotent call to the backend through the circuit breaker, retrying it while the backend is
+// unavailable. The retries stop when the breaker is opened.
+func (r *ResilientProvider) read(call func() error) error {
+	backoff := r.cfg.InitialBackoff
+	for retry := 0; ; retry++ {
+		if err := r.breaker.allow(); err != nil {
+			return err
+		}
+		err := call()
+		r.breaker.record(err)
+		if !isUnavailable(err) || retry >= r.cfg.MaxRetries {
+			return err
+		}
+		log.Debug().Err(err).Int("retry", retry+1).Str("backoff", backoff.String()).Msg("retrying metadata read")
+		r.sleep(backoff)
+		backoff = r.nextBackoff(backoff)
+	}
+}
+
+// Add stores new application metadata or updates it if it exists
+func (r *ResilientProvider) Add(metadata *entities.ApplicationInfo) (*entities.ApplicationInfo, error) {
+	var result *entities.ApplicationInfo
+	err := r.write(func() error {
+		var err error
+		result, err = r.provider.Add(metadata)
+		return err
+	})
+	return result, err
+}
+
+// Get returns the application metadata requested or an error if it does not exist
+func (r *ResilientProvider) Get(appID *entities.ApplicationID) (*entities.ApplicationInfo, error) {
+	var result *entities.ApplicationInfo
+	err := r.read(func() error {
+		var err error
+		result, err = r.provider.Get(appID)
+		return err
+	})
+	return result, err
+}
+
+// Exists checks if an application metadata exists
+func (r *ResilientProvider) Exists(appID *entities.ApplicationID) (bool, error) {
+	var result bool
+	err := r.read(func() error {
+		var err error
+		result, err = r.provider.Exists(appID)
+		return err
+	})
+	return result, err
+}
+
+// Remove removes an application metadata
+func (r *ResilientProvider) Remove(appID *entities.ApplicationID) error {
+	return r.write(func() error {
+		return r.provider.Remove(appID)
+	})
+}
+
+// List returns the applications stored (public and privates)
+func (r *ResilientProvider) List(namespace string) ([]*entities.ApplicationInfo, error) {
+	var result []*entities.ApplicationInfo
+	err := r.read(func() error {
+		var err error
+		result, err = r.provider.List(namespace)
+		return err
+	})
+	return result, err
+}
+
+// GetSummary returns the catalog summary (public apps summary)
+func (r *ResilientProvider) GetSummary() (*entities.Summary, error) {
+	var result *entities.Summary
+	err := r.read(func() error {
+		var err error
+		result, err = r.provider.GetSummary()
+		return err
+	})
+	return result, err
+}
+
+// ListSummaryWithFilter returns the requested page of the summaries of the applications that match a filter
+func (r *ResilientProvider) ListSummaryWithFilter(filter *ListFilter, page *entities.PageRequest) (*entities.ApplicationPage, error) {
+	var result *entities.ApplicationPage
+	err := r.read(func() error {
+		var err error
+		result, err = r.provider.ListSummaryWithFilter(filter, page)
+		return err
+	})
+	return result, err
+}
+
+// ListTags returns the tags of an application sorted by name, it is empty if the application does not exist
+func (r *ResilientProvider) ListTags(namespace string, applicationName string) ([]string, error) {
+	var result []string
+	err := r.read(func() error {
+		var err error
+		result, err = r.provider.ListTags(namespace, applicationName)
+		return err
+	})
+	return result, err
+}
+
+// GetApplicationVisibility returns is an application is private or not or error if the application does not exist
+func (r *ResilientProvider) GetApplicationVisibility(namespace string, applicationName string) (*bool, error) {
+	var result *bool
+	err := r.read(func() error {
+		var err error
+		result, err = r.provider.GetApplicationVisibility(namespace, applicationName)
+		return err
+	})
+	return result, err
+}
+
+// UpdateApplicationVisibility changes the application visibility. It is retried as the tags that already have the
+// visibility are not changed again.
+func (r *ResilientProvider) UpdateApplicationVisibility(namespace string, applicationName string, isPrivate bool) (int, error) {
+	updated := 0
+	err := r.read(func() error {
+		count, err := r.provider.UpdateApplicationVisibility(namespace, applicationName, isPrivate)
+		updated += count
+		return err
+	})
+	return updated, err
+}
+
+// ListDocuments returns all the documents stored, including the ones that cannot be read as application metadata
+func (r *ResilientProvider) ListDocuments() ([]*Document, error) {
+	var result []*Document
+	err := r.read(func() error {
+		var err error
+		result, err = r.provider.ListDocuments()
+		return err
+	})
+	return result, err
+}
+
+// RemoveDocument removes a document by its internal identifier
+func (r *ResilientProvider) RemoveDocument(id string) error {
+	return r.write(func() error {
+		return r.provider.RemoveDocument(id)
+	})
+}
+
+// Search returns the applications that contain the text in their names, metadata or readme sorted by relevance
+func (r *ResilientProvider) Search(request *SearchRequest) (*entities.SearchResult, error) {
+	var result *entities.SearchResult
+	err := r.read(func() error {
+		var err error
+		result, err = r.provider.Search(request)
+		return err
+	})
+	return result, err
+}
+
+// IncrementDownloads adds a download to the counter of an application tag
+func (r *ResilientProvider) IncrementDownloads(appID *entities.ApplicationID) error {
+	return r.write(func() error {
+		return r.provider.IncrementDownloads(appID)
+	})
+}
@@ -0,0 +1,192 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metadata
+
+import (
+	"time"
+
+	"github.com/napptive/catalog-manager/internal/pkg/config"
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/catalog-manager/internal/pkg/utils"
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+// flakyProvider is a MetadataProvider that fails with the error of each call in errors until it is empty
+type flakyProvider struct {
+	MetadataProvider
+	// errors with the errors of the next calls
+	errors []error
+	// calls with the number of calls that reached the provider
+	calls int
+}
+
+// next returns the error of the next call
+func (f *flakyProvider) next() error {
+	f.calls++
+	if len(f.errors) == 0 {
+		return nil
+	}
+	err := f.errors[0]
+	f.errors = f.errors[1:]
+	return err
+}
+
+func (f *flakyProvider) Get(appID *entities.ApplicationID) (*entities.ApplicationInfo, error) {
+	if err := f.next(); err != nil {
+		return nil, err
+	}
+	return f.MetadataProvider.Get(appID)
+}
+
+func (f *flakyProvider) IncrementDownloads(appID *entities.ApplicationID) error {
+	if err := f.next(); err != nil {
+		return err
+	}
+	return f.MetadataProvider.IncrementDownloads(appID)
+}
+
+var _ = ginkgo.Describe("Resilient provider", func() {
+
+	var cfg = config.ResilienceConfig{
+		MaxRetries:       2,
+		InitialBackoff:   10 * time.Millisecond,
+		MaxBackoff:       15 * time.Millisecond,
+		StartupTimeout:   time.Second,
+		BreakerThreshold: 4,
+		BreakerOpenTime:  time.Minute,
+	}
+
+	var flaky *flakyProvider
+	var provider *ResilientProvider
+	var now time.Time
+	var waits []time.Duration
+	var app *entities.ApplicationInfo
+
+	unavailable := func() error {
+		return nerrors.NewUnavailableError("elastic is down")
+	}
+
+	ginkgo.BeforeEach(func() {
+		flaky = &flakyProvider{MetadataProvider: NewMemoryProvider(false)}
+		provider = NewResilientProvider(flaky, cfg)
+		now = time.Now()
+		provider.breaker.now = func() time.Time { return now }
+		waits = nil
+		provider.sleep = func(wait time.Duration) { waits = append(waits, wait) }
+
+		var err error
+		app, err = flaky.Add(utils.CreateTestApplicationInfo())
+		gomega.Expect(err).Should(gomega.Succeed())
+	})
+
+	ginkgo.It("should retry the reads with backoff while the backend is unavailable", func() {
+		flaky.errors = []error{unavailable(), unavailable()}
+		retrieved, err := provider.Get(&entities.ApplicationID{Namespace: app.Namespace, ApplicationName: app.ApplicationName, Tag: app.Tag})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(retrieved.CatalogID).Should(gomega.Equal(app.CatalogID))
+		gomega.Expect(flaky.calls).Should(gomega.Equal(3))
+		gomega.Expect(waits).Should(gomega.Equal([]time.Duration{10 * time.Millisecond, 15 * time.Millisecond}))
+		gomega.Expect(provider.Health().State).Should(gomega.Equal(CircuitClosed))
+		gomega.Expect(provider.Health().ConsecutiveFailures).Should(gomega.Equal(0))
+	})
+
+	ginkgo.It("should stop retrying the reads after the maximum retries", func() {
+		flaky.errors = []error{unavailable(), unavailable(), unavailable()}
+		_, err := provider.Get(&entities.ApplicationID{Namespace: app.Namespace, ApplicationName: app.ApplicationName, Tag: app.Tag})
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.Unavailable))
+		gomega.Expect(flaky.calls).Should(gomega.Equal(3))
+		gomega.Expect(provider.Health().ConsecutiveFailures).Should(gomega.Equal(3))
+		gomega.Expect(provider.Health().Ready).Should(gomega.BeTrue())
+	})
+
+	ginkgo.It("should not retry the errors of the requests", func() {
+		_, err := provider.Get(&entities.ApplicationID{Namespace: "not", ApplicationName: "found", Tag: "latest"})
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.NotFound))
+		gomega.Expect(flaky.calls).Should(gomega.Equal(1))
+		gomega.Expect(waits).Should(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should not retry the writes", func() {
+		flaky.errors = []error{unavailable()}
+		err := provider.IncrementDownloads(&entities.ApplicationID{Namespace: app.Namespace, ApplicationName: app.ApplicationName, Tag: app.Tag})
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.Unavailable))
+		gomega.Expect(flaky.calls).Should(gomega.Equal(1))
+	})
+
+	ginkgo.It("should fail fast while the breaker is open and close it when the backend is back", func() {
+		appID := &entities.ApplicationID{Namespace: app.Namespace, ApplicationName: app.ApplicationName, Tag: app.Tag}
+		flaky.errors = []error{unavailable(), unavailable(), unavailable(), unavailable(), unavailable()}
+		_, err := provider.Get(appID)
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+		_, err = provider.Get(appID)
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.Unavailable))
+		// The breaker opens on the fourth failure and rejects the last retry
+		gomega.Expect(flaky.calls).Should(gomega.Equal(4))
+		gomega.Expect(provider.Health().State).Should(gomega.Equal(CircuitOpen))
+		gomega.Expect(provider.Health().Ready).Should(gomega.BeFalse())
+		gomega.Expect(provider.Health().LastError).ShouldNot(gomega.BeEmpty())
+
+		err = provider.IncrementDownloads(appID)
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.Unavailable))
+		gomega.Expect(flaky.calls).Should(gomega.Equal(4))
+
+		// A failed probe opens the breaker again
+		now = now.Add(cfg.BreakerOpenTime)
+		gomega.Expect(provider.Health().State).Should(gomega.Equal(CircuitHalfOpen))
+		err = provider.IncrementDownloads(appID)
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+		gomega.Expect(flaky.calls).Should(gomega.Equal(5))
+		gomega.Expect(provider.Health().State).Should(gomega.Equal(CircuitOpen))
+
+		now = now.Add(cfg.BreakerOpenTime)
+		retrieved, err := provider.Get(appID)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(retrieved.CatalogID).Should(gomega.Equal(app.CatalogID))
+		gomega.Expect(provider.Health()).Should(gomega.Equal(&HealthStatus{State: CircuitClosed, Ready: true}))
+	})
+
+	ginkgo.It("should wait for the backend when it starts", func() {
+		errors := []error{unavailable(), unavailable()}
+		err := provider.WaitForBackend(func() error {
+			if len(errors) == 0 {
+				return nil
+			}
+			err := errors[0]
+			errors = errors[1:]
+			return err
+		})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(waits).Should(gomega.HaveLen(2))
+	})
+
+	ginkgo.It("should fail to start if the backend is not available after the timeout", func() {
+		provider.sleep = time.Sleep
+		provider.cfg.StartupTimeout = 50 * time.Millisecond
+		err := provider.WaitForBackend(unavailable)
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.Unavailable))
+	})
+
+	ginkgo.It("should not wait for the backend if the initialization fails for other reasons", func() {
+		err := provider.WaitForBackend(func() error {
+			return nerrors.NewInternalError("invalid mapping")
+		})
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.Internal))
+		gomega.Expect(waits).Should(gomega.BeEmpty())
+	})
+})
@@ -0,0 +1,291 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metadata
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/catalog-manager/internal/pkg/utils"
+)
+
+const (
+	// DefaultSearchSize with the number of applications returned by a search if the size is not set
+	DefaultSearchSize = 20
+	// maxFacetValues with the maximum number of values returned for each facet
+	maxFacetValues = 50
+	// maxSearchDocuments with the maximum number of tags considered by a search, the applications that
+	// only match in less relevant tags are not returned
+	maxSearchDocuments = 1000
+	// highlightFragmentSize with the number of characters of a highlighted fragment
+	highlightFragmentSize = 150
+	// highlightContext with the number of characters included in a fragment before the first match
+	highlightContext = 50
+	// highlightPreTag and highlightPostTag enclose the matching terms as in the Elastic highlighter
+	highlightPreTag  = "<em>"
+	highlightPostTag = "</em>"
+)
+
+// SearchRequest with the parameters of a full-text search
+type SearchRequest struct {
+	// Text with the free text to search, the applications must contain all its terms. All the applications
+	// match if it is empty, and they are sorted by namespace and application name.
+	Text string
+	// Filters with the applications that can be returned, an application is returned if it matches any of them.
+	// All the applications can be returned if it is empty.
+	Filters []*ListFilter
+	// Facets with the facet values of the applications to return
+	Facets *entities.FacetFilter
+	// From with the number of applications to skip
+	From int
+	// Size with the maximum number of applications to return, DefaultSearchSize if it is not set
+	Size int
+}
+
+// searchField with a field used by the full-text search
+type searchField struct {
+	// name with the name of the field
+	name string
+	// boost with the weight of the field in the score
+	boost float64
+	// value returns the content of the field
+	value func(application *entities.ApplicationInfo) string
+}
+
+// searchFields with the fields used by the full-text search, the description and the keywords are included in
+// the metadata
+var searchFields = []searchField{
+	{name: ApplicationField, boost: 4, value: func(a *entities.ApplicationInfo) string { return a.ApplicationName }},
+	{name: MetadataNameField, boost: 3, value: func(a *entities.ApplicationInfo) string { return a.MetadataName }},
+	{name: MetadataField, boost: 2, value: func(a *entities.ApplicationInfo) string { return a.Metadata }},
+	{name: ReadmeField, boost: 1, value: func(a *entities.ApplicationInfo) string { return a.Readme }},
+}
+
+// searchTerms returns the lowercase terms of a text
+func searchTerms(text string) []string {
+	return strings.Fields(strings.ToLower(text))
+}
+
+// matchesAny checks if an application matches any of the filters
+func matchesAny(filters []*ListFilter, application *entities.ApplicationInfo) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	for _, filter := range filters {
+		if filter.matches(application) {
+			return true
+		}
+	}
+	return false
+}
+
+// searchMatch with an application tag that matches a search
+type searchMatch struct {
+	// application with the tag
+	application *entities.ApplicationInfo
+	// score with the relevance of the tag
+	score float64
+	// highlights with the fragments of the fields that contain the terms
+	highlights map[string][]string
+}
+
+// applicationFacets returns the facets of the metadata of an application tag
+func applicationFacets(application *entities.ApplicationInfo) *entities.ApplicationFacets {
+	_, metadata, err := utils.IsMetadata([]byte(application.Metadata))
+	if err != nil {
+		return entities.NewApplicationFacets(nil)
+	}
+	return entities.NewApplicationFacets(metadata)
+}
+
+// matchApplication returns how an application tag matches the terms, or nil if any term is not found in its fields.
+// The score adds the boost of the fields that contain each term, all the tags match with score 0 if there are
+// no terms.
+func matchApplication(application *entities.ApplicationInfo, terms []string) *searchMatch {
+	match := &searchMatch{application: application, highlights: make(map[string][]string)}
+	found := make(map[string]bool, len(terms))
+	for _, field := range searchFields {
+		value := field.value(application)
+		lower := strings.ToLower(value)
+		matched := false
+		for _, term := range terms {
+			if strings.Contains(lower, term) {
+				match.score += field.boost
+				found[term] = true
+				matched = true
+			}
+		}
+		if matched {
+			match.highlights[field.name] = []string{highlight(value, terms)}
+		}
+	}
+	if len(found) != len(terms) {
+		return nil
+	}
+	return match
+}
+
+// indexRunes returns the position of needle in haystack starting at from, or -1 if it is not found
+func indexRunes(haystack []rune, needle []rune, from int) int {
+	for i := from; i+len(needle) <= len(haystack); i++ {
+		if string(haystack[i:i+len(needle)]) == string(needle) {
+			return i
+		}
+	}
+	return -1
+}
+
+// highlight returns a fragment of the value around the first term found, with the terms enclosed in
+// highlightPreTag and highlightPostTag
+func highlight(value string, terms []string) string {
+	runes := []rune(value)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+	termRunes := make([][]rune, 0, len(terms))
+	for _, term := range terms {
+		termRunes = append(termRunes, []rune(term))
+	}
+
+	// find the first term
+	first := -1
+	for _, term := range termRunes {
+		if pos := indexRunes(lower, term, 0); pos != -1 && (first == -1 || pos < first) {
+			first = pos
+		}
+	}
+	start := 0
+	if first > highlightContext {
+		start = first - highlightContext
+	}
+	end := start + highlightFragmentSize
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	var fragment strings.Builder
+	for i := start; i < end; {
+		// longest term starting at this position
+		length := 0
+		for _, term := range termRunes {
+			if len(term) > length && indexRunes(lower[:end], term, i) == i {
+				length = len(term)
+			}
+		}
+		if length == 0 {
+			fragment.WriteRune(runes[i])
+			i++
+			continue
+		}
+		fragment.WriteString(highlightPreTag)
+		fragment.WriteString(string(runes[i : i+length]))
+		fragment.WriteString(highlightPostTag)
+		i += length
+	}
+	return strings.TrimSpace(fragment.String())
+}
+
+// searchGroup with the tags of an application that match a search
+type searchGroup struct {
+	// best with the most relevant tag
+	best *searchMatch
+	// applications with the tags of the application
+	applications []*entities.ApplicationInfo
+}
+
+// buildSearchResult groups the matching tags by application and returns the requested page of applications sorted
+// by the score of their most relevant tag
+func buildSearchResult(matches []*searchMatch, from int, size int) *entities.SearchResult {
+	if size <= 0 {
+		size = DefaultSearchSize
+	}
+	groups := make([]*searchGroup, 0)
+	groupIndex := make(map[string]*searchGroup)
+	for _, match := range matches {
+		key := generateCatalogID(match.application.Namespace, match.application.ApplicationName, "")
+		group, exists := groupIndex[key]
+		if !exists {
+			group = &searchGroup{best: match}
+			groupIndex[key] = group
+			groups = append(groups, group)
+		} else if match.score > group.best.score {
+			group.best = match
+		}
+		group.applications = append(group.applications, match.application)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].best.score != groups[j].best.score {
+			return groups[i].best.score > groups[j].best.score
+		}
+		if groups[i].best.application.Namespace != groups[j].best.application.Namespace {
+			return groups[i].best.application.Namespace < groups[j].best.application.Namespace
+		}
+		return groups[i].best.application.ApplicationName < groups[j].best.application.ApplicationName
+	})
+
+	result := &entities.SearchResult{Total: len(groups), Hits: make([]*entities.SearchHit, 0)}
+	if from < 0 || from >= len(groups) {
+		return result
+	}
+	page := groups[from:]
+	if len(page) > size {
+		page = page[:size]
+	}
+	// the groups are different applications, so the builder returns a summary for each of them
+	builder := newSummaryBuilder()
+	for _, group := range page {
+		sortApplications(group.applications)
+		for _, application := range group.applications {
+			builder.Add(application)
+		}
+	}
+	summaryList, _ := builder.Build()
+	for i, group := range page {
+		result.Hits = append(result.Hits, &entities.SearchHit{
+			Application: summaryList[i],
+			Score:       group.best.score,
+			Highlights:  group.best.highlights,
+		})
+	}
+	return result
+}
+
+// searchApplications returns the result of a search over a list of application tags
+func searchApplications(applications []*entities.ApplicationInfo, request *SearchRequest) *entities.SearchResult {
+	terms := searchTerms(request.Text)
+	matches := make([]*searchMatch, 0)
+	counter := entities.NewFacetCounter()
+	for _, application := range applications {
+		if !matchesAny(request.Filters, application) {
+			continue
+		}
+		facets := applicationFacets(application)
+		if !request.Facets.Matches(facets) {
+			continue
+		}
+		if match := matchApplication(application, terms); match != nil {
+			matches = append(matches, match)
+			counter.Add(facets)
+		}
+	}
+	result := buildSearchResult(matches, request.From, request.Size)
+	result.Facets = counter.Build(maxFacetValues)
+	return result
+}
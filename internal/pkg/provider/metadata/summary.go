@@ -0,0 +1,132 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metadata
+
+import (
+	"sort"
+
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/catalog-manager/internal/pkg/utils"
+	"github.com/rs/zerolog/log"
+)
+
+// getCacheFilter returns the filter of the applications included in the catalog summary, as the ElasticProvider
+// cache it only includes the public applications if the authorization is enabled
+func getCacheFilter(authEnable bool) *ListFilter {
+	if authEnable {
+		private := false
+		return &ListFilter{Private: &private}
+	}
+	return &ListFilter{}
+}
+
+// getSummaryFilter returns the filter used to list the application summaries. As in the ElasticProvider,
+// the applications of the catalog summary are returned when the filter requests the public applications
+// of all the namespaces.
+func getSummaryFilter(filter *ListFilter, authEnable bool) *ListFilter {
+	if filter != nil && (filter.Namespace == nil || *filter.Namespace == "") && (filter.Private == nil || !*filter.Private) {
+		return getCacheFilter(authEnable)
+	}
+	return filter
+}
+
+// sortApplications sorts the applications by namespace, application name and tag as expected by the summaryBuilder
+func sortApplications(applications []*entities.ApplicationInfo) {
+	sort.Slice(applications, func(i, j int) bool {
+		if applications[i].Namespace != applications[j].Namespace {
+			return applications[i].Namespace < applications[j].Namespace
+		}
+		if applications[i].ApplicationName != applications[j].ApplicationName {
+			return applications[i].ApplicationName < applications[j].ApplicationName
+		}
+		return applications[i].Tag < applications[j].Tag
+	})
+}
+
+// summaryBuilder groups the application tags, sorted by namespace, application name and tag,
+// in application summaries counting the namespaces, applications and tags
+type summaryBuilder struct {
+	// summaryList with the summary of each application
+	summaryList []*entities.AppSummary
+	// summary with the counters of the catalog
+	summary entities.Summary
+}
+
+// newSummaryBuilder creates an empty summaryBuilder
+func newSummaryBuilder() *summaryBuilder {
+	return &summaryBuilder{summaryList: make([]*entities.AppSummary, 0)}
+}
+
+// Add includes a tag in the summary, the tags must be added sorted by namespace, application name and tag
+func (b *summaryBuilder) Add(application *entities.ApplicationInfo) {
+	// new version
+	b.summary.NumTags++
+
+	var metadataLogo []entities.ApplicationLogo
+	_, metadata, err := utils.IsMetadata([]byte(application.Metadata))
+	if err != nil {
+		// If returns the error, the catalog could be inaccessible. It could be better not return an error and allows to continue listing
+		log.Warn().Str("error", err.Error()).Msg("error getting metadata")
+	} else {
+		metadataLogo = metadata.Logo
+	}
+
+	// check if the last entry has the same namespace and applicationName as the newer one
+	if len(b.summaryList) > 0 {
+		last := b.summaryList[len(b.summaryList)-1]
+		if last.Namespace == application.Namespace && last.ApplicationName == application.ApplicationName {
+			last.TagMetadataName[application.Tag] = application.MetadataName
+			if metadataLogo != nil {
+				last.MetadataLogo[application.Tag] = metadataLogo
+			}
+			if application.LastUpdated.After(last.LastUpdated) {
+				last.LastUpdated = application.LastUpdated
+			}
+			last.Downloads += application.Downloads
+			return
+		}
+		if last.Namespace != application.Namespace {
+			// new namespace
+			b.summary.NumNamespaces++
+		}
+	} else {
+		// new namespace
+		b.summary.NumNamespaces++
+	}
+
+	// new application
+	b.summary.NumApplications++
+	newAppSummary := &entities.AppSummary{
+		Namespace:       application.Namespace,
+		ApplicationName: application.ApplicationName,
+		TagMetadataName: map[string]string{application.Tag: application.MetadataName},
+		MetadataLogo:    map[string][]entities.ApplicationLogo{},
+		Private:         application.Private,
+		LastUpdated:     application.LastUpdated,
+		Downloads:       application.Downloads,
+	}
+	if metadataLogo != nil {
+		newAppSummary.MetadataLogo[application.Tag] = metadataLogo
+	}
+	b.summaryList = append(b.summaryList, newAppSummary)
+}
+
+// Build returns the application summaries and the catalog summary
+func (b *summaryBuilder) Build() ([]*entities.AppSummary, *entities.Summary) {
+	summary := b.summary
+	return b.summaryList, &summary
+}
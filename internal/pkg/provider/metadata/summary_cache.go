@@ -0,0 +1,237 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metadata
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+)
+
+// cacheChange with a change of a tag applied to the summaryCache
+type cacheChange struct {
+	// id with the document identifier of the tag
+	id string
+	// application with the tag stored, nil if the tag has been removed
+	application *entities.ApplicationInfo
+}
+
+// summaryCache keeps the summaries of the applications that match a filter. The changes of the tags are applied
+// as they are stored, so the summaries are up to date without listing all the applications again. The summaries
+// returned are never modified, a change replaces the summary of its application and the list that contains it.
+type summaryCache struct {
+	// filter with the applications included in the cache
+	filter *ListFilter
+	// tags with the tags in the cache indexed by document identifier
+	tags map[string]*entities.ApplicationInfo
+	// applications with the document identifiers of the tags of each application indexed by namespace and name
+	applications map[entities.ApplicationID]map[string]bool
+	// summaries with the summary of each application sorted by namespace and application name
+	summaries []*entities.AppSummary
+	// summary with the counters of the cached applications, nil until the cache is filled
+	summary *entities.Summary
+	// refreshing is true while the applications are listed to fill the cache
+	refreshing bool
+	// pending with the changes applied while the cache is refreshed, they are applied again on the listed tags
+	pending []cacheChange
+	// Mutex to protect the cache
+	sync.Mutex
+}
+
+// newSummaryCache creates an empty cache of the applications that match the filter
+func newSummaryCache(filter *ListFilter) *summaryCache {
+	return &summaryCache{
+		filter:       filter,
+		tags:         make(map[string]*entities.ApplicationInfo),
+		applications: make(map[entities.ApplicationID]map[string]bool),
+		summaries:    make([]*entities.AppSummary, 0),
+	}
+}
+
+// Get returns the application summaries and the catalog summary, the summary is nil if the cache has not been filled
+func (c *summaryCache) Get() ([]*entities.AppSummary, *entities.Summary) {
+	c.Lock()
+	defer c.Unlock()
+	return c.summaries, c.summary
+}
+
+// Put adds or replaces a tag, it is removed from the cache if it does not match the filter anymore
+func (c *summaryCache) Put(id string, application *entities.ApplicationInfo) {
+	cached := *application
+	// the readme is not part of the summaries
+	cached.Readme = ""
+	c.change(cacheChange{id: id, application: &cached})
+}
+
+// Remove removes a tag from the cache
+func (c *summaryCache) Remove(id string) {
+	c.change(cacheChange{id: id})
+}
+
+// change applies a change, and keeps it to apply it again after the refresh in progress
+func (c *summaryCache) change(change cacheChange) {
+	c.Lock()
+	defer c.Unlock()
+	if c.refreshing {
+		c.pending = append(c.pending, change)
+	}
+	c.apply(change)
+}
+
+// StartRefresh records the changes from now on, so they are not lost when the cache is replaced by the
+// tags listed. The refreshes must not run concurrently.
+func (c *summaryCache) StartRefresh() {
+	c.Lock()
+	defer c.Unlock()
+	c.refreshing = true
+	c.pending = nil
+}
+
+// CancelRefresh stops recording the changes when the tags cannot be listed
+func (c *summaryCache) CancelRefresh() {
+	c.Lock()
+	defer c.Unlock()
+	c.refreshing = false
+	c.pending = nil
+}
+
+// Refresh replaces the tags of the cache by the ones listed since StartRefresh was called, the changes
+// applied meanwhile are applied again as they may not be included in the list
+func (c *summaryCache) Refresh(tags map[string]*entities.ApplicationInfo) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.tags = make(map[string]*entities.ApplicationInfo, len(tags))
+	c.applications = make(map[entities.ApplicationID]map[string]bool)
+	applications := make([]*entities.ApplicationInfo, 0, len(tags))
+	for id, application := range tags {
+		if c.filter.matches(application) {
+			c.addTag(id, application)
+			applications = append(applications, application)
+		}
+	}
+	sortApplications(applications)
+	builder := newSummaryBuilder()
+	for _, application := range applications {
+		builder.Add(application)
+	}
+	c.summaries, c.summary = builder.Build()
+
+	for _, change := range c.pending {
+		c.apply(change)
+	}
+	c.refreshing = false
+	c.pending = nil
+}
+
+// applicationKey returns the key of the application of a tag
+func applicationKey(application *entities.ApplicationInfo) entities.ApplicationID {
+	return entities.ApplicationID{Namespace: application.Namespace, ApplicationName: application.ApplicationName}
+}
+
+// addTag indexes a tag. The caller must hold the lock.
+func (c *summaryCache) addTag(id string, application *entities.ApplicationInfo) {
+	c.tags[id] = application
+	key := applicationKey(application)
+	if c.applications[key] == nil {
+		c.applications[key] = make(map[string]bool)
+	}
+	c.applications[key][id] = true
+}
+
+// removeTag removes a tag from the index. The caller must hold the lock.
+func (c *summaryCache) removeTag(id string, application *entities.ApplicationInfo) {
+	delete(c.tags, id)
+	key := applicationKey(application)
+	delete(c.applications[key], id)
+	if len(c.applications[key]) == 0 {
+		delete(c.applications, key)
+	}
+}
+
+// apply updates the tags and the summary of the application changed. The caller must hold the lock.
+func (c *summaryCache) apply(change cacheChange) {
+	previous, exists := c.tags[change.id]
+	if exists {
+		c.removeTag(change.id, previous)
+	}
+	if change.application != nil && c.filter.matches(change.application) {
+		c.addTag(change.id, change.application)
+	}
+
+	if exists {
+		c.updateSummary(applicationKey(previous))
+	}
+	if change.application != nil && (!exists || applicationKey(previous) != applicationKey(change.application)) {
+		c.updateSummary(applicationKey(change.application))
+	}
+}
+
+// updateSummary replaces the summary of an application by one built from its cached tags, and updates the
+// catalog counters. The caller must hold the lock.
+func (c *summaryCache) updateSummary(key entities.ApplicationID) {
+	if c.summary == nil {
+		// the cache has not been filled yet
+		return
+	}
+
+	var updated *entities.AppSummary
+	if ids, exists := c.applications[key]; exists {
+		tags := make([]*entities.ApplicationInfo, 0, len(ids))
+		for id := range ids {
+			tags = append(tags, c.tags[id])
+		}
+		sortApplications(tags)
+		builder := newSummaryBuilder()
+		for _, tag := range tags {
+			builder.Add(tag)
+		}
+		built, _ := builder.Build()
+		updated = built[0]
+	}
+
+	index := sort.Search(len(c.summaries), func(i int) bool {
+		if c.summaries[i].Namespace != key.Namespace {
+			return c.summaries[i].Namespace > key.Namespace
+		}
+		return c.summaries[i].ApplicationName >= key.ApplicationName
+	})
+	found := index < len(c.summaries) && c.summaries[index].Namespace == key.Namespace &&
+		c.summaries[index].ApplicationName == key.ApplicationName
+
+	summaries := make([]*entities.AppSummary, 0, len(c.summaries)+1)
+	summaries = append(summaries, c.summaries[:index]...)
+	if updated != nil {
+		summaries = append(summaries, updated)
+	}
+	if found {
+		index++
+	}
+	summaries = append(summaries, c.summaries[index:]...)
+	c.summaries = summaries
+
+	namespaces := make(map[string]bool)
+	for application := range c.applications {
+		namespaces[application.Namespace] = true
+	}
+	c.summary = &entities.Summary{
+		NumNamespaces:   len(namespaces),
+		NumApplications: len(c.applications),
+		NumTags:         len(c.tags),
+	}
+}
@@ -0,0 +1,163 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metadata
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/catalog-manager/internal/pkg/utils"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Summary cache consistency", func() {
+
+	// catalog with the tags stored, the cache must contain the summaries built from them
+	var catalog map[string]*entities.ApplicationInfo
+	var random *rand.Rand
+
+	ginkgo.BeforeEach(func() {
+		catalog = make(map[string]*entities.ApplicationInfo)
+		random = rand.New(rand.NewSource(ginkgo.GinkgoRandomSeed()))
+	})
+
+	// expected returns the summaries of the catalog tags that match the filter
+	expected := func(filter *ListFilter) ([]*entities.AppSummary, *entities.Summary) {
+		applications := make([]*entities.ApplicationInfo, 0)
+		for _, application := range catalog {
+			if filter.matches(application) {
+				cached := *application
+				cached.Readme = ""
+				applications = append(applications, &cached)
+			}
+		}
+		sortApplications(applications)
+		builder := newSummaryBuilder()
+		for _, application := range applications {
+			builder.Add(application)
+		}
+		return builder.Build()
+	}
+
+	// snapshot returns a copy of the catalog as it would be listed to refresh the cache
+	snapshot := func() map[string]*entities.ApplicationInfo {
+		tags := make(map[string]*entities.ApplicationInfo, len(catalog))
+		for id, application := range catalog {
+			copied := *application
+			tags[id] = &copied
+		}
+		return tags
+	}
+
+	// randomChange applies a random change to the catalog and to the cache: adding or replacing a tag,
+	// removing a tag or changing the visibility of an application
+	randomChange := func(cache *summaryCache) {
+		namespace := fmt.Sprintf("ns%d", random.Intn(3))
+		applicationName := fmt.Sprintf("app%d", random.Intn(3))
+		switch random.Intn(3) {
+		case 0:
+			application := utils.CreateTestApplicationInfo()
+			if random.Intn(2) == 0 {
+				application = utils.CreateTestApplicationInfoWithoutLogo()
+			}
+			application.Namespace = namespace
+			application.ApplicationName = applicationName
+			application.Tag = fmt.Sprintf("v%d", random.Intn(3))
+			application.Private = random.Intn(2) == 0
+			application.LastUpdated = time.Unix(random.Int63n(1000), 0).UTC()
+			application.Downloads = random.Int63n(10)
+			id := generateDocumentID(namespace, applicationName, application.Tag)
+			stored := *application
+			catalog[id] = &stored
+			cache.Put(id, application)
+		case 1:
+			id := generateDocumentID(namespace, applicationName, fmt.Sprintf("v%d", random.Intn(3)))
+			delete(catalog, id)
+			cache.Remove(id)
+		case 2:
+			private := random.Intn(2) == 0
+			for id, application := range catalog {
+				if application.Namespace == namespace && application.ApplicationName == applicationName {
+					application.Private = private
+					cache.Put(id, application)
+				}
+			}
+		}
+	}
+
+	for _, authEnable := range []bool{true, false} {
+		filter := getCacheFilter(authEnable)
+
+		ginkgo.Context(fmt.Sprintf("with authorization enabled %t", authEnable), func() {
+			var cache *summaryCache
+
+			ginkgo.BeforeEach(func() {
+				cache = newSummaryCache(filter)
+				cache.StartRefresh()
+				cache.Refresh(snapshot())
+			})
+
+			ginkgo.It("should not return a summary until the cache is filled", func() {
+				_, summary := newSummaryCache(filter).Get()
+				gomega.Expect(summary).Should(gomega.BeNil())
+			})
+
+			ginkgo.It("should be equal to the catalog after every change", func() {
+				for i := 0; i < 500; i++ {
+					randomChange(cache)
+					expectedList, expectedSummary := expected(filter)
+					summaryList, summary := cache.Get()
+					gomega.Expect(summaryList).Should(gomega.Equal(expectedList))
+					gomega.Expect(summary).Should(gomega.Equal(expectedSummary))
+				}
+			})
+
+			ginkgo.It("should keep the changes stored while it is refreshed", func() {
+				for i := 0; i < 50; i++ {
+					randomChange(cache)
+					cache.StartRefresh()
+					listed := snapshot()
+					for j := 0; j < 10; j++ {
+						randomChange(cache)
+					}
+					cache.Refresh(listed)
+
+					expectedList, expectedSummary := expected(filter)
+					summaryList, summary := cache.Get()
+					gomega.Expect(summaryList).Should(gomega.Equal(expectedList))
+					gomega.Expect(summary).Should(gomega.Equal(expectedSummary))
+				}
+			})
+
+			ginkgo.It("should not modify the summaries already returned", func() {
+				for i := 0; i < 20; i++ {
+					randomChange(cache)
+				}
+				summaryList, summary := cache.Get()
+				returnedList, returnedSummary := expected(filter)
+				for i := 0; i < 100; i++ {
+					randomChange(cache)
+				}
+				gomega.Expect(summaryList).Should(gomega.Equal(returnedList))
+				gomega.Expect(summary).Should(gomega.Equal(returnedSummary))
+			})
+		})
+	}
+})
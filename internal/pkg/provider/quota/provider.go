@@ -0,0 +1,31 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package quota
+
+import "github.com/napptive/catalog-manager/internal/pkg/entities"
+
+// QuotaProvider is an interface with the operations to manage the namespace quotas
+type QuotaProvider interface {
+	// GetQuota returns the quota of a namespace, the default one if it has no override
+	GetQuota(namespace string) (*entities.Quota, error)
+	// SetQuota overrides the quota of a namespace
+	SetQuota(namespace string, quota entities.Quota) error
+	// RemoveQuota removes the override of a namespace, so the default quota is applied
+	RemoveQuota(namespace string) error
+	// ListOverrides returns the quotas overridden indexed by namespace
+	ListOverrides() (map[string]entities.Quota, error)
+}
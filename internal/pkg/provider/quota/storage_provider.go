@@ -0,0 +1,66 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package quota
+
+import (
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/catalog-manager/internal/pkg/storage"
+	"github.com/rs/zerolog/log"
+)
+
+// storageQuotaProvider stores the quota overrides with the applications, so all the replicas that share the
+// storage apply the same quotas
+type storageQuotaProvider struct {
+	// stManager with the storage of the overrides
+	stManager storage.StorageManager
+	// defaults with the quota of the namespaces without override
+	defaults entities.Quota
+}
+
+// NewStorageQuotaProvider returns a QuotaProvider that stores the overrides through the storage manager
+func NewStorageQuotaProvider(stManager storage.StorageManager, defaults entities.Quota) QuotaProvider {
+	return &storageQuotaProvider{stManager: stManager, defaults: defaults}
+}
+
+// GetQuota returns the quota of a namespace, the default one if it has no override
+func (s *storageQuotaProvider) GetQuota(namespace string) (*entities.Quota, error) {
+	quota, err := s.stManager.GetQuotaOverride(namespace)
+	if err != nil {
+		log.Err(err).Str("namespace", namespace).Msg("error getting quota")
+		return nil, err
+	}
+	if quota == nil {
+		defaults := s.defaults
+		return &defaults, nil
+	}
+	return quota, nil
+}
+
+// SetQuota overrides the quota of a namespace
+func (s *storageQuotaProvider) SetQuota(namespace string, quota entities.Quota) error {
+	return s.stManager.StoreQuotaOverride(namespace, quota)
+}
+
+// RemoveQuota removes the override of a namespace, so the default quota is applied
+func (s *storageQuotaProvider) RemoveQuota(namespace string) error {
+	return s.stManager.RemoveQuotaOverride(namespace)
+}
+
+// ListOverrides returns the quotas overridden indexed by namespace
+func (s *storageQuotaProvider) ListOverrides() (map[string]entities.Quota, error) {
+	return s.stManager.ListQuotaOverrides()
+}
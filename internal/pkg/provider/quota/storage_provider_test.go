@@ -0,0 +1,74 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package quota
+
+import (
+	"os"
+
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/catalog-manager/internal/pkg/storage"
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Storage quota provider", func() {
+
+	var dir string
+	var provider QuotaProvider
+	defaults := entities.Quota{MaxBytes: 1024, MaxApplications: 2}
+
+	ginkgo.BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "quota")
+		gomega.Expect(err).Should(gomega.Succeed())
+		provider = NewStorageQuotaProvider(storage.NewStorageManager(dir), defaults)
+	})
+
+	ginkgo.AfterEach(func() {
+		_ = os.RemoveAll(dir)
+	})
+
+	ginkgo.It("should return the default quota without override", func() {
+		quota, err := provider.GetQuota("namespace")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(*quota).Should(gomega.Equal(defaults))
+	})
+
+	ginkgo.It("should override and restore the quota of a namespace", func() {
+		override := entities.Quota{MaxTagsPerApplication: 5}
+		err := provider.SetQuota("namespace", override)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		// the overrides are seen by the other replicas
+		quota, err := NewStorageQuotaProvider(storage.NewStorageManager(dir), defaults).GetQuota("namespace")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(*quota).Should(gomega.Equal(override))
+		overrides, err := provider.ListOverrides()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(overrides).Should(gomega.Equal(map[string]entities.Quota{"namespace": override}))
+
+		err = provider.RemoveQuota("namespace")
+		gomega.Expect(err).Should(gomega.Succeed())
+		quota, err = provider.GetQuota("namespace")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(*quota).Should(gomega.Equal(defaults))
+
+		err = provider.RemoveQuota("namespace")
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.NotFound))
+	})
+})
@@ -0,0 +1,474 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package admin
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/catalog-manager/internal/pkg/utils"
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog/log"
+)
+
+// A backup is a tgz archive that starts with a manifest followed by the application tags. Each tag is stored
+// in its own directory with its metadata and the digest of its files, followed by the files:
+//
+//	backup.json
+//	<namespace>/<application>/<tag>/application.json
+//	<namespace>/<application>/<tag>/files/<path>
+//
+// The archive is written and read sequentially, so only the files of a tag are kept in memory.
+
+const (
+	// backupVersion with the version of the backup format
+	backupVersion = 1
+	// backupManifestFile with the name of the manifest, the first entry of the archive
+	backupManifestFile = "backup.json"
+	// backupApplicationFile with the name of the metadata entry of each application tag
+	backupApplicationFile = "application.json"
+	// backupFilesDir with the directory of the files of each application tag
+	backupFilesDir = "files"
+)
+
+// backupManifest with the description of a backup
+type backupManifest struct {
+	// Version with the version of the backup format
+	Version int
+	// CreatedAt with the time the backup was started
+	CreatedAt time.Time
+	// Namespaces with the namespaces included in the backup
+	Namespaces []string
+}
+
+// backupFile with the description of an application file included in a backup
+type backupFile struct {
+	// Path with the path of the file relative to the application directory
+	Path string
+	// Size with the size of the file in bytes
+	Size int64
+	// SHA256 with the hex encoded digest of the file
+	SHA256 string
+}
+
+// backupApplication with the metadata and the files of an application tag included in a backup
+type backupApplication struct {
+	// Application with the application metadata
+	Application *entities.ApplicationInfo
+	// Files with the files of the application
+	Files []*backupFile
+}
+
+// backupDirectory returns the directory of an application tag in a backup
+func backupDirectory(appID *entities.ApplicationID) string {
+	return path.Join(appID.Namespace, appID.ApplicationName, appID.Tag)
+}
+
+// writeBackupEntry adds a file to a backup
+func writeBackupEntry(tw *tar.Writer, name string, data []byte) error {
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(data)),
+		ModTime:  time.Now(),
+	}); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// writeBackupJSON adds a file with the JSON encoding of value to a backup
+func writeBackupJSON(tw *tar.Writer, name string, value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeBackupEntry(tw, name, data)
+}
+
+// writeBackupApplication adds the metadata and the files of an application tag to a backup
+func writeBackupApplication(tw *tar.Writer, app *entities.ApplicationInfo, files []*entities.FileInfo, result *entities.BackedUpApplication) error {
+	// the storage returns the paths under ./<name>/
+	prefix := fmt.Sprintf("./%s/", app.ApplicationName)
+	described := &backupApplication{Application: app, Files: make([]*backupFile, 0, len(files))}
+	for _, file := range files {
+		sum := sha256.Sum256(file.Data)
+		described.Files = append(described.Files, &backupFile{
+			Path:   strings.TrimPrefix(file.Path, prefix),
+			Size:   int64(len(file.Data)),
+			SHA256: hex.EncodeToString(sum[:]),
+		})
+		result.Bytes += int64(len(file.Data))
+	}
+	result.Files = len(files)
+
+	dir := backupDirectory(app.ToApplicationID())
+	if err := writeBackupJSON(tw, path.Join(dir, backupApplicationFile), described); err != nil {
+		return err
+	}
+	for index, file := range files {
+		if err := writeBackupEntry(tw, path.Join(dir, backupFilesDir, described.Files[index].Path), file.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Backup writes in w a tgz archive with the metadata and the files of the application tags of the namespaces
+// requested, or of all of them. The metadata and the files of each tag are read together, the applications
+// added or removed while the backup is running may not be included. The tags whose files cannot be read are
+// reported with an error and are not included in the archive.
+func (m *manager) Backup(options entities.BackupOptions, w io.Writer) (*entities.BackupReport, error) {
+	namespaces := options.Namespaces
+	if len(namespaces) == 0 {
+		found, err := m.listApplicationNamespaces()
+		if err != nil {
+			log.Err(err).Msg("Unable to back up the catalog, error listing namespaces")
+			return nil, err
+		}
+		namespaces = sortNamespaces(found)
+	}
+
+	report := &entities.BackupReport{Namespaces: namespaces, Applications: make([]*entities.BackedUpApplication, 0)}
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+	manifest := &backupManifest{Version: backupVersion, CreatedAt: time.Now().UTC(), Namespaces: namespaces}
+	if err := writeBackupJSON(tw, backupManifestFile, manifest); err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "unable to write the backup")
+	}
+
+	for _, namespace := range namespaces {
+		applications, err := m.provider.List(namespace)
+		if err != nil {
+			log.Err(err).Str("namespace", namespace).Msg("Unable to back up the catalog, error listing applications")
+			return nil, err
+		}
+		sort.Slice(applications, func(i, j int) bool {
+			return applications[i].ToApplicationID().String() < applications[j].ToApplicationID().String()
+		})
+		for _, app := range applications {
+			result := &entities.BackedUpApplication{ApplicationID: app.ToApplicationID()}
+			report.Applications = append(report.Applications, result)
+			files, err := m.stManager.GetApplication(app.Namespace, app.ApplicationName, app.Tag, entities.DownloadFormatNone)
+			if err != nil {
+				log.Err(err).Str("appID", result.ApplicationID.String()).Msg("Unable to back up the application")
+				result.Error = err.Error()
+				continue
+			}
+			if err = writeBackupApplication(tw, app, files, result); err != nil {
+				return nil, nerrors.NewInternalErrorFrom(err, "unable to write the backup")
+			}
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "unable to write the backup")
+	}
+	if err := zw.Close(); err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "unable to write the backup")
+	}
+	log.Info().Strs("namespaces", namespaces).Int("applications", len(report.Applications)).Msg("Catalog backup finished")
+	return report, nil
+}
+
+// backupTag with an application tag read from a backup
+type backupTag struct {
+	// dir with the directory of the tag in the backup
+	dir string
+	// described with the metadata and the files described in the backup
+	described *backupApplication
+	// files with the content of the files read indexed by path
+	files map[string][]byte
+	// err with the error found reading the files
+	err error
+	// result with the result of restoring the tag, nil if its namespace is not restored
+	result *entities.RestoredApplication
+}
+
+// isTagFile checks if an entry of the backup is a file of the tag
+func (t *backupTag) isTagFile(name string) bool {
+	return t != nil && strings.HasPrefix(name, path.Join(t.dir, backupFilesDir)+"/")
+}
+
+// addFile reads an entry of the backup with a file of the tag
+func (t *backupTag) addFile(name string, reader io.Reader) error {
+	if t.result == nil {
+		return nil
+	}
+	filePath := strings.TrimPrefix(name, path.Join(t.dir, backupFilesDir)+"/")
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nerrors.NewInvalidArgumentErrorFrom(err, "invalid backup, unable to read %s", name)
+	}
+	if _, exists := t.files[filePath]; exists && t.err == nil {
+		t.err = nerrors.NewDataLossError("file %s is duplicated in the backup", filePath)
+	}
+	t.files[filePath] = data
+	return nil
+}
+
+// verify checks that the files read match the ones described in the backup, returning them
+func (t *backupTag) verify() ([]*entities.FileInfo, error) {
+	if t.err != nil {
+		return nil, t.err
+	}
+	files := make([]*entities.FileInfo, 0, len(t.described.Files))
+	for _, described := range t.described.Files {
+		data, exists := t.files[described.Path]
+		if !exists {
+			return nil, nerrors.NewDataLossError("file %s not found in the backup", described.Path)
+		}
+		delete(t.files, described.Path)
+		sum := sha256.Sum256(data)
+		if int64(len(data)) != described.Size || hex.EncodeToString(sum[:]) != described.SHA256 {
+			return nil, nerrors.NewDataLossError("checksum mismatch in file %s", described.Path)
+		}
+		files = append(files, &entities.FileInfo{Path: described.Path, Data: data})
+	}
+	if len(t.files) > 0 {
+		undescribed := make([]string, 0, len(t.files))
+		for filePath := range t.files {
+			undescribed = append(undescribed, filePath)
+		}
+		sort.Strings(undescribed)
+		return nil, nerrors.NewDataLossError("files not described in the backup: %s", strings.Join(undescribed, ", "))
+	}
+	return utils.SanitizeFilePaths(files)
+}
+
+// validBackupName checks that a namespace, application name or tag can be used as a directory of the backup
+func validBackupName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.Contains(name, "/")
+}
+
+// readBackupManifest reads the first entry of a backup
+func readBackupManifest(tr *tar.Reader) (*backupManifest, error) {
+	header, err := tr.Next()
+	if err != nil {
+		return nil, nerrors.NewInvalidArgumentErrorFrom(err, "invalid backup, unable to read the manifest")
+	}
+	if header.Name != backupManifestFile {
+		return nil, nerrors.NewInvalidArgumentError("invalid backup, the manifest must be the first entry")
+	}
+	manifest := &backupManifest{}
+	if err = json.NewDecoder(tr).Decode(manifest); err != nil {
+		return nil, nerrors.NewInvalidArgumentErrorFrom(err, "invalid backup, unable to read the manifest")
+	}
+	if manifest.Version != backupVersion {
+		return nil, nerrors.NewInvalidArgumentError("unsupported backup version %d", manifest.Version)
+	}
+	return manifest, nil
+}
+
+// readBackupTag reads the metadata entry of an application tag
+func readBackupTag(name string, reader io.Reader) (*backupTag, error) {
+	if path.Base(name) != backupApplicationFile {
+		return nil, nerrors.NewInvalidArgumentError("invalid backup, unexpected entry %s", name)
+	}
+	described := &backupApplication{}
+	if err := json.NewDecoder(reader).Decode(described); err != nil {
+		return nil, nerrors.NewInvalidArgumentErrorFrom(err, "invalid backup, unable to read %s", name)
+	}
+	app := described.Application
+	if app == nil || !validBackupName(app.Namespace) || !validBackupName(app.ApplicationName) || !validBackupName(app.Tag) {
+		return nil, nerrors.NewInvalidArgumentError("invalid backup, %s does not describe a valid application", name)
+	}
+	dir := backupDirectory(app.ToApplicationID())
+	if path.Dir(name) != dir {
+		return nil, nerrors.NewInvalidArgumentError("invalid backup, %s does not match the application %s", name, app.ToApplicationID().String())
+	}
+	return &backupTag{dir: dir, described: described, files: make(map[string][]byte)}, nil
+}
+
+// Restore reads a backup from r and stores its application tags, or the ones of the namespaces requested.
+// The files of each tag are verified with the digests of the backup before storing it, the tags that do not
+// match are reported with an error and are not stored. The tags that already exist are only replaced if
+// overwrite is set. An error is returned if the backup cannot be read, the tags found before are restored.
+func (m *manager) Restore(options entities.RestoreOptions, r io.Reader) (*entities.RestoreReport, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nerrors.NewInvalidArgumentErrorFrom(err, "invalid backup")
+	}
+	tr := tar.NewReader(zr)
+	manifest, err := readBackupManifest(tr)
+	if err != nil {
+		return nil, err
+	}
+
+	included := make(map[string]bool, len(manifest.Namespaces))
+	for _, namespace := range manifest.Namespaces {
+		included[namespace] = true
+	}
+	restored := included
+	if len(options.Namespaces) > 0 {
+		restored = make(map[string]bool, len(options.Namespaces))
+		for _, namespace := range options.Namespaces {
+			if !included[namespace] {
+				return nil, nerrors.NewInvalidArgumentError("namespace %s is not included in the backup", namespace)
+			}
+			restored[namespace] = true
+		}
+	}
+
+	report := &entities.RestoreReport{DryRun: options.DryRun, Applications: make([]*entities.RestoredApplication, 0)}
+	var current *backupTag
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Err(err).Int("restored", len(report.Applications)).Msg("Unable to restore the catalog, invalid backup")
+			return nil, nerrors.NewInvalidArgumentErrorFrom(err, "invalid backup")
+		}
+		if err = utils.CheckArchiveEntry(header); err != nil {
+			log.Err(err).Int("restored", len(report.Applications)).Msg("Unable to restore the catalog, invalid backup")
+			return nil, nerrors.NewInvalidArgumentErrorFrom(err, "invalid backup")
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if current.isTagFile(header.Name) {
+			if err = current.addFile(header.Name, tr); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		m.restoreTag(current, options)
+		if current, err = readBackupTag(header.Name, tr); err != nil {
+			log.Err(err).Int("restored", len(report.Applications)).Msg("Unable to restore the catalog, invalid backup")
+			return nil, err
+		}
+		if restored[current.described.Application.Namespace] {
+			current.result = &entities.RestoredApplication{ApplicationID: current.described.Application.ToApplicationID()}
+			report.Applications = append(report.Applications, current.result)
+		}
+	}
+	m.restoreTag(current, options)
+
+	log.Info().Bool("dryRun", options.DryRun).Int("applications", len(report.Applications)).Msg("Catalog restore finished")
+	return report, nil
+}
+
+// restoreTag verifies and stores an application tag read from a backup, filling its result
+func (m *manager) restoreTag(tag *backupTag, options entities.RestoreOptions) {
+	if tag == nil || tag.result == nil {
+		return
+	}
+	files, err := tag.verify()
+	if err == nil {
+		tag.result.Files = len(files)
+		err = m.restoreApplication(tag.described.Application, files, options, tag.result)
+	}
+	if err != nil {
+		log.Err(err).Str("appID", tag.result.ApplicationID.String()).Msg("Unable to restore the application")
+		tag.result.Error = err.Error()
+	}
+}
+
+// restoreApplication stores the metadata and the files of an application tag. As in a push, the metadata is
+// stored first and removed if the files cannot be stored.
+func (m *manager) restoreApplication(app *entities.ApplicationInfo, files []*entities.FileInfo, options entities.RestoreOptions, result *entities.RestoredApplication) error {
+	appID := app.ToApplicationID()
+	exists, err := m.provider.Exists(appID)
+	if err != nil {
+		return err
+	}
+	if exists && !options.Overwrite {
+		result.Skipped = true
+		return nil
+	}
+	if options.DryRun {
+		return nil
+	}
+
+	// the previous state of an overwritten tag is restored if it cannot be replaced
+	var previous *entities.ApplicationInfo
+	if exists {
+		if previous, err = m.provider.Get(appID); err != nil {
+			return err
+		}
+	}
+	current, err := m.provider.GetApplicationVisibility(appID.Namespace, appID.ApplicationName)
+	if err != nil && nerrors.FromError(err).Code != nerrors.NotFound {
+		return err
+	}
+	stored, err := m.stManager.GetApplicationVisibility(appID.Namespace, appID.ApplicationName)
+	if err != nil {
+		return err
+	}
+
+	info := *app
+	info.CatalogID = ""
+	if _, err = m.provider.Add(&info); err != nil {
+		return err
+	}
+	// the visibility is shared by all the tags of the application
+	visibilityChanged := current != nil && *current != info.Private
+	if visibilityChanged {
+		_, err = m.provider.UpdateApplicationVisibility(appID.Namespace, appID.ApplicationName, info.Private)
+	}
+	storedChanged := false
+	if err == nil && (stored == nil || *stored != info.Private) {
+		err = m.stManager.StoreApplicationVisibility(appID.Namespace, appID.ApplicationName, info.Private)
+		storedChanged = err == nil
+	}
+	if err == nil {
+		err = m.stManager.StoreApplication(appID.Namespace, appID.ApplicationName, appID.Tag, files)
+	}
+	if err != nil {
+		m.rollbackRestore(appID, previous, current, visibilityChanged, stored, storedChanged)
+		return err
+	}
+	result.Restored = true
+	return nil
+}
+
+// rollbackRestore undoes the changes of an application that could not be restored. The metadata of the tag is
+// restored to previous, or removed if the tag did not exist, and the visibility of the application is restored
+// in the metadata and in the storage if it was changed.
+func (m *manager) rollbackRestore(appID *entities.ApplicationID, previous *entities.ApplicationInfo, current *bool, visibilityChanged bool, stored *bool, storedChanged bool) {
+	if visibilityChanged {
+		if _, err := m.provider.UpdateApplicationVisibility(appID.Namespace, appID.ApplicationName, *current); err != nil {
+			log.Err(err).Str("appID", appID.String()).Msg("Error in rollback operation, visibility can not be restored")
+		}
+	}
+	if previous != nil {
+		if _, err := m.provider.Add(previous); err != nil {
+			log.Err(err).Str("appID", appID.String()).Msg("Error in rollback operation, metadata can not be restored")
+		}
+	} else if err := m.provider.Remove(appID); err != nil {
+		log.Err(err).Str("appID", appID.String()).Msg("Error in rollback operation, metadata can not be removed")
+	}
+	if storedChanged && stored != nil {
+		if err := m.stManager.StoreApplicationVisibility(appID.Namespace, appID.ApplicationName, *stored); err != nil {
+			log.Err(err).Str("appID", appID.String()).Msg("Error in rollback operation, stored visibility can not be restored")
+		}
+	}
+}
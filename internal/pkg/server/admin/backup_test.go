@@ -0,0 +1,342 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package admin
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"io"
+	"net"
+
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/catalog-manager/internal/pkg/provider/metadata"
+	"github.com/napptive/catalog-manager/internal/pkg/provider/quota"
+	"github.com/napptive/catalog-manager/internal/pkg/storage"
+	"github.com/napptive/catalog-manager/internal/pkg/utils"
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// testCatalog with an in-memory catalog
+type testCatalog struct {
+	stManager storage.StorageManager
+	provider  *metadata.MemoryProvider
+	manager   Manager
+}
+
+func newTestCatalog() *testCatalog {
+	stManager := storage.NewMemoryStorageManager()
+	provider := metadata.NewMemoryProvider(false)
+	return &testCatalog{
+		stManager: stManager,
+		provider:  provider,
+		manager:   NewManager(stManager, provider, quota.NewStorageQuotaProvider(stManager, entities.Quota{})),
+	}
+}
+
+// add stores an application tag in the catalog
+func (c *testCatalog) add(appID *entities.ApplicationID, private bool, files []*entities.FileInfo) *entities.ApplicationInfo {
+	info := utils.CreateTestApplicationInfo()
+	info.Namespace = appID.Namespace
+	info.ApplicationName = appID.ApplicationName
+	info.Tag = appID.Tag
+	info.Private = private
+	_, err := c.provider.Add(info)
+	gomega.Expect(err).Should(gomega.Succeed())
+	gomega.Expect(c.stManager.StoreApplicationVisibility(appID.Namespace, appID.ApplicationName, private)).Should(gomega.Succeed())
+	gomega.Expect(c.stManager.StoreApplication(appID.Namespace, appID.ApplicationName, appID.Tag, files)).Should(gomega.Succeed())
+	return info
+}
+
+// failingStorage with a storage manager that cannot store the application files
+type failingStorage struct {
+	storage.StorageManager
+}
+
+// StoreApplication always fails
+func (f *failingStorage) StoreApplication(repo string, name string, version string, files []*entities.FileInfo) error {
+	return nerrors.NewUnavailableError("storage unavailable")
+}
+
+// expectApplication checks that an application tag is stored in the catalog
+func (c *testCatalog) expectApplication(info *entities.ApplicationInfo, files []*entities.FileInfo) {
+	stored, err := c.provider.Get(info.ToApplicationID())
+	gomega.Expect(err).Should(gomega.Succeed())
+	gomega.Expect(stored).Should(gomega.Equal(info))
+	storedFiles, err := c.stManager.GetApplication(info.Namespace, info.ApplicationName, info.Tag, entities.DownloadFormatNone)
+	gomega.Expect(err).Should(gomega.Succeed())
+	gomega.Expect(storedFiles).Should(gomega.HaveLen(len(files)))
+	for _, file := range files {
+		gomega.Expect(storedFiles).Should(gomega.ContainElement(&entities.FileInfo{Path: "./" + info.ApplicationName + "/" + file.Path, Data: file.Data}))
+	}
+	private, err := c.stManager.GetApplicationVisibility(info.Namespace, info.ApplicationName)
+	gomega.Expect(err).Should(gomega.Succeed())
+	gomega.Expect(*private).Should(gomega.Equal(info.Private))
+}
+
+// rewriteBackup returns a copy of a backup replacing the content of an entry
+func rewriteBackup(backup []byte, name string, data []byte) []byte {
+	zr, err := gzip.NewReader(bytes.NewReader(backup))
+	gomega.Expect(err).Should(gomega.Succeed())
+	tr := tar.NewReader(zr)
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		gomega.Expect(err).Should(gomega.Succeed())
+		content, err := io.ReadAll(tr)
+		gomega.Expect(err).Should(gomega.Succeed())
+		if header.Name == name {
+			content = data
+			header.Size = int64(len(data))
+		}
+		gomega.Expect(tw.WriteHeader(header)).Should(gomega.Succeed())
+		_, err = tw.Write(content)
+		gomega.Expect(err).Should(gomega.Succeed())
+	}
+	gomega.Expect(tw.Close()).Should(gomega.Succeed())
+	gomega.Expect(zw.Close()).Should(gomega.Succeed())
+	return buf.Bytes()
+}
+
+var _ = ginkgo.Describe("Backup and restore", func() {
+
+	app1 := &entities.ApplicationID{Namespace: "ns1", ApplicationName: "app", Tag: "v1"}
+	app2 := &entities.ApplicationID{Namespace: "ns1", ApplicationName: "app", Tag: "v2"}
+	app3 := &entities.ApplicationID{Namespace: "ns2", ApplicationName: "private", Tag: "latest"}
+	files := []*entities.FileInfo{
+		{Path: "app_config.yaml", Data: []byte("app config")},
+		{Path: "components/component.yaml", Data: []byte("component")}}
+
+	var source *testCatalog
+	var infos []*entities.ApplicationInfo
+	var backup []byte
+
+	ginkgo.BeforeEach(func() {
+		source = newTestCatalog()
+		infos = []*entities.ApplicationInfo{
+			source.add(app1, false, files),
+			source.add(app2, false, files[:1]),
+			source.add(app3, true, files),
+		}
+		var buf bytes.Buffer
+		report, err := source.manager.Backup(entities.BackupOptions{}, &buf)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(report.Namespaces).Should(gomega.Equal([]string{"ns1", "ns2"}))
+		gomega.Expect(report.Applications).Should(gomega.Equal([]*entities.BackedUpApplication{
+			{ApplicationID: app1, Files: 2, Bytes: 19},
+			{ApplicationID: app2, Files: 1, Bytes: 10},
+			{ApplicationID: app3, Files: 2, Bytes: 19}}))
+		backup = buf.Bytes()
+	})
+
+	ginkgo.It("should restore a whole catalog in an empty instance", func() {
+		target := newTestCatalog()
+		report, err := target.manager.Restore(entities.RestoreOptions{}, bytes.NewReader(backup))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(report.Applications).Should(gomega.HaveLen(3))
+		for _, app := range report.Applications {
+			gomega.Expect(app.Restored).Should(gomega.BeTrue())
+			gomega.Expect(app.Error).Should(gomega.BeEmpty())
+		}
+		target.expectApplication(infos[0], files)
+		target.expectApplication(infos[1], files[:1])
+		target.expectApplication(infos[2], files)
+	})
+
+	ginkgo.It("should restore a namespace in an existing instance", func() {
+		target := newTestCatalog()
+		existing := []*entities.FileInfo{{Path: "app_config.yaml", Data: []byte("existing")}}
+		info := target.add(app1, false, existing)
+
+		report, err := target.manager.Restore(entities.RestoreOptions{Namespaces: []string{"ns1"}}, bytes.NewReader(backup))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(report.Applications).Should(gomega.Equal([]*entities.RestoredApplication{
+			{ApplicationID: app1, Files: 2, Skipped: true},
+			{ApplicationID: app2, Files: 1, Restored: true}}))
+		target.expectApplication(info, existing)
+		target.expectApplication(infos[1], files[:1])
+		exists, err := target.provider.Exists(app3)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(exists).Should(gomega.BeFalse())
+
+		report, err = target.manager.Restore(entities.RestoreOptions{Namespaces: []string{"ns1"}, Overwrite: true}, bytes.NewReader(backup))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(report.Applications[0].Restored).Should(gomega.BeTrue())
+		target.expectApplication(infos[0], files)
+
+		_, err = target.manager.Restore(entities.RestoreOptions{Namespaces: []string{"other"}}, bytes.NewReader(backup))
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.InvalidArgument))
+	})
+
+	ginkgo.It("should keep the overwritten tags if they cannot be restored", func() {
+		target := newTestCatalog()
+		existing := []*entities.FileInfo{{Path: "app_config.yaml", Data: []byte("existing")}}
+		info := target.add(app1, true, existing)
+		manager := NewManager(&failingStorage{StorageManager: target.stManager}, target.provider, quota.NewStorageQuotaProvider(target.stManager, entities.Quota{}))
+
+		report, err := manager.Restore(entities.RestoreOptions{Namespaces: []string{"ns1"}, Overwrite: true}, bytes.NewReader(backup))
+		gomega.Expect(err).Should(gomega.Succeed())
+		for _, restored := range report.Applications {
+			gomega.Expect(restored.Restored).Should(gomega.BeFalse())
+			gomega.Expect(restored.Error).Should(gomega.ContainSubstring("storage unavailable"))
+		}
+		// the previous metadata and visibility are restored
+		target.expectApplication(info, existing)
+		private, err := target.provider.GetApplicationVisibility(app1.Namespace, app1.ApplicationName)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(*private).Should(gomega.BeTrue())
+		exists, err := target.provider.Exists(app2)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(exists).Should(gomega.BeFalse())
+	})
+
+	ginkgo.It("should not restore the applications whose checksum does not match", func() {
+		tampered := rewriteBackup(backup, "ns1/app/v1/files/app_config.yaml", []byte("tampered!!"))
+		target := newTestCatalog()
+		report, err := target.manager.Restore(entities.RestoreOptions{}, bytes.NewReader(tampered))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(report.Applications[0].Restored).Should(gomega.BeFalse())
+		gomega.Expect(report.Applications[0].Error).Should(gomega.ContainSubstring("checksum mismatch"))
+		gomega.Expect(report.Applications[1].Restored).Should(gomega.BeTrue())
+		exists, err := target.provider.Exists(app1)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(exists).Should(gomega.BeFalse())
+	})
+
+	ginkgo.It("should reject a backup with links", func() {
+		zr, err := gzip.NewReader(bytes.NewReader(backup))
+		gomega.Expect(err).Should(gomega.Succeed())
+		content, err := io.ReadAll(zr)
+		gomega.Expect(err).Should(gomega.Succeed())
+		// the link is appended after the entries, removing the end of the archive
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		tr := tar.NewReader(bytes.NewReader(content))
+		tw := tar.NewWriter(zw)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(tw.WriteHeader(header)).Should(gomega.Succeed())
+			_, err = io.Copy(tw, tr)
+			gomega.Expect(err).Should(gomega.Succeed())
+		}
+		gomega.Expect(tw.WriteHeader(&tar.Header{Name: "ns1/app/v1/files/passwd", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"})).Should(gomega.Succeed())
+		gomega.Expect(tw.Close()).Should(gomega.Succeed())
+		gomega.Expect(zw.Close()).Should(gomega.Succeed())
+
+		target := newTestCatalog()
+		_, err = target.manager.Restore(entities.RestoreOptions{}, bytes.NewReader(buf.Bytes()))
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.InvalidArgument))
+		gomega.Expect(err.Error()).Should(gomega.ContainSubstring("symbolic link"))
+	})
+
+	ginkgo.It("should verify a backup without restoring it in a dry run", func() {
+		target := newTestCatalog()
+		report, err := target.manager.Restore(entities.RestoreOptions{DryRun: true}, bytes.NewReader(backup))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(report.DryRun).Should(gomega.BeTrue())
+		for _, app := range report.Applications {
+			gomega.Expect(app.Restored).Should(gomega.BeFalse())
+			gomega.Expect(app.Error).Should(gomega.BeEmpty())
+		}
+		repositories, err := target.stManager.ListRepositories()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(repositories).Should(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should fail with a truncated backup", func() {
+		target := newTestCatalog()
+		_, err := target.manager.Restore(entities.RestoreOptions{}, bytes.NewReader(backup[:len(backup)/2]))
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.InvalidArgument))
+	})
+
+	ginkgo.It("should send the backup through the extended administration API", func() {
+		// a file bigger than the chunks, random so it is not compressed
+		big := make([]byte, 3*backupChunkSize)
+		_, err := rand.Read(big)
+		gomega.Expect(err).Should(gomega.Succeed())
+		bigApp := &entities.ApplicationID{Namespace: "ns3", ApplicationName: "big", Tag: "v1"}
+		bigInfo := source.add(bigApp, false, []*entities.FileInfo{{Path: "big.bin", Data: big}})
+
+		target := newTestCatalog()
+		sourceClient, sourceStop := startExtendedAdministration(source.manager)
+		defer sourceStop()
+		targetClient, targetStop := startExtendedAdministration(target.manager)
+		defer targetStop()
+
+		backupStream, err := sourceClient.Backup(context.Background(), &BackupRequest{Options: entities.BackupOptions{Namespaces: []string{"ns2", "ns3"}}})
+		gomega.Expect(err).Should(gomega.Succeed())
+		restoreStream, err := targetClient.Restore(context.Background())
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(restoreStream.Send(&RestoreChunk{Options: &entities.RestoreOptions{}})).Should(gomega.Succeed())
+		chunks := 0
+		var backupReport *entities.BackupReport
+		for backupReport == nil {
+			chunk, err := backupStream.Recv()
+			gomega.Expect(err).Should(gomega.Succeed())
+			backupReport = chunk.Report
+			if len(chunk.Data) > 0 {
+				chunks++
+				gomega.Expect(restoreStream.Send(&RestoreChunk{Data: chunk.Data})).Should(gomega.Succeed())
+			}
+		}
+		gomega.Expect(chunks).Should(gomega.BeNumerically(">", 3))
+		gomega.Expect(backupReport.Applications).Should(gomega.HaveLen(2))
+
+		restoreReport, err := restoreStream.CloseAndRecv()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(restoreReport.Applications).Should(gomega.Equal([]*entities.RestoredApplication{
+			{ApplicationID: app3, Files: 2, Restored: true},
+			{ApplicationID: bigApp, Files: 1, Restored: true}}))
+		target.expectApplication(infos[2], files)
+		target.expectApplication(bigInfo, []*entities.FileInfo{{Path: "big.bin", Data: big}})
+	})
+})
+
+// startExtendedAdministration serves the extended administration API of a manager returning a client
+func startExtendedAdministration(manager Manager) (ExtendedAdministrationClient, func()) {
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	RegisterExtendedAdministrationServer(server, NewHandler(manager))
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	conn, err := grpc.Dial("bufnet", grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}))
+	gomega.Expect(err).Should(gomega.Succeed())
+	return NewExtendedAdministrationClient(conn), func() {
+		_ = conn.Close()
+		server.Stop()
+	}
+}
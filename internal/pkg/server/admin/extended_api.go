@@ -0,0 +1,388 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package admin
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/catalog-manager/internal/pkg/server/jsoncodec"
+	"github.com/napptive/grpc-catalog-common-go"
+	"google.golang.org/grpc"
+)
+
+// The administration operations that are not included in the NamespaceAdministration service of
+// grpc-catalog-go are served by the ExtendedAdministration service. Its messages are Go structures
+// encoded as JSON, so the clients use the jsoncodec content subtype.
+
+// ExtendedAdministrationServiceName with the full name of the service
+const ExtendedAdministrationServiceName = "catalog_manager.ExtendedAdministration"
+
+// NamespaceRequest with the namespace of an operation
+type NamespaceRequest struct {
+	// Namespace with the name of the namespace
+	Namespace string
+}
+
+// SetNamespaceQuotaRequest with the quota override of a namespace
+type SetNamespaceQuotaRequest struct {
+	// Namespace with the name of the namespace
+	Namespace string
+	// Quota with the limits of the namespace, a zero value means unlimited
+	Quota entities.Quota
+}
+
+// NamespaceUsageList with the usage report of the namespaces
+type NamespaceUsageList struct {
+	// Usage with the usage of each namespace
+	Usage []*entities.NamespaceUsage
+}
+
+// FsckRequest with the inconsistencies to repair when checking the consistency between the metadata and the storage
+type FsckRequest struct {
+	// Repair with the classes of inconsistencies to repair
+	Repair entities.RepairOptions
+}
+
+// ReindexRequest with the options to rebuild the application metadata from the storage
+type ReindexRequest struct {
+	// Options with the namespace to rebuild, the default visibility and the dry-run flag
+	Options entities.ReindexOptions
+}
+
+// BackupRequest with the applications to include in a backup
+type BackupRequest struct {
+	// Options with the namespaces to back up
+	Options entities.BackupOptions
+}
+
+// BackupChunk with a piece of a backup archive. The last message of the stream only contains the report.
+type BackupChunk struct {
+	// Data with the next bytes of the archive
+	Data []byte
+	// Report with the applications included in the backup
+	Report *entities.BackupReport
+}
+
+// RestoreChunk with a piece of the backup archive to restore. The options are sent in the first message.
+type RestoreChunk struct {
+	// Options with the options to restore the backup
+	Options *entities.RestoreOptions
+	// Data with the next bytes of the archive
+	Data []byte
+}
+
+// ExtendedAdministrationServer is the server API for the ExtendedAdministration service
+type ExtendedAdministrationServer interface {
+	// SetNamespaceQuota overrides the default quota of a namespace
+	SetNamespaceQuota(context.Context, *SetNamespaceQuotaRequest) (*grpc_catalog_common_go.OpResponse, error)
+	// RemoveNamespaceQuota removes the quota override of a namespace
+	RemoveNamespaceQuota(context.Context, *NamespaceRequest) (*grpc_catalog_common_go.OpResponse, error)
+	// GetNamespaceUsage returns the usage report of a namespace, or of all of them if it is empty
+	GetNamespaceUsage(context.Context, *NamespaceRequest) (*NamespaceUsageList, error)
+	// Fsck checks the consistency between the metadata and the storage
+	Fsck(context.Context, *FsckRequest) (*entities.FsckReport, error)
+	// Reindex rebuilds the application metadata from the files stored in the repository
+	Reindex(context.Context, *ReindexRequest) (*entities.ReindexReport, error)
+	// RotateEncryptionKeys encrypts the private applications of a namespace, or of all of them if it is empty,
+	// with a new data key
+	RotateEncryptionKeys(context.Context, *NamespaceRequest) (*entities.KeyRotationReport, error)
+	// Backup sends an archive with the metadata and the files of the applications
+	Backup(*BackupRequest, ExtendedAdministration_BackupServer) error
+	// Restore receives an archive created by Backup and stores its applications
+	Restore(ExtendedAdministration_RestoreServer) error
+}
+
+// ExtendedAdministration_BackupServer is the server side of the Backup stream
+type ExtendedAdministration_BackupServer interface {
+	Send(*BackupChunk) error
+	grpc.ServerStream
+}
+
+type extendedAdministrationBackupServer struct {
+	grpc.ServerStream
+}
+
+// Send sends a piece of the archive
+func (x *extendedAdministrationBackupServer) Send(m *BackupChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// ExtendedAdministration_RestoreServer is the server side of the Restore stream
+type ExtendedAdministration_RestoreServer interface {
+	SendAndClose(*entities.RestoreReport) error
+	Recv() (*RestoreChunk, error)
+	grpc.ServerStream
+}
+
+type extendedAdministrationRestoreServer struct {
+	grpc.ServerStream
+}
+
+// SendAndClose sends the result of the restore
+func (x *extendedAdministrationRestoreServer) SendAndClose(m *entities.RestoreReport) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Recv receives the next piece of the archive
+func (x *extendedAdministrationRestoreServer) Recv() (*RestoreChunk, error) {
+	m := new(RestoreChunk)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// backupHandler serves the Backup stream
+func backupHandler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(BackupRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ExtendedAdministrationServer).Backup(m, &extendedAdministrationBackupServer{stream})
+}
+
+// restoreHandler serves the Restore stream
+func restoreHandler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ExtendedAdministrationServer).Restore(&extendedAdministrationRestoreServer{stream})
+}
+
+// newMethodDesc creates the description of an unary method of the ExtendedAdministration service
+func newMethodDesc[Req any, Resp any](name string, call func(ExtendedAdministrationServer, context.Context, *Req) (*Resp, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			in := new(Req)
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return call(srv.(ExtendedAdministrationServer), ctx, in)
+			}
+			info := &grpc.UnaryServerInfo{
+				Server:     srv,
+				FullMethod: fmt.Sprintf("/%s/%s", ExtendedAdministrationServiceName, name),
+			}
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return call(srv.(ExtendedAdministrationServer), ctx, req.(*Req))
+			}
+			return interceptor(ctx, in, info, handler)
+		},
+	}
+}
+
+// extendedAdministrationServiceDesc with the description of the ExtendedAdministration service
+var extendedAdministrationServiceDesc = grpc.ServiceDesc{
+	ServiceName: ExtendedAdministrationServiceName,
+	HandlerType: (*ExtendedAdministrationServer)(nil),
+	Methods: []grpc.MethodDesc{
+		newMethodDesc("SetNamespaceQuota", ExtendedAdministrationServer.SetNamespaceQuota),
+		newMethodDesc("RemoveNamespaceQuota", ExtendedAdministrationServer.RemoveNamespaceQuota),
+		newMethodDesc("GetNamespaceUsage", ExtendedAdministrationServer.GetNamespaceUsage),
+		newMethodDesc("Fsck", ExtendedAdministrationServer.Fsck),
+		newMethodDesc("Reindex", ExtendedAdministrationServer.Reindex),
+		newMethodDesc("RotateEncryptionKeys", ExtendedAdministrationServer.RotateEncryptionKeys),
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Backup",
+			Handler:       backupHandler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Restore",
+			Handler:       restoreHandler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "extended_api.go",
+}
+
+// RegisterExtendedAdministrationServer registers the ExtendedAdministration service in a gRPC server
+func RegisterExtendedAdministrationServer(s grpc.ServiceRegistrar, srv ExtendedAdministrationServer) {
+	s.RegisterService(&extendedAdministrationServiceDesc, srv)
+}
+
+// ExtendedAdministrationClient is the client API for the ExtendedAdministration service
+type ExtendedAdministrationClient interface {
+	// SetNamespaceQuota overrides the default quota of a namespace
+	SetNamespaceQuota(ctx context.Context, in *SetNamespaceQuotaRequest, opts ...grpc.CallOption) (*grpc_catalog_common_go.OpResponse, error)
+	// RemoveNamespaceQuota removes the quota override of a namespace
+	RemoveNamespaceQuota(ctx context.Context, in *NamespaceRequest, opts ...grpc.CallOption) (*grpc_catalog_common_go.OpResponse, error)
+	// GetNamespaceUsage returns the usage report of a namespace, or of all of them if it is empty
+	GetNamespaceUsage(ctx context.Context, in *NamespaceRequest, opts ...grpc.CallOption) (*NamespaceUsageList, error)
+	// Fsck checks the consistency between the metadata and the storage
+	Fsck(ctx context.Context, in *FsckRequest, opts ...grpc.CallOption) (*entities.FsckReport, error)
+	// Reindex rebuilds the application metadata from the files stored in the repository
+	Reindex(ctx context.Context, in *ReindexRequest, opts ...grpc.CallOption) (*entities.ReindexReport, error)
+	// RotateEncryptionKeys encrypts the private applications of a namespace, or of all of them if it is empty,
+	// with a new data key
+	RotateEncryptionKeys(ctx context.Context, in *NamespaceRequest, opts ...grpc.CallOption) (*entities.KeyRotationReport, error)
+	// Backup receives an archive with the metadata and the files of the applications
+	Backup(ctx context.Context, in *BackupRequest, opts ...grpc.CallOption) (ExtendedAdministration_BackupClient, error)
+	// Restore sends an archive created by Backup to store its applications
+	Restore(ctx context.Context, opts ...grpc.CallOption) (ExtendedAdministration_RestoreClient, error)
+}
+
+type extendedAdministrationClient struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewExtendedAdministrationClient creates a client of the ExtendedAdministration service
+func NewExtendedAdministrationClient(cc grpc.ClientConnInterface) ExtendedAdministrationClient {
+	return &extendedAdministrationClient{cc: cc}
+}
+
+// invoke calls a method of the ExtendedAdministration service using the JSON codec
+func (c *extendedAdministrationClient) invoke(ctx context.Context, method string, in interface{}, out interface{}, opts ...grpc.CallOption) error {
+	opts = append(opts, grpc.CallContentSubtype(jsoncodec.Name))
+	return c.cc.Invoke(ctx, fmt.Sprintf("/%s/%s", ExtendedAdministrationServiceName, method), in, out, opts...)
+}
+
+// SetNamespaceQuota overrides the default quota of a namespace
+func (c *extendedAdministrationClient) SetNamespaceQuota(ctx context.Context, in *SetNamespaceQuotaRequest, opts ...grpc.CallOption) (*grpc_catalog_common_go.OpResponse, error) {
+	out := new(grpc_catalog_common_go.OpResponse)
+	if err := c.invoke(ctx, "SetNamespaceQuota", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RemoveNamespaceQuota removes the quota override of a namespace
+func (c *extendedAdministrationClient) RemoveNamespaceQuota(ctx context.Context, in *NamespaceRequest, opts ...grpc.CallOption) (*grpc_catalog_common_go.OpResponse, error) {
+	out := new(grpc_catalog_common_go.OpResponse)
+	if err := c.invoke(ctx, "RemoveNamespaceQuota", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GetNamespaceUsage returns the usage report of a namespace, or of all of them if it is empty
+func (c *extendedAdministrationClient) GetNamespaceUsage(ctx context.Context, in *NamespaceRequest, opts ...grpc.CallOption) (*NamespaceUsageList, error) {
+	out := new(NamespaceUsageList)
+	if err := c.invoke(ctx, "GetNamespaceUsage", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Fsck checks the consistency between the metadata and the storage
+func (c *extendedAdministrationClient) Fsck(ctx context.Context, in *FsckRequest, opts ...grpc.CallOption) (*entities.FsckReport, error) {
+	out := new(entities.FsckReport)
+	if err := c.invoke(ctx, "Fsck", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Reindex rebuilds the application metadata from the files stored in the repository
+func (c *extendedAdministrationClient) Reindex(ctx context.Context, in *ReindexRequest, opts ...grpc.CallOption) (*entities.ReindexReport, error) {
+	out := new(entities.ReindexReport)
+	if err := c.invoke(ctx, "Reindex", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// RotateEncryptionKeys encrypts the private applications of a namespace, or of all of them if it is empty,
+// with a new data key
+func (c *extendedAdministrationClient) RotateEncryptionKeys(ctx context.Context, in *NamespaceRequest, opts ...grpc.CallOption) (*entities.KeyRotationReport, error) {
+	out := new(entities.KeyRotationReport)
+	if err := c.invoke(ctx, "RotateEncryptionKeys", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// newStream opens a stream of the ExtendedAdministration service using the JSON codec
+func (c *extendedAdministrationClient) newStream(ctx context.Context, desc *grpc.StreamDesc, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	opts = append(opts, grpc.CallContentSubtype(jsoncodec.Name))
+	return c.cc.NewStream(ctx, desc, fmt.Sprintf("/%s/%s", ExtendedAdministrationServiceName, desc.StreamName), opts...)
+}
+
+// Backup receives an archive with the metadata and the files of the applications
+func (c *extendedAdministrationClient) Backup(ctx context.Context, in *BackupRequest, opts ...grpc.CallOption) (ExtendedAdministration_BackupClient, error) {
+	stream, err := c.newStream(ctx, &extendedAdministrationServiceDesc.Streams[0], opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &extendedAdministrationBackupClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// ExtendedAdministration_BackupClient is the client side of the Backup stream
+type ExtendedAdministration_BackupClient interface {
+	Recv() (*BackupChunk, error)
+	grpc.ClientStream
+}
+
+type extendedAdministrationBackupClient struct {
+	grpc.ClientStream
+}
+
+// Recv receives the next piece of the archive
+func (x *extendedAdministrationBackupClient) Recv() (*BackupChunk, error) {
+	m := new(BackupChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Restore sends an archive created by Backup to store its applications
+func (c *extendedAdministrationClient) Restore(ctx context.Context, opts ...grpc.CallOption) (ExtendedAdministration_RestoreClient, error) {
+	stream, err := c.newStream(ctx, &extendedAdministrationServiceDesc.Streams[1], opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &extendedAdministrationRestoreClient{stream}, nil
+}
+
+// ExtendedAdministration_RestoreClient is the client side of the Restore stream
+type ExtendedAdministration_RestoreClient interface {
+	Send(*RestoreChunk) error
+	CloseAndRecv() (*entities.RestoreReport, error)
+	grpc.ClientStream
+}
+
+type extendedAdministrationRestoreClient struct {
+	grpc.ClientStream
+}
+
+// Send sends the next piece of the archive
+func (x *extendedAdministrationRestoreClient) Send(m *RestoreChunk) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+// CloseAndRecv closes the stream and receives the result of the restore
+func (x *extendedAdministrationRestoreClient) CloseAndRecv() (*entities.RestoreReport, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(entities.RestoreReport)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
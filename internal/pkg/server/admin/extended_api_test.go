@@ -0,0 +1,85 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package admin
+
+import (
+	"context"
+	"net"
+
+	"github.com/golang/mock/gomock"
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+var _ = ginkgo.Describe("Extended administration API", func() {
+
+	var ctrl *gomock.Controller
+	var quotaProvider *MockQuotaProvider
+	var server *grpc.Server
+	var conn *grpc.ClientConn
+	var client ExtendedAdministrationClient
+
+	ginkgo.BeforeEach(func() {
+		ctrl = gomock.NewController(ginkgo.GinkgoT())
+		quotaProvider = NewMockQuotaProvider(ctrl)
+		handler := NewHandler(NewManager(NewMockStorageManager(ctrl), NewMockMetadataProvider(ctrl), quotaProvider))
+
+		listener := bufconn.Listen(1024 * 1024)
+		server = grpc.NewServer()
+		RegisterExtendedAdministrationServer(server, handler)
+		go func() {
+			_ = server.Serve(listener)
+		}()
+
+		var err error
+		conn, err = grpc.Dial("bufnet", grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return listener.DialContext(ctx)
+			}))
+		gomega.Expect(err).Should(gomega.Succeed())
+		client = NewExtendedAdministrationClient(conn)
+	})
+
+	ginkgo.AfterEach(func() {
+		_ = conn.Close()
+		server.Stop()
+		ctrl.Finish()
+	})
+
+	ginkgo.It("should send the requests encoded as JSON", func() {
+		quota := entities.Quota{MaxBytes: 1024, MaxTagsPerApplication: 3}
+		quotaProvider.EXPECT().SetQuota("namespace", quota).Return(nil)
+
+		response, err := client.SetNamespaceQuota(context.Background(), &SetNamespaceQuotaRequest{Namespace: "namespace", Quota: quota})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(response.UserInfo).Should(gomega.ContainSubstring("namespace"))
+	})
+
+	ginkgo.It("should return the errors as gRPC status", func() {
+		quotaProvider.EXPECT().RemoveQuota("namespace").Return(nerrors.NewNotFoundError("no override"))
+
+		_, err := client.RemoveNamespaceQuota(context.Background(), &NamespaceRequest{Namespace: "namespace"})
+		gomega.Expect(status.Code(err)).Should(gomega.Equal(codes.NotFound))
+	})
+})
@@ -17,9 +17,11 @@
 package admin
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
 	"github.com/napptive/grpc-catalog-common-go"
 	"github.com/napptive/grpc-catalog-go"
 	"github.com/napptive/nerrors/pkg/nerrors"
@@ -82,3 +84,154 @@ func (h *Handler) List(_ context.Context, request *grpc_catalog_go.ListApplicati
 
 	return &grpc_catalog_go.ApplicationList{Applications: summaryList}, nil
 }
+
+// SetNamespaceQuota overrides the default quota of a namespace
+func (h *Handler) SetNamespaceQuota(_ context.Context, request *SetNamespaceQuotaRequest) (*grpc_catalog_common_go.OpResponse, error) {
+	if request.Namespace == "" {
+		return nil, nerrors.NewInvalidArgumentError("namespace must be filled").ToGRPC()
+	}
+	if err := h.manager.SetNamespaceQuota(request.Namespace, request.Quota); err != nil {
+		log.Warn().Err(err).Str("namespace", request.Namespace).Msg("unable to set namespace quota")
+		return nil, nerrors.FromError(err).ToGRPC()
+	}
+	return &grpc_catalog_common_go.OpResponse{
+		Status:     grpc_catalog_common_go.OpStatus_SUCCESS,
+		StatusName: grpc_catalog_common_go.OpStatus_SUCCESS.String(),
+		UserInfo:   fmt.Sprintf("quota of namespace %s updated", request.Namespace),
+	}, nil
+}
+
+// RemoveNamespaceQuota removes the quota override of a namespace
+func (h *Handler) RemoveNamespaceQuota(_ context.Context, request *NamespaceRequest) (*grpc_catalog_common_go.OpResponse, error) {
+	if request.Namespace == "" {
+		return nil, nerrors.NewInvalidArgumentError("namespace must be filled").ToGRPC()
+	}
+	if err := h.manager.RemoveNamespaceQuota(request.Namespace); err != nil {
+		log.Warn().Err(err).Str("namespace", request.Namespace).Msg("unable to remove namespace quota")
+		return nil, nerrors.FromError(err).ToGRPC()
+	}
+	return &grpc_catalog_common_go.OpResponse{
+		Status:     grpc_catalog_common_go.OpStatus_SUCCESS,
+		StatusName: grpc_catalog_common_go.OpStatus_SUCCESS.String(),
+		UserInfo:   fmt.Sprintf("namespace %s uses the default quota", request.Namespace),
+	}, nil
+}
+
+// GetNamespaceUsage returns the usage report of a namespace, or of all of them if it is empty
+func (h *Handler) GetNamespaceUsage(_ context.Context, request *NamespaceRequest) (*NamespaceUsageList, error) {
+	usage, err := h.manager.GetNamespaceUsage(request.Namespace)
+	if err != nil {
+		return nil, nerrors.FromError(err).ToGRPC()
+	}
+	return &NamespaceUsageList{Usage: usage}, nil
+}
+
+// Fsck checks the consistency between the metadata and the storage
+func (h *Handler) Fsck(_ context.Context, request *FsckRequest) (*entities.FsckReport, error) {
+	report, err := h.manager.Fsck(request.Repair)
+	if err != nil {
+		return nil, nerrors.FromError(err).ToGRPC()
+	}
+	return report, nil
+}
+
+// Reindex rebuilds the application metadata from the files stored in the repository
+func (h *Handler) Reindex(_ context.Context, request *ReindexRequest) (*entities.ReindexReport, error) {
+	report, err := h.manager.Reindex(request.Options)
+	if err != nil {
+		return nil, nerrors.FromError(err).ToGRPC()
+	}
+	return report, nil
+}
+
+// RotateEncryptionKeys encrypts the private applications of a namespace, or of all of them if it is empty,
+// with a new data key
+func (h *Handler) RotateEncryptionKeys(_ context.Context, request *NamespaceRequest) (*entities.KeyRotationReport, error) {
+	report, err := h.manager.RotateEncryptionKeys(request.Namespace)
+	if err != nil {
+		return nil, nerrors.FromError(err).ToGRPC()
+	}
+	return report, nil
+}
+
+// backupChunkSize with the maximum size of the archive pieces sent in the backup and restore streams
+const backupChunkSize = 1024 * 1024
+
+// chunkWriter sends the data written in pieces of at most backupChunkSize bytes
+type chunkWriter struct {
+	send func(data []byte) error
+}
+
+// Write sends p in one or more pieces
+func (w *chunkWriter) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		end := written + backupChunkSize
+		if end > len(p) {
+			end = len(p)
+		}
+		if err := w.send(p[written:end]); err != nil {
+			return written, err
+		}
+		written = end
+	}
+	return written, nil
+}
+
+// chunkReader reads the data of the pieces received in a stream
+type chunkReader struct {
+	recv func() ([]byte, error)
+	data []byte
+}
+
+// Read reads the data of the current piece, receiving the next one when it is consumed
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.data) == 0 {
+		data, err := r.recv()
+		if err != nil {
+			return 0, err
+		}
+		r.data = data
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// Backup sends an archive with the metadata and the files of the applications, the report is sent in the last message
+func (h *Handler) Backup(request *BackupRequest, server ExtendedAdministration_BackupServer) error {
+	writer := bufio.NewWriterSize(&chunkWriter{send: func(data []byte) error {
+		return server.Send(&BackupChunk{Data: data})
+	}}, backupChunkSize)
+	report, err := h.manager.Backup(request.Options, writer)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		return nerrors.FromError(err).ToGRPC()
+	}
+	return server.Send(&BackupChunk{Report: report})
+}
+
+// Restore receives an archive created by Backup and stores its applications, the options are received in the first message
+func (h *Handler) Restore(server ExtendedAdministration_RestoreServer) error {
+	first, err := server.Recv()
+	if err != nil {
+		return err
+	}
+	if first.Options == nil {
+		return nerrors.NewInvalidArgumentError("the restore options must be sent in the first message").ToGRPC()
+	}
+	reader := &chunkReader{data: first.Data, recv: func() ([]byte, error) {
+		chunk, err := server.Recv()
+		if err != nil {
+			return nil, err
+		}
+		return chunk.Data, nil
+	}}
+	report, err := h.manager.Restore(*first.Options, reader)
+	if err != nil {
+		return nerrors.FromError(err).ToGRPC()
+	}
+	return server.SendAndClose(report)
+}
@@ -17,14 +17,23 @@
 package admin
 
 import (
+	"io"
+	"sort"
+	"time"
+
 	"github.com/napptive/catalog-manager/internal/pkg/entities"
 	"github.com/napptive/catalog-manager/internal/pkg/provider/metadata"
+	"github.com/napptive/catalog-manager/internal/pkg/provider/quota"
 	"github.com/napptive/catalog-manager/internal/pkg/storage"
 	"github.com/napptive/catalog-manager/internal/pkg/utils"
 	"github.com/napptive/nerrors/pkg/nerrors"
 	"github.com/rs/zerolog/log"
 )
 
+// orphanMetadataGracePeriod with the time the metadata of a tag is not considered orphan after it is updated. The
+// metadata is written before the files, so the recent metadata without files may belong to a push in progress.
+const orphanMetadataGracePeriod = time.Hour
+
 type Manager interface {
 	// DeleteNamespace deletes a namespace so that the applications contained on it are no longer available.
 	DeleteNamespace(namespace string) error
@@ -32,17 +41,36 @@ type Manager interface {
 	DeleteApplication(requestedAppID string) error
 	// List returns a list of applications (without metadata and readme content)
 	List(namespace string) ([]*entities.AppSummary, error)
+	// SetNamespaceQuota overrides the default quota of a namespace
+	SetNamespaceQuota(namespace string, quota entities.Quota) error
+	// RemoveNamespaceQuota removes the quota override of a namespace
+	RemoveNamespaceQuota(namespace string) error
+	// GetNamespaceUsage returns the usage of a namespace, or of all of them if namespace is empty
+	GetNamespaceUsage(namespace string) ([]*entities.NamespaceUsage, error)
+	// Fsck checks the consistency between the metadata and the storage, repairing the inconsistencies requested
+	Fsck(repair entities.RepairOptions) (*entities.FsckReport, error)
+	// Reindex rebuilds the application metadata from the files stored in the repository
+	Reindex(options entities.ReindexOptions) (*entities.ReindexReport, error)
+	// RotateEncryptionKeys encrypts the private applications of a namespace, or of all of them if it is empty,
+	// with a new data key
+	RotateEncryptionKeys(namespace string) (*entities.KeyRotationReport, error)
+	// Backup writes in w an archive with the metadata and the files of the applications
+	Backup(options entities.BackupOptions, w io.Writer) (*entities.BackupReport, error)
+	// Restore stores the applications of an archive created by Backup
+	Restore(options entities.RestoreOptions, r io.Reader) (*entities.RestoreReport, error)
 }
 
 type manager struct {
-	stManager storage.StorageManager
-	provider  metadata.MetadataProvider
+	stManager     storage.StorageManager
+	provider      metadata.MetadataProvider
+	quotaProvider quota.QuotaProvider
 }
 
-func NewManager(stManager storage.StorageManager, metadataProvider metadata.MetadataProvider) Manager {
+func NewManager(stManager storage.StorageManager, metadataProvider metadata.MetadataProvider, quotaProvider quota.QuotaProvider) Manager {
 	return &manager{
-		stManager: stManager,
-		provider:  metadataProvider,
+		stManager:     stManager,
+		provider:      metadataProvider,
+		quotaProvider: quotaProvider,
 	}
 }
 
@@ -99,9 +127,387 @@ func (m *manager) List(namespace string) ([]*entities.AppSummary, error) {
 		Namespace: &namespace,
 		Private:   nil,
 	}
-	appSummary, _, err := m.provider.ListSummaryWithFilter(&filter)
+	page, err := m.provider.ListSummaryWithFilter(&filter, nil)
+	if err != nil {
+		return nil, err
+	}
+	return page.Applications, nil
+}
+
+// SetNamespaceQuota overrides the default quota of a namespace
+func (m *manager) SetNamespaceQuota(namespace string, quota entities.Quota) error {
+	if quota.MaxBytes < 0 || quota.MaxApplications < 0 || quota.MaxTagsPerApplication < 0 || quota.MaxFileSize < 0 {
+		return nerrors.NewInvalidArgumentError("quota limits cannot be negative")
+	}
+	return m.quotaProvider.SetQuota(namespace, quota)
+}
+
+// RemoveNamespaceQuota removes the quota override of a namespace
+func (m *manager) RemoveNamespaceQuota(namespace string) error {
+	return m.quotaProvider.RemoveQuota(namespace)
+}
+
+// GetNamespaceUsage returns the usage of a namespace, or of all of them if namespace is empty.
+// All the namespaces are the ones with applications or with quota override.
+func (m *manager) GetNamespaceUsage(namespace string) ([]*entities.NamespaceUsage, error) {
+	namespaces := []string{namespace}
+	if namespace == "" {
+		var err error
+		if namespaces, err = m.listNamespaces(); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make([]*entities.NamespaceUsage, 0, len(namespaces))
+	for _, name := range namespaces {
+		quota, err := m.quotaProvider.GetQuota(name)
+		if err != nil {
+			return nil, err
+		}
+		tags, err := m.stManager.GetRepositoryUsage(name)
+		if err != nil {
+			log.Err(err).Str("namespace", name).Msg("Unable to get namespace usage")
+			return nil, err
+		}
+		result = append(result, entities.NewNamespaceUsage(name, tags, *quota))
+	}
+	return result, nil
+}
+
+// listNamespaces returns the namespaces with applications or with quota override
+func (m *manager) listNamespaces() ([]string, error) {
+	found, err := m.listApplicationNamespaces()
+	if err != nil {
+		return nil, err
+	}
+	overrides, err := m.quotaProvider.ListOverrides()
+	if err != nil {
+		return nil, err
+	}
+	for namespace := range overrides {
+		found[namespace] = true
+	}
+	return sortNamespaces(found), nil
+}
+
+// listApplicationNamespaces returns the set of namespaces with applications
+func (m *manager) listApplicationNamespaces() (map[string]bool, error) {
+	page, err := m.provider.ListSummaryWithFilter(&metadata.ListFilter{}, nil)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string]bool)
+	for _, app := range page.Applications {
+		found[app.Namespace] = true
+	}
+	return found, nil
+}
+
+// sortNamespaces returns the namespaces of a set sorted by name
+func sortNamespaces(found map[string]bool) []string {
+	namespaces := make([]string, 0, len(found))
+	for namespace := range found {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// Fsck checks the consistency between the metadata and the storage. The application metadata is written before
+// storing the files and removed before removing them, so a failed operation may leave:
+//   - orphan directories: applications stored without metadata,
+//   - orphan metadata: metadata of applications that are not stored,
+//   - invalid metadata: documents that cannot be read or do not describe a valid application.
+//
+// The storage managers that share the file contents between applications also check the references of the blobs.
+//
+// The inconsistencies are checked again before repairing them to skip the ones fixed by a concurrent operation, and
+// the orphan metadata updated during the grace period is not removed as it may belong to a push in progress.
+func (m *manager) Fsck(repair entities.RepairOptions) (*entities.FsckReport, error) {
+	report := &entities.FsckReport{Inconsistencies: make([]*entities.Inconsistency, 0)}
+
+	// 1.- Check the metadata documents
+	documents, err := m.provider.ListDocuments()
+	if err != nil {
+		log.Err(err).Msg("Unable to check consistency, error listing metadata documents")
+		return nil, err
+	}
+	report.Documents = len(documents)
+	indexed := make(map[string]*entities.ApplicationID)
+	for _, document := range documents {
+		if err := validateDocument(document); err != nil {
+			inconsistency := &entities.Inconsistency{
+				Type:       entities.InvalidMetadata,
+				DocumentID: document.ID,
+				Reason:     err.Error(),
+			}
+			if document.Application != nil {
+				inconsistency.ApplicationID = document.Application.ToApplicationID()
+			}
+			if repair.InvalidMetadata {
+				m.repair(inconsistency, func() error {
+					return m.provider.RemoveDocument(document.ID)
+				})
+			}
+			report.Inconsistencies = append(report.Inconsistencies, inconsistency)
+			continue
+		}
+		appID := document.Application.ToApplicationID()
+		indexed[appID.String()] = appID
+	}
+
+	// 2.- Check the applications stored
+	repositories, err := m.stManager.ListRepositories()
+	if err != nil {
+		log.Err(err).Msg("Unable to check consistency, error listing repositories")
+		return nil, err
+	}
+	report.Repositories = len(repositories)
+	stored := make(map[string]bool)
+	for _, repo := range repositories {
+		applications, err := m.stManager.ListApplications(repo)
+		if err != nil {
+			log.Err(err).Str("repository", repo).Msg("Unable to check consistency, error listing applications")
+			return nil, err
+		}
+		report.StoredApplications += len(applications)
+		for _, appID := range applications {
+			stored[appID.String()] = true
+			if _, exists := indexed[appID.String()]; exists {
+				continue
+			}
+			inconsistency := &entities.Inconsistency{
+				Type:          entities.OrphanDirectory,
+				ApplicationID: appID,
+				Reason:        "application stored without metadata",
+			}
+			if repair.OrphanDirectories {
+				m.repair(inconsistency, func() error {
+					return m.removeOrphanDirectory(appID)
+				})
+			}
+			report.Inconsistencies = append(report.Inconsistencies, inconsistency)
+		}
+	}
+
+	// 3.- Check the metadata without files
+	for _, document := range documents {
+		if document.Error != nil || document.Application == nil {
+			continue
+		}
+		appID := document.Application.ToApplicationID()
+		if _, valid := indexed[appID.String()]; !valid || stored[appID.String()] {
+			continue
+		}
+		inconsistency := &entities.Inconsistency{
+			Type:          entities.OrphanMetadata,
+			DocumentID:    document.ID,
+			ApplicationID: appID,
+			Reason:        "application metadata without files in the storage",
+		}
+		if repair.OrphanMetadata {
+			m.repair(inconsistency, func() error {
+				return m.removeOrphanMetadata(appID)
+			})
+		}
+		report.Inconsistencies = append(report.Inconsistencies, inconsistency)
+	}
+
+	// 4.- Check the references of the blobs
+	if collector, ok := m.stManager.(storage.BlobCollector); ok {
+		inconsistencies, err := collector.CollectBlobs(repair.LeakedBlobs)
+		if err != nil {
+			log.Err(err).Msg("Unable to check consistency, error collecting blobs")
+			return nil, err
+		}
+		report.Inconsistencies = append(report.Inconsistencies, inconsistencies...)
+	}
+
+	log.Info().Int("documents", report.Documents).Int("stored", report.StoredApplications).
+		Int("inconsistencies", len(report.Inconsistencies)).Msg("Consistency check finished")
+	return report, nil
+}
+
+// repair executes the repair operation of an inconsistency and stores the result on it
+func (m *manager) repair(inconsistency *entities.Inconsistency, operation func() error) {
+	if err := operation(); err != nil {
+		log.Err(err).Str("type", string(inconsistency.Type)).Str("documentID", inconsistency.DocumentID).
+			Interface("appID", inconsistency.ApplicationID).Msg("Unable to repair inconsistency")
+		inconsistency.RepairError = err.Error()
+		return
+	}
+	inconsistency.Repaired = true
+}
+
+// removeOrphanDirectory removes an application stored without metadata if it is still orphan
+func (m *manager) removeOrphanDirectory(appID *entities.ApplicationID) error {
+	exists, err := m.provider.Exists(appID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nerrors.NewAbortedError("application metadata has been added")
+	}
+	return m.stManager.RemoveApplication(appID.Namespace, appID.ApplicationName, appID.Tag)
+}
+
+// removeOrphanMetadata removes the metadata of an application that is not stored if it is still orphan. The metadata
+// is read again, so the one updated during the grace period is not removed.
+func (m *manager) removeOrphanMetadata(appID *entities.ApplicationID) error {
+	app, err := m.provider.Get(appID)
+	if err != nil {
+		return err
+	}
+	if time.Since(app.LastUpdated) < orphanMetadataGracePeriod {
+		return nerrors.NewAbortedError("application metadata updated recently, it may belong to a push in progress")
+	}
+	exists, err := m.stManager.ApplicationExists(appID.Namespace, appID.ApplicationName, appID.Tag)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nerrors.NewAbortedError("application files have been stored")
+	}
+	return m.provider.Remove(appID)
+}
+
+// validateDocument checks that a metadata document describes a valid application
+func validateDocument(document *metadata.Document) error {
+	if document.Error != nil {
+		return document.Error
+	}
+	if document.Application == nil {
+		return nerrors.NewInternalError("document without application metadata")
+	}
+	app := document.Application
+	if app.Namespace == "" || app.ApplicationName == "" || app.Tag == "" {
+		return nerrors.NewFailedPreconditionError("namespace, application name and tag are required")
+	}
+	if app.MetadataName == "" {
+		return nerrors.NewFailedPreconditionError("metadata name is required")
+	}
+	isMetadata, _, err := utils.IsMetadata([]byte(app.Metadata))
+	if err != nil || !isMetadata {
+		return nerrors.NewFailedPreconditionError("metadata file is not valid")
+	}
+	return nil
+}
+
+// Reindex rebuilds the application metadata from the files stored in the repository. The metadata file and
+// the readme are read as in a push, and the visibility is read from the visibility file of each application.
+// The applications stored without visibility file take the default one.
+func (m *manager) Reindex(options entities.ReindexOptions) (*entities.ReindexReport, error) {
+	repositories := []string{options.Namespace}
+	if options.Namespace == "" {
+		var err error
+		if repositories, err = m.stManager.ListRepositories(); err != nil {
+			log.Err(err).Msg("Unable to rebuild the metadata, error listing repositories")
+			return nil, err
+		}
+	}
+
+	report := &entities.ReindexReport{DryRun: options.DryRun, Applications: make([]*entities.ReindexedApplication, 0)}
+	indexed := 0
+	for _, repo := range repositories {
+		applications, err := m.stManager.ListApplications(repo)
+		if err != nil {
+			log.Err(err).Str("repository", repo).Msg("Unable to rebuild the metadata, error listing applications")
+			return nil, err
+		}
+		for _, appID := range applications {
+			result := &entities.ReindexedApplication{ApplicationID: appID}
+			report.Applications = append(report.Applications, result)
+			if err := m.reindexApplication(appID, options, result); err != nil {
+				log.Err(err).Str("appID", appID.String()).Msg("Unable to rebuild the application metadata")
+				result.Error = err.Error()
+				continue
+			}
+			if result.Indexed {
+				indexed++
+			}
+		}
+	}
+
+	log.Info().Bool("dryRun", options.DryRun).Int("applications", len(report.Applications)).
+		Int("indexed", indexed).Msg("Metadata rebuilt from the storage")
+	return report, nil
+}
+
+// reindexApplication rebuilds the metadata of an application tag filling the result
+func (m *manager) reindexApplication(appID *entities.ApplicationID, options entities.ReindexOptions, result *entities.ReindexedApplication) error {
+	files, err := m.stManager.GetApplication(appID.Namespace, appID.ApplicationName, appID.Tag, entities.DownloadFormatNone)
+	if err != nil {
+		return err
+	}
+	readme := utils.GetFile(utils.ReadmeFile, files)
+	appMetadata, header, err := utils.GetApplicationMetadataFile(files)
+	if err != nil {
+		return err
+	}
+	if appMetadata == nil {
+		return nerrors.NewNotFoundError("metadata file not found")
+	}
+	if header == nil || header.Name == "" {
+		return nerrors.NewFailedPreconditionError("metadata name is required")
+	}
+	result.MetadataName = header.Name
+
+	private, err := m.stManager.GetApplicationVisibility(appID.Namespace, appID.ApplicationName)
+	if err != nil {
+		return err
+	}
+	result.Private = options.DefaultPrivate
+	if private != nil {
+		result.Private = *private
+		result.VisibilityStored = true
+	}
+
+	if options.DryRun {
+		return nil
+	}
+	app := &entities.ApplicationInfo{
+		Namespace:       appID.Namespace,
+		ApplicationName: appID.ApplicationName,
+		Tag:             appID.Tag,
+		Readme:          string(readme),
+		Metadata:        string(appMetadata),
+		MetadataName:    header.Name,
+		Private:         result.Private,
+	}
+	// the downloads and the last update of the tags already indexed are kept, the other tags take the time
+	// when their files were stored
+	existing, err := m.provider.Get(appID)
+	if err != nil && nerrors.FromError(err).Code != nerrors.NotFound {
+		return err
+	}
+	if err == nil && existing != nil {
+		app.LastUpdated = existing.LastUpdated
+		app.Downloads = existing.Downloads
+	} else {
+		updated, err := m.stManager.GetApplicationUpdateTime(appID.Namespace, appID.ApplicationName, appID.Tag)
+		if err != nil {
+			return err
+		}
+		app.LastUpdated = updated.UTC()
+	}
+	if _, err = m.provider.Add(app); err != nil {
+		return err
+	}
+	result.Indexed = true
+	return nil
+}
+
+// RotateEncryptionKeys encrypts the private applications of a namespace, or of all of them if it is empty,
+// with a new data key. The storage must encrypt the private applications.
+func (m *manager) RotateEncryptionKeys(namespace string) (*entities.KeyRotationReport, error) {
+	rotator, ok := m.stManager.(storage.KeyRotator)
+	if !ok {
+		return nil, nerrors.NewFailedPreconditionError("the encryption at rest is not enabled")
+	}
+	report, err := rotator.RotateKeys(namespace)
 	if err != nil {
+		log.Err(err).Str("namespace", namespace).Msg("error rotating the encryption keys")
 		return nil, err
 	}
-	return appSummary, nil
+	return report, nil
 }
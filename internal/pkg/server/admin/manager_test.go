@@ -17,10 +17,14 @@
 package admin
 
 import (
+	"time"
+
 	"github.com/golang/mock/gomock"
 	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/catalog-manager/internal/pkg/provider/metadata"
 	"github.com/napptive/catalog-manager/internal/pkg/utils"
 	"github.com/napptive/mock-extensions/pkg/matcher"
+	"github.com/napptive/nerrors/pkg/nerrors"
 	"github.com/onsi/ginkgo"
 	"github.com/onsi/gomega"
 )
@@ -40,13 +44,15 @@ var _ = ginkgo.Describe("Catalog handler test", func() {
 	var ctrl *gomock.Controller
 	var storageProvider *MockStorageManager
 	var metadataProvider *MockMetadataProvider
+	var quotaProvider *MockQuotaProvider
 	var manager Manager
 
 	ginkgo.BeforeEach(func() {
 		ctrl = gomock.NewController(ginkgo.GinkgoT())
 		storageProvider = NewMockStorageManager(ctrl)
 		metadataProvider = NewMockMetadataProvider(ctrl)
-		manager = NewManager(storageProvider, metadataProvider)
+		quotaProvider = NewMockQuotaProvider(ctrl)
+		manager = NewManager(storageProvider, metadataProvider, quotaProvider)
 	})
 
 	ginkgo.AfterEach(func() {
@@ -72,5 +78,173 @@ var _ = ginkgo.Describe("Catalog handler test", func() {
 		err := manager.DeleteNamespace(namespace)
 		gomega.Expect(err).Should(gomega.Succeed())
 	})
+	ginkgo.It("should not accept negative quotas", func() {
+		err := manager.SetNamespaceQuota("namespace", entities.Quota{MaxBytes: -1})
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+	ginkgo.It("should report the usage of all the namespaces", func() {
+		metadataProvider.EXPECT().ListSummaryWithFilter(gomock.Any(), nil).Return(&entities.ApplicationPage{Applications: []*entities.AppSummary{
+			{Namespace: "first", ApplicationName: "app1"},
+			{Namespace: "first", ApplicationName: "app2"}}}, nil)
+		quotaProvider.EXPECT().ListOverrides().Return(map[string]entities.Quota{"second": {MaxApplications: 1}}, nil)
+		quotaProvider.EXPECT().GetQuota("first").Return(&entities.Quota{}, nil)
+		quotaProvider.EXPECT().GetQuota("second").Return(&entities.Quota{MaxApplications: 1}, nil)
+		storageProvider.EXPECT().GetRepositoryUsage("first").Return([]*entities.TagUsage{
+			{ApplicationName: "app1", Tag: "v1", Bytes: 10},
+			{ApplicationName: "app1", Tag: "v2", Bytes: 20},
+			{ApplicationName: "app2", Tag: "v1", Bytes: 5}}, nil)
+		storageProvider.EXPECT().GetRepositoryUsage("second").Return([]*entities.TagUsage{}, nil)
+
+		usage, err := manager.GetNamespaceUsage("")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(len(usage)).Should(gomega.Equal(2))
+		gomega.Expect(usage[0].Namespace).Should(gomega.Equal("first"))
+		gomega.Expect(usage[0].Bytes).Should(gomega.Equal(int64(35)))
+		gomega.Expect(usage[0].Applications).Should(gomega.Equal(2))
+		gomega.Expect(usage[0].Tags).Should(gomega.Equal(map[string]int{"app1": 2, "app2": 1}))
+		gomega.Expect(usage[1].Namespace).Should(gomega.Equal("second"))
+		gomega.Expect(usage[1].Quota.MaxApplications).Should(gomega.Equal(1))
+	})
+
+	ginkgo.Context("Checking consistency", func() {
+
+		var valid, orphan *entities.ApplicationInfo
+		var stored *entities.ApplicationID
+		var invalid *entities.ApplicationInfo
+
+		ginkgo.BeforeEach(func() {
+			valid = utils.CreateTestApplicationInfo()
+			valid.Namespace = "namespace"
+			orphan = utils.CreateTestApplicationInfo()
+			orphan.Namespace = "namespace"
+			invalid = utils.CreateTestApplicationInfo()
+			invalid.Metadata = "not valid"
+			stored = &entities.ApplicationID{Namespace: "namespace", ApplicationName: "stored", Tag: "v1"}
+
+			metadataProvider.EXPECT().ListDocuments().Return([]*metadata.Document{
+				{ID: "valid", Application: valid},
+				{ID: "orphan", Application: orphan},
+				{ID: "invalid", Application: invalid},
+				{ID: "unreadable", Error: nerrors.NewInternalError("error unmarshalling application metadata")},
+			}, nil)
+			storageProvider.EXPECT().ListRepositories().Return([]string{"namespace"}, nil)
+			storageProvider.EXPECT().ListApplications("namespace").Return([]*entities.ApplicationID{
+				valid.ToApplicationID(), stored}, nil)
+		})
+
+		ginkgo.It("should report the inconsistencies without repairing them", func() {
+			report, err := manager.Fsck(entities.RepairOptions{})
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(report.Documents).Should(gomega.Equal(4))
+			gomega.Expect(report.Repositories).Should(gomega.Equal(1))
+			gomega.Expect(report.StoredApplications).Should(gomega.Equal(2))
+			gomega.Expect(len(report.Inconsistencies)).Should(gomega.Equal(4))
+
+			gomega.Expect(report.Inconsistencies[0].Type).Should(gomega.Equal(entities.InvalidMetadata))
+			gomega.Expect(report.Inconsistencies[0].DocumentID).Should(gomega.Equal("invalid"))
+			gomega.Expect(report.Inconsistencies[1].Type).Should(gomega.Equal(entities.InvalidMetadata))
+			gomega.Expect(report.Inconsistencies[1].ApplicationID).Should(gomega.BeNil())
+			gomega.Expect(report.Inconsistencies[2].Type).Should(gomega.Equal(entities.OrphanDirectory))
+			gomega.Expect(report.Inconsistencies[2].ApplicationID).Should(gomega.Equal(stored))
+			gomega.Expect(report.Inconsistencies[3].Type).Should(gomega.Equal(entities.OrphanMetadata))
+			gomega.Expect(report.Inconsistencies[3].ApplicationID).Should(gomega.Equal(orphan.ToApplicationID()))
+			for _, inconsistency := range report.Inconsistencies {
+				gomega.Expect(inconsistency.Repaired).Should(gomega.BeFalse())
+			}
+		})
+
+		ginkgo.It("should repair the inconsistencies requested", func() {
+			metadataProvider.EXPECT().RemoveDocument("invalid").Return(nil)
+			metadataProvider.EXPECT().RemoveDocument("unreadable").Return(nerrors.NewInternalError("elastic error"))
+			metadataProvider.EXPECT().Exists(stored).Return(false, nil)
+			storageProvider.EXPECT().RemoveApplication(stored.Namespace, stored.ApplicationName, stored.Tag).Return(nil)
+			metadataProvider.EXPECT().Get(orphan.ToApplicationID()).Return(orphan, nil)
+			storageProvider.EXPECT().ApplicationExists(orphan.Namespace, orphan.ApplicationName, orphan.Tag).Return(true, nil)
 
+			report, err := manager.Fsck(entities.RepairOptions{OrphanDirectories: true, OrphanMetadata: true, InvalidMetadata: true})
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(len(report.Inconsistencies)).Should(gomega.Equal(4))
+			gomega.Expect(report.Inconsistencies[0].Repaired).Should(gomega.BeTrue())
+			gomega.Expect(report.Inconsistencies[1].Repaired).Should(gomega.BeFalse())
+			gomega.Expect(report.Inconsistencies[1].RepairError).ShouldNot(gomega.BeEmpty())
+			gomega.Expect(report.Inconsistencies[2].Repaired).Should(gomega.BeTrue())
+			// the application has been stored after listing the documents
+			gomega.Expect(report.Inconsistencies[3].Repaired).Should(gomega.BeFalse())
+		})
+		ginkgo.It("should not remove the metadata of a push in progress", func() {
+			recent := *orphan
+			recent.LastUpdated = time.Now().UTC()
+			metadataProvider.EXPECT().Get(orphan.ToApplicationID()).Return(&recent, nil)
+
+			report, err := manager.Fsck(entities.RepairOptions{OrphanMetadata: true})
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(report.Inconsistencies[3].Type).Should(gomega.Equal(entities.OrphanMetadata))
+			gomega.Expect(report.Inconsistencies[3].Repaired).Should(gomega.BeFalse())
+			gomega.Expect(report.Inconsistencies[3].RepairError).ShouldNot(gomega.BeEmpty())
+		})
+	})
+
+	ginkgo.Context("Rebuilding the metadata", func() {
+
+		appMetadata := `apiVersion: core.napptive.com/v1alpha1
+kind: ApplicationMetadata
+name: "Application"
+`
+		first := &entities.ApplicationID{Namespace: "namespace", ApplicationName: "first", Tag: "v1"}
+		second := &entities.ApplicationID{Namespace: "namespace", ApplicationName: "second", Tag: "v1"}
+		broken := &entities.ApplicationID{Namespace: "namespace", ApplicationName: "broken", Tag: "v1"}
+
+		ginkgo.BeforeEach(func() {
+			files := []*entities.FileInfo{
+				{Path: "./app/metadata.yaml", Data: []byte(appMetadata)},
+				{Path: "./app/README.md", Data: []byte("readme")}}
+			storageProvider.EXPECT().ListRepositories().Return([]string{"namespace"}, nil)
+			storageProvider.EXPECT().ListApplications("namespace").Return([]*entities.ApplicationID{first, second, broken}, nil)
+			storageProvider.EXPECT().GetApplication("namespace", "first", "v1", entities.DownloadFormatNone).Return(files, nil)
+			storageProvider.EXPECT().GetApplication("namespace", "second", "v1", entities.DownloadFormatNone).Return(files, nil)
+			storageProvider.EXPECT().GetApplication("namespace", "broken", "v1", entities.DownloadFormatNone).Return([]*entities.FileInfo{
+				{Path: "./app/README.md", Data: []byte("readme")}}, nil)
+			private := false
+			storageProvider.EXPECT().GetApplicationVisibility("namespace", "first").Return(&private, nil)
+			storageProvider.EXPECT().GetApplicationVisibility("namespace", "second").Return(nil, nil)
+		})
+
+		ginkgo.It("should report the metadata without storing it in a dry run", func() {
+			report, err := manager.Reindex(entities.ReindexOptions{DryRun: true, DefaultPrivate: true})
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(report.DryRun).Should(gomega.BeTrue())
+			gomega.Expect(len(report.Applications)).Should(gomega.Equal(3))
+			gomega.Expect(*report.Applications[0]).Should(gomega.Equal(entities.ReindexedApplication{
+				ApplicationID: first, MetadataName: "Application", Private: false, VisibilityStored: true}))
+			gomega.Expect(*report.Applications[1]).Should(gomega.Equal(entities.ReindexedApplication{
+				ApplicationID: second, MetadataName: "Application", Private: true}))
+			gomega.Expect(report.Applications[2].Error).ShouldNot(gomega.BeEmpty())
+		})
+
+		ginkgo.It("should store the metadata rebuilt", func() {
+			lastUpdated := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+			stored := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+			// the popularity and the last update of the indexed tags are kept
+			metadataProvider.EXPECT().Get(first).Return(&entities.ApplicationInfo{LastUpdated: lastUpdated, Downloads: 7}, nil)
+			metadataProvider.EXPECT().Get(second).Return(nil, nerrors.NewNotFoundError("application not found"))
+			storageProvider.EXPECT().GetApplicationUpdateTime("namespace", "second", "v1").Return(stored, nil)
+			metadataProvider.EXPECT().Add(matcher.NewStructMatcher(map[string]interface{}{
+				"ApplicationName": "first", "Readme": "readme", "MetadataName": "Application", "Private": false,
+				"LastUpdated": lastUpdated, "Downloads": int64(7)})).Return(nil, nil)
+			metadataProvider.EXPECT().Add(matcher.NewStructMatcher(map[string]interface{}{
+				"ApplicationName": "second", "Private": true, "LastUpdated": stored, "Downloads": int64(0)})).Return(nil, nil)
+
+			report, err := manager.Reindex(entities.ReindexOptions{DefaultPrivate: true})
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(report.Applications[0].Indexed).Should(gomega.BeTrue())
+			gomega.Expect(report.Applications[1].Indexed).Should(gomega.BeTrue())
+			gomega.Expect(report.Applications[2].Indexed).Should(gomega.BeFalse())
+		})
+	})
+
+	ginkgo.It("should not rotate the encryption keys if the storage is not encrypted", func() {
+		_, err := manager.RotateEncryptionKeys("namespace")
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.FailedPrecondition))
+	})
 })
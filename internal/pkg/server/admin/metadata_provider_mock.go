@@ -110,6 +110,20 @@ func (mr *MockMetadataProviderMockRecorder) GetSummary() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSummary", reflect.TypeOf((*MockMetadataProvider)(nil).GetSummary))
 }
 
+// IncrementDownloads mocks base method.
+func (m *MockMetadataProvider) IncrementDownloads(arg0 *entities.ApplicationID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IncrementDownloads", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// IncrementDownloads indicates an expected call of IncrementDownloads.
+func (mr *MockMetadataProviderMockRecorder) IncrementDownloads(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncrementDownloads", reflect.TypeOf((*MockMetadataProvider)(nil).IncrementDownloads), arg0)
+}
+
 // List mocks base method.
 func (m *MockMetadataProvider) List(arg0 string) ([]*entities.ApplicationInfo, error) {
 	m.ctrl.T.Helper()
@@ -125,20 +139,49 @@ func (mr *MockMetadataProviderMockRecorder) List(arg0 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockMetadataProvider)(nil).List), arg0)
 }
 
+// ListDocuments mocks base method.
+func (m *MockMetadataProvider) ListDocuments() ([]*metadata.Document, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListDocuments")
+	ret0, _ := ret[0].([]*metadata.Document)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListDocuments indicates an expected call of ListDocuments.
+func (mr *MockMetadataProviderMockRecorder) ListDocuments() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListDocuments", reflect.TypeOf((*MockMetadataProvider)(nil).ListDocuments))
+}
+
 // ListSummaryWithFilter mocks base method.
-func (m *MockMetadataProvider) ListSummaryWithFilter(arg0 *metadata.ListFilter) ([]*entities.AppSummary, *entities.Summary, error) {
+func (m *MockMetadataProvider) ListSummaryWithFilter(arg0 *metadata.ListFilter, arg1 *entities.PageRequest) (*entities.ApplicationPage, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ListSummaryWithFilter", arg0)
-	ret0, _ := ret[0].([]*entities.AppSummary)
-	ret1, _ := ret[1].(*entities.Summary)
-	ret2, _ := ret[2].(error)
-	return ret0, ret1, ret2
+	ret := m.ctrl.Call(m, "ListSummaryWithFilter", arg0, arg1)
+	ret0, _ := ret[0].(*entities.ApplicationPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // ListSummaryWithFilter indicates an expected call of ListSummaryWithFilter.
-func (mr *MockMetadataProviderMockRecorder) ListSummaryWithFilter(arg0 interface{}) *gomock.Call {
+func (mr *MockMetadataProviderMockRecorder) ListSummaryWithFilter(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListSummaryWithFilter", reflect.TypeOf((*MockMetadataProvider)(nil).ListSummaryWithFilter), arg0, arg1)
+}
+
+// ListTags mocks base method.
+func (m *MockMetadataProvider) ListTags(arg0, arg1 string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListTags", arg0, arg1)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListTags indicates an expected call of ListTags.
+func (mr *MockMetadataProviderMockRecorder) ListTags(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListSummaryWithFilter", reflect.TypeOf((*MockMetadataProvider)(nil).ListSummaryWithFilter), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListTags", reflect.TypeOf((*MockMetadataProvider)(nil).ListTags), arg0, arg1)
 }
 
 // Remove mocks base method.
@@ -155,14 +198,44 @@ func (mr *MockMetadataProviderMockRecorder) Remove(arg0 interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Remove", reflect.TypeOf((*MockMetadataProvider)(nil).Remove), arg0)
 }
 
-// UpdateApplicationVisibility mocks base method.
-func (m *MockMetadataProvider) UpdateApplicationVisibility(arg0, arg1 string, arg2 bool) error {
+// RemoveDocument mocks base method.
+func (m *MockMetadataProvider) RemoveDocument(arg0 string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateApplicationVisibility", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "RemoveDocument", arg0)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
+// RemoveDocument indicates an expected call of RemoveDocument.
+func (mr *MockMetadataProviderMockRecorder) RemoveDocument(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveDocument", reflect.TypeOf((*MockMetadataProvider)(nil).RemoveDocument), arg0)
+}
+
+// Search mocks base method.
+func (m *MockMetadataProvider) Search(arg0 *metadata.SearchRequest) (*entities.SearchResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Search", arg0)
+	ret0, _ := ret[0].(*entities.SearchResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Search indicates an expected call of Search.
+func (mr *MockMetadataProviderMockRecorder) Search(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Search", reflect.TypeOf((*MockMetadataProvider)(nil).Search), arg0)
+}
+
+// UpdateApplicationVisibility mocks base method.
+func (m *MockMetadataProvider) UpdateApplicationVisibility(arg0, arg1 string, arg2 bool) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateApplicationVisibility", arg0, arg1, arg2)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
 // UpdateApplicationVisibility indicates an expected call of UpdateApplicationVisibility.
 func (mr *MockMetadataProviderMockRecorder) UpdateApplicationVisibility(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
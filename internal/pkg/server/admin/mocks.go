@@ -18,6 +18,7 @@ package admin
 
 //go:generate  mockgen -destination metadata_provider_mock.go -package=admin github.com/napptive/catalog-manager/internal/pkg/provider/metadata MetadataProvider
 //go:generate  mockgen -destination storage_mock.go -package=admin github.com/napptive/catalog-manager/internal/pkg/storage StorageManager
+//go:generate  mockgen -destination quota_provider_mock.go -package=admin github.com/napptive/catalog-manager/internal/pkg/provider/quota QuotaProvider
 
 // Mock is a place holder to unify all mock generators.
 func Mock() {}
@@ -50,18 +50,33 @@ func (mr *MockCatalogManagerMockRecorder) Add(arg0, arg1, arg2, arg3 interface{}
 }
 
 // Download mocks base method.
-func (m *MockCatalogManager) Download(arg0 string, arg1, arg2 bool) ([]*entities.FileInfo, error) {
+func (m *MockCatalogManager) Download(arg0 string, arg1 entities.DownloadFormat, arg2, arg3 bool) ([]*entities.FileInfo, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Download", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "Download", arg0, arg1, arg2, arg3)
 	ret0, _ := ret[0].([]*entities.FileInfo)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Download indicates an expected call of Download.
-func (mr *MockCatalogManagerMockRecorder) Download(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockCatalogManagerMockRecorder) Download(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Download", reflect.TypeOf((*MockCatalogManager)(nil).Download), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Download", reflect.TypeOf((*MockCatalogManager)(nil).Download), arg0, arg1, arg2, arg3)
+}
+
+// DownloadStream mocks base method.
+func (m *MockCatalogManager) DownloadStream(arg0 string, arg1 entities.DownloadFormat, arg2, arg3 bool) (*entities.FileStream, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DownloadStream", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(*entities.FileStream)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DownloadStream indicates an expected call of DownloadStream.
+func (mr *MockCatalogManagerMockRecorder) DownloadStream(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DownloadStream", reflect.TypeOf((*MockCatalogManager)(nil).DownloadStream), arg0, arg1, arg2, arg3)
 }
 
 // Get mocks base method.
@@ -80,18 +95,18 @@ func (mr *MockCatalogManagerMockRecorder) Get(arg0, arg1 interface{}) *gomock.Ca
 }
 
 // List mocks base method.
-func (m *MockCatalogManager) List(arg0 map[string]*bool, arg1 bool) ([]*entities.AppSummary, error) {
+func (m *MockCatalogManager) List(arg0 map[string]*bool, arg1 bool, arg2 *entities.PageRequest) (*entities.ApplicationPage, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "List", arg0, arg1)
-	ret0, _ := ret[0].([]*entities.AppSummary)
+	ret := m.ctrl.Call(m, "List", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*entities.ApplicationPage)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // List indicates an expected call of List.
-func (mr *MockCatalogManagerMockRecorder) List(arg0, arg1 interface{}) *gomock.Call {
+func (mr *MockCatalogManagerMockRecorder) List(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockCatalogManager)(nil).List), arg0, arg1)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockCatalogManager)(nil).List), arg0, arg1, arg2)
 }
 
 // Remove mocks base method.
@@ -108,6 +123,21 @@ func (mr *MockCatalogManagerMockRecorder) Remove(arg0 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Remove", reflect.TypeOf((*MockCatalogManager)(nil).Remove), arg0)
 }
 
+// Search mocks base method.
+func (m *MockCatalogManager) Search(arg0 string, arg1 *entities.FacetFilter, arg2 map[string]*bool, arg3 bool, arg4, arg5 int) (*entities.SearchResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Search", arg0, arg1, arg2, arg3, arg4, arg5)
+	ret0, _ := ret[0].(*entities.SearchResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Search indicates an expected call of Search.
+func (mr *MockCatalogManagerMockRecorder) Search(arg0, arg1, arg2, arg3, arg4, arg5 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Search", reflect.TypeOf((*MockCatalogManager)(nil).Search), arg0, arg1, arg2, arg3, arg4, arg5)
+}
+
 // Summary mocks base method.
 func (m *MockCatalogManager) Summary() (*entities.Summary, error) {
 	m.ctrl.T.Helper()
@@ -124,11 +154,12 @@ func (mr *MockCatalogManagerMockRecorder) Summary() *gomock.Call {
 }
 
 // UpdateApplicationVisibility mocks base method.
-func (m *MockCatalogManager) UpdateApplicationVisibility(arg0, arg1 string, arg2 bool) error {
+func (m *MockCatalogManager) UpdateApplicationVisibility(arg0, arg1 string, arg2 bool) (int, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "UpdateApplicationVisibility", arg0, arg1, arg2)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // UpdateApplicationVisibility indicates an expected call of UpdateApplicationVisibility.
@@ -19,6 +19,7 @@ package apps
 import (
 	"github.com/napptive/catalog-manager/internal/pkg/config"
 	"github.com/napptive/catalog-manager/internal/pkg/connection"
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
 	"github.com/napptive/catalog-manager/internal/pkg/server/catalog-manager"
 	"github.com/napptive/grpc-catalog-common-go"
 	"github.com/napptive/grpc-catalog-go"
@@ -62,7 +63,7 @@ func (m *manager) Deploy(userToken string, applicationID string, targetEnvironme
 	instanceConfiguration map[string]*grpc_catalog_go.ApplicationInstanceConfiguration, allowed bool) (*grpc_catalog_common_go.OpResponse, error) {
 
 	// Download the application
-	app, err := m.catalogManager.Download(applicationID, true, allowed)
+	app, err := m.catalogManager.Download(applicationID, entities.DownloadFormatTgz, allowed, false)
 	if err != nil {
 		log.Error().Err(err).Str("application_id", applicationID).Msg("error downloading the application, unable to deploy it")
 		return nil, err
@@ -115,7 +116,7 @@ func (m *manager) GetConfiguration(applicationID string, allowed bool) (*grpc_ca
 
 	log.Debug().Str("application_id", applicationID).Bool("allowed", allowed).Msg("getting configuration")
 	// Download the application
-	files, err := m.catalogManager.Download(applicationID, false, allowed)
+	files, err := m.catalogManager.Download(applicationID, entities.DownloadFormatNone, allowed, false)
 	if err != nil {
 		log.Error().Err(err).Str("application_id", applicationID).Msg("error downloading the application, unable to get application configuration")
 		return nil, err
@@ -82,7 +82,7 @@ var _ = ginkgo.Describe("Apps manager test", func() {
 
 			appID := fmt.Sprintf("%s/%s", "username", "application")
 
-			catalogManager.EXPECT().Download(appID, false, true).Return([]*entities.FileInfo{{
+			catalogManager.EXPECT().Download(appID, entities.DownloadFormatNone, true, false).Return([]*entities.FileInfo{{
 				Path: "application.yaml",
 				Data: []byte(application),
 			}}, nil)
@@ -97,7 +97,7 @@ var _ = ginkgo.Describe("Apps manager test", func() {
 
 			appID := fmt.Sprintf("%s/%s", "username", "application")
 
-			catalogManager.EXPECT().Download(appID, false, true).Return([]*entities.FileInfo{{
+			catalogManager.EXPECT().Download(appID, entities.DownloadFormatNone, true, false).Return([]*entities.FileInfo{{
 				Path: "cm.yaml",
 				Data: []byte(cm),
 			}}, nil)
@@ -111,7 +111,7 @@ var _ = ginkgo.Describe("Apps manager test", func() {
 
 			appID := fmt.Sprintf("%s/%s", "username", "application")
 
-			catalogManager.EXPECT().Download(appID, false, true).Return([]*entities.FileInfo{}, nerrors.NewNotFoundError("Application not found"))
+			catalogManager.EXPECT().Download(appID, entities.DownloadFormatNone, true, false).Return([]*entities.FileInfo{}, nerrors.NewNotFoundError("Application not found"))
 
 			_, err := manager.GetConfiguration(appID, true)
 			gomega.Expect(err).ShouldNot(gomega.Succeed())
@@ -0,0 +1,296 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package catalog_manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/catalog-manager/internal/pkg/server/jsoncodec"
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// The catalog operations that are not included in the Catalog service of grpc-catalog-go are served by the
+// ExtendedCatalog service. Its messages are Go structures encoded as JSON, so the clients use the jsoncodec
+// content subtype. The HTTP gateway routes of the service are registered with RegisterExtendedCatalogHandlerFromEndpoint.
+
+const (
+	// ExtendedCatalogServiceName with the full name of the service
+	ExtendedCatalogServiceName = "catalog_manager.ExtendedCatalog"
+	// SearchPath with the HTTP gateway route of the Search method
+	SearchPath = "/v0/catalog/search"
+	// ListPagePath with the HTTP gateway route of the ListPage method
+	ListPagePath = "/v0/catalog/applications"
+)
+
+// SearchRequest with a full-text search
+type SearchRequest struct {
+	// Text with the free text to search in the names, metadata and readme of the applications, all the
+	// applications are listed if it is empty
+	Text string
+	// Facets with the facet values of the applications to return
+	Facets entities.FacetFilter
+	// Namespace to search in, the public applications and the private ones of the user accounts are searched if it is empty
+	Namespace string
+	// From with the number of applications to skip
+	From int
+	// Size with the maximum number of applications to return, metadata.DefaultSearchSize if it is not set
+	Size int
+}
+
+// ListPageRequest with a page of the list of applications
+type ListPageRequest struct {
+	// Namespace to list, the public applications and the private ones of the user accounts are listed if it is empty
+	Namespace string
+	// Sort with the order of the applications: name, namespace, last_updated or popularity. By namespace if it is empty
+	Sort string
+	// PageSize with the maximum number of applications to return, defaultPageSize if it is not set
+	PageSize int
+	// PageToken with the NextPageToken of the previous page, empty to request the first one
+	PageToken string
+}
+
+// ExtendedCatalogServer is the server API for the ExtendedCatalog service
+type ExtendedCatalogServer interface {
+	// Search returns a page of the applications that contain a text and match the facets sorted by relevance
+	Search(context.Context, *SearchRequest) (*entities.SearchResult, error)
+	// ListPage returns a page of the applications in the requested order
+	ListPage(context.Context, *ListPageRequest) (*entities.ApplicationPage, error)
+}
+
+// searchHandler serves the Search method
+func searchHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SearchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExtendedCatalogServer).Search(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: fmt.Sprintf("/%s/Search", ExtendedCatalogServiceName),
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExtendedCatalogServer).Search(ctx, req.(*SearchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// listPageHandler serves the ListPage method
+func listPageHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListPageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExtendedCatalogServer).ListPage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: fmt.Sprintf("/%s/ListPage", ExtendedCatalogServiceName),
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExtendedCatalogServer).ListPage(ctx, req.(*ListPageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// extendedCatalogServiceDesc with the description of the ExtendedCatalog service
+var extendedCatalogServiceDesc = grpc.ServiceDesc{
+	ServiceName: ExtendedCatalogServiceName,
+	HandlerType: (*ExtendedCatalogServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Search",
+			Handler:    searchHandler,
+		},
+		{
+			MethodName: "ListPage",
+			Handler:    listPageHandler,
+		},
+	},
+	Metadata: "extended_api.go",
+}
+
+// RegisterExtendedCatalogServer registers the ExtendedCatalog service in a gRPC server
+func RegisterExtendedCatalogServer(s grpc.ServiceRegistrar, srv ExtendedCatalogServer) {
+	s.RegisterService(&extendedCatalogServiceDesc, srv)
+}
+
+// ExtendedCatalogClient is the client API for the ExtendedCatalog service
+type ExtendedCatalogClient interface {
+	// Search returns a page of the applications that contain a text and match the facets sorted by relevance
+	Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*entities.SearchResult, error)
+	// ListPage returns a page of the applications in the requested order
+	ListPage(ctx context.Context, in *ListPageRequest, opts ...grpc.CallOption) (*entities.ApplicationPage, error)
+}
+
+type extendedCatalogClient struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewExtendedCatalogClient creates a client of the ExtendedCatalog service
+func NewExtendedCatalogClient(cc grpc.ClientConnInterface) ExtendedCatalogClient {
+	return &extendedCatalogClient{cc: cc}
+}
+
+// Search returns a page of the applications that contain a text and match the facets sorted by relevance
+func (c *extendedCatalogClient) Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (*entities.SearchResult, error) {
+	out := new(entities.SearchResult)
+	opts = append(opts, grpc.CallContentSubtype(jsoncodec.Name))
+	if err := c.cc.Invoke(ctx, fmt.Sprintf("/%s/Search", ExtendedCatalogServiceName), in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListPage returns a page of the applications in the requested order
+func (c *extendedCatalogClient) ListPage(ctx context.Context, in *ListPageRequest, opts ...grpc.CallOption) (*entities.ApplicationPage, error) {
+	out := new(entities.ApplicationPage)
+	opts = append(opts, grpc.CallContentSubtype(jsoncodec.Name))
+	if err := c.cc.Invoke(ctx, fmt.Sprintf("/%s/ListPage", ExtendedCatalogServiceName), in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// searchRequestFromHTTP reads a SearchRequest from the JSON body of a POST request, or from the query parameters
+// of a GET request: q, namespace, from, size and the repeatable keyword, license, trait, scope and kind facets
+func searchRequestFromHTTP(req *http.Request) (*SearchRequest, error) {
+	request := &SearchRequest{}
+	if req.Method == http.MethodPost {
+		if err := json.NewDecoder(req.Body).Decode(request); err != nil {
+			return nil, nerrors.NewInvalidArgumentErrorFrom(err, "invalid search request")
+		}
+		return request, nil
+	}
+	query := req.URL.Query()
+	request.Text = query.Get("q")
+	request.Namespace = query.Get("namespace")
+	request.Facets = entities.FacetFilter{
+		Keywords: query["keyword"],
+		Licenses: query["license"],
+		Traits:   query["trait"],
+		Scopes:   query["scope"],
+		K8sKinds: query["kind"],
+	}
+	if err := intParameters(query, map[string]*int{"from": &request.From, "size": &request.Size}); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// listPageRequestFromHTTP reads a ListPageRequest from the namespace, sort, page_size and page_token query parameters
+func listPageRequestFromHTTP(req *http.Request) (*ListPageRequest, error) {
+	query := req.URL.Query()
+	request := &ListPageRequest{
+		Namespace: query.Get("namespace"),
+		Sort:      query.Get("sort"),
+		PageToken: query.Get("page_token"),
+	}
+	if err := intParameters(query, map[string]*int{"page_size": &request.PageSize}); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// intParameters parses the integer query parameters that are set
+func intParameters(query url.Values, values map[string]*int) error {
+	for param, value := range values {
+		if query.Get(param) == "" {
+			continue
+		}
+		parsed, err := strconv.Atoi(query.Get(param))
+		if err != nil {
+			return nerrors.NewInvalidArgumentError("invalid %s parameter [%s]", param, query.Get(param))
+		}
+		*value = parsed
+	}
+	return nil
+}
+
+// RegisterExtendedCatalogHandlerFromEndpoint registers the HTTP gateway routes of the ExtendedCatalog service,
+// the requests are forwarded to the gRPC server listening in endpoint
+func RegisterExtendedCatalogHandlerFromEndpoint(ctx context.Context, mux *runtime.ServeMux, endpoint string, opts []grpc.DialOption) error {
+	conn, err := grpc.DialContext(ctx, endpoint, opts...)
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+	client := NewExtendedCatalogClient(conn)
+
+	search := gatewayHandler(mux, "Search", func(ctx context.Context, req *http.Request) (interface{}, error) {
+		request, err := searchRequestFromHTTP(req)
+		if err != nil {
+			return nil, err
+		}
+		return client.Search(ctx, request)
+	})
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		if err := mux.HandlePath(method, SearchPath, search); err != nil {
+			return err
+		}
+	}
+	listPage := gatewayHandler(mux, "ListPage", func(ctx context.Context, req *http.Request) (interface{}, error) {
+		request, err := listPageRequestFromHTTP(req)
+		if err != nil {
+			return nil, err
+		}
+		return client.ListPage(ctx, request)
+	})
+	return mux.HandlePath(http.MethodGet, ListPagePath, listPage)
+}
+
+// gatewayHandler returns the HTTP handler of a method that calls the gRPC client with the authorization header and
+// the rest of the metadata as the generated gateways, and writes the JSON response
+func gatewayHandler(mux *runtime.ServeMux, method string, call func(ctx context.Context, req *http.Request) (interface{}, error)) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request, _ map[string]string) {
+		_, outboundMarshaler := runtime.MarshalerForRequest(mux, req)
+		rctx, err := runtime.AnnotateContext(req.Context(), mux, req, fmt.Sprintf("/%s/%s", ExtendedCatalogServiceName, method))
+		if err != nil {
+			runtime.HTTPError(req.Context(), mux, outboundMarshaler, w, req, err)
+			return
+		}
+		result, err := call(rctx, req)
+		if err != nil {
+			if _, isStatus := status.FromError(err); !isStatus {
+				err = nerrors.FromError(err).ToGRPC()
+			}
+			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
+			return
+		}
+		data, err := json.Marshal(result)
+		if err != nil {
+			runtime.HTTPError(rctx, mux, outboundMarshaler, w, req, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
@@ -0,0 +1,187 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package catalog_manager
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/golang/mock/gomock"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/napptive/catalog-manager/internal/pkg/config"
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/catalog-manager/internal/pkg/provider/metadata"
+	"github.com/napptive/catalog-manager/internal/pkg/server/resolver"
+	"github.com/napptive/catalog-manager/internal/pkg/utils"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+var _ = ginkgo.Describe("Extended catalog API", func() {
+
+	var ctrl *gomock.Controller
+	var server *grpc.Server
+	var dialOptions []grpc.DialOption
+	var conn *grpc.ClientConn
+	var client ExtendedCatalogClient
+	var app *entities.ApplicationInfo
+
+	ginkgo.BeforeEach(func() {
+		ctrl = gomock.NewController(ginkgo.GinkgoT())
+		provider := metadata.NewMemoryProvider(false)
+		app = utils.CreateTestApplicationInfo()
+		app.Readme = "A WordPress installation"
+		_, err := provider.Add(app)
+		gomega.Expect(err).Should(gomega.Succeed())
+		_, err = provider.Add(utils.CreateTestApplicationInfo())
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		manager := NewManager(NewMockStorageManager(ctrl), provider, NewMockQuotaProvider(ctrl), "")
+		permissionResolver := resolver.NewPermissionResolver(false, config.NewTeamConfig(false, "", ""))
+		handler := NewHandler(manager, false, config.TeamConfig{}, *permissionResolver)
+
+		listener := bufconn.Listen(1024 * 1024)
+		server = grpc.NewServer()
+		RegisterExtendedCatalogServer(server, handler)
+		go func() {
+			_ = server.Serve(listener)
+		}()
+
+		dialOptions = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return listener.DialContext(ctx)
+			})}
+		conn, err = grpc.Dial("bufnet", dialOptions...)
+		gomega.Expect(err).Should(gomega.Succeed())
+		client = NewExtendedCatalogClient(conn)
+	})
+
+	ginkgo.AfterEach(func() {
+		_ = conn.Close()
+		server.Stop()
+		ctrl.Finish()
+	})
+
+	ginkgo.It("should search the applications", func() {
+		result, err := client.Search(context.Background(), &SearchRequest{Text: "wordpress"})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(result.Total).Should(gomega.Equal(1))
+		gomega.Expect(result.Hits[0].Application.ApplicationName).Should(gomega.Equal(app.ApplicationName))
+		gomega.Expect(result.Hits[0].Highlights[metadata.ReadmeField]).Should(gomega.Equal([]string{"A <em>WordPress</em> installation"}))
+	})
+
+	ginkgo.It("should list the applications that match the facets", func() {
+		result, err := client.Search(context.Background(), &SearchRequest{Facets: entities.FacetFilter{Keywords: []string{"storage"}}})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(result.Total).Should(gomega.Equal(2))
+		gomega.Expect(result.Facets.Keywords).Should(gomega.Equal([]*entities.FacetCount{{Value: "storage", Count: 2}}))
+	})
+
+	ginkgo.It("should reject a search with a negative offset", func() {
+		_, err := client.Search(context.Background(), &SearchRequest{Text: "wordpress", From: -1})
+		gomega.Expect(status.Code(err)).Should(gomega.Equal(codes.InvalidArgument))
+	})
+
+	ginkgo.It("should list the applications page by page", func() {
+		first, err := client.ListPage(context.Background(), &ListPageRequest{Sort: "name", PageSize: 1})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(first.Applications).Should(gomega.HaveLen(1))
+		gomega.Expect(first.NextPageToken).ShouldNot(gomega.BeEmpty())
+
+		second, err := client.ListPage(context.Background(), &ListPageRequest{Sort: "name", PageSize: 1, PageToken: first.NextPageToken})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(second.Applications).Should(gomega.HaveLen(1))
+		gomega.Expect(second.Applications[0].ApplicationName).ShouldNot(gomega.Equal(first.Applications[0].ApplicationName))
+		gomega.Expect(second.NextPageToken).Should(gomega.BeEmpty())
+	})
+
+	ginkgo.Context("using the HTTP gateway", func() {
+		var mux *runtime.ServeMux
+		var ctx context.Context
+		var cancel context.CancelFunc
+
+		ginkgo.BeforeEach(func() {
+			ctx, cancel = context.WithCancel(context.Background())
+			mux = runtime.NewServeMux()
+			err := RegisterExtendedCatalogHandlerFromEndpoint(ctx, mux, "bufnet", dialOptions)
+			gomega.Expect(err).Should(gomega.Succeed())
+		})
+
+		ginkgo.AfterEach(func() {
+			cancel()
+		})
+
+		ginkgo.It("should search the applications with the query parameters", func() {
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, SearchPath+"?q=wordpress&size=5", nil))
+			gomega.Expect(recorder.Code).Should(gomega.Equal(http.StatusOK))
+			var result entities.SearchResult
+			gomega.Expect(json.Unmarshal(recorder.Body.Bytes(), &result)).Should(gomega.Succeed())
+			gomega.Expect(result.Total).Should(gomega.Equal(1))
+		})
+
+		ginkgo.It("should filter the applications with the facet query parameters", func() {
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, SearchPath+"?keyword=other&keyword=storage&license=MIT", nil))
+			gomega.Expect(recorder.Code).Should(gomega.Equal(http.StatusOK))
+			var result entities.SearchResult
+			gomega.Expect(json.Unmarshal(recorder.Body.Bytes(), &result)).Should(gomega.Succeed())
+			gomega.Expect(result.Total).Should(gomega.BeZero())
+		})
+
+		ginkgo.It("should search the applications with a JSON body", func() {
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, SearchPath, strings.NewReader(`{"Text": "wordpress"}`)))
+			gomega.Expect(recorder.Code).Should(gomega.Equal(http.StatusOK))
+			var result entities.SearchResult
+			gomega.Expect(json.Unmarshal(recorder.Body.Bytes(), &result)).Should(gomega.Succeed())
+			gomega.Expect(result.Total).Should(gomega.Equal(1))
+		})
+
+		ginkgo.It("should list the applications with the query parameters", func() {
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, ListPagePath+"?sort=last_updated&page_size=1", nil))
+			gomega.Expect(recorder.Code).Should(gomega.Equal(http.StatusOK))
+			var page entities.ApplicationPage
+			gomega.Expect(json.Unmarshal(recorder.Body.Bytes(), &page)).Should(gomega.Succeed())
+			gomega.Expect(page.Applications).Should(gomega.HaveLen(1))
+
+			recorder = httptest.NewRecorder()
+			mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, ListPagePath+"?sort=name&page_token="+page.NextPageToken, nil))
+			gomega.Expect(recorder.Code).Should(gomega.Equal(http.StatusBadRequest))
+		})
+
+		ginkgo.It("should return the errors with their HTTP status", func() {
+			recorder := httptest.NewRecorder()
+			mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, SearchPath+"?q=wordpress&size=many", nil))
+			gomega.Expect(recorder.Code).Should(gomega.Equal(http.StatusBadRequest))
+
+			recorder = httptest.NewRecorder()
+			mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, SearchPath+"?from=-1", nil))
+			gomega.Expect(recorder.Code).Should(gomega.Equal(http.StatusBadRequest))
+		})
+	})
+})
@@ -25,14 +25,30 @@ import (
 	"github.com/napptive/catalog-manager/internal/pkg/config"
 	"github.com/napptive/catalog-manager/internal/pkg/entities"
 	"github.com/napptive/catalog-manager/internal/pkg/server/resolver"
+	"github.com/napptive/catalog-manager/internal/pkg/utils"
 	"github.com/napptive/grpc-catalog-common-go"
 	"github.com/napptive/grpc-catalog-go"
 	"github.com/napptive/nerrors/pkg/nerrors"
 	"github.com/napptive/njwt/pkg/interceptors"
 	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/metadata"
 )
 
-const appRemovedMsg = "%s removed from catalog"
+// DownloadFormatMetadataKey with the key of the incoming metadata used to select the download format. If the key is
+// not present, the format is derived from the compressed flag of the request.
+const DownloadFormatMetadataKey = "download-format"
+
+const (
+	appRemovedMsg = "%s removed from catalog"
+	// downloadChunkSize with the maximum size of the messages sent when downloading a compressed application
+	downloadChunkSize = 1024 * 1024
+	// maxSearchSize with the maximum number of applications returned by a search
+	maxSearchSize = 100
+	// defaultPageSize with the number of applications returned in a page if the size is not requested
+	defaultPageSize = 50
+	// maxPageSize with the maximum number of applications returned in a page
+	maxPageSize = 500
+)
 
 type Handler struct {
 	teamConfig config.TeamConfig
@@ -71,6 +87,11 @@ func (h *Handler) Add(server grpc_catalog_go.Catalog_AddServer) error {
 		// From https://grpc.io/docs/languages/go/basics/#server-side-streaming-rpc-1
 		request, err := server.Recv()
 		if err == io.EOF {
+			applicationFiles, err = utils.SanitizeFilePaths(applicationFiles)
+			if err != nil {
+				log.Error().Err(err).Str("applicationID", applicationID).Msg("error adding application, invalid files")
+				return nerrors.FromError(err).ToGRPC()
+			}
 			isPrivate, err := h.manager.Add(applicationID, applicationFiles, private, accountName)
 			if err != nil {
 				return nerrors.FromError(err).ToGRPC()
@@ -160,6 +181,11 @@ func (h *Handler) Upload(ctx context.Context, request *grpc_catalog_go.UploadApp
 			Data: sDec,
 		})
 	}
+	files, err := utils.SanitizeFilePaths(files)
+	if err != nil {
+		log.Error().Err(err).Str("applicationID", request.ApplicationId).Msg("error uploading application, invalid files")
+		return nil, nerrors.FromError(err).ToGRPC()
+	}
 	isPrivate, err := h.manager.Add(request.ApplicationId, files, request.Private, accountName)
 	if err != nil {
 		log.Error().Err(err).Str("applicationID", request.ApplicationId).Msg("error uploading application")
@@ -194,8 +220,15 @@ func (h *Handler) Download(request *grpc_catalog_go.DownloadApplicationRequest,
 		log.Error().Err(err).Str("application_name", request.ApplicationId).Msg("error checking permission, unable to download the application")
 		return nerrors.FromError(err).ToGRPC()
 	}
+	format, err := getDownloadFormat(server.Context(), request.Compressed)
+	if err != nil {
+		return nerrors.FromError(err).ToGRPC()
+	}
+	if format.IsArchive() {
+		return h.sendStream(request.ApplicationId, format, *accountAllowed, server)
+	}
 	// download the application
-	files, err := h.manager.Download(request.ApplicationId, request.Compressed, *accountAllowed)
+	files, err := h.manager.Download(request.ApplicationId, format, *accountAllowed, true)
 	if err != nil {
 		log.Error().Err(err).Str("application_name", request.ApplicationId).Msg("error downloading the application")
 		return nerrors.FromError(err).ToGRPC()
@@ -209,6 +242,45 @@ func (h *Handler) Download(request *grpc_catalog_go.DownloadApplicationRequest,
 	return nil
 }
 
+// getDownloadFormat returns the format requested in the incoming metadata, or the one matching the compressed flag
+// if no format is set.
+func getDownloadFormat(ctx context.Context, compressed bool) (entities.DownloadFormat, error) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(DownloadFormatMetadataKey); len(values) > 0 && values[0] != "" {
+			return entities.ParseDownloadFormat(values[0])
+		}
+	}
+	return entities.NewDownloadFormat(compressed), nil
+}
+
+// sendStream sends the application archive in chunks of downloadChunkSize bytes.
+// All the messages have the same path, the client must concatenate them.
+func (h *Handler) sendStream(applicationID string, format entities.DownloadFormat, accountAllowed bool, server grpc_catalog_go.Catalog_DownloadServer) error {
+	stream, err := h.manager.DownloadStream(applicationID, format, accountAllowed, true)
+	if err != nil {
+		log.Error().Err(err).Str("application_name", applicationID).Msg("error downloading the application")
+		return nerrors.FromError(err).ToGRPC()
+	}
+	defer stream.Reader.Close()
+
+	buffer := make([]byte, downloadChunkSize)
+	for {
+		n, err := io.ReadFull(stream.Reader, buffer)
+		if n > 0 {
+			if sErr := server.Send(&grpc_catalog_go.FileInfo{Path: stream.Path, Data: buffer[:n]}); sErr != nil {
+				return nerrors.NewInternalErrorFrom(sErr, "unable to send the file").ToGRPC()
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			log.Error().Err(err).Str("application_name", applicationID).Msg("error reading the application")
+			return nerrors.NewInternalErrorFrom(err, "unable to read the application").ToGRPC()
+		}
+	}
+}
+
 // Remove an application from the catalog
 func (h *Handler) Remove(ctx context.Context, request *grpc_catalog_go.RemoveApplicationRequest) (*grpc_catalog_common_go.OpResponse, error) {
 
@@ -269,12 +341,12 @@ func (h *Handler) List(ctx context.Context, request *grpc_catalog_go.ListApplica
 		}
 	}
 
-	list, err := h.manager.List(namespacesMap, showPublicApps)
+	list, err := h.manager.List(namespacesMap, showPublicApps, nil)
 	if err != nil {
 		return nil, nerrors.FromError(err).ToGRPC()
 	}
 	summaryList := make([]*grpc_catalog_go.ApplicationSummary, 0)
-	for _, app := range list {
+	for _, app := range list.Applications {
 		summaryList = append(summaryList, app.ToApplicationSummary())
 	}
 
@@ -282,6 +354,95 @@ func (h *Handler) List(ctx context.Context, request *grpc_catalog_go.ListApplica
 
 }
 
+// getVisibleAccounts returns the visibility filter of each account whose applications the user can see, and if the
+// public applications of all the accounts are visible. In a namespace, all the applications are visible if the
+// user can operate in it, only the public ones otherwise. Without namespace, the public applications and the
+// private ones of the user accounts are visible.
+func (h *Handler) getVisibleAccounts(ctx context.Context, namespace string) (map[string]*bool, bool, error) {
+	namespacesMap := make(map[string]*bool)
+	if namespace != "" {
+		// check user permission in the application namespace (for private apps)
+		accountAllowed, err := h.resolver.CheckAccountPermissions(ctx, fmt.Sprintf("%s/dummy", namespace), false)
+		if err != nil {
+			return nil, false, err
+		}
+		if *accountAllowed {
+			accountAllowed = nil
+		}
+		namespacesMap[namespace] = accountAllowed
+		return namespacesMap, false, nil
+	}
+	if h.authEnabled {
+		ownApps := true
+		claim, err := interceptors.GetClaimFromContext(ctx)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, account := range claim.Accounts {
+			namespacesMap[account.Name] = &ownApps
+		}
+	}
+	return namespacesMap, true, nil
+}
+
+// ListPage returns a page of the applications sorted by name, namespace, last update or popularity. As in List,
+// the private applications are only returned if the user can operate in their namespace.
+func (h *Handler) ListPage(ctx context.Context, request *ListPageRequest) (*entities.ApplicationPage, error) {
+	if request.PageSize < 0 || request.PageSize > maxPageSize {
+		return nil, nerrors.NewInvalidArgumentError("page size must be between 0 and %d", maxPageSize).ToGRPC()
+	}
+	sort, err := entities.ParseListSort(request.Sort)
+	if err != nil {
+		return nil, nerrors.FromError(err).ToGRPC()
+	}
+	pageSize := request.PageSize
+	if pageSize == 0 {
+		pageSize = defaultPageSize
+	}
+
+	namespacesMap, showPublicApps, err := h.getVisibleAccounts(ctx, request.Namespace)
+	if err != nil {
+		log.Error().Err(err).Str("namespace", request.Namespace).Msg("error checking permission, unable to list applications")
+		return nil, nerrors.FromError(err).ToGRPC()
+	}
+
+	page, err := h.manager.List(namespacesMap, showPublicApps, &entities.PageRequest{
+		Sort:      sort,
+		PageSize:  pageSize,
+		PageToken: request.PageToken,
+	})
+	if err != nil {
+		log.Error().Err(err).Str("namespace", request.Namespace).Msg("error listing applications")
+		return nil, nerrors.FromError(err).ToGRPC()
+	}
+	return page, nil
+}
+
+// Search returns a page of the applications that contain a text and match the facets sorted by relevance, with the
+// number of tags per facet value. As in List, the private applications are only returned if the user can operate
+// in their namespace.
+func (h *Handler) Search(ctx context.Context, request *SearchRequest) (*entities.SearchResult, error) {
+	if request.From < 0 {
+		return nil, nerrors.NewInvalidArgumentError("from must not be negative").ToGRPC()
+	}
+	if request.Size < 0 || request.Size > maxSearchSize {
+		return nil, nerrors.NewInvalidArgumentError("size must be between 0 and %d", maxSearchSize).ToGRPC()
+	}
+
+	namespacesMap, showPublicApps, err := h.getVisibleAccounts(ctx, request.Namespace)
+	if err != nil {
+		log.Error().Err(err).Str("namespace", request.Namespace).Msg("error checking permission, unable to search applications")
+		return nil, nerrors.FromError(err).ToGRPC()
+	}
+
+	result, err := h.manager.Search(request.Text, &request.Facets, namespacesMap, showPublicApps, request.From, request.Size)
+	if err != nil {
+		log.Error().Err(err).Str("text", request.Text).Msg("error searching applications")
+		return nil, nerrors.FromError(err).ToGRPC()
+	}
+	return result, nil
+}
+
 // Info returns the detail of a given application
 func (h *Handler) Info(ctx context.Context, request *grpc_catalog_go.InfoApplicationRequest) (*grpc_catalog_go.InfoApplicationResponse, error) {
 
@@ -340,7 +501,8 @@ func (h *Handler) Update(ctx context.Context, request *grpc_catalog_go.UpdateReq
 		return nil, nerrors.FromError(err).ToGRPC()
 	}
 
-	if err := h.manager.UpdateApplicationVisibility(request.Namespace, request.ApplicationName, request.Private); err != nil {
+	updated, err := h.manager.UpdateApplicationVisibility(request.Namespace, request.ApplicationName, request.Private)
+	if err != nil {
 		log.Error().Err(err).Str("namespace", request.Namespace).
 			Str("application", request.ApplicationName).Msg("error changing application visibility")
 		return nil, nerrors.FromError(err).ToGRPC()
@@ -354,7 +516,7 @@ func (h *Handler) Update(ctx context.Context, request *grpc_catalog_go.UpdateReq
 	return &grpc_catalog_common_go.OpResponse{
 		Status:     grpc_catalog_common_go.OpStatus_SUCCESS,
 		StatusName: grpc_catalog_common_go.OpStatus_SUCCESS.String(),
-		UserInfo:   fmt.Sprintf("Application %s/%s changed to %s", request.Namespace, request.ApplicationName, privateStr),
+		UserInfo:   fmt.Sprintf("Application %s/%s changed to %s (%d tags updated)", request.Namespace, request.ApplicationName, privateStr, updated),
 	}, nil
 }
 
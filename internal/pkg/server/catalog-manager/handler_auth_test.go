@@ -24,11 +24,14 @@ import (
 
 	"github.com/golang/mock/gomock"
 	"github.com/napptive/catalog-manager/internal/pkg/config"
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
 	"github.com/napptive/catalog-manager/internal/pkg/utils"
 	"github.com/napptive/grpc-catalog-common-go"
 	"github.com/napptive/grpc-catalog-go"
 	"github.com/onsi/ginkgo"
 	"github.com/onsi/gomega"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 var (
@@ -191,4 +194,67 @@ var _ = ginkgo.Describe("Catalog handler test with auth enabled by JWT", func()
 		})
 	})
 
+	ginkgo.Context("searching applications", func() {
+		ownApps := true
+		publicApps := false
+		result := &entities.SearchResult{Hits: make([]*entities.SearchHit, 0)}
+
+		ginkgo.It("should search the public applications and the private ones of the user accounts", func() {
+			manager.EXPECT().Search("wordpress", &entities.FacetFilter{}, map[string]*bool{validAccountName: &ownApps}, true, 0, 0).Return(result, nil)
+			_, err := handler.Search(GetTestMemberContext(), &SearchRequest{Text: "wordpress"})
+			gomega.Expect(err).To(gomega.Succeed())
+		})
+		ginkgo.It("should search all the applications of an account of the user", func() {
+			manager.EXPECT().Search("wordpress", &entities.FacetFilter{}, map[string]*bool{validAccountName: nil}, false, 10, 5).Return(result, nil)
+			_, err := handler.Search(GetTestMemberContext(), &SearchRequest{Text: "wordpress", Namespace: validAccountName, From: 10, Size: 5})
+			gomega.Expect(err).To(gomega.Succeed())
+		})
+		ginkgo.It("should only search the public applications of another account", func() {
+			manager.EXPECT().Search("wordpress", &entities.FacetFilter{}, map[string]*bool{"unauthorized": &publicApps}, false, 0, 0).Return(result, nil)
+			_, err := handler.Search(GetTestMemberContext(), &SearchRequest{Text: "wordpress", Namespace: "unauthorized"})
+			gomega.Expect(err).To(gomega.Succeed())
+		})
+		ginkgo.It("should pass the facets to filter the applications", func() {
+			facets := entities.FacetFilter{Keywords: []string{"storage"}}
+			manager.EXPECT().Search("", &facets, map[string]*bool{validAccountName: &ownApps}, true, 0, 0).Return(result, nil)
+			_, err := handler.Search(GetTestMemberContext(), &SearchRequest{Facets: facets})
+			gomega.Expect(err).To(gomega.Succeed())
+		})
+		ginkgo.It("should fail if the page size is too big", func() {
+			_, err := handler.Search(GetTestMemberContext(), &SearchRequest{Text: "wordpress", Size: maxSearchSize + 1})
+			gomega.Expect(err).To(gomega.HaveOccurred())
+		})
+	})
+
+	ginkgo.Context("listing pages of applications", func() {
+		ownApps := true
+		publicApps := false
+		page := &entities.ApplicationPage{Applications: make([]*entities.AppSummary, 0)}
+
+		ginkgo.It("should list the public applications and the ones of the user accounts with the default page size", func() {
+			manager.EXPECT().List(map[string]*bool{validAccountName: &ownApps}, true,
+				&entities.PageRequest{Sort: entities.ListSortNamespace, PageSize: defaultPageSize}).Return(page, nil)
+			_, err := handler.ListPage(GetTestMemberContext(), &ListPageRequest{})
+			gomega.Expect(err).To(gomega.Succeed())
+		})
+		ginkgo.It("should list the requested page of an account of the user", func() {
+			manager.EXPECT().List(map[string]*bool{validAccountName: nil}, false,
+				&entities.PageRequest{Sort: entities.ListSortPopularity, PageSize: 10, PageToken: "token"}).Return(page, nil)
+			_, err := handler.ListPage(GetTestMemberContext(), &ListPageRequest{Namespace: validAccountName, Sort: "popularity", PageSize: 10, PageToken: "token"})
+			gomega.Expect(err).To(gomega.Succeed())
+		})
+		ginkgo.It("should only list the public applications of another account", func() {
+			manager.EXPECT().List(map[string]*bool{"unauthorized": &publicApps}, false,
+				&entities.PageRequest{Sort: entities.ListSortName, PageSize: defaultPageSize}).Return(page, nil)
+			_, err := handler.ListPage(GetTestMemberContext(), &ListPageRequest{Namespace: "unauthorized", Sort: "name"})
+			gomega.Expect(err).To(gomega.Succeed())
+		})
+		ginkgo.It("should fail if the order or the page size are not valid", func() {
+			_, err := handler.ListPage(GetTestMemberContext(), &ListPageRequest{Sort: "size"})
+			gomega.Expect(status.Code(err)).To(gomega.Equal(codes.InvalidArgument))
+			_, err = handler.ListPage(GetTestMemberContext(), &ListPageRequest{PageSize: maxPageSize + 1})
+			gomega.Expect(status.Code(err)).To(gomega.Equal(codes.InvalidArgument))
+		})
+	})
+
 })
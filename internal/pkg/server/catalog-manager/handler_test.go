@@ -0,0 +1,183 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package catalog_manager
+
+import (
+	"bytes"
+	"context"
+	b64 "encoding/base64"
+	"io"
+
+	"github.com/golang/mock/gomock"
+	"github.com/napptive/catalog-manager/internal/pkg/config"
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/catalog-manager/internal/pkg/server/resolver"
+	"github.com/napptive/grpc-catalog-go"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// downloadServer stores the messages sent by the Download operation
+type downloadServer struct {
+	grpc.ServerStream
+	ctx   context.Context
+	files []*grpc_catalog_go.FileInfo
+}
+
+func (d *downloadServer) Context() context.Context {
+	if d.ctx == nil {
+		return context.Background()
+	}
+	return d.ctx
+}
+
+func (d *downloadServer) Send(file *grpc_catalog_go.FileInfo) error {
+	// the handler reuses the buffer between messages
+	d.files = append(d.files, &grpc_catalog_go.FileInfo{Path: file.Path, Data: append([]byte{}, file.Data...)})
+	return nil
+}
+
+var _ = ginkgo.Describe("Catalog handler test", func() {
+
+	var ctrl *gomock.Controller
+	var handler *Handler
+	var manager *MockManager
+	var addServerStream *MockCatalog_AddServer
+
+	ginkgo.BeforeEach(func() {
+		ctrl = gomock.NewController(ginkgo.GinkgoT())
+		manager = NewMockManager(ctrl)
+		addServerStream = NewMockCatalog_AddServer(ctrl)
+		permissionResolver := resolver.NewPermissionResolver(false, config.NewTeamConfig(false, "", ""))
+		handler = NewHandler(manager, false, config.TeamConfig{}, *permissionResolver)
+	})
+
+	ginkgo.AfterEach(func() {
+		ctrl.Finish()
+	})
+
+	mockAddStream := func(applicationID string, paths ...string) {
+		addServerStream.EXPECT().Context().Return(context.Background()).AnyTimes()
+		for _, filePath := range paths {
+			addServerStream.EXPECT().Recv().Return(&grpc_catalog_go.AddApplicationRequest{
+				ApplicationId: applicationID,
+				File:          &grpc_catalog_go.FileInfo{Path: filePath, Data: []byte("data")},
+			}, nil)
+		}
+		addServerStream.EXPECT().Recv().Return(nil, io.EOF)
+	}
+
+	ginkgo.Context("adding applications with hostile file paths", func() {
+		ginkgo.It("should add the application with the normalised paths", func() {
+			mockAddStream("namespace/app:latest", "./app/app_config.yaml", "app//component.yaml")
+			manager.EXPECT().Add("namespace/app:latest", []*entities.FileInfo{
+				{Path: "app/app_config.yaml", Data: []byte("data")},
+				{Path: "app/component.yaml", Data: []byte("data")},
+			}, false, "").Return(false, nil)
+			addServerStream.EXPECT().SendAndClose(gomock.Any()).Return(nil)
+
+			err := handler.Add(addServerStream)
+			gomega.Expect(err).To(gomega.Succeed())
+		})
+
+		ginkgo.It("should reject a stream with files outside the application directory", func() {
+			mockAddStream("namespace/app:latest", "app/app_config.yaml", "../../other-ns/app/tag/x.yaml")
+
+			err := handler.Add(addServerStream)
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			gomega.Expect(status.Code(err)).To(gomega.Equal(codes.FailedPrecondition))
+			gomega.Expect(err.Error()).To(gomega.ContainSubstring("../../other-ns/app/tag/x.yaml"))
+		})
+
+		ginkgo.It("should reject an upload with absolute and duplicated paths", func() {
+			data := b64.StdEncoding.EncodeToString([]byte("data"))
+			request := &grpc_catalog_go.UploadApplicationRequest{
+				ApplicationId: "namespace/app:latest",
+				Files: []*grpc_catalog_go.Base64FileInfo{
+					{Path: "app/app_config.yaml", Data: data},
+					{Path: "/etc/passwd", Data: data},
+					{Path: "app/./app_config.yaml", Data: data},
+				},
+			}
+
+			_, err := handler.Upload(context.Background(), request)
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			gomega.Expect(status.Code(err)).To(gomega.Equal(codes.FailedPrecondition))
+			gomega.Expect(err.Error()).To(gomega.ContainSubstring("/etc/passwd"))
+			gomega.Expect(err.Error()).To(gomega.ContainSubstring("duplicated path"))
+		})
+	})
+	ginkgo.Context("downloading compressed applications", func() {
+		ginkgo.It("should send the application in bounded chunks", func() {
+			data := make([]byte, 2*downloadChunkSize+downloadChunkSize/2)
+			for i := range data {
+				data[i] = byte(i % 251)
+			}
+			manager.EXPECT().DownloadStream("namespace/app:latest", entities.DownloadFormatTgz, true, true).Return(&entities.FileStream{
+				Path:   "./app.tgz",
+				Reader: io.NopCloser(bytes.NewReader(data)),
+			}, nil)
+
+			server := &downloadServer{}
+			err := handler.Download(&grpc_catalog_go.DownloadApplicationRequest{
+				ApplicationId: "namespace/app:latest",
+				Compressed:    true,
+			}, server)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(len(server.files)).To(gomega.Equal(3))
+
+			received := make([]byte, 0, len(data))
+			for _, file := range server.files {
+				gomega.Expect(file.Path).To(gomega.Equal("./app.tgz"))
+				gomega.Expect(len(file.Data)).To(gomega.BeNumerically("<=", downloadChunkSize))
+				received = append(received, file.Data...)
+			}
+			gomega.Expect(received).To(gomega.Equal(data))
+		})
+
+		ginkgo.It("should send the application in the format requested in the metadata", func() {
+			manager.EXPECT().DownloadStream("namespace/app:latest", entities.DownloadFormatZip, true, true).Return(&entities.FileStream{
+				Path:   "./app.zip",
+				Reader: io.NopCloser(bytes.NewReader([]byte("zip"))),
+			}, nil)
+
+			server := &downloadServer{ctx: metadata.NewIncomingContext(context.Background(),
+				metadata.Pairs(DownloadFormatMetadataKey, "zip"))}
+			err := handler.Download(&grpc_catalog_go.DownloadApplicationRequest{
+				ApplicationId: "namespace/app:latest",
+			}, server)
+			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(len(server.files)).To(gomega.Equal(1))
+			gomega.Expect(server.files[0].Path).To(gomega.Equal("./app.zip"))
+		})
+
+		ginkgo.It("should reject an invalid download format", func() {
+			server := &downloadServer{ctx: metadata.NewIncomingContext(context.Background(),
+				metadata.Pairs(DownloadFormatMetadataKey, "rar"))}
+			err := handler.Download(&grpc_catalog_go.DownloadApplicationRequest{
+				ApplicationId: "namespace/app:latest",
+				Compressed:    true,
+			}, server)
+			gomega.Expect(err).To(gomega.HaveOccurred())
+			gomega.Expect(status.Code(err)).To(gomega.Equal(codes.InvalidArgument))
+		})
+	})
+})
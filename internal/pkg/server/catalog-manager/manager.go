@@ -18,10 +18,11 @@ package catalog_manager
 
 import (
 	"regexp"
-	"strings"
+	"time"
 
 	"github.com/napptive/catalog-manager/internal/pkg/entities"
 	"github.com/napptive/catalog-manager/internal/pkg/provider/metadata"
+	"github.com/napptive/catalog-manager/internal/pkg/provider/quota"
 	"github.com/napptive/catalog-manager/internal/pkg/storage"
 	"github.com/napptive/catalog-manager/internal/pkg/utils"
 	"github.com/napptive/nerrors/pkg/nerrors"
@@ -29,8 +30,6 @@ import (
 )
 
 const (
-	// readmeFile with the name of the readme file
-	readmeFile = "readme.md"
 	// NamespaceRegex with the regular expression to match namespaces.
 	// * Must not contain two consecutive hyphens
 	// * Must be lowercase
@@ -44,63 +43,103 @@ var validNamespace = regexp.MustCompile(NamespaceRegex)
 type Manager interface {
 	// Add stores a new application in the repository.
 	Add(requestedAppID string, files []*entities.FileInfo, isPrivate bool, accountName string) (bool, error)
-	// Download returns the files of an application
-	Download(applicationDescriptor string, compressed bool, accessNsAllowed bool) ([]*entities.FileInfo, error)
+	// Download returns the files of an application, or a single file with the application archive in the given format.
+	// countDownload adds the download to the application popularity, the internal uses of the files are not counted.
+	Download(applicationDescriptor string, format entities.DownloadFormat, accessNsAllowed bool, countDownload bool) ([]*entities.FileInfo, error)
+	// DownloadStream returns the application archive in the given format that is read incrementally, countDownload
+	// adds the download to the application popularity
+	DownloadStream(applicationDescriptor string, format entities.DownloadFormat, accessNsAllowed bool, countDownload bool) (*entities.FileStream, error)
 	// Remove removes an application from the repository
 	Remove(requestedAppID string) error
 	// Get returns a given application metadata
 	Get(requestedAppID string, accessNsAllowed bool) (*entities.ExtendedApplicationMetadata, error)
-	// List returns a list of applications (without metadata and readme content)
-	List(accounts map[string]*bool, showPublicApps bool) ([]*entities.AppSummary, error)
+	// List returns a page of applications (without metadata and readme content), all of them if page is nil
+	List(accounts map[string]*bool, showPublicApps bool, page *entities.PageRequest) (*entities.ApplicationPage, error)
+	// Search returns a page of the applications that contain the text and match the facets sorted by relevance,
+	// the accounts and the public applications are filtered as in List
+	Search(text string, facets *entities.FacetFilter, accounts map[string]*bool, showPublicApps bool, from int, size int) (*entities.SearchResult, error)
 	// Summary returns catalog summary
 	Summary() (*entities.Summary, error)
-	// UpdateApplicationVisibility changes the application visibility
-	UpdateApplicationVisibility(namespace string, applicationName string, isPrivate bool) error
+	// UpdateApplicationVisibility changes the application visibility and returns the number of tags changed
+	UpdateApplicationVisibility(namespace string, applicationName string, isPrivate bool) (int, error)
 }
 
 type manager struct {
 	stManager storage.StorageManager
 	provider  metadata.MetadataProvider
+	// quotaProvider with the quotas of the namespaces
+	quotaProvider quota.QuotaProvider
+	// usage with the usage of the namespaces checked against the quotas
+	usage *usageCache
 	// catalogURL is the URL of the repository managed by this catalog
 	catalogURL string
 }
 
 // NewManager returns a new object of manager
-func NewManager(stManager storage.StorageManager, provider metadata.MetadataProvider, catalogURL string) Manager {
+func NewManager(stManager storage.StorageManager, provider metadata.MetadataProvider, quotaProvider quota.QuotaProvider, catalogURL string) Manager {
 	return &manager{
-		stManager:  stManager,
-		provider:   provider,
-		catalogURL: catalogURL,
+		stManager:     stManager,
+		provider:      provider,
+		quotaProvider: quotaProvider,
+		usage:         newUsageCache(stManager, usageCacheTTL),
+		catalogURL:    catalogURL,
 	}
 }
 
-// getApplicationMetadataFile checks the YAML files and returns the application metadata yaml file
-func (m *manager) getApplicationMetadataFile(files []*entities.FileInfo) ([]byte, *entities.ApplicationMetadata, error) {
-	var data []byte
-	var appMetadata *entities.ApplicationMetadata
+// filesSize returns the size of the application files
+func filesSize(files []*entities.FileInfo) int64 {
+	var size int64
 	for _, file := range files {
-		// the files must have .yaml extension
-		if utils.IsYamlFile(strings.ToLower(file.Path)) {
-			// 2.- Get Metadata
-			isMetadata, metadataObj, err := utils.IsMetadata(file.Data)
-			if err != nil {
-				log.Error().Err(err).Str("file", file.Path).Msg("Error looking for the metadata file")
-				return nil, nil, nerrors.NewInternalError("error in %s file [%s]", file.Path, err.Error())
-			}
-			if isMetadata {
-				data = file.Data
-				appMetadata = metadataObj
-			} else {
-				// validate YAML file to avoid errors
-				_, gkvErr := utils.GetGvk(file.Data)
-				if gkvErr != nil {
-					log.Error().Err(gkvErr).Str("file", file.Path).Msg("Error checking YAML file")
-					return nil, nil, nerrors.NewInternalError("error in %s file [%s]", file.Path, gkvErr.Error())
-				}
-			}
+		size += int64(len(file.Data))
+	}
+	return size
+}
+
+// checkQuota verifies that storing the application does not exceed the quota of its namespace.
+// The files of the tag being replaced are not taken into account.
+func (m *manager) checkQuota(appID *entities.ApplicationID, files []*entities.FileInfo) error {
+	quota, err := m.quotaProvider.GetQuota(appID.Namespace)
+	if err != nil {
+		return err
+	}
+	if *quota == (entities.Quota{}) {
+		// unlimited
+		return nil
+	}
+
+	for _, file := range files {
+		if quota.MaxFileSize > 0 && int64(len(file.Data)) > quota.MaxFileSize {
+			return nerrors.NewResourceExhaustedError("file %s exceeds the maximum file size of the namespace (%d bytes)", file.Path, quota.MaxFileSize)
 		}
 	}
-	return data, appMetadata, nil
+	size := filesSize(files)
+
+	tags, err := m.usage.get(appID.Namespace)
+	if err != nil {
+		return err
+	}
+	usage := entities.NewNamespaceUsage(appID.Namespace, tags, *quota)
+	if previous := usage.GetTagUsage(appID.ApplicationName, appID.Tag); previous != nil {
+		// the tag is replaced
+		usage.Bytes -= previous.Bytes
+	} else {
+		if _, exists := usage.Tags[appID.ApplicationName]; !exists {
+			usage.Applications++
+		}
+		usage.Tags[appID.ApplicationName]++
+	}
+	usage.Bytes += size
+
+	if quota.MaxApplications > 0 && usage.Applications > quota.MaxApplications {
+		return nerrors.NewResourceExhaustedError("the namespace has reached the maximum number of applications (%d)", quota.MaxApplications)
+	}
+	if quota.MaxTagsPerApplication > 0 && usage.Tags[appID.ApplicationName] > quota.MaxTagsPerApplication {
+		return nerrors.NewResourceExhaustedError("the application has reached the maximum number of tags (%d)", quota.MaxTagsPerApplication)
+	}
+	if quota.MaxBytes > 0 && usage.Bytes > quota.MaxBytes {
+		return nerrors.NewResourceExhaustedError("the application exceeds the storage quota of the namespace (%d of %d bytes used)", usage.Bytes-size, quota.MaxBytes)
+	}
+	return nil
 }
 
 // Add stores a new application in the repository returning the application visibility
@@ -120,6 +159,11 @@ func (m *manager) Add(requestedAppID string, files []*entities.FileInfo, isPriva
 		return false, nerrors.NewFailedPreconditionError("Invalid namespace, must contain lowercase letters, can contain single hyphens and numbers.")
 	}
 
+	// the tags that would shadow the resolution of latest, stable or a version constraint are rejected
+	if err = utils.CheckTag(appID.Tag); err != nil {
+		return false, err
+	}
+
 	// if catalogURL is not empty, check it!
 	if m.catalogURL != "" {
 		// check that the url of the application matches the url of the catalog
@@ -130,8 +174,8 @@ func (m *manager) Add(requestedAppID string, files []*entities.FileInfo, isPriva
 		}
 	}
 
-	readme := utils.GetFile(readmeFile, files)
-	appMetadata, header, err := m.getApplicationMetadataFile(files)
+	readme := utils.GetFile(utils.ReadmeFile, files)
+	appMetadata, header, err := utils.GetApplicationMetadataFile(files)
 	if err != nil {
 		log.Err(err).Str("name", requestedAppID).Msg("Unable to add the application. Error getting metadata")
 		return false, err
@@ -145,28 +189,51 @@ func (m *manager) Add(requestedAppID string, files []*entities.FileInfo, isPriva
 		return false, nerrors.NewFailedPreconditionError("Unable to add the application. Metadata name is required.")
 	}
 
-	// If authentication is enabled
-	if accountName != "" {
-		// Check Application visibility
-		private, err := m.provider.GetApplicationVisibility(appID.Namespace, appID.ApplicationName)
-		if err != nil {
-			if nerrors.FromError(err).Code != nerrors.NotFound {
-				log.Err(err).Str("name", requestedAppID).Msg("Unable to add the application, error getting application visibility")
-				return false, nerrors.NewInternalErrorFrom(err, "Unable to add the application.")
-			}
+	// The tags of an application share its visibility, with or without authentication
+	private, err := m.provider.GetApplicationVisibility(appID.Namespace, appID.ApplicationName)
+	if err != nil {
+		if nerrors.FromError(err).Code != nerrors.NotFound {
+			log.Err(err).Str("name", requestedAppID).Msg("Unable to add the application, error getting application visibility")
+			return false, nerrors.NewInternalErrorFrom(err, "Unable to add the application.")
 		}
+	}
 
-		if private != nil {
-			log.Debug().Bool("application visibility", *private).Bool("new app visibility", isPrivate).Msg("checking application visibility")
-			// the application stored is public and the user wants to store another version PRIVATE -> error
-			if !*private && isPrivate {
-				return false, nerrors.NewInternalError("error adding application. There is already a public application, change the visibility before adding a private one.")
-			} else {
-				isPrivate = *private
-			}
+	if private != nil {
+		log.Debug().Bool("application visibility", *private).Bool("new app visibility", isPrivate).Msg("checking application visibility")
+		// the application stored is public and the user wants to store another version PRIVATE -> error
+		if !*private && isPrivate {
+			return false, nerrors.NewInternalError("error adding application. There is already a public application, change the visibility before adding a private one.")
 		} else {
-			log.Debug().Bool("new app visibility", isPrivate).Msg("There is no applications previously")
+			isPrivate = *private
+		}
+	} else {
+		log.Debug().Bool("new app visibility", isPrivate).Msg("There is no applications previously")
+	}
+
+	if err = m.checkQuota(appID, files); err != nil {
+		log.Err(err).Str("name", requestedAppID).Msg("Unable to add the application, quota exceeded")
+		return false, err
+	}
+
+	// the downloads of a tag are kept when it is replaced, its metadata is restored if the push fails
+	var downloads int64
+	previous, err := m.provider.Get(appID)
+	if err != nil {
+		if nerrors.FromError(err).Code != nerrors.NotFound {
+			log.Err(err).Str("name", requestedAppID).Msg("Unable to add the application, error getting the previous metadata")
+			return false, nerrors.NewInternalErrorFrom(err, "Unable to add the application.")
 		}
+		previous = nil
+	}
+	if previous != nil {
+		downloads = previous.Downloads
+	}
+
+	// the visibility stored with the files, nil if it has not been stored yet
+	storedPrivate, err := m.stManager.GetApplicationVisibility(appID.Namespace, appID.ApplicationName)
+	if err != nil {
+		log.Err(err).Str("name", requestedAppID).Msg("Unable to add the application, error getting stored visibility")
+		return false, nerrors.NewInternalErrorFrom(err, "Unable to add the application.")
 	}
 
 	if _, err := m.provider.Add(&entities.ApplicationInfo{
@@ -177,25 +244,78 @@ func (m *manager) Add(requestedAppID string, files []*entities.FileInfo, isPriva
 		Metadata:        string(appMetadata),
 		MetadataName:    header.Name,
 		Private:         isPrivate,
+		LastUpdated:     time.Now().UTC(),
+		Downloads:       downloads,
 	}); err != nil {
 		log.Err(err).Str("name", requestedAppID).Msg("Error storing application metadata")
 		return false, err
 	}
 
-	// store the files into the repository storage
+	// keep a copy of the visibility with the files, it is used to rebuild the metadata and to encrypt the
+	// files of the private applications, so it is stored before them. It is only written when it changes, as it
+	// applies to all the tags.
+	var restorePrivate *bool
+	if storedPrivate == nil || *storedPrivate != isPrivate {
+		if err = m.stManager.StoreApplicationVisibility(appID.Namespace, appID.ApplicationName, isPrivate); err != nil {
+			log.Err(err).Str("name", requestedAppID).Msg("Error storing application visibility")
+			m.rollbackAdd(appID, previous, nil)
+			return false, err
+		}
+		restorePrivate = storedPrivate
+	}
+
+	// store the files into the repository storage, the tgz served by the compressed downloads is created here
 	if err = m.stManager.StoreApplication(appID.Namespace, appID.ApplicationName, appID.Tag, files); err != nil {
 		log.Err(err).Str("name", requestedAppID).Msg("Error storing application")
-		// rollback operation
-		if rErr := m.provider.Remove(appID); rErr != nil {
-			log.Err(err).Interface("appID", appID).Msg("Error in rollback operation, metadata can not be removed")
-		}
+		m.rollbackAdd(appID, previous, restorePrivate)
 		return false, err
 	}
+	m.usage.setTag(appID, filesSize(files))
 
 	return isPrivate, nil
 }
 
-func (m *manager) Download(applicationID string, compressed bool, allowed bool) ([]*entities.FileInfo, error) {
+// rollbackAdd undoes the changes of an application push that could not be completed. The metadata of the tag is
+// restored to previous, or removed if the tag did not exist, and the stored visibility is restored to
+// previousPrivate if it was changed.
+func (m *manager) rollbackAdd(appID *entities.ApplicationID, previous *entities.ApplicationInfo, previousPrivate *bool) {
+	if previous != nil {
+		if _, err := m.provider.Add(previous); err != nil {
+			log.Err(err).Interface("appID", appID).Msg("Error in rollback operation, metadata can not be restored")
+		}
+	} else if err := m.provider.Remove(appID); err != nil {
+		log.Err(err).Interface("appID", appID).Msg("Error in rollback operation, metadata can not be removed")
+	}
+	if previousPrivate != nil {
+		if err := m.stManager.StoreApplicationVisibility(appID.Namespace, appID.ApplicationName, *previousPrivate); err != nil {
+			log.Err(err).Interface("appID", appID).Msg("Error in rollback operation, visibility can not be restored")
+		}
+	}
+}
+
+// getApplication returns the metadata of an application tag. If the tag does not exist, it is resolved among the
+// tags of the application as latest, stable or a version constraint, and the identifier is updated with the
+// resolved tag.
+func (m *manager) getApplication(appID *entities.ApplicationID) (*entities.ApplicationInfo, error) {
+	app, err := m.provider.Get(appID)
+	if err == nil || nerrors.FromError(err).Code != nerrors.NotFound {
+		return app, err
+	}
+	tags, lErr := m.provider.ListTags(appID.Namespace, appID.ApplicationName)
+	if lErr != nil {
+		return nil, lErr
+	}
+	tag, found := utils.ResolveTag(appID.Tag, tags)
+	if !found {
+		return nil, err
+	}
+	log.Debug().Str("application", appID.String()).Str("resolved", tag).Msg("tag resolved")
+	appID.Tag = tag
+	return m.provider.Get(appID)
+}
+
+// getDownloadableApplication checks that the application exists and it can be downloaded
+func (m *manager) getDownloadableApplication(applicationID string, allowed bool) (*entities.ApplicationID, error) {
 
 	_, applicationDescriptor, err := utils.DecomposeApplicationID(applicationID)
 
@@ -204,7 +324,7 @@ func (m *manager) Download(applicationID string, compressed bool, allowed bool)
 		return nil, err
 	}
 	// If the application is private and the username is the application owner -> error
-	app, err := m.provider.Get(applicationDescriptor)
+	app, err := m.getApplication(applicationDescriptor)
 	if err != nil {
 		if nerrors.FromError(err).Code == nerrors.NotFound {
 			return nil, nerrors.NewNotFoundError("application %s not available", applicationDescriptor.String())
@@ -216,8 +336,49 @@ func (m *manager) Download(applicationID string, compressed bool, allowed bool)
 		return nil, nerrors.NewNotFoundError("application %s not available", applicationDescriptor.String())
 
 	}
+	return applicationDescriptor, nil
+}
 
-	return m.stManager.GetApplication(applicationDescriptor.Namespace, applicationDescriptor.ApplicationName, applicationDescriptor.Tag, compressed)
+// countDownload adds a download to the application popularity, the download does not fail if it cannot be counted
+func (m *manager) countDownload(appID *entities.ApplicationID) {
+	if err := m.provider.IncrementDownloads(appID); err != nil {
+		log.Warn().Err(err).Str("application", appID.String()).Msg("unable to count the application download")
+	}
+}
+
+// Download returns the files of an application, or a single file with the application archive in the given format
+func (m *manager) Download(applicationID string, format entities.DownloadFormat, allowed bool, countDownload bool) ([]*entities.FileInfo, error) {
+	applicationDescriptor, err := m.getDownloadableApplication(applicationID, allowed)
+	if err != nil {
+		return nil, err
+	}
+	files, err := m.stManager.GetApplication(applicationDescriptor.Namespace, applicationDescriptor.ApplicationName, applicationDescriptor.Tag, format)
+	if err != nil {
+		return nil, err
+	}
+	if countDownload {
+		m.countDownload(applicationDescriptor)
+	}
+	return files, nil
+}
+
+// DownloadStream returns the application archive in the given format that is read incrementally
+func (m *manager) DownloadStream(applicationID string, format entities.DownloadFormat, allowed bool, countDownload bool) (*entities.FileStream, error) {
+	applicationDescriptor, err := m.getDownloadableApplication(applicationID, allowed)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := m.stManager.GetApplicationStream(applicationDescriptor.Namespace, applicationDescriptor.ApplicationName, applicationDescriptor.Tag, format)
+	if err != nil {
+		return nil, err
+	}
+	if countDownload {
+		m.countDownload(applicationDescriptor)
+	}
+	return &entities.FileStream{
+		Path:   format.FileName(applicationDescriptor.ApplicationName),
+		Reader: reader,
+	}, nil
 }
 
 // Remove removes an application from the repository
@@ -242,6 +403,7 @@ func (m *manager) Remove(requestedAppID string) error {
 		log.Err(err).Str("requestedAppID", requestedAppID).Msg("Unable to remove application")
 		return err
 	}
+	m.usage.removeTag(appID)
 
 	return nil
 }
@@ -254,7 +416,7 @@ func (m *manager) Get(requestedAppID string, accessNsAllowed bool) (*entities.Ex
 		return nil, err
 	}
 
-	app, err := m.provider.Get(appID)
+	app, err := m.getApplication(appID)
 	if err != nil {
 		if nerrors.FromError(err).Code == nerrors.NotFound {
 			return nil, nerrors.NewNotFoundError("application %s not available", appID.String())
@@ -292,33 +454,57 @@ func (m *manager) Get(requestedAppID string, accessNsAllowed bool) (*entities.Ex
 // List ([catalogURL/]namespace)
 // List returns a list f applications
 // The private and or public applications for the accounts in accounts
-// and if showPublicApps is true, already returns all the public applications
-func (m *manager) List(accounts map[string]*bool, showPublicApps bool) ([]*entities.AppSummary, error) {
+// and if showPublicApps is true, already returns all the public applications.
+// The metadata provider returns the page of the public applications and the one of each account, and they are
+// merged. The page tokens point after the last application returned so they are valid even if the public
+// applications cache is refreshed between pages
+func (m *manager) List(accounts map[string]*bool, showPublicApps bool, page *entities.PageRequest) (*entities.ApplicationPage, error) {
 
-	result := make([]*entities.AppSummary, 0)
+	pages := make([]*entities.ApplicationPage, 0, len(accounts)+1)
 	if showPublicApps {
 		private := false
-		apps, _, err := m.provider.ListSummaryWithFilter(&metadata.ListFilter{
+		apps, err := m.provider.ListSummaryWithFilter(&metadata.ListFilter{
 			Namespace: nil,
 			Private:   &private,
-		})
+		}, page)
 		if err != nil {
 			return nil, err
 		}
-		result = append(result, apps...)
+		pages = append(pages, apps)
 	}
 
 	for accountName, private := range accounts {
-		apps, _, err := m.provider.ListSummaryWithFilter(&metadata.ListFilter{
+		accountName := accountName
+		apps, err := m.provider.ListSummaryWithFilter(&metadata.ListFilter{
 			Namespace: &accountName,
 			Private:   private,
-		})
+		}, page)
 		if err != nil {
 			return nil, err
 		}
-		result = append(result, apps...)
+		pages = append(pages, apps)
+	}
+	return metadata.MergePages(page, pages...)
+}
+
+// Search returns a page of the applications that contain the text and match the facets sorted by relevance.
+// An application is returned if it is public and showPublicApps is set, or if it belongs to one of the accounts
+// and matches its visibility filter.
+func (m *manager) Search(text string, facets *entities.FacetFilter, accounts map[string]*bool, showPublicApps bool, from int, size int) (*entities.SearchResult, error) {
+	filters := make([]*metadata.ListFilter, 0, len(accounts)+1)
+	if showPublicApps {
+		private := false
+		filters = append(filters, &metadata.ListFilter{Private: &private})
+	}
+	for accountName, private := range accounts {
+		accountName := accountName
+		filters = append(filters, &metadata.ListFilter{Namespace: &accountName, Private: private})
+	}
+	if len(filters) == 0 {
+		// no applications can be returned, an empty list of filters does not restrict the search
+		return &entities.SearchResult{Hits: make([]*entities.SearchHit, 0), Facets: entities.NewFacetCounter().Build(0)}, nil
 	}
-	return result, nil
+	return m.provider.Search(&metadata.SearchRequest{Text: text, Filters: filters, Facets: facets, From: from, Size: size})
 }
 
 // Summary returns catalog summary
@@ -326,22 +512,35 @@ func (m *manager) Summary() (*entities.Summary, error) {
 	return m.provider.GetSummary()
 }
 
-func (m *manager) UpdateApplicationVisibility(namespace string, applicationName string, isPrivate bool) error {
+func (m *manager) UpdateApplicationVisibility(namespace string, applicationName string, isPrivate bool) (int, error) {
 
 	previousVisibility, err := m.provider.GetApplicationVisibility(namespace, applicationName)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	if previousVisibility == nil {
-		return nerrors.NewNotFoundError("error updating application visibility. Application not found")
+		return 0, nerrors.NewNotFoundError("error updating application visibility. Application not found")
 	}
 	if *previousVisibility == isPrivate {
 		privateStr := "public"
 		if isPrivate {
 			privateStr = "private"
 		}
-		return nerrors.NewPermissionDeniedError("error updating application visibility. The application is already %s", privateStr)
+		return 0, nerrors.NewPermissionDeniedError("error updating application visibility. The application is already %s", privateStr)
 	}
 
-	return m.provider.UpdateApplicationVisibility(namespace, applicationName, isPrivate)
+	updated, err := m.provider.UpdateApplicationVisibility(namespace, applicationName, isPrivate)
+	if err != nil {
+		return updated, err
+	}
+	// the files are encrypted or decrypted if the encryption at rest is enabled
+	if err = m.stManager.StoreApplicationVisibility(namespace, applicationName, isPrivate); err != nil {
+		log.Err(err).Str("namespace", namespace).Str("applicationName", applicationName).Msg("Error storing application visibility")
+		// rollback operation
+		if _, rErr := m.provider.UpdateApplicationVisibility(namespace, applicationName, *previousVisibility); rErr != nil {
+			log.Err(rErr).Str("namespace", namespace).Str("applicationName", applicationName).Msg("Error in rollback operation, visibility can not be restored")
+		}
+		return 0, err
+	}
+	return updated, nil
 }
@@ -21,6 +21,7 @@ import (
 
 	"github.com/golang/mock/gomock"
 	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/catalog-manager/internal/pkg/provider/metadata"
 	"github.com/napptive/mock-extensions/pkg/matcher"
 	"github.com/napptive/nerrors/pkg/nerrors"
 	"github.com/onsi/ginkgo"
@@ -97,11 +98,13 @@ var _ = ginkgo.Describe("Catalog handler test", func() {
 	var ctrl *gomock.Controller
 	var storageProvider *MockStorageManager
 	var metadataProvider *MockMetadataProvider
+	var quotaProvider *MockQuotaProvider
 
 	ginkgo.BeforeEach(func() {
 		ctrl = gomock.NewController(ginkgo.GinkgoT())
 		storageProvider = NewMockStorageManager(ctrl)
 		metadataProvider = NewMockMetadataProvider(ctrl)
+		quotaProvider = NewMockQuotaProvider(ctrl)
 	})
 
 	ginkgo.AfterEach(func() {
@@ -127,14 +130,31 @@ var _ = ginkgo.Describe("Catalog handler test", func() {
 				ApplicationName: appName,
 				Private:         false,
 			}, nil)
-			storageProvider.EXPECT().GetApplication(namespace, appName, "latest", false).Return(filesReturned, nil)
+			storageProvider.EXPECT().GetApplication(namespace, appName, "latest", entities.DownloadFormatNone).Return(filesReturned, nil)
+			metadataProvider.EXPECT().IncrementDownloads(&entities.ApplicationID{Namespace: namespace, ApplicationName: appName, Tag: "latest"}).Return(nil)
 
-			manager := NewManager(storageProvider, metadataProvider, "")
-			files, err := manager.Download(fmt.Sprintf("%s/%s", namespace, appName), false, true)
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
+			files, err := manager.Download(fmt.Sprintf("%s/%s", namespace, appName), entities.DownloadFormatNone, true, true)
 			gomega.Expect(err).Should(gomega.Succeed())
 			gomega.Expect(files).ShouldNot(gomega.BeEmpty())
 			gomega.Expect(files).ShouldNot(gomega.BeNil())
 		})
+		ginkgo.It("should not count the downloads of the internal uses of an application", func() {
+			namespace := "namespace"
+			appName := "appName"
+
+			metadataProvider.EXPECT().Get(gomock.Any()).Return(&entities.ApplicationInfo{
+				Namespace:       namespace,
+				ApplicationName: appName,
+			}, nil)
+			storageProvider.EXPECT().GetApplication(namespace, appName, "latest", entities.DownloadFormatTgz).
+				Return([]*entities.FileInfo{{Path: "appName.tgz", Data: []byte("tgz")}}, nil)
+
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
+			files, err := manager.Download(fmt.Sprintf("%s/%s", namespace, appName), entities.DownloadFormatTgz, true, false)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(files).Should(gomega.HaveLen(1))
+		})
 		ginkgo.It("Should be able to download a private application if the user can access to the account", func() {
 			namespace := "namespace"
 			appName := "appName"
@@ -153,10 +173,11 @@ var _ = ginkgo.Describe("Catalog handler test", func() {
 				ApplicationName: appName,
 				Private:         true,
 			}, nil)
-			storageProvider.EXPECT().GetApplication(namespace, appName, "latest", false).Return(filesReturned, nil)
+			storageProvider.EXPECT().GetApplication(namespace, appName, "latest", entities.DownloadFormatNone).Return(filesReturned, nil)
+			metadataProvider.EXPECT().IncrementDownloads(&entities.ApplicationID{Namespace: namespace, ApplicationName: appName, Tag: "latest"}).Return(nil)
 
-			manager := NewManager(storageProvider, metadataProvider, "")
-			files, err := manager.Download(fmt.Sprintf("%s/%s", namespace, appName), false, true)
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
+			files, err := manager.Download(fmt.Sprintf("%s/%s", namespace, appName), entities.DownloadFormatNone, true, true)
 			gomega.Expect(err).Should(gomega.Succeed())
 			gomega.Expect(files).ShouldNot(gomega.BeEmpty())
 			gomega.Expect(files).ShouldNot(gomega.BeNil())
@@ -171,16 +192,38 @@ var _ = ginkgo.Describe("Catalog handler test", func() {
 				Private:         true,
 			}, nil)
 
-			manager := NewManager(storageProvider, metadataProvider, "")
-			_, err := manager.Download(fmt.Sprintf("%s/%s", namespace, appName), false, false)
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
+			_, err := manager.Download(fmt.Sprintf("%s/%s", namespace, appName), entities.DownloadFormatNone, false, true)
 			gomega.Expect(err).ShouldNot(gomega.Succeed())
 
 		})
+		ginkgo.It("should download the highest version that satisfies a constraint", func() {
+			namespace := "namespace"
+			appName := "appName"
+			resolved := &entities.ApplicationID{Namespace: namespace, ApplicationName: appName, Tag: "1.3.1"}
+
+			metadataProvider.EXPECT().Get(&entities.ApplicationID{Namespace: namespace, ApplicationName: appName, Tag: "^1.2"}).
+				Return(nil, nerrors.NewNotFoundError("not found"))
+			metadataProvider.EXPECT().ListTags(namespace, appName).Return([]string{"1.1.0", "1.3.1", "2.0.0"}, nil)
+			metadataProvider.EXPECT().Get(resolved).Return(&entities.ApplicationInfo{
+				Namespace:       namespace,
+				ApplicationName: appName,
+				Tag:             "1.3.1",
+			}, nil)
+			storageProvider.EXPECT().GetApplication(namespace, appName, "1.3.1", entities.DownloadFormatNone).
+				Return([]*entities.FileInfo{{Path: "./app.yaml", Data: []byte("app")}}, nil)
+			metadataProvider.EXPECT().IncrementDownloads(resolved).Return(nil)
+
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
+			files, err := manager.Download(fmt.Sprintf("%s/%s:^1.2", namespace, appName), entities.DownloadFormatNone, true, true)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(files).Should(gomega.HaveLen(1))
+		})
 		ginkgo.It("should not be able to download an application with a wrong name", func() {
 			appName := "appName"
 
-			manager := NewManager(storageProvider, metadataProvider, "")
-			_, err := manager.Download(appName, false, true)
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
+			_, err := manager.Download(appName, entities.DownloadFormatNone, true, true)
 			gomega.Expect(err).ShouldNot(gomega.Succeed())
 		})
 		ginkgo.It("should not be able to download an application if there is an error in the storage", func() {
@@ -192,10 +235,10 @@ var _ = ginkgo.Describe("Catalog handler test", func() {
 				ApplicationName: appName,
 				Private:         false,
 			}, nil)
-			storageProvider.EXPECT().GetApplication(namespace, appName, "latest", false).Return(nil, nerrors.NewInternalError("error reading repository"))
+			storageProvider.EXPECT().GetApplication(namespace, appName, "latest", entities.DownloadFormatNone).Return(nil, nerrors.NewInternalError("error reading repository"))
 
-			manager := NewManager(storageProvider, metadataProvider, "")
-			_, err := manager.Download(fmt.Sprintf("%s/%s", namespace, appName), false, true)
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
+			_, err := manager.Download(fmt.Sprintf("%s/%s", namespace, appName), entities.DownloadFormatNone, true, true)
 			gomega.Expect(err).ShouldNot(gomega.Succeed())
 		})
 	})
@@ -216,7 +259,7 @@ var _ = ginkgo.Describe("Catalog handler test", func() {
 				Private:         false,
 			}, nil)
 
-			manager := NewManager(storageProvider, metadataProvider, "")
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
 			metadata, err := manager.Get(fmt.Sprintf("%s/%s", namespace, appName), true)
 			gomega.Expect(err).Should(gomega.Succeed())
 			gomega.Expect(metadata).ShouldNot(gomega.BeNil())
@@ -238,7 +281,7 @@ var _ = ginkgo.Describe("Catalog handler test", func() {
 				Private:         true,
 			}, nil)
 
-			manager := NewManager(storageProvider, metadataProvider, "")
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
 			metadata, err := manager.Get(fmt.Sprintf("%s/%s", namespace, appName), true)
 			gomega.Expect(err).Should(gomega.Succeed())
 			gomega.Expect(metadata).ShouldNot(gomega.BeNil())
@@ -260,7 +303,7 @@ var _ = ginkgo.Describe("Catalog handler test", func() {
 				Private:         true,
 			}, nil)
 
-			manager := NewManager(storageProvider, metadataProvider, "")
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
 			_, err := manager.Get(fmt.Sprintf("%s/%s", namespace, appName), false)
 			gomega.Expect(err).ShouldNot(gomega.Succeed())
 
@@ -271,14 +314,36 @@ var _ = ginkgo.Describe("Catalog handler test", func() {
 
 			matcher := matcher.NewStructMatcher(map[string]interface{}{"Namespace": namespace, "ApplicationName": appName})
 			metadataProvider.EXPECT().Get(matcher).Return(nil, nerrors.NewNotFoundError("not found"))
+			metadataProvider.EXPECT().ListTags(namespace, appName).Return([]string{}, nil)
 
-			manager := NewManager(storageProvider, metadataProvider, "")
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
 			_, err := manager.Get(fmt.Sprintf("%s/%s", namespace, appName), true)
-			gomega.Expect(err).ShouldNot(gomega.Succeed())
+			gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.NotFound))
+
+		})
+		ginkgo.It("should resolve latest to the highest released version if there is no latest tag", func() {
+			namespace := "namespace"
+			appName := "appName"
 
+			metadataProvider.EXPECT().Get(&entities.ApplicationID{Namespace: namespace, ApplicationName: appName, Tag: "latest"}).
+				Return(nil, nerrors.NewNotFoundError("not found"))
+			metadataProvider.EXPECT().ListTags(namespace, appName).Return([]string{"1.10.0", "1.2.0", "2.0.0-rc.1"}, nil)
+			metadataProvider.EXPECT().Get(&entities.ApplicationID{Namespace: namespace, ApplicationName: appName, Tag: "1.10.0"}).
+				Return(&entities.ApplicationInfo{
+					Namespace:       namespace,
+					ApplicationName: appName,
+					Tag:             "1.10.0",
+					MetadataName:    "My App",
+					Metadata:        metadataFile,
+				}, nil)
+
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
+			metadata, err := manager.Get(fmt.Sprintf("%s/%s", namespace, appName), true)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(metadata.Tag).Should(gomega.Equal("1.10.0"))
 		})
 		ginkgo.It("should not be able to return a invalid application", func() {
-			manager := NewManager(storageProvider, metadataProvider, "")
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
 			_, err := manager.Get("invalidApp", true)
 			gomega.Expect(err).ShouldNot(gomega.Succeed())
 		})
@@ -299,19 +364,13 @@ var _ = ginkgo.Describe("Catalog handler test", func() {
 					TagMetadataName: map[string]string{"tag2": "my app v2"},
 				},
 			}
-			summary := entities.Summary{
-				NumNamespaces:   1,
-				NumApplications: 1,
-				NumTags:         2,
-			}
+			metadataProvider.EXPECT().ListSummaryWithFilter(gomock.Any(), nil).Return(&entities.ApplicationPage{Applications: returned}, nil)
 
-			metadataProvider.EXPECT().ListSummaryWithFilter(gomock.Any()).Return(returned, &summary, nil)
-
-			manager := NewManager(storageProvider, metadataProvider, "")
-			received, err := manager.List(map[string]*bool{}, true)
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
+			received, err := manager.List(map[string]*bool{}, true, nil)
 			gomega.Expect(err).Should(gomega.Succeed())
-			gomega.Expect(received).ShouldNot(gomega.BeEmpty())
-			gomega.Expect(len(received)).ShouldNot(gomega.BeZero())
+			gomega.Expect(received.Applications).ShouldNot(gomega.BeEmpty())
+			gomega.Expect(received.NextPageToken).Should(gomega.BeEmpty())
 		})
 		ginkgo.It("should be able to list applications from a selected namespace", func() {
 			returned := []*entities.AppSummary{
@@ -328,32 +387,74 @@ var _ = ginkgo.Describe("Catalog handler test", func() {
 					Private:         false,
 				},
 			}
-			summary := entities.Summary{
-				NumNamespaces:   1,
-				NumApplications: 1,
-				NumTags:         2,
-			}
-			metadataProvider.EXPECT().ListSummaryWithFilter(gomock.Any()).Return(returned, &summary, nil)
-			manager := NewManager(storageProvider, metadataProvider, "")
-			received, err := manager.List(map[string]*bool{"ns1": nil}, false)
+			metadataProvider.EXPECT().ListSummaryWithFilter(gomock.Any(), nil).Return(&entities.ApplicationPage{Applications: returned}, nil)
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
+			received, err := manager.List(map[string]*bool{"ns1": nil}, false, nil)
 			gomega.Expect(err).Should(gomega.Succeed())
-			gomega.Expect(received).ShouldNot(gomega.BeEmpty())
-			gomega.Expect(len(received)).Should(gomega.Equal(len(returned)))
+			gomega.Expect(received.Applications).Should(gomega.HaveLen(len(returned)))
 
 		})
 		ginkgo.It("should be able to return an empty list of applications", func() {
 			var returned []*entities.AppSummary
-			summary := entities.Summary{
-				NumNamespaces:   0,
-				NumApplications: 0,
-				NumTags:         0,
+			metadataProvider.EXPECT().ListSummaryWithFilter(gomock.Any(), nil).Return(&entities.ApplicationPage{Applications: returned}, nil)
+
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
+			received, err := manager.List(map[string]*bool{"ns1": nil}, false, nil)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(received.Applications).Should(gomega.BeEmpty())
+		})
+		ginkgo.It("should merge the pages of the public applications and the ones of the accounts", func() {
+			page := &entities.PageRequest{Sort: entities.ListSortName, PageSize: 2}
+			public := &entities.ApplicationPage{
+				Applications:  []*entities.AppSummary{{Namespace: "ns2", ApplicationName: "app1"}, {Namespace: "ns2", ApplicationName: "app3"}},
+				NextPageToken: "more public applications",
+			}
+			own := &entities.ApplicationPage{
+				Applications: []*entities.AppSummary{{Namespace: "ns1", ApplicationName: "app2"}},
 			}
-			metadataProvider.EXPECT().ListSummaryWithFilter(gomock.Any()).Return(returned, &summary, nil)
+			metadataProvider.EXPECT().ListSummaryWithFilter(gomock.Any(), page).DoAndReturn(func(filter *metadata.ListFilter, _ *entities.PageRequest) (*entities.ApplicationPage, error) {
+				if filter.Namespace == nil {
+					return public, nil
+				}
+				gomega.Expect(*filter.Namespace).Should(gomega.Equal("ns1"))
+				return own, nil
+			}).Times(2)
+
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
+			received, err := manager.List(map[string]*bool{"ns1": nil}, true, page)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(received.Applications).Should(gomega.Equal([]*entities.AppSummary{public.Applications[0], own.Applications[0]}))
+			gomega.Expect(received.NextPageToken).ShouldNot(gomega.BeEmpty())
+		})
+	})
 
-			manager := NewManager(storageProvider, metadataProvider, "")
-			received, err := manager.List(map[string]*bool{"ns1": nil}, false)
+	ginkgo.Context("Searching applications", func() {
+		ginkgo.It("should search the public applications and the ones of the accounts", func() {
+			ownApps := true
+			result := &entities.SearchResult{Total: 1, Hits: []*entities.SearchHit{{Application: &entities.AppSummary{Namespace: "ns1"}}}}
+			metadataProvider.EXPECT().Search(gomock.Any()).DoAndReturn(func(request *metadata.SearchRequest) (*entities.SearchResult, error) {
+				gomega.Expect(request.Text).Should(gomega.Equal("wordpress"))
+				gomega.Expect(request.From).Should(gomega.Equal(20))
+				gomega.Expect(request.Size).Should(gomega.Equal(10))
+				gomega.Expect(request.Facets.Keywords).Should(gomega.Equal([]string{"storage"}))
+				gomega.Expect(len(request.Filters)).Should(gomega.Equal(2))
+				gomega.Expect(request.Filters[0].Namespace).Should(gomega.BeNil())
+				gomega.Expect(*request.Filters[0].Private).Should(gomega.BeFalse())
+				gomega.Expect(*request.Filters[1].Namespace).Should(gomega.Equal("ns1"))
+				gomega.Expect(*request.Filters[1].Private).Should(gomega.BeTrue())
+				return result, nil
+			})
+
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
+			received, err := manager.Search("wordpress", &entities.FacetFilter{Keywords: []string{"storage"}}, map[string]*bool{"ns1": &ownApps}, true, 20, 10)
 			gomega.Expect(err).Should(gomega.Succeed())
-			gomega.Expect(received).Should(gomega.BeEmpty())
+			gomega.Expect(received).Should(gomega.Equal(result))
+		})
+		ginkgo.It("should not search if no applications can be returned", func() {
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
+			received, err := manager.Search("wordpress", nil, map[string]*bool{}, false, 0, 0)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(received.Total).Should(gomega.BeZero())
 		})
 	})
 
@@ -372,7 +473,7 @@ var _ = ginkgo.Describe("Catalog handler test", func() {
 					Data: []byte(metadataFile),
 				}}
 
-			manager := NewManager(storageProvider, metadataProvider, "")
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
 			_, err := manager.Add(fmt.Sprintf("%s/%s:%s", namespace, appName, tag), filesReturned, false, "")
 			gomega.Expect(err).ShouldNot(gomega.Succeed())
 		})
@@ -389,13 +490,58 @@ var _ = ginkgo.Describe("Catalog handler test", func() {
 					Path: "./metadata.yaml",
 					Data: []byte(metadataFile),
 				}}
+			metadataProvider.EXPECT().GetApplicationVisibility(namespace, appName).Return(nil, nerrors.NewNotFoundError("application not found"))
+			quotaProvider.EXPECT().GetQuota(namespace).Return(&entities.Quota{}, nil)
+			metadataProvider.EXPECT().Get(gomock.Any()).Return(nil, nerrors.NewNotFoundError("application not found"))
+			storageProvider.EXPECT().GetApplicationVisibility(namespace, appName).Return(nil, nil)
 			metadataProvider.EXPECT().Add(gomock.Any()).Return(nil, nil)
 			storageProvider.EXPECT().StoreApplication(namespace, appName, tag, gomock.Any()).Return(nil)
+			storageProvider.EXPECT().StoreApplicationVisibility(namespace, appName, false).Return(nil)
 
-			manager := NewManager(storageProvider, metadataProvider, "")
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
 			_, err := manager.Add(fmt.Sprintf("%s/%s:%s", namespace, appName, tag), filesReturned, false, "")
 			gomega.Expect(err).Should(gomega.Succeed())
 		})
+		ginkgo.It("Should not store the files if the visibility cannot be stored", func() {
+
+			namespace := "namespace"
+			appName := "app"
+			tag := "v1.0"
+			filesReturned := []*entities.FileInfo{
+				{
+					Path: "./app.yaml",
+					Data: []byte(appFile),
+				}, {
+					Path: "./metadata.yaml",
+					Data: []byte(metadataFile),
+				}}
+			metadataProvider.EXPECT().GetApplicationVisibility(namespace, appName).Return(nil, nerrors.NewNotFoundError("application not found"))
+			quotaProvider.EXPECT().GetQuota(namespace).Return(&entities.Quota{}, nil)
+			metadataProvider.EXPECT().Get(gomock.Any()).Return(nil, nerrors.NewNotFoundError("application not found"))
+			storageProvider.EXPECT().GetApplicationVisibility(namespace, appName).Return(nil, nil)
+			metadataProvider.EXPECT().Add(gomock.Any()).Return(nil, nil)
+			storageProvider.EXPECT().StoreApplicationVisibility(namespace, appName, true).Return(nerrors.NewInternalError("error"))
+			metadataProvider.EXPECT().Remove(&entities.ApplicationID{Namespace: namespace, ApplicationName: appName, Tag: tag}).Return(nil)
+
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
+			_, err := manager.Add(fmt.Sprintf("%s/%s:%s", namespace, appName, tag), filesReturned, true, "")
+			gomega.Expect(err).ShouldNot(gomega.Succeed())
+		})
+		ginkgo.It("should not add the tags that would shadow the resolution of other tags", func() {
+			filesReturned := []*entities.FileInfo{
+				{
+					Path: "./app.yaml",
+					Data: []byte(appFile),
+				}, {
+					Path: "./metadata.yaml",
+					Data: []byte(metadataFile),
+				}}
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
+			for _, tag := range []string{"stable", "^1.2", ">=1.0", "1.x"} {
+				_, err := manager.Add(fmt.Sprintf("namespace/app:%s", tag), filesReturned, false, "")
+				gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.InvalidArgument), tag)
+			}
+		})
 		ginkgo.It("Should not be able to add an application if the namespace is wrong", func() {
 
 			namespace := "Namespace"
@@ -409,19 +555,74 @@ var _ = ginkgo.Describe("Catalog handler test", func() {
 					Path: "./metadata.yaml",
 					Data: []byte(metadataFile),
 				}}
-			manager := NewManager(storageProvider, metadataProvider, "")
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
 			_, err := manager.Add(fmt.Sprintf("%s/%s:%s", namespace, appName, tag), filesReturned, false, "")
 			gomega.Expect(err).ShouldNot(gomega.Succeed())
 		})
 	})
 
+	ginkgo.Context("Adding tags to an existing application", func() {
+		namespace := "namespace"
+		appName := "app"
+		files := []*entities.FileInfo{
+			{
+				Path: "./app.yaml",
+				Data: []byte(appFile),
+			}, {
+				Path: "./metadata.yaml",
+				Data: []byte(metadataFile),
+			}}
+
+		ginkgo.It("should keep the visibility of the application when the authentication is disabled", func() {
+			private := true
+			metadataProvider.EXPECT().GetApplicationVisibility(namespace, appName).Return(&private, nil)
+			quotaProvider.EXPECT().GetQuota(namespace).Return(&entities.Quota{}, nil)
+			metadataProvider.EXPECT().Get(gomock.Any()).Return(nil, nerrors.NewNotFoundError("application not found"))
+			storageProvider.EXPECT().GetApplicationVisibility(namespace, appName).Return(&private, nil)
+			metadataProvider.EXPECT().Add(matcher.NewStructMatcher(map[string]interface{}{"Tag": "v2.0", "Private": true})).Return(nil, nil)
+			storageProvider.EXPECT().StoreApplication(namespace, appName, "v2.0", gomock.Any()).Return(nil)
+
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
+			stored, err := manager.Add(fmt.Sprintf("%s/%s:v2.0", namespace, appName), files, false, "")
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(stored).Should(gomega.BeTrue())
+		})
+		ginkgo.It("should not replace a tag if its previous metadata cannot be read", func() {
+			metadataProvider.EXPECT().GetApplicationVisibility(namespace, appName).Return(nil, nerrors.NewNotFoundError("application not found"))
+			quotaProvider.EXPECT().GetQuota(namespace).Return(&entities.Quota{}, nil)
+			metadataProvider.EXPECT().Get(gomock.Any()).Return(nil, nerrors.NewUnavailableError("metadata provider unavailable"))
+
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
+			_, err := manager.Add(fmt.Sprintf("%s/%s:v1.0", namespace, appName), files, false, "")
+			gomega.Expect(err).ShouldNot(gomega.Succeed())
+		})
+
+		ginkgo.It("should restore the previous tag and visibility if the files cannot be stored", func() {
+			private := true
+			previous := &entities.ApplicationInfo{Namespace: namespace, ApplicationName: appName, Tag: "v1.0", Downloads: 3}
+			metadataProvider.EXPECT().GetApplicationVisibility(namespace, appName).Return(nil, nerrors.NewNotFoundError("application not found"))
+			quotaProvider.EXPECT().GetQuota(namespace).Return(&entities.Quota{}, nil)
+			metadataProvider.EXPECT().Get(gomock.Any()).Return(previous, nil)
+			storageProvider.EXPECT().GetApplicationVisibility(namespace, appName).Return(&private, nil)
+			metadataProvider.EXPECT().Add(matcher.NewStructMatcher(map[string]interface{}{"Tag": "v1.0", "Downloads": int64(3), "Private": false})).Return(nil, nil)
+			storageProvider.EXPECT().StoreApplicationVisibility(namespace, appName, false).Return(nil)
+			storageProvider.EXPECT().StoreApplication(namespace, appName, "v1.0", gomock.Any()).Return(nerrors.NewInternalError("error"))
+			metadataProvider.EXPECT().Add(previous).Return(nil, nil)
+			storageProvider.EXPECT().StoreApplicationVisibility(namespace, appName, true).Return(nil)
+
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
+			_, err := manager.Add(fmt.Sprintf("%s/%s:v1.0", namespace, appName), files, false, "")
+			gomega.Expect(err).ShouldNot(gomega.Succeed())
+		})
+	})
+
 	ginkgo.Context("Changing visibility", func() {
 		ginkgo.It("Should not be able to change visibility if the application does not exist", func() {
 
 			metadataProvider.EXPECT().GetApplicationVisibility("namespace", "appName").Return(nil, nerrors.NewNotFoundError("application not found"))
 
-			manager := NewManager(storageProvider, metadataProvider, "")
-			err := manager.UpdateApplicationVisibility("namespace", "appName", true)
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
+			_, err := manager.UpdateApplicationVisibility("namespace", "appName", true)
 			gomega.Expect(err).NotTo(gomega.Succeed())
 
 		})
@@ -429,19 +630,122 @@ var _ = ginkgo.Describe("Catalog handler test", func() {
 			private := true
 			metadataProvider.EXPECT().GetApplicationVisibility("namespace", "appName").Return(&private, nil)
 
-			manager := NewManager(storageProvider, metadataProvider, "")
-			err := manager.UpdateApplicationVisibility("namespace", "appName", true)
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
+			_, err := manager.UpdateApplicationVisibility("namespace", "appName", true)
 			gomega.Expect(err).NotTo(gomega.Succeed())
 
 		})
 		ginkgo.It("Should be able to change application visibility", func() {
 			private := false
 			metadataProvider.EXPECT().GetApplicationVisibility("namespace", "appName").Return(&private, nil)
-			metadataProvider.EXPECT().UpdateApplicationVisibility("namespace", "appName", true).Return(nil)
+			metadataProvider.EXPECT().UpdateApplicationVisibility("namespace", "appName", true).Return(3, nil)
+			storageProvider.EXPECT().StoreApplicationVisibility("namespace", "appName", true).Return(nil)
 
-			manager := NewManager(storageProvider, metadataProvider, "")
-			err := manager.UpdateApplicationVisibility("namespace", "appName", true)
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
+			updated, err := manager.UpdateApplicationVisibility("namespace", "appName", true)
 			gomega.Expect(err).To(gomega.Succeed())
+			gomega.Expect(updated).Should(gomega.Equal(3))
+		})
+		ginkgo.It("Should restore the visibility if the files cannot be converted", func() {
+			private := false
+			metadataProvider.EXPECT().GetApplicationVisibility("namespace", "appName").Return(&private, nil)
+			metadataProvider.EXPECT().UpdateApplicationVisibility("namespace", "appName", true).Return(3, nil)
+			storageProvider.EXPECT().StoreApplicationVisibility("namespace", "appName", true).Return(nerrors.NewInternalError("error"))
+			metadataProvider.EXPECT().UpdateApplicationVisibility("namespace", "appName", false).Return(3, nil)
+
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
+			_, err := manager.UpdateApplicationVisibility("namespace", "appName", true)
+			gomega.Expect(err).NotTo(gomega.Succeed())
+		})
+	})
+
+	ginkgo.Context("Checking quotas", func() {
+		namespace := "namespace"
+		appName := "app"
+		files := []*entities.FileInfo{
+			{
+				Path: "./app.yaml",
+				Data: []byte(appFile),
+			}, {
+				Path: "./metadata.yaml",
+				Data: []byte(metadataFile),
+			}}
+		size := int64(len(appFile) + len(metadataFile))
+
+		ginkgo.It("should not add an application with a file bigger than the quota", func() {
+			metadataProvider.EXPECT().GetApplicationVisibility(namespace, appName).Return(nil, nerrors.NewNotFoundError("application not found"))
+			quotaProvider.EXPECT().GetQuota(namespace).Return(&entities.Quota{MaxFileSize: int64(len(appFile))}, nil)
+
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
+			_, err := manager.Add(fmt.Sprintf("%s/%s:v1.0", namespace, appName), files, false, "")
+			gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.ResourceExhausted))
+		})
+		ginkgo.It("should not add a new application if the namespace has reached the maximum number of applications", func() {
+			metadataProvider.EXPECT().GetApplicationVisibility(namespace, appName).Return(nil, nerrors.NewNotFoundError("application not found"))
+			quotaProvider.EXPECT().GetQuota(namespace).Return(&entities.Quota{MaxApplications: 1}, nil)
+			storageProvider.EXPECT().GetRepositoryUsage(namespace).Return([]*entities.TagUsage{
+				{ApplicationName: "other", Tag: "latest", Bytes: 10}}, nil)
+
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
+			_, err := manager.Add(fmt.Sprintf("%s/%s:v1.0", namespace, appName), files, false, "")
+			gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.ResourceExhausted))
+		})
+		ginkgo.It("should not add a new tag if the application has reached the maximum number of tags", func() {
+			metadataProvider.EXPECT().GetApplicationVisibility(namespace, appName).Return(nil, nerrors.NewNotFoundError("application not found"))
+			quotaProvider.EXPECT().GetQuota(namespace).Return(&entities.Quota{MaxTagsPerApplication: 1}, nil)
+			storageProvider.EXPECT().GetRepositoryUsage(namespace).Return([]*entities.TagUsage{
+				{ApplicationName: appName, Tag: "v0.1", Bytes: 10}}, nil)
+
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
+			_, err := manager.Add(fmt.Sprintf("%s/%s:v1.0", namespace, appName), files, false, "")
+			gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.ResourceExhausted))
+		})
+		ginkgo.It("should not add an application that exceeds the storage quota", func() {
+			metadataProvider.EXPECT().GetApplicationVisibility(namespace, appName).Return(nil, nerrors.NewNotFoundError("application not found"))
+			quotaProvider.EXPECT().GetQuota(namespace).Return(&entities.Quota{MaxBytes: size + 9}, nil)
+			storageProvider.EXPECT().GetRepositoryUsage(namespace).Return([]*entities.TagUsage{
+				{ApplicationName: "other", Tag: "latest", Bytes: 10}}, nil)
+
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
+			_, err := manager.Add(fmt.Sprintf("%s/%s:v1.0", namespace, appName), files, false, "")
+			gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.ResourceExhausted))
+		})
+		ginkgo.It("should replace a tag without counting its previous size", func() {
+			metadataProvider.EXPECT().GetApplicationVisibility(namespace, appName).Return(nil, nerrors.NewNotFoundError("application not found"))
+			quotaProvider.EXPECT().GetQuota(namespace).Return(&entities.Quota{MaxBytes: size, MaxTagsPerApplication: 1, MaxApplications: 1}, nil)
+			storageProvider.EXPECT().GetRepositoryUsage(namespace).Return([]*entities.TagUsage{
+				{ApplicationName: appName, Tag: "v1.0", Bytes: size}}, nil)
+			metadataProvider.EXPECT().Get(gomock.Any()).Return(nil, nerrors.NewNotFoundError("application not found"))
+			storageProvider.EXPECT().GetApplicationVisibility(namespace, appName).Return(nil, nil)
+			metadataProvider.EXPECT().Add(gomock.Any()).Return(nil, nil)
+			storageProvider.EXPECT().StoreApplication(namespace, appName, "v1.0", gomock.Any()).Return(nil)
+			storageProvider.EXPECT().StoreApplicationVisibility(namespace, appName, false).Return(nil)
+
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
+			_, err := manager.Add(fmt.Sprintf("%s/%s:v1.0", namespace, appName), files, false, "")
+			gomega.Expect(err).Should(gomega.Succeed())
+		})
+		ginkgo.It("should update the usage with the pushes instead of reading the namespace again", func() {
+			metadataProvider.EXPECT().GetApplicationVisibility(namespace, appName).Return(nil, nerrors.NewNotFoundError("application not found")).Times(3)
+			quotaProvider.EXPECT().GetQuota(namespace).Return(&entities.Quota{MaxTagsPerApplication: 1}, nil).Times(3)
+			storageProvider.EXPECT().GetRepositoryUsage(namespace).Return([]*entities.TagUsage{}, nil).Times(1)
+			metadataProvider.EXPECT().Get(gomock.Any()).Return(nil, nerrors.NewNotFoundError("application not found")).Times(2)
+			storageProvider.EXPECT().GetApplicationVisibility(namespace, appName).Return(nil, nil).Times(2)
+			metadataProvider.EXPECT().Add(gomock.Any()).Return(nil, nil).Times(2)
+			metadataProvider.EXPECT().Remove(gomock.Any()).Return(nil)
+			storageProvider.EXPECT().StoreApplication(namespace, appName, gomock.Any(), gomock.Any()).Return(nil).Times(2)
+			storageProvider.EXPECT().StoreApplicationVisibility(namespace, appName, false).Return(nil).Times(2)
+			storageProvider.EXPECT().RemoveApplication(namespace, appName, "v1.0").Return(nil)
+
+			manager := NewManager(storageProvider, metadataProvider, quotaProvider, "")
+			_, err := manager.Add(fmt.Sprintf("%s/%s:v1.0", namespace, appName), files, false, "")
+			gomega.Expect(err).Should(gomega.Succeed())
+			_, err = manager.Add(fmt.Sprintf("%s/%s:v2.0", namespace, appName), files, false, "")
+			gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.ResourceExhausted))
+			err = manager.Remove(fmt.Sprintf("%s/%s:v1.0", namespace, appName))
+			gomega.Expect(err).Should(gomega.Succeed())
+			_, err = manager.Add(fmt.Sprintf("%s/%s:v2.0", namespace, appName), files, false, "")
+			gomega.Expect(err).Should(gomega.Succeed())
 		})
 	})
 })
@@ -0,0 +1,93 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/napptive/catalog-manager/internal/pkg/provider/quota (interfaces: QuotaProvider)
+
+// Package catalog_manager is a generated GoMock package.
+package catalog_manager
+
+import (
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	entities "github.com/napptive/catalog-manager/internal/pkg/entities"
+)
+
+// MockQuotaProvider is a mock of QuotaProvider interface.
+type MockQuotaProvider struct {
+	ctrl     *gomock.Controller
+	recorder *MockQuotaProviderMockRecorder
+}
+
+// MockQuotaProviderMockRecorder is the mock recorder for MockQuotaProvider.
+type MockQuotaProviderMockRecorder struct {
+	mock *MockQuotaProvider
+}
+
+// NewMockQuotaProvider creates a new mock instance.
+func NewMockQuotaProvider(ctrl *gomock.Controller) *MockQuotaProvider {
+	mock := &MockQuotaProvider{ctrl: ctrl}
+	mock.recorder = &MockQuotaProviderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockQuotaProvider) EXPECT() *MockQuotaProviderMockRecorder {
+	return m.recorder
+}
+
+// GetQuota mocks base method.
+func (m *MockQuotaProvider) GetQuota(arg0 string) (*entities.Quota, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetQuota", arg0)
+	ret0, _ := ret[0].(*entities.Quota)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetQuota indicates an expected call of GetQuota.
+func (mr *MockQuotaProviderMockRecorder) GetQuota(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetQuota", reflect.TypeOf((*MockQuotaProvider)(nil).GetQuota), arg0)
+}
+
+// ListOverrides mocks base method.
+func (m *MockQuotaProvider) ListOverrides() (map[string]entities.Quota, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListOverrides")
+	ret0, _ := ret[0].(map[string]entities.Quota)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListOverrides indicates an expected call of ListOverrides.
+func (mr *MockQuotaProviderMockRecorder) ListOverrides() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListOverrides", reflect.TypeOf((*MockQuotaProvider)(nil).ListOverrides))
+}
+
+// RemoveQuota mocks base method.
+func (m *MockQuotaProvider) RemoveQuota(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveQuota", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveQuota indicates an expected call of RemoveQuota.
+func (mr *MockQuotaProviderMockRecorder) RemoveQuota(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveQuota", reflect.TypeOf((*MockQuotaProvider)(nil).RemoveQuota), arg0)
+}
+
+// SetQuota mocks base method.
+func (m *MockQuotaProvider) SetQuota(arg0 string, arg1 entities.Quota) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetQuota", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetQuota indicates an expected call of SetQuota.
+func (mr *MockQuotaProviderMockRecorder) SetQuota(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetQuota", reflect.TypeOf((*MockQuotaProvider)(nil).SetQuota), arg0, arg1)
+}
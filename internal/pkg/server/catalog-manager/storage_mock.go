@@ -5,7 +5,9 @@
 package catalog_manager
 
 import (
+	io "io"
 	reflect "reflect"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 	entities "github.com/napptive/catalog-manager/internal/pkg/entities"
@@ -64,7 +66,7 @@ func (mr *MockStorageManagerMockRecorder) CreateRepository(arg0 interface{}) *go
 }
 
 // GetApplication mocks base method.
-func (m *MockStorageManager) GetApplication(arg0, arg1, arg2 string, arg3 bool) ([]*entities.FileInfo, error) {
+func (m *MockStorageManager) GetApplication(arg0, arg1, arg2 string, arg3 entities.DownloadFormat) ([]*entities.FileInfo, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "GetApplication", arg0, arg1, arg2, arg3)
 	ret0, _ := ret[0].([]*entities.FileInfo)
@@ -78,6 +80,141 @@ func (mr *MockStorageManagerMockRecorder) GetApplication(arg0, arg1, arg2, arg3
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetApplication", reflect.TypeOf((*MockStorageManager)(nil).GetApplication), arg0, arg1, arg2, arg3)
 }
 
+// GetApplicationStream mocks base method.
+func (m *MockStorageManager) GetApplicationStream(arg0, arg1, arg2 string, arg3 entities.DownloadFormat) (io.ReadCloser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetApplicationStream", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(io.ReadCloser)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetApplicationStream indicates an expected call of GetApplicationStream.
+func (mr *MockStorageManagerMockRecorder) GetApplicationStream(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetApplicationStream", reflect.TypeOf((*MockStorageManager)(nil).GetApplicationStream), arg0, arg1, arg2, arg3)
+}
+
+// GetApplicationUpdateTime mocks base method.
+func (m *MockStorageManager) GetApplicationUpdateTime(arg0, arg1, arg2 string) (time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetApplicationUpdateTime", arg0, arg1, arg2)
+	ret0, _ := ret[0].(time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetApplicationUpdateTime indicates an expected call of GetApplicationUpdateTime.
+func (mr *MockStorageManagerMockRecorder) GetApplicationUpdateTime(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetApplicationUpdateTime", reflect.TypeOf((*MockStorageManager)(nil).GetApplicationUpdateTime), arg0, arg1, arg2)
+}
+
+// GetApplicationVisibility mocks base method.
+func (m *MockStorageManager) GetApplicationVisibility(arg0, arg1 string) (*bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetApplicationVisibility", arg0, arg1)
+	ret0, _ := ret[0].(*bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetApplicationVisibility indicates an expected call of GetApplicationVisibility.
+func (mr *MockStorageManagerMockRecorder) GetApplicationVisibility(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetApplicationVisibility", reflect.TypeOf((*MockStorageManager)(nil).GetApplicationVisibility), arg0, arg1)
+}
+
+// GetEncryptionKeys mocks base method.
+func (m *MockStorageManager) GetEncryptionKeys() ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetEncryptionKeys")
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetEncryptionKeys indicates an expected call of GetEncryptionKeys.
+func (mr *MockStorageManagerMockRecorder) GetEncryptionKeys() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEncryptionKeys", reflect.TypeOf((*MockStorageManager)(nil).GetEncryptionKeys))
+}
+
+// GetQuotaOverride mocks base method.
+func (m *MockStorageManager) GetQuotaOverride(arg0 string) (*entities.Quota, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetQuotaOverride", arg0)
+	ret0, _ := ret[0].(*entities.Quota)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetQuotaOverride indicates an expected call of GetQuotaOverride.
+func (mr *MockStorageManagerMockRecorder) GetQuotaOverride(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetQuotaOverride", reflect.TypeOf((*MockStorageManager)(nil).GetQuotaOverride), arg0)
+}
+
+// GetRepositoryUsage mocks base method.
+func (m *MockStorageManager) GetRepositoryUsage(arg0 string) ([]*entities.TagUsage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRepositoryUsage", arg0)
+	ret0, _ := ret[0].([]*entities.TagUsage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRepositoryUsage indicates an expected call of GetRepositoryUsage.
+func (mr *MockStorageManagerMockRecorder) GetRepositoryUsage(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRepositoryUsage", reflect.TypeOf((*MockStorageManager)(nil).GetRepositoryUsage), arg0)
+}
+
+// ListApplications mocks base method.
+func (m *MockStorageManager) ListApplications(arg0 string) ([]*entities.ApplicationID, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListApplications", arg0)
+	ret0, _ := ret[0].([]*entities.ApplicationID)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListApplications indicates an expected call of ListApplications.
+func (mr *MockStorageManagerMockRecorder) ListApplications(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListApplications", reflect.TypeOf((*MockStorageManager)(nil).ListApplications), arg0)
+}
+
+// ListQuotaOverrides mocks base method.
+func (m *MockStorageManager) ListQuotaOverrides() (map[string]entities.Quota, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListQuotaOverrides")
+	ret0, _ := ret[0].(map[string]entities.Quota)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListQuotaOverrides indicates an expected call of ListQuotaOverrides.
+func (mr *MockStorageManagerMockRecorder) ListQuotaOverrides() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListQuotaOverrides", reflect.TypeOf((*MockStorageManager)(nil).ListQuotaOverrides))
+}
+
+// ListRepositories mocks base method.
+func (m *MockStorageManager) ListRepositories() ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListRepositories")
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListRepositories indicates an expected call of ListRepositories.
+func (mr *MockStorageManagerMockRecorder) ListRepositories() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListRepositories", reflect.TypeOf((*MockStorageManager)(nil).ListRepositories))
+}
+
 // RemoveApplication mocks base method.
 func (m *MockStorageManager) RemoveApplication(arg0, arg1, arg2 string) error {
 	m.ctrl.T.Helper()
@@ -92,6 +229,20 @@ func (mr *MockStorageManagerMockRecorder) RemoveApplication(arg0, arg1, arg2 int
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveApplication", reflect.TypeOf((*MockStorageManager)(nil).RemoveApplication), arg0, arg1, arg2)
 }
 
+// RemoveQuotaOverride mocks base method.
+func (m *MockStorageManager) RemoveQuotaOverride(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveQuotaOverride", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveQuotaOverride indicates an expected call of RemoveQuotaOverride.
+func (mr *MockStorageManagerMockRecorder) RemoveQuotaOverride(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveQuotaOverride", reflect.TypeOf((*MockStorageManager)(nil).RemoveQuotaOverride), arg0)
+}
+
 // RemoveRepository mocks base method.
 func (m *MockStorageManager) RemoveRepository(arg0 string) error {
 	m.ctrl.T.Helper()
@@ -134,3 +285,45 @@ func (mr *MockStorageManagerMockRecorder) StoreApplication(arg0, arg1, arg2, arg
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StoreApplication", reflect.TypeOf((*MockStorageManager)(nil).StoreApplication), arg0, arg1, arg2, arg3)
 }
+
+// StoreApplicationVisibility mocks base method.
+func (m *MockStorageManager) StoreApplicationVisibility(arg0, arg1 string, arg2 bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StoreApplicationVisibility", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StoreApplicationVisibility indicates an expected call of StoreApplicationVisibility.
+func (mr *MockStorageManagerMockRecorder) StoreApplicationVisibility(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StoreApplicationVisibility", reflect.TypeOf((*MockStorageManager)(nil).StoreApplicationVisibility), arg0, arg1, arg2)
+}
+
+// StoreQuotaOverride mocks base method.
+func (m *MockStorageManager) StoreQuotaOverride(arg0 string, arg1 entities.Quota) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StoreQuotaOverride", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StoreQuotaOverride indicates an expected call of StoreQuotaOverride.
+func (mr *MockStorageManagerMockRecorder) StoreQuotaOverride(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StoreQuotaOverride", reflect.TypeOf((*MockStorageManager)(nil).StoreQuotaOverride), arg0, arg1)
+}
+
+// UpdateEncryptionKeys mocks base method.
+func (m *MockStorageManager) UpdateEncryptionKeys(arg0 func([]byte) ([]byte, error)) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateEncryptionKeys", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateEncryptionKeys indicates an expected call of UpdateEncryptionKeys.
+func (mr *MockStorageManagerMockRecorder) UpdateEncryptionKeys(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateEncryptionKeys", reflect.TypeOf((*MockStorageManager)(nil).UpdateEncryptionKeys), arg0)
+}
@@ -0,0 +1,106 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package catalog_manager
+
+import (
+	"sync"
+	"time"
+
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/catalog-manager/internal/pkg/storage"
+)
+
+// usageCacheTTL with the time the usage of a namespace is kept before reading it again from the storage. The usage
+// is updated with the pushes and removals of this replica, the ones of the other replicas are seen once it expires.
+const usageCacheTTL = time.Minute
+
+// cachedUsage with the size of the tags of a namespace
+type cachedUsage struct {
+	// tags with the size of each tag indexed by application name and tag
+	tags map[entities.ApplicationID]int64
+	// loaded with the time the usage was read from the storage
+	loaded time.Time
+}
+
+// usageCache keeps the usage of the namespaces so the quotas are checked without walking the namespace on each push
+type usageCache struct {
+	stManager storage.StorageManager
+	// ttl with the time the usage of a namespace is kept
+	ttl time.Duration
+	// namespaces with the usage indexed by namespace
+	namespaces map[string]*cachedUsage
+	// Mutex to protect the namespaces
+	sync.Mutex
+}
+
+// newUsageCache returns an empty cache of the usage of the namespaces
+func newUsageCache(stManager storage.StorageManager, ttl time.Duration) *usageCache {
+	return &usageCache{stManager: stManager, ttl: ttl, namespaces: make(map[string]*cachedUsage)}
+}
+
+// get returns the usage of the tags of a namespace, it is read from the storage if it is not cached or it has expired
+func (c *usageCache) get(namespace string) ([]*entities.TagUsage, error) {
+	c.Lock()
+	usage, exists := c.namespaces[namespace]
+	if exists && time.Since(usage.loaded) < c.ttl {
+		tags := usage.list()
+		c.Unlock()
+		return tags, nil
+	}
+	c.Unlock()
+
+	tags, err := c.stManager.GetRepositoryUsage(namespace)
+	if err != nil {
+		return nil, err
+	}
+	usage = &cachedUsage{tags: make(map[entities.ApplicationID]int64, len(tags)), loaded: time.Now()}
+	for _, tag := range tags {
+		usage.tags[entities.ApplicationID{ApplicationName: tag.ApplicationName, Tag: tag.Tag}] = tag.Bytes
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	c.namespaces[namespace] = usage
+	return usage.list(), nil
+}
+
+// setTag updates the size of a tag stored, the usage is only updated if the namespace is cached
+func (c *usageCache) setTag(appID *entities.ApplicationID, bytes int64) {
+	c.Lock()
+	defer c.Unlock()
+	if usage, exists := c.namespaces[appID.Namespace]; exists {
+		usage.tags[entities.ApplicationID{ApplicationName: appID.ApplicationName, Tag: appID.Tag}] = bytes
+	}
+}
+
+// removeTag removes a tag from the usage of its namespace
+func (c *usageCache) removeTag(appID *entities.ApplicationID) {
+	c.Lock()
+	defer c.Unlock()
+	if usage, exists := c.namespaces[appID.Namespace]; exists {
+		delete(usage.tags, entities.ApplicationID{ApplicationName: appID.ApplicationName, Tag: appID.Tag})
+	}
+}
+
+// list returns a copy of the usage of the tags, the caller must hold the lock
+func (u *cachedUsage) list() []*entities.TagUsage {
+	tags := make([]*entities.TagUsage, 0, len(u.tags))
+	for id, bytes := range u.tags {
+		tags = append(tags, &entities.TagUsage{ApplicationName: id.ApplicationName, Tag: id.Tag, Bytes: bytes})
+	}
+	return tags
+}
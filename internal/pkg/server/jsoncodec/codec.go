@@ -0,0 +1,51 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package jsoncodec
+
+import (
+	"encoding/json"
+
+	"google.golang.org/grpc/encoding"
+)
+
+// The services that are not included in grpc-catalog-go use Go structures as messages. They are encoded
+// as JSON with this codec, that is selected by the clients with the Name content subtype.
+
+// Name with the content subtype of the messages encoded as JSON
+const Name = "json"
+
+func init() {
+	encoding.RegisterCodec(Codec{})
+}
+
+// Codec encodes the messages as JSON
+type Codec struct{}
+
+// Marshal returns the JSON encoding of v
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal parses the JSON encoded data into v
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// Name returns the content subtype of the codec
+func (Codec) Name() string {
+	return Name
+}
@@ -0,0 +1,317 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package storage
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// artifactFile with the name of the precomputed tgz of an application, it is stored next to the application files
+	artifactFile = ".catalog-artifact.tgz"
+	// artifactDigestFile with the name of the file that stores the SHA-256 of the artifact
+	artifactDigestFile = artifactFile + ".sha256"
+	// manifestFile with the name of the file that describes the content of a tag stored with deduplication
+	manifestFile = ".catalog-manifest.json"
+)
+
+// archiveModTime with the modification time of all the entries, fixed so the archives are reproducible
+var archiveModTime = time.Unix(0, 0)
+
+// zipModTime with the modification time of the zip entries, the MS-DOS dates used by zip start in 1980
+var zipModTime = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// isReservedFile checks if a path relative to the application directory is reserved for the artifact or the manifest
+func isReservedFile(filePath string) bool {
+	filePath = path.Clean(filePath)
+	return filePath == artifactFile || filePath == artifactDigestFile || filePath == manifestFile
+}
+
+// checkReservedPaths returns an error if any of the application files uses a name reserved for the artifact or the
+// manifest
+func checkReservedPaths(files []*entities.FileInfo) error {
+	for _, file := range files {
+		if isReservedFile(file.Path) {
+			return nerrors.NewFailedPreconditionError("invalid application file path [%s], the name is reserved", file.Path)
+		}
+	}
+	return nil
+}
+
+// archiveEntry with a file to include in an archive
+type archiveEntry struct {
+	// Path with the path of the file relative to the application directory
+	Path string
+	// Size with the size of the file in bytes
+	Size int64
+	// Open returns the content of the file
+	Open func() (io.ReadCloser, error)
+}
+
+// newMemoryEntries creates the archive entries of files loaded in memory
+func newMemoryEntries(files []*entities.FileInfo) []archiveEntry {
+	entries := make([]archiveEntry, 0, len(files))
+	for _, file := range files {
+		data := file.Data
+		entries = append(entries, archiveEntry{
+			Path: file.Path,
+			Size: int64(len(data)),
+			Open: func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(data)), nil
+			},
+		})
+	}
+	return entries
+}
+
+// sortEntries returns a copy of the entries sorted by path
+func sortEntries(entries []archiveEntry) []archiveEntry {
+	sorted := make([]archiveEntry, len(entries))
+	copy(sorted, entries)
+	sort.Slice(sorted, func(i, j int) bool {
+		return path.Clean(sorted[i].Path) < path.Clean(sorted[j].Path)
+	})
+	return sorted
+}
+
+// copyEntry writes the content of an entry in w
+func copyEntry(w io.Writer, entry archiveEntry) error {
+	reader, err := entry.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	_, err = io.Copy(w, reader)
+	return err
+}
+
+// writeTar writes a tar file with the application entries. The entry paths must be relative
+// to the application directory, the entries in the tar are created under ./<name>/
+// The archive is deterministic: the entries are sorted by path and the headers do not include
+// modification times, owners or the original modes, so the same content always produces the same tar.
+func writeTar(w io.Writer, name string, entries []archiveEntry) error {
+	tw := tar.NewWriter(w)
+
+	// directories already included in the tar
+	dirs := map[string]bool{}
+	addDir := func(dir string) error {
+		if dirs[dir] {
+			return nil
+		}
+		dirs[dir] = true
+		return tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeDir,
+			Name:     fmt.Sprintf("./%s", dir),
+			Mode:     0755,
+			ModTime:  archiveModTime,
+		})
+	}
+
+	if err := addDir(name); err != nil {
+		return err
+	}
+	for _, entry := range sortEntries(entries) {
+		filePath := path.Join(name, path.Clean(entry.Path))
+		// include the parent directories
+		elements := strings.Split(filePath, "/")
+		for i := 2; i < len(elements); i++ {
+			if err := addDir(strings.Join(elements[:i], "/")); err != nil {
+				return err
+			}
+		}
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     fmt.Sprintf("./%s", filePath),
+			Mode:     0644,
+			Size:     entry.Size,
+			ModTime:  archiveModTime,
+		}); err != nil {
+			return err
+		}
+		if err := copyEntry(tw, entry); err != nil {
+			return err
+		}
+	}
+
+	// produce tar
+	return tw.Close()
+}
+
+// writeTgz writes a tgz file with the application entries, see writeTar.
+func writeTgz(w io.Writer, name string, entries []archiveEntry) error {
+	// the default gzip header has no name and no modification time
+	zr := gzip.NewWriter(w)
+	if err := writeTar(zr, name, entries); err != nil {
+		return err
+	}
+	// produce gzip
+	return zr.Close()
+}
+
+// writeTarZstd writes a tar file compressed with zstd with the application entries, see writeTar.
+func writeTarZstd(w io.Writer, name string, entries []archiveEntry) error {
+	zw, err := zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return err
+	}
+	if err = writeTar(zw, name, entries); err != nil {
+		zw.Close()
+		return err
+	}
+	return zw.Close()
+}
+
+// writeZip writes a zip file with the application entries. The entry paths must be relative
+// to the application directory, the entries in the zip are created under <name>/
+// As in the tar files, the entries are sorted and have the same modification time and mode.
+func writeZip(w io.Writer, name string, entries []archiveEntry) error {
+	zw := zip.NewWriter(w)
+	for _, entry := range sortEntries(entries) {
+		header := &zip.FileHeader{
+			Name:     path.Join(name, path.Clean(entry.Path)),
+			Method:   zip.Deflate,
+			Modified: zipModTime,
+		}
+		header.SetMode(0644)
+		fw, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if err = copyEntry(fw, entry); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// writeArchive writes the application entries in an archive with the given format
+func writeArchive(w io.Writer, format entities.DownloadFormat, name string, entries []archiveEntry) error {
+	switch format {
+	case entities.DownloadFormatTgz:
+		return writeTgz(w, name, entries)
+	case entities.DownloadFormatZip:
+		return writeZip(w, name, entries)
+	case entities.DownloadFormatTarZstd:
+		return writeTarZstd(w, name, entries)
+	}
+	return nerrors.NewInvalidArgumentError("the application cannot be archived in the %s format", format)
+}
+
+// checkArchiveFormat returns an error if the format does not produce a single file
+func checkArchiveFormat(format entities.DownloadFormat) error {
+	switch format {
+	case entities.DownloadFormatTgz, entities.DownloadFormatZip, entities.DownloadFormatTarZstd:
+		return nil
+	}
+	return nerrors.NewInvalidArgumentError("the application cannot be archived in the %s format", format)
+}
+
+// streamArchive returns a reader with the archive of the application entries, the archive is generated
+// while it is read. The reader must be closed, release is called once the archive is written or
+// the reader is closed.
+func streamArchive(format entities.DownloadFormat, name string, entries []archiveEntry, release func()) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		defer release()
+		err := writeArchive(pw, format, name, entries)
+		if err != nil && err != io.ErrClosedPipe {
+			log.Err(err).Str("name", name).Str("format", string(format)).Msg("error streaming application")
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// compressFiles creates an archive with the application files. The file paths must be relative
+// to the application directory, the entries in the archive are created under ./<name>/
+func compressFiles(name string, format entities.DownloadFormat, files []*entities.FileInfo) ([]*entities.FileInfo, error) {
+	var buf bytes.Buffer
+	if err := writeArchive(&buf, format, name, newMemoryEntries(files)); err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "Error creating %s", format)
+	}
+	return []*entities.FileInfo{{
+		Path: format.FileName(name),
+		Data: buf.Bytes(),
+	}}, nil
+}
+
+// buildArtifact creates the tgz of the application files returning its content and its SHA-256
+func buildArtifact(name string, files []*entities.FileInfo) ([]byte, string, error) {
+	var buf bytes.Buffer
+	if err := writeTgz(&buf, name, newMemoryEntries(files)); err != nil {
+		return nil, "", nerrors.NewInternalErrorFrom(err, "Error creating tgz")
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	return buf.Bytes(), hex.EncodeToString(sum[:]), nil
+}
+
+// digestReader verifies the digest of the content when the reader reaches the end
+type digestReader struct {
+	reader io.ReadCloser
+	hash   hash.Hash
+	digest string
+}
+
+// newDigestReader returns a reader that fails at the end of the content if its SHA-256 does not match digest
+func newDigestReader(reader io.ReadCloser, digest string) io.ReadCloser {
+	return &digestReader{reader: reader, hash: sha256.New(), digest: digest}
+}
+
+// Read reads from the underlying reader returning an error at the end if the digest does not match
+func (d *digestReader) Read(p []byte) (int, error) {
+	n, err := d.reader.Read(p)
+	d.hash.Write(p[:n])
+	if err == io.EOF && hex.EncodeToString(d.hash.Sum(nil)) != d.digest {
+		return n, nerrors.NewDataLossError("digest mismatch in %s", d.digest)
+	}
+	return n, err
+}
+
+// Close closes the underlying reader
+func (d *digestReader) Close() error {
+	return d.reader.Close()
+}
+
+// readStream loads in memory the archive returned by a stream
+func readStream(name string, format entities.DownloadFormat, stream io.ReadCloser) ([]*entities.FileInfo, error) {
+	defer stream.Close()
+	data, err := io.ReadAll(stream)
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "Error creating %s", format)
+	}
+	return []*entities.FileInfo{{
+		Path: format.FileName(name),
+		Data: data,
+	}}, nil
+}
@@ -0,0 +1,695 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// blobsDirectory with the name of the directory (under basePath) where the file contents are stored.
+	// It starts with a dot to avoid collisions with the namespaces.
+	blobsDirectory = ".blobs"
+	// refsSuffix with the suffix of the file that stores the number of references of a blob
+	refsSuffix = ".refs"
+	// refsLockFile with the name of the file (under the blobs directory) locked while the references change
+	refsLockFile = ".lock"
+)
+
+// ManifestEntry with the information of a file stored in a tag
+type ManifestEntry struct {
+	// Path with the relative path of the file in the application
+	Path string
+	// Digest with the SHA-256 of the file content
+	Digest string
+	// Size with the size of the file in bytes
+	Size int64
+}
+
+// Manifest with the list of files of an application tag
+type Manifest struct {
+	// Files with the files of the tag indexed by path
+	Files []ManifestEntry
+	// Artifact with the precomputed tgz of the tag, it is nil for the tags stored before generating it
+	Artifact *ManifestEntry `json:",omitempty"`
+}
+
+// BlobCollector is implemented by the storage managers that share the file contents between applications
+type BlobCollector interface {
+	// CollectBlobs recomputes the references of the blobs from the manifests of the applications, reporting the
+	// counters that do not match and the blobs referenced but not stored. If repair is set, the counters are fixed
+	// and the blobs without references are removed.
+	CollectBlobs(repair bool) ([]*entities.Inconsistency, error)
+}
+
+// casStorageManager is a content-addressable StorageManager. Each file content is stored once
+// under its SHA-256 digest, and each tag only keeps a manifest with the path -> digest relation.
+// Blobs are reference counted so they are only removed when no manifest points to them.
+//
+// basePath/.blobs/sha256/<2 first chars>/<digest>       -> file content
+// basePath/.blobs/sha256/<2 first chars>/<digest>.refs  -> number of references
+// basePath/<repo>/<app>/<tag>/.catalog-manifest.json   -> tag manifest
+//
+// The precomputed tgz of each tag is stored as one more blob referenced by the manifest. The reference counters
+// are protected with a lock file so several replicas can share the volume. The lock is only taken on Linux, other
+// platforms require a single replica.
+type casStorageManager struct {
+	// storageManager with the basic directory operations
+	storageManager
+	// RWMutex to protect the reference counters in this process, the readers hold it so the blobs they read are not removed
+	sync.RWMutex
+}
+
+// NewContentAddressableStorageManager returns a StorageManager that deduplicates the application files
+func NewContentAddressableStorageManager(basePath string) StorageManager {
+	return &casStorageManager{storageManager: newStorageManager(basePath)}
+}
+
+// getBlobPath returns the path of the blob with the given digest
+func (s *casStorageManager) getBlobPath(digest string) string {
+	return filepath.Join(s.basePath, blobsDirectory, "sha256", digest[:2], digest)
+}
+
+// getManifestPath returns the path of the manifest of an application
+func (s *casStorageManager) getManifestPath(repo string, name string, version string) string {
+	return filepath.Join(s.getAppDirectory(repo, name, version), manifestFile)
+}
+
+// lockRefs locks the reference counters for this process and for the other processes that share the volume,
+// returning the function that unlocks them
+func (s *casStorageManager) lockRefs() (func(), error) {
+	return s.lockRefsFile(s.Lock, s.Unlock, lockFile)
+}
+
+// rLockRefs locks the reference counters for reading, so no blob is removed until the returned function is called
+func (s *casStorageManager) rLockRefs() (func(), error) {
+	return s.lockRefsFile(s.RLock, s.RUnlock, lockFileShared)
+}
+
+// lockRefsFile takes the process lock and then the lock file of the blobs
+func (s *casStorageManager) lockRefsFile(lock func(), unlock func(), lockFile func(file *os.File) error) (func(), error) {
+	lock()
+	lockPath := filepath.Join(s.basePath, blobsDirectory, refsLockFile)
+	if err := s.createDirectory(filepath.Dir(lockPath)); err != nil {
+		unlock()
+		return nil, err
+	}
+	file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		unlock()
+		return nil, nerrors.NewInternalErrorFrom(err, "unable to open the blobs lock")
+	}
+	if err = lockFile(file); err != nil {
+		file.Close()
+		unlock()
+		return nil, nerrors.NewInternalErrorFrom(err, "unable to lock the blobs")
+	}
+	return func() {
+		if err := unlockFile(file); err != nil {
+			log.Warn().Err(err).Msg("unable to unlock the blobs")
+		}
+		file.Close()
+		unlock()
+	}, nil
+}
+
+// writeFileAtomic writes a file in a temporary path and then renames it
+func (s *casStorageManager) writeFileAtomic(filePath string, data []byte) error {
+	if err := s.createDirectory(filepath.Dir(filePath)); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), ".tmp-")
+	if err != nil {
+		return nerrors.FromError(err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return nerrors.FromError(err)
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return nerrors.FromError(err)
+	}
+	if err = tmp.Close(); err != nil {
+		return nerrors.FromError(err)
+	}
+	if err = os.Rename(tmp.Name(), filePath); err != nil {
+		return nerrors.FromError(err)
+	}
+	return nil
+}
+
+// readRefs returns the number of references of a blob
+func (s *casStorageManager) readRefs(digest string) (int, error) {
+	data, err := os.ReadFile(s.getBlobPath(digest) + refsSuffix)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, nerrors.FromError(err)
+	}
+	refs, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, nerrors.NewInternalErrorFrom(err, "invalid reference counter for blob %s", digest)
+	}
+	return refs, nil
+}
+
+// addRef stores the blob (if it is not already stored) and increments its reference counter.
+// The caller must hold the references lock.
+func (s *casStorageManager) addRef(digest string, data []byte) error {
+	blobPath := s.getBlobPath(digest)
+	if _, err := os.Stat(blobPath); err != nil {
+		if !os.IsNotExist(err) {
+			return nerrors.FromError(err)
+		}
+		if err = s.writeFileAtomic(blobPath, data); err != nil {
+			return err
+		}
+	}
+	refs, err := s.readRefs(digest)
+	if err != nil {
+		return err
+	}
+	return s.writeFileAtomic(blobPath+refsSuffix, []byte(strconv.Itoa(refs+1)))
+}
+
+// removeRef decrements the reference counter of a blob and removes it if it is no longer referenced.
+// The caller must hold the references lock.
+func (s *casStorageManager) removeRef(digest string) error {
+	blobPath := s.getBlobPath(digest)
+	refs, err := s.readRefs(digest)
+	if err != nil {
+		return err
+	}
+	if refs > 1 {
+		return s.writeFileAtomic(blobPath+refsSuffix, []byte(strconv.Itoa(refs-1)))
+	}
+	return s.removeBlob(digest)
+}
+
+// removeBlob removes a blob and its reference counter. The caller must hold the references lock.
+func (s *casStorageManager) removeBlob(digest string) error {
+	blobPath := s.getBlobPath(digest)
+	log.Debug().Str("digest", digest).Msg("removing unreferenced blob")
+	if err := os.Remove(blobPath); err != nil && !os.IsNotExist(err) {
+		return nerrors.FromError(err)
+	}
+	if err := os.Remove(blobPath + refsSuffix); err != nil && !os.IsNotExist(err) {
+		return nerrors.FromError(err)
+	}
+	return nil
+}
+
+// readManifest loads the manifest of an application. Returns nil if the application
+// was stored without manifest (by the plain storage manager).
+func (s *casStorageManager) readManifest(repo string, name string, version string) (*Manifest, error) {
+	data, err := os.ReadFile(s.getManifestPath(repo, name, version))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, nerrors.FromError(err)
+	}
+	var manifest Manifest
+	if err = json.Unmarshal(data, &manifest); err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "invalid manifest for %s/%s:%s", repo, name, version)
+	}
+	return &manifest, nil
+}
+
+// releaseManifest decrements the references of all the blobs of a manifest.
+// The caller must hold the references lock.
+func (s *casStorageManager) releaseManifest(manifest *Manifest) error {
+	entries := manifest.Files
+	if manifest.Artifact != nil {
+		entries = append(entries[:len(entries):len(entries)], *manifest.Artifact)
+	}
+	for _, entry := range entries {
+		if err := s.removeRef(entry.Digest); err != nil {
+			log.Err(err).Str("digest", entry.Digest).Msg("error releasing blob")
+			return err
+		}
+	}
+	return nil
+}
+
+// StoreApplication stores the blobs of the application files and the manifest of the tag
+func (s *casStorageManager) StoreApplication(repo string, name string, version string, files []*entities.FileInfo) error {
+	if err := checkReservedPaths(files); err != nil {
+		return err
+	}
+	artifact, artifactDigest, err := buildArtifact(name, files)
+	if err != nil {
+		log.Err(err).Str("repo", repo).Str("name", name).Str("version", version).Msg("Error storing application, unable to create the artifact")
+		return err
+	}
+
+	unlock, err := s.lockRefs()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	previous, err := s.readManifest(repo, name, version)
+	if err != nil {
+		log.Err(err).Str("repo", repo).Str("name", name).Str("version", version).Msg("Error storing application, unable to read the previous manifest")
+		return err
+	}
+
+	manifest := Manifest{Files: make([]ManifestEntry, 0, len(files))}
+	for _, appFile := range files {
+		sum := sha256.Sum256(appFile.Data)
+		digest := hex.EncodeToString(sum[:])
+		if err = s.addRef(digest, appFile.Data); err != nil {
+			log.Err(err).Str("file", appFile.Path).Msg("Error storing application file, unable to store the blob")
+			// release the blobs already referenced
+			_ = s.releaseManifest(&manifest)
+			return err
+		}
+		manifest.Files = append(manifest.Files, ManifestEntry{
+			Path:   path.Clean(appFile.Path),
+			Digest: digest,
+			Size:   int64(len(appFile.Data)),
+		})
+	}
+	sort.Slice(manifest.Files, func(i, j int) bool {
+		return manifest.Files[i].Path < manifest.Files[j].Path
+	})
+	if err = s.addRef(artifactDigest, artifact); err != nil {
+		log.Err(err).Str("repo", repo).Str("name", name).Str("version", version).Msg("Error storing application artifact, unable to store the blob")
+		_ = s.releaseManifest(&manifest)
+		return err
+	}
+	manifest.Artifact = &ManifestEntry{
+		Path:   artifactFile,
+		Digest: artifactDigest,
+		Size:   int64(len(artifact)),
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		_ = s.releaseManifest(&manifest)
+		return nerrors.NewInternalErrorFrom(err, "unable to create the application manifest")
+	}
+
+	// the new manifest replaces the whole tag directory, including the files
+	// stored by the plain storage manager
+	dir := s.getAppDirectory(repo, name, version)
+	staging, err := s.createStagingDirectory()
+	if err != nil {
+		_ = s.releaseManifest(&manifest)
+		return err
+	}
+	if err = writeFileSync(filepath.Join(staging, manifestFile), data); err != nil {
+		log.Err(err).Str("application", dir).Msg("Error storing application, unable to write the manifest")
+		_ = s.removeDirectory(staging)
+		_ = s.releaseManifest(&manifest)
+		return err
+	}
+	if err = s.swapDirectory(staging, dir); err != nil {
+		log.Err(err).Str("application", dir).Msg("Error storing application, unable to replace old one")
+		_ = s.removeDirectory(staging)
+		_ = s.releaseManifest(&manifest)
+		return err
+	}
+
+	if previous != nil {
+		if err = s.releaseManifest(previous); err != nil {
+			log.Err(err).Str("application", dir).Msg("error releasing the blobs of the previous version")
+		}
+	}
+	return nil
+}
+
+// GetApplication returns the application files, or a single file with the application archive in the given format
+func (s *casStorageManager) GetApplication(repo string, name string, version string, format entities.DownloadFormat) ([]*entities.FileInfo, error) {
+	if format.IsArchive() {
+		stream, err := s.GetApplicationStream(repo, name, version, format)
+		if err != nil {
+			return nil, err
+		}
+		return readStream(name, format, stream)
+	}
+
+	// a new version of the tag cannot release the blobs until they are read
+	unlock, err := s.rLockRefs()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	exists, err := s.ApplicationExists(repo, name, version)
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error checking if the catalog application exists")
+	}
+	if !exists {
+		return nil, nerrors.NewNotFoundError("Application not found")
+	}
+
+	manifest, err := s.readManifest(repo, name, version)
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil {
+		// application stored before enabling the deduplication
+		return s.storageManager.GetApplication(repo, name, version, format)
+	}
+
+	files := make([]*entities.FileInfo, 0, len(manifest.Files))
+	for _, entry := range manifest.Files {
+		data, err := os.ReadFile(s.getBlobPath(entry.Digest))
+		if err != nil {
+			log.Err(err).Str("digest", entry.Digest).Str("file", entry.Path).Msg("error reading blob")
+			return nil, nerrors.NewInternalErrorFrom(err, "Error reading file")
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != entry.Digest {
+			return nil, nerrors.NewInternalError("Error reading file, digest mismatch in %s", entry.Path)
+		}
+		files = append(files, &entities.FileInfo{
+			Path: entry.Path,
+			Data: data,
+		})
+	}
+
+	for _, file := range files {
+		file.Path = fmt.Sprintf("./%s/%s", name, file.Path)
+	}
+	return files, nil
+}
+
+// GetApplicationStream returns the application archive. The tgz is the precomputed one, the other formats
+// (or the tgz of the applications stored without it) are generated while they are read.
+func (s *casStorageManager) GetApplicationStream(repo string, name string, version string, format entities.DownloadFormat) (io.ReadCloser, error) {
+	if err := checkArchiveFormat(format); err != nil {
+		return nil, err
+	}
+	// the blobs are opened before a new version of the tag can release them, the open blobs are still readable
+	// after they are removed
+	unlock, err := s.rLockRefs()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	manifest, err := s.readManifest(repo, name, version)
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil {
+		// application stored before enabling the deduplication
+		return s.storageManager.GetApplicationStream(repo, name, version, format)
+	}
+	if format == entities.DownloadFormatTgz && manifest.Artifact != nil {
+		file, err := os.Open(s.getBlobPath(manifest.Artifact.Digest))
+		if err != nil {
+			log.Err(err).Str("digest", manifest.Artifact.Digest).Msg("error opening artifact blob")
+			return nil, nerrors.NewInternalErrorFrom(err, "Error reading file")
+		}
+		return newDigestReader(file, manifest.Artifact.Digest), nil
+	}
+
+	entries, release, err := s.openBlobs(manifest)
+	if err != nil {
+		return nil, err
+	}
+	return streamArchive(format, name, entries, release), nil
+}
+
+// openBlobs opens the blobs of the files of a manifest. Returns the archive entries and the function that closes
+// the blobs. The caller must hold the references lock.
+func (s *casStorageManager) openBlobs(manifest *Manifest) ([]archiveEntry, func(), error) {
+	entries := make([]archiveEntry, 0, len(manifest.Files))
+	opened := make([]*os.File, 0, len(manifest.Files))
+	release := func() {
+		for _, file := range opened {
+			file.Close()
+		}
+	}
+	for _, entry := range manifest.Files {
+		file, err := os.Open(s.getBlobPath(entry.Digest))
+		if err != nil {
+			log.Err(err).Str("digest", entry.Digest).Str("file", entry.Path).Msg("error opening blob")
+			release()
+			return nil, nil, nerrors.NewInternalErrorFrom(err, "Error reading file")
+		}
+		opened = append(opened, file)
+		digest := entry.Digest
+		entries = append(entries, archiveEntry{
+			Path: entry.Path,
+			Size: entry.Size,
+			Open: func() (io.ReadCloser, error) {
+				// the blob is closed by release
+				return newDigestReader(io.NopCloser(file), digest), nil
+			},
+		})
+	}
+	return entries, release, nil
+}
+
+// GetRepositoryUsage returns the size of the application files of each tag stored in a repository.
+// The size is the one of the application before the deduplication.
+func (s *casStorageManager) GetRepositoryUsage(name string) ([]*entities.TagUsage, error) {
+	tags, err := s.listTags(name)
+	if err != nil {
+		log.Err(err).Str("name", name).Msg("error getting repository usage")
+		return nil, err
+	}
+	for _, tag := range tags {
+		manifest, err := s.readManifest(name, tag.ApplicationName, tag.Tag)
+		if err != nil {
+			return nil, err
+		}
+		if manifest == nil {
+			// application stored before enabling the deduplication
+			if tag.Bytes, err = s.getApplicationSize(s.getAppDirectory(name, tag.ApplicationName, tag.Tag)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		for _, entry := range manifest.Files {
+			tag.Bytes += entry.Size
+		}
+	}
+	return tags, nil
+}
+
+// RemoveApplication removes an application, returns an error if it does not exist
+func (s *casStorageManager) RemoveApplication(repo string, name string, version string) error {
+	unlock, err := s.lockRefs()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	manifest, err := s.readManifest(repo, name, version)
+	if err != nil {
+		return nerrors.NewInternalErrorFrom(err, "unable to delete application")
+	}
+	if err = s.storageManager.RemoveApplication(repo, name, version); err != nil {
+		return err
+	}
+	if manifest != nil {
+		if err = s.releaseManifest(manifest); err != nil {
+			log.Err(err).Str("repo", repo).Str("name", name).Str("version", version).Msg("error releasing application blobs")
+		}
+	}
+	return nil
+}
+
+// RemoveRepository removes the repository directory releasing all the blobs referenced by its applications
+func (s *casStorageManager) RemoveRepository(name string) error {
+	unlock, err := s.lockRefs()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	tags, err := s.listTags(name)
+	if err != nil {
+		log.Err(err).Str("name", name).Msg("error listing repository tags")
+		return nerrors.NewInternalErrorFrom(err, "error removing repository")
+	}
+	manifests := make([]*Manifest, 0, len(tags))
+	for _, tag := range tags {
+		manifest, err := s.readManifest(name, tag.ApplicationName, tag.Tag)
+		if err != nil {
+			log.Err(err).Str("name", name).Msg("error reading repository manifests")
+			return nerrors.NewInternalErrorFrom(err, "error removing repository")
+		}
+		if manifest != nil {
+			manifests = append(manifests, manifest)
+		}
+	}
+
+	if err := s.storageManager.RemoveRepository(name); err != nil {
+		return err
+	}
+	for _, manifest := range manifests {
+		if err := s.releaseManifest(manifest); err != nil {
+			log.Err(err).Str("name", name).Msg("error releasing repository blobs")
+		}
+	}
+	return nil
+}
+
+// CollectBlobs recomputes the references of the blobs from the manifests. A failure between storing the blobs of a
+// push and replacing its manifest leaves references that no manifest holds, so those blobs are never removed.
+func (s *casStorageManager) CollectBlobs(repair bool) ([]*entities.Inconsistency, error) {
+	unlock, err := s.lockRefs()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	// 1.- Count the references of the manifests
+	refs := make(map[string]int)
+	owners := make(map[string]*entities.ApplicationID)
+	repositories, err := s.ListRepositories()
+	if err != nil {
+		return nil, err
+	}
+	for _, repo := range repositories {
+		tags, err := s.listTags(repo)
+		if err != nil {
+			log.Err(err).Str("repo", repo).Msg("error listing the tags to collect the blobs")
+			return nil, err
+		}
+		for _, tag := range tags {
+			manifest, err := s.readManifest(repo, tag.ApplicationName, tag.Tag)
+			if err != nil {
+				return nil, err
+			}
+			if manifest == nil {
+				continue
+			}
+			entries := manifest.Files
+			if manifest.Artifact != nil {
+				entries = append(entries[:len(entries):len(entries)], *manifest.Artifact)
+			}
+			for _, entry := range entries {
+				refs[entry.Digest]++
+				if _, exists := owners[entry.Digest]; !exists {
+					owners[entry.Digest] = &entities.ApplicationID{Namespace: repo, ApplicationName: tag.ApplicationName, Tag: tag.Tag}
+				}
+			}
+		}
+	}
+
+	// 2.- Compare them with the counters of the blobs stored
+	stored, err := s.listBlobs()
+	if err != nil {
+		return nil, err
+	}
+	inconsistencies := make([]*entities.Inconsistency, 0)
+	for _, digest := range stored {
+		counter, err := s.readRefs(digest)
+		if err != nil {
+			return nil, err
+		}
+		expected := refs[digest]
+		delete(refs, digest)
+		if counter == expected && expected > 0 {
+			continue
+		}
+		inconsistency := &entities.Inconsistency{
+			Type:          entities.LeakedBlob,
+			ApplicationID: owners[digest],
+			Digest:        digest,
+			Reason:        fmt.Sprintf("blob with %d references stored and %d in the manifests", counter, expected),
+		}
+		if repair {
+			if expected == 0 {
+				err = s.removeBlob(digest)
+			} else {
+				err = s.writeFileAtomic(s.getBlobPath(digest)+refsSuffix, []byte(strconv.Itoa(expected)))
+			}
+			if err != nil {
+				log.Err(err).Str("digest", digest).Msg("Unable to repair the blob references")
+				inconsistency.RepairError = err.Error()
+			} else {
+				inconsistency.Repaired = true
+			}
+		}
+		inconsistencies = append(inconsistencies, inconsistency)
+	}
+
+	// 3.- Report the blobs referenced that are not stored, they cannot be repaired
+	missing := make([]string, 0, len(refs))
+	for digest := range refs {
+		missing = append(missing, digest)
+	}
+	sort.Strings(missing)
+	for _, digest := range missing {
+		inconsistencies = append(inconsistencies, &entities.Inconsistency{
+			Type:          entities.MissingBlob,
+			ApplicationID: owners[digest],
+			Digest:        digest,
+			Reason:        "blob referenced by a manifest that is not stored",
+		})
+	}
+	return inconsistencies, nil
+}
+
+// listBlobs returns the sorted digests of the blobs stored, including the ones that only keep the reference counter.
+// The caller must hold the references lock.
+func (s *casStorageManager) listBlobs() ([]string, error) {
+	digests := make(map[string]bool)
+	root := filepath.Join(s.basePath, blobsDirectory, "sha256")
+	if err := filepath.WalkDir(root, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && filePath == root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			// skip the temporary files of the interrupted writes
+			return nil
+		}
+		digests[strings.TrimSuffix(d.Name(), refsSuffix)] = true
+		return nil
+	}); err != nil {
+		log.Err(err).Msg("error listing the blobs")
+		return nil, nerrors.NewInternalErrorFrom(err, "error listing the blobs")
+	}
+	result := make([]string, 0, len(digests))
+	for digest := range digests {
+		result = append(result, digest)
+	}
+	sort.Strings(result)
+	return result, nil
+}
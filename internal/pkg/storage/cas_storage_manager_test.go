@@ -0,0 +1,268 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/catalog-manager/internal/pkg/utils"
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog/log"
+	"syreclabs.com/go/faker"
+)
+
+var _ = ginkgo.Describe("Content addressable storage test", func() {
+
+	if !utils.RunIntegrationTests("storage") {
+		log.Warn().Msg("Content addressable storage manager tests are skipped")
+		return
+	}
+
+	var basePath = os.Getenv("REPO_BASE_PATH")
+	if basePath == "" {
+		basePath = "/tmp/cmtest"
+	}
+
+	getDigest := func(data []byte) string {
+		sum := sha256.Sum256(data)
+		return hex.EncodeToString(sum[:])
+	}
+
+	ginkgo.It("should store the same content only once", func() {
+		manager := NewContentAddressableStorageManager(basePath)
+		repo := faker.Name().FirstName()
+		appName := faker.App().Name()
+		content := []byte(faker.Lorem().Paragraph(3))
+		files := []*entities.FileInfo{
+			{Path: "app_config.yaml", Data: content},
+			{Path: "component1.yaml", Data: []byte("component1")}}
+
+		err := manager.StoreApplication(repo, appName, "v0.0.1", files)
+		gomega.Expect(err).Should(gomega.Succeed())
+		err = manager.StoreApplication(repo, appName, "v0.0.2", files)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		cas := manager.(*casStorageManager)
+		refs, err := cas.readRefs(getDigest(content))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(refs).Should(gomega.Equal(2))
+	})
+
+	ginkgo.It("should return the same files that were stored", func() {
+		manager := NewContentAddressableStorageManager(basePath)
+		repo := faker.Name().FirstName()
+		appName := faker.App().Name()
+		files := []*entities.FileInfo{
+			{Path: "app_config.yaml", Data: []byte("appconf")},
+			{Path: "components/component1.yaml", Data: []byte("component1")}}
+
+		err := manager.StoreApplication(repo, appName, "latest", files)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		returned, err := manager.GetApplication(repo, appName, "latest", entities.DownloadFormatNone)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(returned).Should(gomega.ConsistOf(
+			&entities.FileInfo{Path: "./" + appName + "/app_config.yaml", Data: []byte("appconf")},
+			&entities.FileInfo{Path: "./" + appName + "/components/component1.yaml", Data: []byte("component1")}))
+
+		compressed, err := manager.GetApplication(repo, appName, "latest", entities.DownloadFormatTgz)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(len(compressed)).Should(gomega.Equal(1))
+		gomega.Expect(compressed[0].Path).Should(gomega.Equal("./" + appName + ".tgz"))
+	})
+
+	ginkgo.It("should only remove the blobs that are no longer referenced", func() {
+		manager := NewContentAddressableStorageManager(basePath)
+		repo := faker.Name().FirstName()
+		appName := faker.App().Name()
+		shared := []byte(faker.Lorem().Paragraph(3))
+		unique := []byte(faker.Lorem().Paragraph(4))
+
+		err := manager.StoreApplication(repo, appName, "v0.0.1", []*entities.FileInfo{
+			{Path: "app_config.yaml", Data: shared}})
+		gomega.Expect(err).Should(gomega.Succeed())
+		err = manager.StoreApplication(repo, appName, "v0.0.2", []*entities.FileInfo{
+			{Path: "app_config.yaml", Data: shared},
+			{Path: "component.yaml", Data: unique}})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		err = manager.RemoveApplication(repo, appName, "v0.0.2")
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		cas := manager.(*casStorageManager)
+		_, err = os.Stat(cas.getBlobPath(getDigest(unique)))
+		gomega.Expect(os.IsNotExist(err)).Should(gomega.BeTrue())
+		_, err = os.Stat(cas.getBlobPath(getDigest(shared)))
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		err = manager.RemoveRepository(repo)
+		gomega.Expect(err).Should(gomega.Succeed())
+		_, err = os.Stat(cas.getBlobPath(getDigest(shared)))
+		gomega.Expect(os.IsNotExist(err)).Should(gomega.BeTrue())
+	})
+
+	ginkgo.It("should read the applications stored without manifest", func() {
+		repo := faker.Name().FirstName()
+		appName := faker.App().Name()
+		files := []*entities.FileInfo{
+			{Path: "app_config.yaml", Data: []byte("appconf")}}
+		err := NewStorageManager(basePath).StoreApplication(repo, appName, "latest", files)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		manager := NewContentAddressableStorageManager(basePath)
+		returned, err := manager.GetApplication(repo, appName, "latest", entities.DownloadFormatNone)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(len(returned)).Should(gomega.Equal(1))
+
+		err = manager.RemoveApplication(repo, appName, "latest")
+		gomega.Expect(err).Should(gomega.Succeed())
+	})
+
+	ginkgo.It("should not read the user files named manifest.json as manifests", func() {
+		repo := faker.Name().FirstName()
+		appName := faker.App().Name()
+		files := []*entities.FileInfo{
+			{Path: "manifest.json", Data: []byte(`{"Files": [{"Path": "app.yaml", "Digest": "not-a-blob"}]}`)},
+			{Path: "nested/manifest.json", Data: []byte("not json")}}
+		err := NewStorageManager(basePath).StoreApplication(repo, appName, "latest", files)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		manager := NewContentAddressableStorageManager(basePath)
+		returned, err := manager.GetApplication(repo, appName, "latest", entities.DownloadFormatNone)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(len(returned)).Should(gomega.Equal(2))
+
+		err = manager.RemoveRepository(repo)
+		gomega.Expect(err).Should(gomega.Succeed())
+	})
+
+	ginkgo.It("should reject the files that use the manifest name", func() {
+		manager := NewContentAddressableStorageManager(basePath)
+		err := manager.StoreApplication(faker.Name().FirstName(), faker.App().Name(), "latest", []*entities.FileInfo{
+			{Path: "./" + manifestFile, Data: []byte("{}")}})
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.FailedPrecondition))
+	})
+
+	ginkgo.It("should store the precomputed tgz as a shared blob", func() {
+		manager := NewContentAddressableStorageManager(basePath)
+		repo := faker.Name().FirstName()
+		appName := faker.App().Name()
+		files := []*entities.FileInfo{
+			{Path: "app_config.yaml", Data: []byte(faker.Lorem().Paragraph(3))}}
+
+		err := manager.StoreApplication(repo, appName, "v0.0.1", files)
+		gomega.Expect(err).Should(gomega.Succeed())
+		err = manager.StoreApplication(repo, appName, "v0.0.2", files)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		artifact, digest, err := buildArtifact(appName, files)
+		gomega.Expect(err).Should(gomega.Succeed())
+		cas := manager.(*casStorageManager)
+		refs, err := cas.readRefs(digest)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(refs).Should(gomega.Equal(2))
+
+		compressed, err := manager.GetApplication(repo, appName, "v0.0.1", entities.DownloadFormatTgz)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(compressed[0].Data).Should(gomega.Equal(artifact))
+
+		err = manager.RemoveRepository(repo)
+		gomega.Expect(err).Should(gomega.Succeed())
+		_, err = os.Stat(cas.getBlobPath(digest))
+		gomega.Expect(os.IsNotExist(err)).Should(gomega.BeTrue())
+	})
+
+	ginkgo.It("should keep streaming a generated archive if the application is replaced while it is read", func() {
+		manager := NewContentAddressableStorageManager(basePath)
+		repo := faker.Name().FirstName()
+		appName := faker.App().Name()
+		old := []byte(faker.Lorem().Paragraph(3))
+		err := manager.StoreApplication(repo, appName, "latest", []*entities.FileInfo{
+			{Path: "app_config.yaml", Data: old}})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		stream, err := manager.GetApplicationStream(repo, appName, "latest", entities.DownloadFormatZip)
+		gomega.Expect(err).Should(gomega.Succeed())
+		err = manager.StoreApplication(repo, appName, "latest", []*entities.FileInfo{
+			{Path: "app_config.yaml", Data: []byte(faker.Lorem().Paragraph(4))}})
+		gomega.Expect(err).Should(gomega.Succeed())
+		_, err = os.Stat(manager.(*casStorageManager).getBlobPath(getDigest(old)))
+		gomega.Expect(os.IsNotExist(err)).Should(gomega.BeTrue())
+
+		streamed, err := readStream(appName, entities.DownloadFormatZip, stream)
+		gomega.Expect(err).Should(gomega.Succeed())
+		extracted, err := extractArchive(entities.DownloadFormatZip, streamed[0].Data)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(extracted).Should(gomega.Equal(map[string][]byte{appName + "/app_config.yaml": old}))
+	})
+
+	ginkgo.It("should recompute the blob references from the manifests", func() {
+		collectPath, err := os.MkdirTemp("", "cmcollect")
+		gomega.Expect(err).Should(gomega.Succeed())
+		defer os.RemoveAll(collectPath)
+		manager := NewContentAddressableStorageManager(collectPath)
+		cas := manager.(*casStorageManager)
+		repo := faker.Name().FirstName()
+		appName := faker.App().Name()
+		shared := []byte(faker.Lorem().Paragraph(3))
+		err = manager.StoreApplication(repo, appName, "v0.0.1", []*entities.FileInfo{
+			{Path: "app_config.yaml", Data: shared}})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		// references added by a push that failed before storing its manifest
+		leaked := []byte(faker.Lorem().Paragraph(4))
+		gomega.Expect(cas.addRef(getDigest(shared), shared)).Should(gomega.Succeed())
+		gomega.Expect(cas.addRef(getDigest(leaked), leaked)).Should(gomega.Succeed())
+
+		inconsistencies, err := cas.CollectBlobs(false)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(len(inconsistencies)).Should(gomega.Equal(2))
+		for _, inconsistency := range inconsistencies {
+			gomega.Expect(inconsistency.Type).Should(gomega.Equal(entities.LeakedBlob))
+			gomega.Expect(inconsistency.Repaired).Should(gomega.BeFalse())
+		}
+
+		inconsistencies, err = cas.CollectBlobs(true)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(len(inconsistencies)).Should(gomega.Equal(2))
+		for _, inconsistency := range inconsistencies {
+			gomega.Expect(inconsistency.Repaired).Should(gomega.BeTrue())
+		}
+		refs, err := cas.readRefs(getDigest(shared))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(refs).Should(gomega.Equal(1))
+		_, err = os.Stat(cas.getBlobPath(getDigest(leaked)))
+		gomega.Expect(os.IsNotExist(err)).Should(gomega.BeTrue())
+
+		inconsistencies, err = cas.CollectBlobs(false)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(inconsistencies).Should(gomega.BeEmpty())
+
+		// a blob removed by hand cannot be repaired
+		gomega.Expect(os.Remove(cas.getBlobPath(getDigest(shared)))).Should(gomega.Succeed())
+		gomega.Expect(os.Remove(cas.getBlobPath(getDigest(shared)) + refsSuffix)).Should(gomega.Succeed())
+		inconsistencies, err = cas.CollectBlobs(true)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(len(inconsistencies)).Should(gomega.BeNumerically(">=", 1))
+		gomega.Expect(inconsistencies[len(inconsistencies)-1].Type).Should(gomega.Equal(entities.MissingBlob))
+		gomega.Expect(inconsistencies[len(inconsistencies)-1].ApplicationID.Namespace).Should(gomega.Equal(repo))
+	})
+})
@@ -0,0 +1,376 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package storage
+
+import (
+	"bytes"
+	"io"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog/log"
+)
+
+// encryptedFileMagic with the prefix of the encrypted files. It starts with a NUL byte so it
+// cannot be confused with the text files of the applications.
+var encryptedFileMagic = []byte("\x00cmenc1")
+
+// KeyRotator is implemented by the storage managers that encrypt the private applications
+type KeyRotator interface {
+	// RotateKeys creates a new data key for a namespace (for all of them if it is empty), encrypts again its private
+	// applications with the new key and removes the previous ones. The data keys are wrapped again with the active
+	// master key, so the previous master keys can be removed once all the namespaces are rotated.
+	RotateKeys(namespace string) (*entities.KeyRotationReport, error)
+}
+
+// encryptedStorageManager encrypts the files of the private applications before storing them in another storage
+// manager. The files are encrypted with AES-GCM using a data key per namespace, the data keys are wrapped by a master
+// key. The file paths are not encrypted.
+type encryptedStorageManager struct {
+	StorageManager
+	// keys with the data keys of the namespaces
+	keys *keyRing
+	// conversionLock blocks the pushes while the files of an application are encrypted or decrypted again
+	conversionLock sync.RWMutex
+}
+
+// NewEncryptedStorageManager returns a StorageManager that encrypts the private applications stored in manager.
+// The master keys are read from masterKeyPath and the data keys are stored in manager, so all the replicas share them.
+// The data keys of the legacy keysPath file are imported if manager has no keys.
+func NewEncryptedStorageManager(manager StorageManager, masterKeyPath string, keysPath string) (StorageManager, error) {
+	keys, err := newKeyRing(manager, masterKeyPath, keysPath)
+	if err != nil {
+		log.Err(err).Str("masterKeyPath", masterKeyPath).Str("keysPath", keysPath).Msg("error loading the encryption keys")
+		return nil, err
+	}
+	return &encryptedStorageManager{StorageManager: manager, keys: keys}, nil
+}
+
+// fileAdditionalData returns the additional data that binds an encrypted file to its application and path
+func fileAdditionalData(repo string, name string, filePath string) []byte {
+	return []byte(path.Join(repo, name, filePath))
+}
+
+// isEncrypted checks if the content of a file is encrypted
+func isEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, encryptedFileMagic)
+}
+
+// encryptFile returns the content of a file encrypted with key. The encrypted content includes the magic prefix,
+// the length and identifier of the data key, the nonce and the ciphertext.
+func encryptFile(key *dataKey, additionalData []byte, data []byte) ([]byte, error) {
+	sealed, err := seal(key.aead, data, additionalData)
+	if err != nil {
+		return nil, err
+	}
+	encrypted := make([]byte, 0, len(encryptedFileMagic)+1+len(key.ID)+len(sealed))
+	encrypted = append(encrypted, encryptedFileMagic...)
+	encrypted = append(encrypted, byte(len(key.ID)))
+	encrypted = append(encrypted, key.ID...)
+	return append(encrypted, sealed...), nil
+}
+
+// getKeyID returns the identifier of the data key of an encrypted file
+func getKeyID(data []byte) (string, []byte, error) {
+	data = data[len(encryptedFileMagic):]
+	if len(data) == 0 || len(data) < int(data[0])+1 {
+		return "", nil, nerrors.NewDataLossError("invalid encrypted file")
+	}
+	return string(data[1 : data[0]+1]), data[data[0]+1:], nil
+}
+
+// relativePath returns the path of a file returned by GetApplication relative to the application directory
+func relativePath(name string, filePath string) string {
+	return strings.TrimPrefix(path.Clean(filePath), name+"/")
+}
+
+// isPrivate checks if the visibility stored of an application is private
+func (e *encryptedStorageManager) isPrivate(repo string, name string) (bool, error) {
+	private, err := e.StorageManager.GetApplicationVisibility(repo, name)
+	if err != nil {
+		return false, err
+	}
+	return private != nil && *private, nil
+}
+
+// encryptFiles returns a copy of the files encrypted with key
+func (e *encryptedStorageManager) encryptFiles(repo string, name string, key *dataKey, files []*entities.FileInfo) ([]*entities.FileInfo, error) {
+	encrypted := make([]*entities.FileInfo, 0, len(files))
+	for _, file := range files {
+		filePath := path.Clean(file.Path)
+		data, err := encryptFile(key, fileAdditionalData(repo, name, filePath), file.Data)
+		if err != nil {
+			return nil, err
+		}
+		encrypted = append(encrypted, &entities.FileInfo{Path: file.Path, Data: data})
+	}
+	return encrypted, nil
+}
+
+// decryptFiles decrypts the encrypted files returned by GetApplication, the files that are not encrypted are not modified
+func (e *encryptedStorageManager) decryptFiles(repo string, name string, files []*entities.FileInfo) error {
+	for _, file := range files {
+		if !isEncrypted(file.Data) {
+			continue
+		}
+		id, sealed, err := getKeyID(file.Data)
+		if err != nil {
+			return err
+		}
+		key, err := e.keys.GetKey(repo, id)
+		if err != nil {
+			return nerrors.NewDataLossErrorFrom(err, "unable to decrypt %s", file.Path)
+		}
+		if file.Data, err = open(key.aead, sealed, fileAdditionalData(repo, name, relativePath(name, file.Path))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getFiles returns the decrypted files of an application with their paths relative to the application directory
+func (e *encryptedStorageManager) getFiles(repo string, name string, version string) ([]*entities.FileInfo, error) {
+	files, err := e.StorageManager.GetApplication(repo, name, version, entities.DownloadFormatNone)
+	if err != nil {
+		return nil, err
+	}
+	if err = e.decryptFiles(repo, name, files); err != nil {
+		log.Err(err).Str("repo", repo).Str("name", name).Str("version", version).Msg("error decrypting application")
+		return nil, err
+	}
+	for _, file := range files {
+		file.Path = relativePath(name, file.Path)
+	}
+	return files, nil
+}
+
+// StoreApplication encrypts the files of the private applications before storing them
+func (e *encryptedStorageManager) StoreApplication(repo string, name string, version string, files []*entities.FileInfo) error {
+	e.conversionLock.RLock()
+	defer e.conversionLock.RUnlock()
+
+	private, err := e.isPrivate(repo, name)
+	if err != nil {
+		log.Err(err).Str("repo", repo).Str("name", name).Msg("error storing application, unable to get the visibility")
+		return err
+	}
+	if !private {
+		return e.StorageManager.StoreApplication(repo, name, version, files)
+	}
+	key, err := e.keys.GetActiveKey(repo)
+	if err != nil {
+		log.Err(err).Str("repo", repo).Msg("error storing application, unable to get the data key")
+		return err
+	}
+	encrypted, err := e.encryptFiles(repo, name, key, files)
+	if err != nil {
+		return err
+	}
+	return e.StorageManager.StoreApplication(repo, name, version, encrypted)
+}
+
+// GetApplication returns the application files decrypted. The archives of the private applications are created
+// from the decrypted files as the precomputed ones contain the encrypted files.
+func (e *encryptedStorageManager) GetApplication(repo string, name string, version string, format entities.DownloadFormat) ([]*entities.FileInfo, error) {
+	if format.IsArchive() {
+		private, err := e.isPrivate(repo, name)
+		if err != nil {
+			return nil, err
+		}
+		if !private {
+			return e.StorageManager.GetApplication(repo, name, version, format)
+		}
+		files, err := e.getFiles(repo, name, version)
+		if err != nil {
+			return nil, err
+		}
+		return compressFiles(name, format, files)
+	}
+
+	files, err := e.StorageManager.GetApplication(repo, name, version, format)
+	if err != nil {
+		return nil, err
+	}
+	if err = e.decryptFiles(repo, name, files); err != nil {
+		log.Err(err).Str("repo", repo).Str("name", name).Str("version", version).Msg("error decrypting application")
+		return nil, err
+	}
+	return files, nil
+}
+
+// GetApplicationStream returns the application archive. The archives of the private applications are created
+// from the decrypted files.
+func (e *encryptedStorageManager) GetApplicationStream(repo string, name string, version string, format entities.DownloadFormat) (io.ReadCloser, error) {
+	if err := checkArchiveFormat(format); err != nil {
+		return nil, err
+	}
+	private, err := e.isPrivate(repo, name)
+	if err != nil {
+		return nil, err
+	}
+	if !private {
+		return e.StorageManager.GetApplicationStream(repo, name, version, format)
+	}
+	files, err := e.getFiles(repo, name, version)
+	if err != nil {
+		return nil, err
+	}
+	return streamArchive(format, name, newMemoryEntries(files), func() {}), nil
+}
+
+// StoreApplicationVisibility stores the visibility of an application. If the application becomes private its files
+// are encrypted, and if it becomes public they are decrypted. The visibility is stored once all the tags are converted,
+// so a failed conversion is completed storing the same visibility again.
+func (e *encryptedStorageManager) StoreApplicationVisibility(repo string, name string, isPrivate bool) error {
+	private, err := e.isPrivate(repo, name)
+	if err != nil {
+		return err
+	}
+	if private == isPrivate {
+		return e.StorageManager.StoreApplicationVisibility(repo, name, isPrivate)
+	}
+
+	e.conversionLock.Lock()
+	defer e.conversionLock.Unlock()
+
+	var key *dataKey
+	if isPrivate {
+		if key, err = e.keys.GetActiveKey(repo); err != nil {
+			log.Err(err).Str("repo", repo).Msg("error changing the application visibility, unable to get the data key")
+			return err
+		}
+	}
+	if _, err = e.convertApplication(repo, name, key); err != nil {
+		log.Err(err).Str("repo", repo).Str("name", name).Bool("isPrivate", isPrivate).Msg("error converting the application files")
+		return err
+	}
+	return e.StorageManager.StoreApplicationVisibility(repo, name, isPrivate)
+}
+
+// CollectBlobs collects the blobs of the storage manager that stores the encrypted files, if it shares them
+func (e *encryptedStorageManager) CollectBlobs(repair bool) ([]*entities.Inconsistency, error) {
+	collector, ok := e.StorageManager.(BlobCollector)
+	if !ok {
+		return []*entities.Inconsistency{}, nil
+	}
+	return collector.CollectBlobs(repair)
+}
+
+// convertApplication stores again all the tags of an application, the files are encrypted with key or stored
+// in plain text if it is nil. Returns the number of tags converted. The caller must hold the conversion lock.
+func (e *encryptedStorageManager) convertApplication(repo string, name string, key *dataKey) (int, error) {
+	applications, err := e.StorageManager.ListApplications(repo)
+	if err != nil {
+		return 0, err
+	}
+	converted := 0
+	for _, appID := range applications {
+		if appID.ApplicationName != name {
+			continue
+		}
+		files, err := e.getFiles(repo, name, appID.Tag)
+		if err != nil {
+			return converted, err
+		}
+		if key != nil {
+			if files, err = e.encryptFiles(repo, name, key, files); err != nil {
+				return converted, err
+			}
+		}
+		if err = e.StorageManager.StoreApplication(repo, name, appID.Tag, files); err != nil {
+			return converted, err
+		}
+		converted++
+	}
+	return converted, nil
+}
+
+// RotateKeys creates a new data key for a namespace (for all of them if it is empty), encrypts again its private
+// applications with the new key and removes the previous ones. The namespaces without private applications are not
+// included in the report.
+func (e *encryptedStorageManager) RotateKeys(namespace string) (*entities.KeyRotationReport, error) {
+	e.conversionLock.Lock()
+	defer e.conversionLock.Unlock()
+
+	namespaces := []string{namespace}
+	if namespace == "" {
+		repositories, err := e.StorageManager.ListRepositories()
+		if err != nil {
+			return nil, err
+		}
+		namespaces = repositories
+	}
+
+	report := &entities.KeyRotationReport{MasterKeyID: e.keys.activeMasterKey().ID, Namespaces: make([]*entities.NamespaceKeyRotation, 0)}
+	for _, name := range namespaces {
+		result := &entities.NamespaceKeyRotation{Namespace: name}
+		rotated, err := e.rotateNamespace(result)
+		if err != nil {
+			log.Err(err).Str("namespace", name).Msg("error rotating the data key")
+			result.Error = err.Error()
+		}
+		if rotated {
+			report.Namespaces = append(report.Namespaces, result)
+		}
+	}
+	return report, nil
+}
+
+// rotateNamespace encrypts the private applications of a namespace with a new data key. The previous keys are only
+// removed if all the applications are encrypted with the new one. The namespaces without private applications
+// keep their keys. Returns false if the namespace is skipped. The caller must hold the conversion lock.
+func (e *encryptedStorageManager) rotateNamespace(result *entities.NamespaceKeyRotation) (bool, error) {
+	applications, err := e.StorageManager.ListApplications(result.Namespace)
+	if err != nil {
+		return true, err
+	}
+	checked := make(map[string]bool, 0)
+	private := make([]string, 0)
+	for _, appID := range applications {
+		if checked[appID.ApplicationName] {
+			continue
+		}
+		checked[appID.ApplicationName] = true
+		isPrivate, err := e.isPrivate(result.Namespace, appID.ApplicationName)
+		if err != nil {
+			return true, err
+		}
+		if isPrivate {
+			private = append(private, appID.ApplicationName)
+		}
+	}
+	if len(private) == 0 {
+		return false, nil
+	}
+
+	key, err := e.keys.AddKey(result.Namespace)
+	if err != nil {
+		return true, err
+	}
+	result.KeyID = key.ID
+	for _, name := range private {
+		converted, err := e.convertApplication(result.Namespace, name, key)
+		result.Applications += converted
+		if err != nil {
+			return true, err
+		}
+	}
+	return true, e.keys.RetainKey(result.Namespace, key.ID)
+}
@@ -0,0 +1,264 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/catalog-manager/internal/pkg/utils"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog/log"
+	"syreclabs.com/go/faker"
+)
+
+// newMasterKey returns a base64 encoded master key
+func newMasterKey() string {
+	key := make([]byte, encryptionKeySize)
+	_, err := rand.Read(key)
+	gomega.Expect(err).Should(gomega.Succeed())
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+var _ = ginkgo.Describe("Encrypted storage test", func() {
+
+	if !utils.RunIntegrationTests("storage") {
+		log.Warn().Msg("Encrypted storage manager tests are skipped")
+		return
+	}
+
+	var keysDir string
+	var masterKeyPath string
+	var keysPath string
+	var backend StorageManager
+	var manager StorageManager
+	var repo string
+	var appName string
+	files := []*entities.FileInfo{
+		{Path: "app_config.yaml", Data: []byte("appconf")},
+		{Path: "components/component1.yaml", Data: []byte("component1")}}
+
+	// expectEncrypted checks if the files stored in the backend are encrypted
+	expectEncrypted := func(version string, encrypted bool) {
+		stored, err := backend.GetApplication(repo, appName, version, entities.DownloadFormatNone)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(len(stored)).Should(gomega.Equal(len(files)))
+		for _, file := range stored {
+			gomega.Expect(isEncrypted(file.Data)).Should(gomega.Equal(encrypted))
+		}
+	}
+
+	// expectFiles checks that the encrypted storage returns the stored files
+	expectFiles := func(manager StorageManager, version string) {
+		returned, err := manager.GetApplication(repo, appName, version, entities.DownloadFormatNone)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(returned).Should(gomega.ConsistOf(
+			&entities.FileInfo{Path: "./" + appName + "/app_config.yaml", Data: []byte("appconf")},
+			&entities.FileInfo{Path: "./" + appName + "/components/component1.yaml", Data: []byte("component1")}))
+	}
+
+	ginkgo.BeforeEach(func() {
+		var err error
+		keysDir, err = os.MkdirTemp("", "cmkeys")
+		gomega.Expect(err).Should(gomega.Succeed())
+		masterKeyPath = filepath.Join(keysDir, "master.key")
+		keysPath = filepath.Join(keysDir, "keys.json")
+		err = os.WriteFile(masterKeyPath, []byte(newMasterKey()+"\n"), 0600)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		// the data keys are stored with the applications, each test uses its own storage
+		backend = NewStorageManager(filepath.Join(keysDir, "repository"))
+		manager, err = NewEncryptedStorageManager(backend, masterKeyPath, keysPath)
+		gomega.Expect(err).Should(gomega.Succeed())
+		repo = faker.Name().FirstName()
+		appName = faker.App().Name()
+	})
+
+	ginkgo.AfterEach(func() {
+		_ = os.RemoveAll(keysDir)
+		_ = backend.RemoveRepository(repo)
+	})
+
+	ginkgo.It("should encrypt the files of the private applications", func() {
+		err := manager.StoreApplicationVisibility(repo, appName, true)
+		gomega.Expect(err).Should(gomega.Succeed())
+		err = manager.StoreApplication(repo, appName, "latest", files)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		expectEncrypted("latest", true)
+		expectFiles(manager, "latest")
+
+		for _, format := range []entities.DownloadFormat{entities.DownloadFormatTgz, entities.DownloadFormatZip} {
+			returned, err := manager.GetApplication(repo, appName, "latest", format)
+			gomega.Expect(err).Should(gomega.Succeed())
+			expected, err := compressFiles(appName, format, files)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(returned).Should(gomega.Equal(expected))
+
+			stream, err := manager.GetApplicationStream(repo, appName, "latest", format)
+			gomega.Expect(err).Should(gomega.Succeed())
+			streamed, err := readStream(appName, format, stream)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(streamed).Should(gomega.Equal(expected))
+		}
+	})
+
+	ginkgo.It("should not encrypt the files of the public applications", func() {
+		err := manager.StoreApplicationVisibility(repo, appName, false)
+		gomega.Expect(err).Should(gomega.Succeed())
+		err = manager.StoreApplication(repo, appName, "latest", files)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		expectEncrypted("latest", false)
+		expectFiles(manager, "latest")
+	})
+
+	ginkgo.It("should encrypt and decrypt the files when the visibility changes", func() {
+		err := manager.StoreApplication(repo, appName, "v1", files)
+		gomega.Expect(err).Should(gomega.Succeed())
+		err = manager.StoreApplication(repo, appName, "v2", files)
+		gomega.Expect(err).Should(gomega.Succeed())
+		expectEncrypted("v1", false)
+
+		err = manager.StoreApplicationVisibility(repo, appName, true)
+		gomega.Expect(err).Should(gomega.Succeed())
+		expectEncrypted("v1", true)
+		expectEncrypted("v2", true)
+		expectFiles(manager, "v2")
+
+		err = manager.StoreApplicationVisibility(repo, appName, false)
+		gomega.Expect(err).Should(gomega.Succeed())
+		expectEncrypted("v1", false)
+		expectEncrypted("v2", false)
+		expectFiles(manager, "v1")
+	})
+
+	ginkgo.It("should rotate the data keys and the master key", func() {
+		err := manager.StoreApplicationVisibility(repo, appName, true)
+		gomega.Expect(err).Should(gomega.Succeed())
+		err = manager.StoreApplication(repo, appName, "latest", files)
+		gomega.Expect(err).Should(gomega.Succeed())
+		previousKeys, err := backend.GetEncryptionKeys()
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		// the new master key is added before the previous one
+		previousMasterKey, err := os.ReadFile(masterKeyPath)
+		gomega.Expect(err).Should(gomega.Succeed())
+		newMasterKey := newMasterKey()
+		err = os.WriteFile(masterKeyPath, []byte(newMasterKey+"\n"+string(previousMasterKey)), 0600)
+		gomega.Expect(err).Should(gomega.Succeed())
+		manager, err = NewEncryptedStorageManager(backend, masterKeyPath, keysPath)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		report, err := manager.(KeyRotator).RotateKeys(repo)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(len(report.Namespaces)).Should(gomega.Equal(1))
+		gomega.Expect(report.Namespaces[0].Error).Should(gomega.BeEmpty())
+		gomega.Expect(report.Namespaces[0].Applications).Should(gomega.Equal(1))
+		gomega.Expect(string(previousKeys)).ShouldNot(gomega.ContainSubstring(report.Namespaces[0].KeyID))
+
+		// the previous master key is no longer required
+		err = os.WriteFile(masterKeyPath, []byte(newMasterKey), 0600)
+		gomega.Expect(err).Should(gomega.Succeed())
+		rotated, err := NewEncryptedStorageManager(backend, masterKeyPath, keysPath)
+		gomega.Expect(err).Should(gomega.Succeed())
+		expectEncrypted("latest", true)
+		expectFiles(rotated, "latest")
+	})
+
+	ginkgo.It("should share the data keys with the replicas that use the same storage", func() {
+		// each replica has its own storage manager on the shared volume
+		replica, err := NewEncryptedStorageManager(NewStorageManager(filepath.Join(keysDir, "repository")), masterKeyPath, "")
+		gomega.Expect(err).Should(gomega.Succeed())
+		otherRepo := faker.Name().FirstName() + "-other"
+		defer backend.RemoveRepository(otherRepo)
+
+		err = manager.StoreApplicationVisibility(repo, appName, true)
+		gomega.Expect(err).Should(gomega.Succeed())
+		err = manager.StoreApplication(repo, appName, "latest", files)
+		gomega.Expect(err).Should(gomega.Succeed())
+		err = replica.StoreApplicationVisibility(otherRepo, appName, true)
+		gomega.Expect(err).Should(gomega.Succeed())
+		err = replica.StoreApplication(otherRepo, appName, "latest", files)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		// the key created by each replica does not overwrite the key of the other one
+		for _, reader := range []StorageManager{manager, replica} {
+			_, err = reader.GetApplication(repo, appName, "latest", entities.DownloadFormatNone)
+			gomega.Expect(err).Should(gomega.Succeed())
+			_, err = reader.GetApplication(otherRepo, appName, "latest", entities.DownloadFormatNone)
+			gomega.Expect(err).Should(gomega.Succeed())
+		}
+
+		// the replica encrypts the new files with the key rotated by the other one
+		report, err := manager.(KeyRotator).RotateKeys(repo)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(report.Namespaces[0].Error).Should(gomega.BeEmpty())
+		err = replica.StoreApplication(repo, appName, "v2", files)
+		gomega.Expect(err).Should(gomega.Succeed())
+		stored, err := backend.GetApplication(repo, appName, "v2", entities.DownloadFormatNone)
+		gomega.Expect(err).Should(gomega.Succeed())
+		keyID, _, err := getKeyID(stored[0].Data)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(keyID).Should(gomega.Equal(report.Namespaces[0].KeyID))
+		expectFiles(manager, "v2")
+	})
+
+	ginkgo.It("should import the data keys of the legacy keys file", func() {
+		err := manager.StoreApplicationVisibility(repo, appName, true)
+		gomega.Expect(err).Should(gomega.Succeed())
+		err = manager.StoreApplication(repo, appName, "latest", files)
+		gomega.Expect(err).Should(gomega.Succeed())
+		stored, err := backend.GetEncryptionKeys()
+		gomega.Expect(err).Should(gomega.Succeed())
+		err = os.WriteFile(keysPath, stored, 0600)
+		gomega.Expect(err).Should(gomega.Succeed())
+		err = os.Remove(filepath.Join(keysDir, "repository", encryptionKeysFile))
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		imported, err := NewEncryptedStorageManager(backend, masterKeyPath, keysPath)
+		gomega.Expect(err).Should(gomega.Succeed())
+		expectFiles(imported, "latest")
+		stored, err = backend.GetEncryptionKeys()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(stored).ShouldNot(gomega.BeNil())
+	})
+
+	ginkgo.It("should not load the data keys without their master key", func() {
+		err := manager.StoreApplicationVisibility(repo, appName, true)
+		gomega.Expect(err).Should(gomega.Succeed())
+		err = manager.StoreApplication(repo, appName, "latest", files)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		err = os.WriteFile(masterKeyPath, []byte(newMasterKey()), 0600)
+		gomega.Expect(err).Should(gomega.Succeed())
+		_, err = NewEncryptedStorageManager(backend, masterKeyPath, keysPath)
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.It("should not load an invalid master key", func() {
+		err := os.WriteFile(masterKeyPath, []byte(strings.Repeat("a", 10)), 0600)
+		gomega.Expect(err).Should(gomega.Succeed())
+		_, err = NewEncryptedStorageManager(backend, masterKeyPath, keysPath)
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+})
@@ -0,0 +1,461 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// encryptionKeySize with the size of the master and data keys, AES-256 is used
+	encryptionKeySize = 32
+	// encryptionKeysFile with the name of the file (under the storage base path) with the data keys of the namespaces.
+	// It starts with a dot to avoid collisions with the namespaces.
+	encryptionKeysFile = ".encryption-keys.json"
+	// encryptionKeysLockFile with the name of the file (under the storage base path) locked while the keys change
+	encryptionKeysLockFile = ".encryption-keys.lock"
+)
+
+// newAEAD returns the AES-GCM cipher of a key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "invalid encryption key")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "invalid encryption key")
+	}
+	return aead, nil
+}
+
+// seal encrypts data with a random nonce, the nonce is returned before the ciphertext
+func seal(aead cipher.AEAD, data []byte, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "unable to generate the nonce")
+	}
+	return aead.Seal(nonce, nonce, data, additionalData), nil
+}
+
+// open decrypts the data encrypted by seal
+func open(aead cipher.AEAD, data []byte, additionalData []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, nerrors.NewDataLossError("encrypted data too short")
+	}
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], additionalData)
+	if err != nil {
+		return nil, nerrors.NewDataLossErrorFrom(err, "unable to decrypt the data")
+	}
+	return plain, nil
+}
+
+// masterKey with a key that wraps the data keys of the namespaces
+type masterKey struct {
+	// ID with the identifier of the key, derived from its content
+	ID   string
+	aead cipher.AEAD
+}
+
+// loadMasterKeys reads the master keys from a file with a base64 encoded key of 32 bytes per line. The first key
+// is the active one, the following ones are previous keys only used to unwrap the data keys until they are rotated.
+// Empty lines and lines starting with # are ignored.
+func loadMasterKeys(path string) ([]*masterKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nerrors.NewFailedPreconditionErrorFrom(err, "unable to read the master key file")
+	}
+	keys := make([]*masterKey, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(line)
+		if err != nil || len(key) != encryptionKeySize {
+			return nil, nerrors.NewFailedPreconditionError("invalid master key in line %d, it must be a base64 encoded key of %d bytes", len(keys)+1, encryptionKeySize)
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(key)
+		keys = append(keys, &masterKey{ID: hex.EncodeToString(sum[:8]), aead: aead})
+	}
+	if len(keys) == 0 {
+		return nil, nerrors.NewFailedPreconditionError("the master key file does not contain any key")
+	}
+	return keys, nil
+}
+
+// dataKey with a key that encrypts the files of the private applications of a namespace
+type dataKey struct {
+	// ID with the identifier of the key
+	ID   string
+	key  []byte
+	aead cipher.AEAD
+}
+
+// storedDataKey with a data key wrapped by a master key as it is stored in the keys file
+type storedDataKey struct {
+	// ID with the identifier of the data key
+	ID string
+	// MasterKeyID with the identifier of the master key that wraps the data key
+	MasterKeyID string
+	// WrappedKey with the data key encrypted with the master key
+	WrappedKey []byte
+}
+
+// keyRing manages the data keys of the namespaces. The keys are stored with the applications in a JSON file wrapped
+// by a master key, so all the replicas share them. The last key of each namespace is the one used to encrypt new files.
+// The keys are read again when the file changes, and every change is a read-modify-write exclusive among the replicas.
+type keyRing struct {
+	// store with the storage manager that stores the keys file
+	store StorageManager
+	// masterKeys with the master keys, the first one is the active one
+	masterKeys []*masterKey
+	// keys with the unwrapped keys of each namespace
+	keys map[string][]*dataKey
+	// loaded with the content of the keys file the keys were read from
+	loaded []byte
+	// Mutex to protect the keys
+	sync.Mutex
+}
+
+// newKeyRing loads the master keys and unwraps the data keys stored in store. The data keys of the legacy keys file
+// are imported if the storage has no keys.
+func newKeyRing(store StorageManager, masterKeyPath string, legacyKeysPath string) (*keyRing, error) {
+	masterKeys, err := loadMasterKeys(masterKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	ring := &keyRing{store: store, masterKeys: masterKeys, keys: make(map[string][]*dataKey)}
+	if err = ring.reload(); err != nil {
+		return nil, err
+	}
+	if ring.loaded != nil || legacyKeysPath == "" {
+		return ring, nil
+	}
+	legacy, err := os.ReadFile(legacyKeysPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ring, nil
+		}
+		return nil, nerrors.NewInternalErrorFrom(err, "unable to read the encryption keys")
+	}
+	if _, err = ring.decode(legacy); err != nil {
+		return nil, err
+	}
+	if err = ring.update(func(keys map[string][]*dataKey) error { return nil }, legacy); err != nil {
+		return nil, err
+	}
+	return ring, nil
+}
+
+// activeMasterKey returns the master key used to wrap the data keys
+func (k *keyRing) activeMasterKey() *masterKey {
+	return k.masterKeys[0]
+}
+
+// wrapAdditionalData returns the additional data that binds a wrapped key to its namespace
+func wrapAdditionalData(namespace string, id string) []byte {
+	return []byte(namespace + "/" + id)
+}
+
+// unwrap decrypts a stored data key
+func (k *keyRing) unwrap(namespace string, stored *storedDataKey) (*dataKey, error) {
+	for _, master := range k.masterKeys {
+		if master.ID != stored.MasterKeyID {
+			continue
+		}
+		key, err := open(master.aead, stored.WrappedKey, wrapAdditionalData(namespace, stored.ID))
+		if err != nil {
+			return nil, err
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+		return &dataKey{ID: stored.ID, key: key, aead: aead}, nil
+	}
+	return nil, nerrors.NewFailedPreconditionError("the data key %s of %s is wrapped by the unknown master key %s", stored.ID, namespace, stored.MasterKeyID)
+}
+
+// decode unwraps the data keys of the content of a keys file, nil content has no keys
+func (k *keyRing) decode(data []byte) (map[string][]*dataKey, error) {
+	keys := make(map[string][]*dataKey)
+	if data == nil {
+		return keys, nil
+	}
+	stored := make(map[string][]*storedDataKey)
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, nerrors.NewDataLossErrorFrom(err, "invalid encryption keys file")
+	}
+	for namespace, namespaceKeys := range stored {
+		for _, storedKey := range namespaceKeys {
+			key, err := k.unwrap(namespace, storedKey)
+			if err != nil {
+				return nil, err
+			}
+			keys[namespace] = append(keys[namespace], key)
+		}
+	}
+	return keys, nil
+}
+
+// encode returns the content of the keys file with all the data keys wrapped by the active master key
+func (k *keyRing) encode(keys map[string][]*dataKey) ([]byte, error) {
+	master := k.activeMasterKey()
+	stored := make(map[string][]*storedDataKey, len(keys))
+	for namespace, namespaceKeys := range keys {
+		for _, key := range namespaceKeys {
+			wrapped, err := seal(master.aead, key.key, wrapAdditionalData(namespace, key.ID))
+			if err != nil {
+				return nil, err
+			}
+			stored[namespace] = append(stored[namespace], &storedDataKey{ID: key.ID, MasterKeyID: master.ID, WrappedKey: wrapped})
+		}
+	}
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "unable to write the encryption keys")
+	}
+	return data, nil
+}
+
+// reload reads the keys file again if it has been changed, the caller must hold the lock
+func (k *keyRing) reload() error {
+	data, err := k.store.GetEncryptionKeys()
+	if err != nil {
+		return err
+	}
+	if k.loaded != nil && bytes.Equal(data, k.loaded) {
+		return nil
+	}
+	keys, err := k.decode(data)
+	if err != nil {
+		return err
+	}
+	k.keys = keys
+	k.loaded = data
+	return nil
+}
+
+// update changes the data keys read from the stored keys file (or from initial if it is not stored) and stores them.
+// The keys in memory are only replaced once they are stored. The caller must hold the lock.
+func (k *keyRing) update(change func(keys map[string][]*dataKey) error, initial []byte) error {
+	var keys map[string][]*dataKey
+	var data []byte
+	err := k.store.UpdateEncryptionKeys(func(current []byte) ([]byte, error) {
+		if current == nil {
+			current = initial
+		}
+		var err error
+		if keys, err = k.decode(current); err != nil {
+			return nil, err
+		}
+		if err = change(keys); err != nil {
+			return nil, err
+		}
+		data, err = k.encode(keys)
+		return data, err
+	})
+	if err != nil {
+		return err
+	}
+	k.keys = keys
+	k.loaded = data
+	return nil
+}
+
+// addKey creates a new data key for a namespace, it becomes the active key of the namespace.
+// The caller must hold the lock.
+func (k *keyRing) addKey(namespace string) (*dataKey, error) {
+	key := make([]byte, encryptionKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "unable to generate the data key")
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	created := &dataKey{ID: xid.New().String(), key: key, aead: aead}
+	if err = k.update(func(keys map[string][]*dataKey) error {
+		keys[namespace] = append(keys[namespace], created)
+		return nil
+	}, nil); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// GetActiveKey returns the key used to encrypt the files of a namespace, it is created if the namespace has no keys.
+// The keys are read again first, so a key rotated by another replica is not used.
+func (k *keyRing) GetActiveKey(namespace string) (*dataKey, error) {
+	k.Lock()
+	defer k.Unlock()
+	if err := k.reload(); err != nil {
+		return nil, err
+	}
+	if keys := k.keys[namespace]; len(keys) > 0 {
+		return keys[len(keys)-1], nil
+	}
+	return k.addKey(namespace)
+}
+
+// GetKey returns a data key of a namespace. The keys are read again if it is not found, it may have been
+// created by another replica.
+func (k *keyRing) GetKey(namespace string, id string) (*dataKey, error) {
+	k.Lock()
+	defer k.Unlock()
+	if key := k.findKey(namespace, id); key != nil {
+		return key, nil
+	}
+	if err := k.reload(); err != nil {
+		return nil, err
+	}
+	if key := k.findKey(namespace, id); key != nil {
+		return key, nil
+	}
+	return nil, nerrors.NewNotFoundError("data key %s of %s not found", id, namespace)
+}
+
+// findKey returns a data key of a namespace loaded in memory, nil if it is not found. The caller must hold the lock.
+func (k *keyRing) findKey(namespace string, id string) *dataKey {
+	for _, key := range k.keys[namespace] {
+		if key.ID == id {
+			return key
+		}
+	}
+	return nil
+}
+
+// AddKey creates a new active data key for a namespace. The previous keys are kept to decrypt the files
+// until they are removed with RetainKey.
+func (k *keyRing) AddKey(namespace string) (*dataKey, error) {
+	k.Lock()
+	defer k.Unlock()
+	return k.addKey(namespace)
+}
+
+// RetainKey removes all the data keys of a namespace except the given one
+func (k *keyRing) RetainKey(namespace string, id string) error {
+	k.Lock()
+	defer k.Unlock()
+	return k.update(func(keys map[string][]*dataKey) error {
+		retained := make([]*dataKey, 0, 1)
+		for _, key := range keys[namespace] {
+			if key.ID == id {
+				retained = append(retained, key)
+			}
+		}
+		keys[namespace] = retained
+		return nil
+	}, nil)
+}
+
+// Namespaces returns the namespaces with data keys
+func (k *keyRing) Namespaces() ([]string, error) {
+	k.Lock()
+	defer k.Unlock()
+	if err := k.reload(); err != nil {
+		return nil, err
+	}
+	namespaces := make([]string, 0, len(k.keys))
+	for namespace := range k.keys {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+// getEncryptionKeysPath returns the path of the encryption keys file
+func (s *storageManager) getEncryptionKeysPath() string {
+	return filepath.Join(s.basePath, encryptionKeysFile)
+}
+
+// GetEncryptionKeys returns the content of the encryption keys file, nil if it was not stored
+func (s *storageManager) GetEncryptionKeys() ([]byte, error) {
+	data, err := os.ReadFile(s.getEncryptionKeysPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, nerrors.NewInternalErrorFrom(err, "unable to read the encryption keys")
+	}
+	return data, nil
+}
+
+// UpdateEncryptionKeys replaces the encryption keys file holding a lock file, so the replicas that share the volume
+// do not overwrite the keys added by the others. The file is replaced atomically.
+func (s *storageManager) UpdateEncryptionKeys(update func(current []byte) ([]byte, error)) error {
+	s.keysLock.Lock()
+	defer s.keysLock.Unlock()
+	if err := s.createDirectory(s.basePath); err != nil {
+		return err
+	}
+	lock, err := os.OpenFile(filepath.Join(s.basePath, encryptionKeysLockFile), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nerrors.NewInternalErrorFrom(err, "unable to open the encryption keys lock")
+	}
+	defer lock.Close()
+	if err = lockFile(lock); err != nil {
+		return nerrors.NewInternalErrorFrom(err, "unable to lock the encryption keys")
+	}
+	defer func() {
+		if err := unlockFile(lock); err != nil {
+			log.Warn().Err(err).Msg("unable to unlock the encryption keys")
+		}
+	}()
+
+	current, err := s.GetEncryptionKeys()
+	if err != nil {
+		return err
+	}
+	data, err := update(current)
+	if err != nil {
+		return err
+	}
+	keysPath := s.getEncryptionKeysPath()
+	tmp := keysPath + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return nerrors.NewInternalErrorFrom(err, "unable to write the encryption keys")
+	}
+	if err = os.Rename(tmp, keysPath); err != nil {
+		_ = os.Remove(tmp)
+		return nerrors.NewInternalErrorFrom(err, "unable to write the encryption keys")
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+//go:build !linux
+// +build !linux
+
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package storage
+
+import "errors"
+
+// exchangeDirectories is not supported outside Linux, the caller falls back to two renames
+func exchangeDirectories(oldPath string, newPath string) error {
+	return errors.New("atomic exchange not supported")
+}
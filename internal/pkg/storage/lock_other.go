@@ -0,0 +1,37 @@
+//go:build !linux
+// +build !linux
+
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package storage
+
+import "os"
+
+// lockFile does not lock the file outside Linux, the process lock is the only protection so the volume cannot be
+// shared by several replicas
+func lockFile(file *os.File) error {
+	return nil
+}
+
+// unlockFile does nothing outside Linux
+func lockFileShared(file *os.File) error {
+	return nil
+}
+
+func unlockFile(file *os.File) error {
+	return nil
+}
@@ -0,0 +1,374 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/nerrors/pkg/nerrors"
+)
+
+// memoryTag with the files of an application tag stored in memory
+type memoryTag struct {
+	// files with the application files with their paths relative to the application
+	files []*entities.FileInfo
+	// artifact with the precomputed tgz of the application
+	artifact []byte
+	// stored with the time when the tag was stored
+	stored time.Time
+}
+
+// memoryApplication with the tags of an application stored in memory
+type memoryApplication struct {
+	// tags with the application tags indexed by name
+	tags map[string]*memoryTag
+	// visibility with the visibility stored of the application, nil if it was not stored
+	visibility *bool
+}
+
+// memoryStorageManager stores the applications in memory, so the applications are lost when the service stops.
+// It behaves as the filesystem storage manager: the repositories without applications are kept until an
+// application is removed, and the visibility of an application is removed with its last tag.
+type memoryStorageManager struct {
+	// repositories with the applications of each repository indexed by name
+	repositories map[string]map[string]*memoryApplication
+	// quotas with the quota overrides indexed by namespace
+	quotas map[string]entities.Quota
+	// encryptionKeys with the content of the encryption keys file
+	encryptionKeys []byte
+	// RWMutex to protect the repositories
+	sync.RWMutex
+}
+
+// NewMemoryStorageManager returns an empty StorageManager that stores the applications in memory
+func NewMemoryStorageManager() StorageManager {
+	return &memoryStorageManager{
+		repositories: make(map[string]map[string]*memoryApplication),
+		quotas:       make(map[string]entities.Quota),
+	}
+}
+
+// getTag returns a tag of an application, nil if it does not exist. The caller must hold the lock.
+func (m *memoryStorageManager) getTag(repo string, name string, version string) *memoryTag {
+	app, exists := m.repositories[repo][name]
+	if !exists {
+		return nil
+	}
+	return app.tags[version]
+}
+
+// getApplication returns an application creating it if it does not exist. The caller must hold the lock.
+func (m *memoryStorageManager) getApplication(repo string, name string) *memoryApplication {
+	if _, exists := m.repositories[repo]; !exists {
+		m.repositories[repo] = make(map[string]*memoryApplication)
+	}
+	app, exists := m.repositories[repo][name]
+	if !exists {
+		app = &memoryApplication{tags: make(map[string]*memoryTag)}
+		m.repositories[repo][name] = app
+	}
+	return app
+}
+
+// copyFiles returns a copy of the application files with their paths cleaned, the paths cannot be absolute
+// or point outside the application
+func copyFiles(files []*entities.FileInfo) ([]*entities.FileInfo, error) {
+	copied := make([]*entities.FileInfo, 0, len(files))
+	for _, file := range files {
+		filePath := path.Clean(file.Path)
+		if path.IsAbs(filePath) || filePath == "." || filePath == ".." || strings.HasPrefix(filePath, "../") {
+			return nil, nerrors.NewFailedPreconditionError("invalid application file path [%s]", file.Path)
+		}
+		copied = append(copied, &entities.FileInfo{Path: filePath, Data: append([]byte{}, file.Data...)})
+	}
+	sort.Slice(copied, func(i, j int) bool {
+		return copied[i].Path < copied[j].Path
+	})
+	return copied, nil
+}
+
+// StoreApplication save all files in their corresponding path, the precomputed tgz is created with them
+func (m *memoryStorageManager) StoreApplication(repo string, name string, version string, files []*entities.FileInfo) error {
+	if err := checkReservedPaths(files); err != nil {
+		return err
+	}
+	copied, err := copyFiles(files)
+	if err != nil {
+		return err
+	}
+	artifact, _, err := buildArtifact(name, copied)
+	if err != nil {
+		return err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	m.getApplication(repo, name).tags[version] = &memoryTag{files: copied, artifact: artifact, stored: time.Now()}
+	return nil
+}
+
+// GetApplication returns the application files, or a single file with the application archive in the given format
+func (m *memoryStorageManager) GetApplication(repo string, name string, version string, format entities.DownloadFormat) ([]*entities.FileInfo, error) {
+	if format.IsArchive() {
+		stream, err := m.GetApplicationStream(repo, name, version, format)
+		if err != nil {
+			return nil, err
+		}
+		return readStream(name, format, stream)
+	}
+
+	m.RLock()
+	defer m.RUnlock()
+	tag := m.getTag(repo, name, version)
+	if tag == nil {
+		return nil, nerrors.NewNotFoundError("Application not found")
+	}
+	files := make([]*entities.FileInfo, 0, len(tag.files))
+	for _, file := range tag.files {
+		files = append(files, &entities.FileInfo{
+			Path: fmt.Sprintf("./%s/%s", name, file.Path),
+			Data: append([]byte{}, file.Data...),
+		})
+	}
+	return files, nil
+}
+
+// GetApplicationStream returns the application archive. The tgz is the precomputed one, the other formats
+// are generated while they are read.
+func (m *memoryStorageManager) GetApplicationStream(repo string, name string, version string, format entities.DownloadFormat) (io.ReadCloser, error) {
+	if err := checkArchiveFormat(format); err != nil {
+		return nil, err
+	}
+
+	m.RLock()
+	defer m.RUnlock()
+	tag := m.getTag(repo, name, version)
+	if tag == nil {
+		return nil, nerrors.NewNotFoundError("Application not found")
+	}
+	// the stored tags are not modified, a new version replaces the whole tag
+	if format == entities.DownloadFormatTgz {
+		return io.NopCloser(bytes.NewReader(tag.artifact)), nil
+	}
+	return streamArchive(format, name, newMemoryEntries(tag.files), func() {}), nil
+}
+
+// RemoveApplication removes an application, returns an error if it does not exist
+func (m *memoryStorageManager) RemoveApplication(repo string, name string, version string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.getTag(repo, name, version) == nil {
+		return nerrors.NewNotFoundError("unable to delete application")
+	}
+	app := m.repositories[repo][name]
+	delete(app.tags, version)
+	if len(app.tags) == 0 {
+		delete(m.repositories[repo], name)
+	}
+	if len(m.repositories[repo]) == 0 {
+		delete(m.repositories, repo)
+	}
+	return nil
+}
+
+// ApplicationExists checks if an application exists
+func (m *memoryStorageManager) ApplicationExists(repo string, name string, version string) (bool, error) {
+	m.RLock()
+	defer m.RUnlock()
+	return m.getTag(repo, name, version) != nil, nil
+}
+
+// GetApplicationUpdateTime returns the time when the files of an application tag were stored
+func (m *memoryStorageManager) GetApplicationUpdateTime(repo string, name string, version string) (time.Time, error) {
+	m.RLock()
+	defer m.RUnlock()
+	tag := m.getTag(repo, name, version)
+	if tag == nil {
+		return time.Time{}, nerrors.NewNotFoundError("Application not found")
+	}
+	return tag.stored, nil
+}
+
+// CreateRepository creates an empty repository if it does not exist
+func (m *memoryStorageManager) CreateRepository(name string) error {
+	m.Lock()
+	defer m.Unlock()
+	if _, exists := m.repositories[name]; !exists {
+		m.repositories[name] = make(map[string]*memoryApplication)
+	}
+	return nil
+}
+
+// RepositoryExists checks if a repository exists
+func (m *memoryStorageManager) RepositoryExists(name string) (bool, error) {
+	m.RLock()
+	defer m.RUnlock()
+	_, exists := m.repositories[name]
+	return exists, nil
+}
+
+// RemoveRepository removes the repository with ALL its applications
+func (m *memoryStorageManager) RemoveRepository(name string) error {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.repositories, name)
+	return nil
+}
+
+// GetRepositoryUsage returns the size of the application files of each tag stored in a repository.
+// The precomputed tgz is not included.
+func (m *memoryStorageManager) GetRepositoryUsage(name string) ([]*entities.TagUsage, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	usage := make([]*entities.TagUsage, 0)
+	for appName, app := range m.repositories[name] {
+		for version, tag := range app.tags {
+			var size int64
+			for _, file := range tag.files {
+				size += int64(len(file.Data))
+			}
+			usage = append(usage, &entities.TagUsage{ApplicationName: appName, Tag: version, Bytes: size})
+		}
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].ApplicationName != usage[j].ApplicationName {
+			return usage[i].ApplicationName < usage[j].ApplicationName
+		}
+		return usage[i].Tag < usage[j].Tag
+	})
+	return usage, nil
+}
+
+// ListRepositories returns the names of the repositories stored
+func (m *memoryStorageManager) ListRepositories() ([]string, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	repositories := make([]string, 0, len(m.repositories))
+	for name := range m.repositories {
+		repositories = append(repositories, name)
+	}
+	sort.Strings(repositories)
+	return repositories, nil
+}
+
+// ListApplications returns the application tags stored in a repository
+func (m *memoryStorageManager) ListApplications(repo string) ([]*entities.ApplicationID, error) {
+	usage, err := m.GetRepositoryUsage(repo)
+	if err != nil {
+		return nil, err
+	}
+	applications := make([]*entities.ApplicationID, 0, len(usage))
+	for _, tag := range usage {
+		applications = append(applications, &entities.ApplicationID{Namespace: repo, ApplicationName: tag.ApplicationName, Tag: tag.Tag})
+	}
+	return applications, nil
+}
+
+// StoreApplicationVisibility stores the visibility of an application
+func (m *memoryStorageManager) StoreApplicationVisibility(repo string, name string, isPrivate bool) error {
+	m.Lock()
+	defer m.Unlock()
+	m.getApplication(repo, name).visibility = &isPrivate
+	return nil
+}
+
+// GetApplicationVisibility returns the visibility stored of an application, nil if it was not stored
+func (m *memoryStorageManager) GetApplicationVisibility(repo string, name string) (*bool, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	app, exists := m.repositories[repo][name]
+	if !exists || app.visibility == nil {
+		return nil, nil
+	}
+	private := *app.visibility
+	return &private, nil
+}
+
+// StoreQuotaOverride stores the quota override of a namespace
+func (m *memoryStorageManager) StoreQuotaOverride(namespace string, quota entities.Quota) error {
+	m.Lock()
+	defer m.Unlock()
+	m.quotas[namespace] = quota
+	return nil
+}
+
+// GetQuotaOverride returns the quota override of a namespace, nil if it has no override
+func (m *memoryStorageManager) GetQuotaOverride(namespace string) (*entities.Quota, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	quota, exists := m.quotas[namespace]
+	if !exists {
+		return nil, nil
+	}
+	return &quota, nil
+}
+
+// RemoveQuotaOverride removes the quota override of a namespace, returns an error if it does not exist
+func (m *memoryStorageManager) RemoveQuotaOverride(namespace string) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if _, exists := m.quotas[namespace]; !exists {
+		return nerrors.NewNotFoundError("namespace %s has no quota override", namespace)
+	}
+	delete(m.quotas, namespace)
+	return nil
+}
+
+// ListQuotaOverrides returns the quota overrides indexed by namespace
+func (m *memoryStorageManager) ListQuotaOverrides() (map[string]entities.Quota, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	overrides := make(map[string]entities.Quota, len(m.quotas))
+	for namespace, quota := range m.quotas {
+		overrides[namespace] = quota
+	}
+	return overrides, nil
+}
+
+// GetEncryptionKeys returns the content of the encryption keys file, nil if it was not stored
+func (m *memoryStorageManager) GetEncryptionKeys() ([]byte, error) {
+	m.RLock()
+	defer m.RUnlock()
+	return m.encryptionKeys, nil
+}
+
+// UpdateEncryptionKeys replaces the content of the encryption keys file with the one returned by update
+func (m *memoryStorageManager) UpdateEncryptionKeys(update func(current []byte) ([]byte, error)) error {
+	m.Lock()
+	defer m.Unlock()
+	data, err := update(m.encryptionKeys)
+	if err != nil {
+		return err
+	}
+	m.encryptionKeys = data
+	return nil
+}
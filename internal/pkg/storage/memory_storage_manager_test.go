@@ -0,0 +1,127 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package storage
+
+import (
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Memory storage test", func() {
+
+	var manager StorageManager
+	files := []*entities.FileInfo{
+		{Path: "components/component1.yaml", Data: []byte("component1")},
+		{Path: "app_config.yaml", Data: []byte("appconf")}}
+
+	ginkgo.BeforeEach(func() {
+		manager = NewMemoryStorageManager()
+	})
+
+	ginkgo.It("should return the files that were stored", func() {
+		err := manager.StoreApplication("repo", "app", "latest", files)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		returned, err := manager.GetApplication("repo", "app", "latest", entities.DownloadFormatNone)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(returned).Should(gomega.Equal([]*entities.FileInfo{
+			{Path: "./app/app_config.yaml", Data: []byte("appconf")},
+			{Path: "./app/components/component1.yaml", Data: []byte("component1")}}))
+
+		for _, format := range []entities.DownloadFormat{entities.DownloadFormatTgz, entities.DownloadFormatZip, entities.DownloadFormatTarZstd} {
+			archive, err := manager.GetApplication("repo", "app", "latest", format)
+			gomega.Expect(err).Should(gomega.Succeed())
+			expected, err := compressFiles("app", format, files)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(archive).Should(gomega.Equal(expected))
+		}
+	})
+
+	ginkgo.It("should replace a tag and not share the stored files", func() {
+		stored := []*entities.FileInfo{{Path: "app_config.yaml", Data: []byte("old")}}
+		err := manager.StoreApplication("repo", "app", "latest", stored)
+		gomega.Expect(err).Should(gomega.Succeed())
+		stored[0].Data[0] = 'x'
+		returned, err := manager.GetApplication("repo", "app", "latest", entities.DownloadFormatNone)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(returned[0].Data).Should(gomega.Equal([]byte("old")))
+
+		err = manager.StoreApplication("repo", "app", "latest", []*entities.FileInfo{{Path: "app_config.yaml", Data: []byte("new")}})
+		gomega.Expect(err).Should(gomega.Succeed())
+		returned, err = manager.GetApplication("repo", "app", "latest", entities.DownloadFormatNone)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(returned[0].Data).Should(gomega.Equal([]byte("new")))
+	})
+
+	ginkgo.It("should reject the paths outside the application", func() {
+		for _, filePath := range []string{"../other/app_config.yaml", "/etc/passwd", artifactFile} {
+			err := manager.StoreApplication("repo", "app", "latest", []*entities.FileInfo{{Path: filePath, Data: []byte("data")}})
+			gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.FailedPrecondition))
+		}
+	})
+
+	ginkgo.It("should list the repositories, applications and usage", func() {
+		err := manager.StoreApplication("repo", "app", "v1", files)
+		gomega.Expect(err).Should(gomega.Succeed())
+		err = manager.StoreApplication("repo", "app", "v2", files[:1])
+		gomega.Expect(err).Should(gomega.Succeed())
+		err = manager.CreateRepository("empty")
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		repositories, err := manager.ListRepositories()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(repositories).Should(gomega.Equal([]string{"empty", "repo"}))
+
+		applications, err := manager.ListApplications("repo")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(applications).Should(gomega.Equal([]*entities.ApplicationID{
+			{Namespace: "repo", ApplicationName: "app", Tag: "v1"},
+			{Namespace: "repo", ApplicationName: "app", Tag: "v2"}}))
+
+		usage, err := manager.GetRepositoryUsage("repo")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(usage).Should(gomega.Equal([]*entities.TagUsage{
+			{ApplicationName: "app", Tag: "v1", Bytes: 17},
+			{ApplicationName: "app", Tag: "v2", Bytes: 10}}))
+	})
+
+	ginkgo.It("should remove the visibility and the repository with the last tag", func() {
+		err := manager.StoreApplication("repo", "app", "v1", files)
+		gomega.Expect(err).Should(gomega.Succeed())
+		err = manager.StoreApplicationVisibility("repo", "app", true)
+		gomega.Expect(err).Should(gomega.Succeed())
+		private, err := manager.GetApplicationVisibility("repo", "app")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(*private).Should(gomega.BeTrue())
+
+		err = manager.RemoveApplication("repo", "app", "v2")
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.NotFound))
+		err = manager.RemoveApplication("repo", "app", "v1")
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		private, err = manager.GetApplicationVisibility("repo", "app")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(private).Should(gomega.BeNil())
+		exists, err := manager.RepositoryExists("repo")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(exists).Should(gomega.BeFalse())
+		_, err = manager.GetApplication("repo", "app", "v1", entities.DownloadFormatNone)
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.NotFound))
+	})
+})
@@ -0,0 +1,150 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog/log"
+)
+
+// quotasDirectory with the name of the directory (under basePath) with the quota overrides of the namespaces, one
+// file per namespace. It is stored with the applications so all the replicas share the same overrides.
+const quotasDirectory = ".quotas"
+
+// quotaFileExtension with the extension of the quota override files
+const quotaFileExtension = ".json"
+
+// checkQuotaNamespace returns an error if the namespace cannot be used as the name of a quota override
+func checkQuotaNamespace(namespace string) error {
+	if namespace == "" || strings.HasPrefix(namespace, ".") || strings.ContainsAny(namespace, "/\\") {
+		return nerrors.NewInvalidArgumentError("invalid namespace [%s]", namespace)
+	}
+	return nil
+}
+
+// encodeQuota returns the content of a quota override file
+func encodeQuota(quota entities.Quota) ([]byte, error) {
+	data, err := json.Marshal(quota)
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "unable to encode the namespace quota")
+	}
+	return data, nil
+}
+
+// decodeQuota parses the content of a quota override file
+func decodeQuota(data []byte) (*entities.Quota, error) {
+	var quota entities.Quota
+	if err := json.Unmarshal(data, &quota); err != nil {
+		return nil, nerrors.NewDataLossErrorFrom(err, "unable to read the namespace quota")
+	}
+	return &quota, nil
+}
+
+// getQuotaPath returns the path of the quota override file of a namespace
+func (s *storageManager) getQuotaPath(namespace string) string {
+	return filepath.Join(s.basePath, quotasDirectory, namespace+quotaFileExtension)
+}
+
+// StoreQuotaOverride stores the quota override of a namespace. The file is replaced atomically.
+func (s *storageManager) StoreQuotaOverride(namespace string, quota entities.Quota) error {
+	if err := checkQuotaNamespace(namespace); err != nil {
+		return err
+	}
+	data, err := encodeQuota(quota)
+	if err != nil {
+		return err
+	}
+	quotaPath := s.getQuotaPath(namespace)
+	if err = s.createDirectory(filepath.Dir(quotaPath)); err != nil {
+		return err
+	}
+	tmp := quotaPath + ".tmp"
+	if err = writeFileSync(tmp, data); err != nil {
+		log.Err(err).Str("namespace", namespace).Msg("error storing namespace quota")
+		return err
+	}
+	if err = os.Rename(tmp, quotaPath); err != nil {
+		log.Err(err).Str("namespace", namespace).Msg("error storing namespace quota")
+		_ = os.Remove(tmp)
+		return nerrors.FromError(err)
+	}
+	return nil
+}
+
+// GetQuotaOverride returns the quota override of a namespace, nil if it has no override
+func (s *storageManager) GetQuotaOverride(namespace string) (*entities.Quota, error) {
+	if err := checkQuotaNamespace(namespace); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(s.getQuotaPath(namespace))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, nerrors.FromError(err)
+	}
+	return decodeQuota(data)
+}
+
+// RemoveQuotaOverride removes the quota override of a namespace, returns an error if it does not exist
+func (s *storageManager) RemoveQuotaOverride(namespace string) error {
+	if err := checkQuotaNamespace(namespace); err != nil {
+		return err
+	}
+	if err := os.Remove(s.getQuotaPath(namespace)); err != nil {
+		if os.IsNotExist(err) {
+			return nerrors.NewNotFoundError("namespace %s has no quota override", namespace)
+		}
+		log.Err(err).Str("namespace", namespace).Msg("error removing namespace quota")
+		return nerrors.FromError(err)
+	}
+	return nil
+}
+
+// ListQuotaOverrides returns the quota overrides indexed by namespace
+func (s *storageManager) ListQuotaOverrides() (map[string]entities.Quota, error) {
+	overrides := make(map[string]entities.Quota)
+	entries, err := os.ReadDir(filepath.Join(s.basePath, quotasDirectory))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return overrides, nil
+		}
+		log.Err(err).Msg("error listing namespace quotas")
+		return nil, nerrors.FromError(err)
+	}
+	for _, entry := range entries {
+		// the temporary files of the overrides being written are skipped
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), quotaFileExtension) {
+			continue
+		}
+		namespace := strings.TrimSuffix(entry.Name(), quotaFileExtension)
+		quota, err := s.GetQuotaOverride(namespace)
+		if err != nil {
+			return nil, err
+		}
+		if quota != nil {
+			overrides[namespace] = *quota
+		}
+	}
+	return overrides, nil
+}
@@ -0,0 +1,402 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/napptive/catalog-manager/internal/pkg/config"
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// s3Timeout with the maximum duration of a request to the object storage
+	s3Timeout = time.Minute
+	// s3DateFormat with the format of the x-amz-date header
+	s3DateFormat = "20060102T150405Z"
+	// s3Algorithm with the signing algorithm
+	s3Algorithm = "AWS4-HMAC-SHA256"
+	// s3Service with the service name used in the credential scope
+	s3Service = "s3"
+)
+
+// s3Object with the information of an object returned by a list operation
+type s3Object struct {
+	Key          string    `xml:"Key"`
+	Size         int64     `xml:"Size"`
+	LastModified time.Time `xml:"LastModified"`
+}
+
+// s3CommonPrefix with a key prefix returned by a list operation with a delimiter
+type s3CommonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+// listBucketResult with the response of the ListObjectsV2 operation
+type listBucketResult struct {
+	Contents              []s3Object       `xml:"Contents"`
+	CommonPrefixes        []s3CommonPrefix `xml:"CommonPrefixes"`
+	IsTruncated           bool             `xml:"IsTruncated"`
+	NextContinuationToken string           `xml:"NextContinuationToken"`
+}
+
+// s3Error with the error document returned by the object storage
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// s3Client is a minimal client of the S3 REST API that signs the requests with AWS Signature Version 4.
+// Only the operations required by the storage manager are implemented.
+type s3Client struct {
+	cfg      config.S3Config
+	endpoint *url.URL
+	client   *http.Client
+	// streamClient sends the requests whose body is read while it is streamed, only the response headers
+	// are limited by s3Timeout
+	streamClient *http.Client
+	// now returns the signing time, it is replaced in the tests
+	now func() time.Time
+}
+
+// newS3Client creates a client for the given configuration
+func newS3Client(cfg config.S3Config) (*s3Client, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, nerrors.NewFailedPreconditionErrorFrom(err, "invalid S3 endpoint")
+	}
+	if endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, nerrors.NewFailedPreconditionError("invalid S3 endpoint [%s]", cfg.Endpoint)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = s3Timeout
+	return &s3Client{
+		cfg:          cfg,
+		endpoint:     endpoint,
+		client:       &http.Client{Timeout: s3Timeout},
+		streamClient: &http.Client{Transport: transport},
+		now:          time.Now,
+	}, nil
+}
+
+// objectURL returns the URL of an object (or of the bucket if key is empty)
+func (c *s3Client) objectURL(key string, query url.Values) *url.URL {
+	u := *c.endpoint
+	basePath := strings.TrimSuffix(u.Path, "/")
+	if c.cfg.UsePathStyle {
+		u.Path = fmt.Sprintf("%s/%s", basePath, c.cfg.Bucket)
+		if key != "" {
+			u.Path = fmt.Sprintf("%s/%s", u.Path, key)
+		}
+	} else {
+		u.Host = fmt.Sprintf("%s.%s", c.cfg.Bucket, u.Host)
+		u.Path = fmt.Sprintf("%s/%s", basePath, key)
+	}
+	u.RawPath = ""
+	u.RawQuery = ""
+	if query != nil {
+		u.RawQuery = canonicalQuery(query)
+	}
+	return &u
+}
+
+// s3Escape encodes a string following the URI encoding rules of AWS Signature Version 4
+func s3Escape(value string, encodeSlash bool) string {
+	var buf strings.Builder
+	for _, b := range []byte(value) {
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') ||
+			b == '-' || b == '_' || b == '.' || b == '~' || (b == '/' && !encodeSlash) {
+			buf.WriteByte(b)
+		} else {
+			fmt.Fprintf(&buf, "%%%02X", b)
+		}
+	}
+	return buf.String()
+}
+
+// canonicalQuery returns the query string sorted by key and encoded
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, fmt.Sprintf("%s=%s", s3Escape(key, true), s3Escape(value, true)))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of the data
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// sign adds the Authorization header to the request. All the headers already included
+// in the request are signed.
+func (c *s3Client) sign(req *http.Request, payloadHash string) {
+	now := c.now().UTC()
+	amzDate := now.Format(s3DateFormat)
+	date := now.Format("20060102")
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(fmt.Sprintf("%s:%s\n", name, headers[name]))
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3Escape(req.URL.Path, false),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, c.cfg.Region, s3Service)
+	stringToSign := strings.Join([]string{s3Algorithm, amzDate, scope, hex.EncodeToString(requestHash[:])}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.cfg.SecretAccessKey), date)
+	key = hmacSHA256(key, c.cfg.Region)
+	key = hmacSHA256(key, s3Service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, c.cfg.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// send signs and sends a request with the given client and headers, returning the response
+func (c *s3Client) send(client *http.Client, method string, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	payloadHash := sha256.Sum256(body)
+	req, err := http.NewRequest(method, c.objectURL(key, query).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "unable to create S3 request")
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.ContentLength = int64(len(body))
+	c.sign(req, hex.EncodeToString(payloadHash[:]))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		log.Err(err).Str("method", method).Str("key", key).Msg("error sending S3 request")
+		return nil, nerrors.NewUnavailableErrorFrom(err, "unable to connect to the object storage")
+	}
+	return resp, nil
+}
+
+// responseError returns the error of an unexpected response with the given body
+func responseError(method string, key string, statusCode int, data []byte) error {
+	if statusCode == http.StatusNotFound {
+		return nerrors.NewNotFoundError("object [%s] not found", key)
+	}
+	var s3Err s3Error
+	_ = xml.Unmarshal(data, &s3Err)
+	log.Error().Str("method", method).Str("key", key).Int("status", statusCode).
+		Str("code", s3Err.Code).Str("message", s3Err.Message).Msg("unexpected S3 response")
+	return nerrors.NewInternalError("object storage error [%d] %s", statusCode, s3Err.Code)
+}
+
+// do signs and sends a request, returning the response body if the status code is the expected one
+func (c *s3Client) do(method string, key string, query url.Values, body []byte, expected ...int) ([]byte, int, error) {
+	resp, err := c.send(c.client, method, key, query, nil, body)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.StatusCode, nerrors.NewUnavailableErrorFrom(err, "unable to read the object storage response")
+	}
+	for _, code := range expected {
+		if resp.StatusCode == code {
+			return data, resp.StatusCode, nil
+		}
+	}
+	return nil, resp.StatusCode, responseError(method, key, resp.StatusCode, data)
+}
+
+// PutObject stores an object
+func (c *s3Client) PutObject(key string, data []byte) error {
+	_, _, err := c.do(http.MethodPut, key, nil, data, http.StatusOK)
+	return err
+}
+
+// GetObject returns the content of an object
+func (c *s3Client) GetObject(key string) ([]byte, error) {
+	data, _, err := c.do(http.MethodGet, key, nil, nil, http.StatusOK)
+	return data, err
+}
+
+// GetObjectStream returns a reader of the content of an object that must be closed by the caller. The content
+// is read from the object storage as the reader is consumed.
+func (c *s3Client) GetObjectStream(key string) (io.ReadCloser, error) {
+	resp, err := c.send(c.streamClient, http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return resp.Body, nil
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return nil, responseError(http.MethodGet, key, resp.StatusCode, data)
+}
+
+// GetObjectVersion returns the content of an object and its ETag, so it can be replaced only if it does not change
+func (c *s3Client) GetObjectVersion(key string) ([]byte, string, error) {
+	resp, err := c.send(c.client, http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", nerrors.NewUnavailableErrorFrom(err, "unable to read the object storage response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", responseError(http.MethodGet, key, resp.StatusCode, data)
+	}
+	return data, resp.Header.Get("ETag"), nil
+}
+
+// PutObjectIfMatch stores an object only if its ETag is etag, or only if it does not exist when etag is empty.
+// Returns an Aborted error if the object has been changed by another writer.
+func (c *s3Client) PutObjectIfMatch(key string, data []byte, etag string) error {
+	header := http.Header{}
+	if etag == "" {
+		header.Set("If-None-Match", "*")
+	} else {
+		header.Set("If-Match", etag)
+	}
+	resp, err := c.send(c.client, http.MethodPut, key, nil, header, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		// 409 is returned when a concurrent conditional write of the same key is in progress
+		return nerrors.NewAbortedError("object [%s] has been changed", key)
+	}
+	return responseError(http.MethodPut, key, resp.StatusCode, body)
+}
+
+// DeleteObject removes an object. Removing a missing object is not an error.
+func (c *s3Client) DeleteObject(key string) error {
+	_, _, err := c.do(http.MethodDelete, key, nil, nil, http.StatusNoContent, http.StatusOK, http.StatusNotFound)
+	return err
+}
+
+// ListObjects returns the objects whose key starts with prefix. If limit is greater than zero,
+// at most limit objects are returned.
+func (c *s3Client) ListObjects(prefix string, limit int) ([]s3Object, error) {
+	objects := make([]s3Object, 0)
+	token := ""
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", prefix)
+		if limit > 0 {
+			query.Set("max-keys", strconv.Itoa(limit-len(objects)))
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		data, _, err := c.do(http.MethodGet, "", query, nil, http.StatusOK)
+		if err != nil {
+			return nil, err
+		}
+		var result listBucketResult
+		if err = xml.Unmarshal(data, &result); err != nil {
+			return nil, nerrors.NewInternalErrorFrom(err, "invalid list objects response")
+		}
+		objects = append(objects, result.Contents...)
+		if !result.IsTruncated || result.NextContinuationToken == "" || (limit > 0 && len(objects) >= limit) {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// ListPrefixes returns the prefixes of the keys that start with prefix up to the next slash, as the directories
+// under prefix. The objects under them are not listed.
+func (c *s3Client) ListPrefixes(prefix string) ([]string, error) {
+	prefixes := make([]string, 0)
+	token := ""
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", prefix)
+		query.Set("delimiter", "/")
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		data, _, err := c.do(http.MethodGet, "", query, nil, http.StatusOK)
+		if err != nil {
+			return nil, err
+		}
+		var result listBucketResult
+		if err = xml.Unmarshal(data, &result); err != nil {
+			return nil, nerrors.NewInternalErrorFrom(err, "invalid list objects response")
+		}
+		for _, common := range result.CommonPrefixes {
+			prefixes = append(prefixes, common.Prefix)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return prefixes, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
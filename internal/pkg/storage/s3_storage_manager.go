@@ -0,0 +1,573 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package storage
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/napptive/catalog-manager/internal/pkg/config"
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog/log"
+)
+
+// repositoryMarker with the name of the object that marks that a repository was created
+const repositoryMarker = ".repository"
+
+// s3UpdateAttempts with the number of times a conditional write is retried when another replica changes the object
+const s3UpdateAttempts = 10
+
+// s3StorageManager stores the applications in an S3 compatible object storage.
+// Each application file is stored as an object with the key:
+//
+// <prefix>/<repo>/<app>/<tag>/<file path>
+//
+// The precomputed tgz of the application and its digest are stored as two more objects under the same prefix.
+type s3StorageManager struct {
+	client *s3Client
+	// prefix with the prefix of all the keys, it is empty or ends with a slash
+	prefix string
+}
+
+// NewS3StorageManager returns a StorageManager that uses an S3 compatible object storage
+func NewS3StorageManager(cfg config.S3Config) (StorageManager, error) {
+	client, err := newS3Client(cfg)
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.Trim(cfg.Prefix, "/")
+	if prefix != "" {
+		prefix = prefix + "/"
+	}
+	return &s3StorageManager{client: client, prefix: prefix}, nil
+}
+
+// getRepositoryPrefix returns the key prefix of a repository
+func (s *s3StorageManager) getRepositoryPrefix(repo string) string {
+	return fmt.Sprintf("%s%s/", s.prefix, repo)
+}
+
+// getAppPrefix returns the key prefix of an application
+func (s *s3StorageManager) getAppPrefix(repo string, name string, version string) string {
+	return fmt.Sprintf("%s%s/%s/%s/", s.prefix, repo, name, version)
+}
+
+// deleteObjects removes the objects with the given keys
+func (s *s3StorageManager) deleteObjects(objects []s3Object) error {
+	for _, object := range objects {
+		if err := s.client.DeleteObject(object.Key); err != nil {
+			log.Err(err).Str("key", object.Key).Msg("error deleting object")
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateRepository creates the marker object of a repository
+func (s *s3StorageManager) CreateRepository(name string) error {
+	if err := s.client.PutObject(s.getRepositoryPrefix(name)+repositoryMarker, []byte{}); err != nil {
+		log.Err(err).Str("name", name).Msg("error creating repository")
+		return err
+	}
+	return nil
+}
+
+// RepositoryExists checks if a repository exists
+func (s *s3StorageManager) RepositoryExists(name string) (bool, error) {
+	objects, err := s.client.ListObjects(s.getRepositoryPrefix(name), 1)
+	if err != nil {
+		return false, err
+	}
+	return len(objects) > 0, nil
+}
+
+// RemoveRepository removes all the objects of a repository. Be careful using this function
+// it will remove ALL the applications
+func (s *s3StorageManager) RemoveRepository(name string) error {
+	objects, err := s.client.ListObjects(s.getRepositoryPrefix(name), 0)
+	if err != nil {
+		log.Err(err).Str("name", name).Msg("error removing repository")
+		return err
+	}
+	if err = s.deleteObjects(objects); err != nil {
+		log.Err(err).Str("name", name).Msg("error removing repository")
+		return err
+	}
+	return nil
+}
+
+// GetRepositoryUsage returns the size of the application files of each tag stored in a repository.
+// The precomputed tgz is not included.
+func (s *s3StorageManager) GetRepositoryUsage(name string) ([]*entities.TagUsage, error) {
+	repoPrefix := s.getRepositoryPrefix(name)
+	objects, err := s.client.ListObjects(repoPrefix, 0)
+	if err != nil {
+		log.Err(err).Str("name", name).Msg("error getting repository usage")
+		return nil, err
+	}
+	tags := make([]*entities.TagUsage, 0)
+	indexed := make(map[string]*entities.TagUsage)
+	for _, object := range objects {
+		// <app>/<tag>/<file path>
+		elements := strings.SplitN(strings.TrimPrefix(object.Key, repoPrefix), "/", 3)
+		if len(elements) != 3 || isReservedFile(elements[2]) {
+			continue
+		}
+		id := elements[0] + "/" + elements[1]
+		tag, exists := indexed[id]
+		if !exists {
+			tag = &entities.TagUsage{ApplicationName: elements[0], Tag: elements[1]}
+			indexed[id] = tag
+			tags = append(tags, tag)
+		}
+		tag.Bytes += object.Size
+	}
+	return tags, nil
+}
+
+// ListRepositories returns the names of the repositories stored. Only the top-level prefixes are listed, and the
+// internal ones are skipped.
+func (s *s3StorageManager) ListRepositories() ([]string, error) {
+	prefixes, err := s.client.ListPrefixes(s.prefix)
+	if err != nil {
+		log.Err(err).Msg("error listing repositories")
+		return nil, err
+	}
+	repositories := make([]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		// <repo>/
+		name := strings.TrimSuffix(strings.TrimPrefix(prefix, s.prefix), "/")
+		// the internal prefixes, as the quota overrides, are skipped
+		if name == "" || strings.HasPrefix(name, ".") {
+			continue
+		}
+		repositories = append(repositories, name)
+	}
+	sort.Strings(repositories)
+	return repositories, nil
+}
+
+// ListApplications returns the application tags stored in a repository
+func (s *s3StorageManager) ListApplications(repo string) ([]*entities.ApplicationID, error) {
+	repoPrefix := s.getRepositoryPrefix(repo)
+	objects, err := s.client.ListObjects(repoPrefix, 0)
+	if err != nil {
+		log.Err(err).Str("repo", repo).Msg("error listing applications")
+		return nil, err
+	}
+	applications := make([]*entities.ApplicationID, 0)
+	found := make(map[string]bool)
+	for _, object := range objects {
+		// <app>/<tag>/<file path>
+		elements := strings.SplitN(strings.TrimPrefix(object.Key, repoPrefix), "/", 3)
+		if len(elements) != 3 {
+			continue
+		}
+		id := elements[0] + "/" + elements[1]
+		if found[id] {
+			continue
+		}
+		found[id] = true
+		applications = append(applications, &entities.ApplicationID{Namespace: repo, ApplicationName: elements[0], Tag: elements[1]})
+	}
+	return applications, nil
+}
+
+// getVisibilityKey returns the key of the visibility object of an application
+func (s *s3StorageManager) getVisibilityKey(repo string, name string) string {
+	return fmt.Sprintf("%s%s/%s/%s", s.prefix, repo, name, visibilityFile)
+}
+
+// StoreApplicationVisibility stores the visibility of an application
+func (s *s3StorageManager) StoreApplicationVisibility(repo string, name string, isPrivate bool) error {
+	data, err := encodeVisibility(isPrivate)
+	if err != nil {
+		return err
+	}
+	if err = s.client.PutObject(s.getVisibilityKey(repo, name), data); err != nil {
+		log.Err(err).Str("repo", repo).Str("name", name).Msg("error storing application visibility")
+		return err
+	}
+	return nil
+}
+
+// GetApplicationVisibility returns the visibility stored of an application, nil if it was not stored
+func (s *s3StorageManager) GetApplicationVisibility(repo string, name string) (*bool, error) {
+	data, err := s.client.GetObject(s.getVisibilityKey(repo, name))
+	if err != nil {
+		if nerrors.FromError(err).Code == nerrors.NotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return decodeVisibility(data)
+}
+
+// getQuotaKey returns the key of the quota override object of a namespace
+func (s *s3StorageManager) getQuotaKey(namespace string) string {
+	return fmt.Sprintf("%s%s/%s%s", s.prefix, quotasDirectory, namespace, quotaFileExtension)
+}
+
+// StoreQuotaOverride stores the quota override of a namespace
+func (s *s3StorageManager) StoreQuotaOverride(namespace string, quota entities.Quota) error {
+	if err := checkQuotaNamespace(namespace); err != nil {
+		return err
+	}
+	data, err := encodeQuota(quota)
+	if err != nil {
+		return err
+	}
+	if err = s.client.PutObject(s.getQuotaKey(namespace), data); err != nil {
+		log.Err(err).Str("namespace", namespace).Msg("error storing namespace quota")
+		return err
+	}
+	return nil
+}
+
+// GetQuotaOverride returns the quota override of a namespace, nil if it has no override
+func (s *s3StorageManager) GetQuotaOverride(namespace string) (*entities.Quota, error) {
+	if err := checkQuotaNamespace(namespace); err != nil {
+		return nil, err
+	}
+	data, err := s.client.GetObject(s.getQuotaKey(namespace))
+	if err != nil {
+		if nerrors.FromError(err).Code == nerrors.NotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return decodeQuota(data)
+}
+
+// RemoveQuotaOverride removes the quota override of a namespace, returns an error if it does not exist
+func (s *s3StorageManager) RemoveQuotaOverride(namespace string) error {
+	quota, err := s.GetQuotaOverride(namespace)
+	if err != nil {
+		return err
+	}
+	if quota == nil {
+		return nerrors.NewNotFoundError("namespace %s has no quota override", namespace)
+	}
+	if err = s.client.DeleteObject(s.getQuotaKey(namespace)); err != nil {
+		log.Err(err).Str("namespace", namespace).Msg("error removing namespace quota")
+		return err
+	}
+	return nil
+}
+
+// ListQuotaOverrides returns the quota overrides indexed by namespace
+func (s *s3StorageManager) ListQuotaOverrides() (map[string]entities.Quota, error) {
+	quotasPrefix := fmt.Sprintf("%s%s/", s.prefix, quotasDirectory)
+	objects, err := s.client.ListObjects(quotasPrefix, 0)
+	if err != nil {
+		log.Err(err).Msg("error listing namespace quotas")
+		return nil, err
+	}
+	overrides := make(map[string]entities.Quota)
+	for _, object := range objects {
+		namespace := strings.TrimSuffix(strings.TrimPrefix(object.Key, quotasPrefix), quotaFileExtension)
+		quota, err := s.GetQuotaOverride(namespace)
+		if err != nil {
+			return nil, err
+		}
+		if quota != nil {
+			overrides[namespace] = *quota
+		}
+	}
+	return overrides, nil
+}
+
+// getEncryptionKeysKey returns the key of the encryption keys object
+func (s *s3StorageManager) getEncryptionKeysKey() string {
+	return s.prefix + encryptionKeysFile
+}
+
+// GetEncryptionKeys returns the content of the encryption keys file, nil if it was not stored
+func (s *s3StorageManager) GetEncryptionKeys() ([]byte, error) {
+	data, err := s.client.GetObject(s.getEncryptionKeysKey())
+	if err != nil {
+		if nerrors.FromError(err).Code == nerrors.NotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// UpdateEncryptionKeys replaces the encryption keys object with a conditional write, so it fails if another replica
+// changes it in the meantime. The update is retried with the new content.
+func (s *s3StorageManager) UpdateEncryptionKeys(update func(current []byte) ([]byte, error)) error {
+	key := s.getEncryptionKeysKey()
+	for attempt := 0; attempt < s3UpdateAttempts; attempt++ {
+		current, etag, err := s.client.GetObjectVersion(key)
+		if err != nil && nerrors.FromError(err).Code != nerrors.NotFound {
+			return err
+		}
+		data, err := update(current)
+		if err != nil {
+			return err
+		}
+		err = s.client.PutObjectIfMatch(key, data, etag)
+		if err == nil {
+			return nil
+		}
+		if nerrors.FromError(err).Code != nerrors.Aborted {
+			log.Err(err).Msg("error storing the encryption keys")
+			return err
+		}
+		log.Debug().Int("attempt", attempt).Msg("encryption keys changed by another replica, retrying the update")
+	}
+	return nerrors.NewAbortedError("unable to update the encryption keys, they are being changed by other replicas")
+}
+
+// StoreApplication save all files in their corresponding path. The new files are written before
+// removing the files of the previous version that are no longer included. The artifact is written
+// after the files, so it is never served with the files of a previous version.
+func (s *s3StorageManager) StoreApplication(repo string, name string, version string, files []*entities.FileInfo) error {
+	if err := checkReservedPaths(files); err != nil {
+		return err
+	}
+	artifact, digest, err := buildArtifact(name, files)
+	if err != nil {
+		return err
+	}
+
+	appPrefix := s.getAppPrefix(repo, name, version)
+	previous, err := s.client.ListObjects(appPrefix, 0)
+	if err != nil {
+		log.Err(err).Str("application", appPrefix).Msg("Error storing application, unable to list old one")
+		return err
+	}
+
+	stored := make(map[string]bool, len(files))
+	for _, appFile := range files {
+		key := appPrefix + path.Clean(appFile.Path)
+		if err = s.client.PutObject(key, appFile.Data); err != nil {
+			log.Err(err).Str("application", appPrefix).Str("file", appFile.Path).Msg("Error storing application file")
+			return err
+		}
+		stored[key] = true
+	}
+	// the digest is written first, an artifact that does not match it is rejected when it is read
+	if err = s.client.PutObject(appPrefix+artifactDigestFile, []byte(digest)); err != nil {
+		log.Err(err).Str("application", appPrefix).Msg("Error storing application artifact digest")
+		return err
+	}
+	if err = s.client.PutObject(appPrefix+artifactFile, artifact); err != nil {
+		log.Err(err).Str("application", appPrefix).Msg("Error storing application artifact")
+		return err
+	}
+	stored[appPrefix+artifactDigestFile] = true
+	stored[appPrefix+artifactFile] = true
+
+	stale := make([]s3Object, 0)
+	for _, object := range previous {
+		if !stored[object.Key] {
+			stale = append(stale, object)
+		}
+	}
+	if err = s.deleteObjects(stale); err != nil {
+		log.Err(err).Str("application", appPrefix).Msg("Error storing application, unable to delete old files")
+		return err
+	}
+	return nil
+}
+
+// ApplicationExists checks if an application exists
+func (s *s3StorageManager) ApplicationExists(repo string, name string, version string) (bool, error) {
+	objects, err := s.client.ListObjects(s.getAppPrefix(repo, name, version), 1)
+	if err != nil {
+		return false, nerrors.NewInternalErrorFrom(err, "unable to check if the application exists")
+	}
+	return len(objects) > 0, nil
+}
+
+// GetApplicationUpdateTime returns the time when the files of an application tag were stored, the last modification
+// of its objects
+func (s *s3StorageManager) GetApplicationUpdateTime(repo string, name string, version string) (time.Time, error) {
+	objects, err := s.client.ListObjects(s.getAppPrefix(repo, name, version), 0)
+	if err != nil {
+		return time.Time{}, nerrors.NewInternalErrorFrom(err, "unable to get the application update time")
+	}
+	if len(objects) == 0 {
+		return time.Time{}, nerrors.NewNotFoundError("Application not found")
+	}
+	var updated time.Time
+	for _, object := range objects {
+		if object.LastModified.After(updated) {
+			updated = object.LastModified
+		}
+	}
+	return updated, nil
+}
+
+// RemoveApplication removes an application, returns an error if it does not exist
+func (s *s3StorageManager) RemoveApplication(repo string, name string, version string) error {
+	appPrefix := s.getAppPrefix(repo, name, version)
+	objects, err := s.client.ListObjects(appPrefix, 0)
+	if err != nil {
+		log.Err(err).Str("appName", appPrefix).Msg("error deleting application")
+		return nerrors.NewInternalErrorFrom(err, "unable to delete application")
+	}
+	if len(objects) == 0 {
+		return nerrors.NewNotFoundError("unable to delete application")
+	}
+	if err = s.deleteObjects(objects); err != nil {
+		return nerrors.NewInternalErrorFrom(err, "unable to delete application")
+	}
+	if err = s.cleanApplication(repo, name); err != nil {
+		log.Err(err).Str("repo", repo).Str("name", name).Msg("error cleaning application")
+	}
+	if err = s.cleanRepository(repo); err != nil {
+		log.Err(err).Str("repo", repo).Msg("error cleaning repository")
+	}
+	return nil
+}
+
+// cleanApplication removes the visibility object if the application has no tags
+func (s *s3StorageManager) cleanApplication(repo string, name string) error {
+	visibilityKey := s.getVisibilityKey(repo, name)
+	objects, err := s.client.ListObjects(path.Dir(visibilityKey)+"/", 2)
+	if err != nil {
+		return err
+	}
+	if len(objects) == 1 && objects[0].Key == visibilityKey {
+		return s.client.DeleteObject(visibilityKey)
+	}
+	return nil
+}
+
+// cleanRepository removes the repository marker if the repository has no applications
+func (s *s3StorageManager) cleanRepository(repo string) error {
+	repoPrefix := s.getRepositoryPrefix(repo)
+	objects, err := s.client.ListObjects(repoPrefix, 2)
+	if err != nil {
+		return err
+	}
+	if len(objects) == 1 && objects[0].Key == repoPrefix+repositoryMarker {
+		return s.client.DeleteObject(objects[0].Key)
+	}
+	return nil
+}
+
+// GetApplication returns the application files, or a single file with the application archive in the given format
+func (s *s3StorageManager) GetApplication(repo string, name string, version string, format entities.DownloadFormat) ([]*entities.FileInfo, error) {
+	if format.IsArchive() {
+		stream, err := s.GetApplicationStream(repo, name, version, format)
+		if err != nil {
+			return nil, err
+		}
+		return readStream(name, format, stream)
+	}
+
+	appPrefix := s.getAppPrefix(repo, name, version)
+	log.Debug().Str("prefix", appPrefix).Msg("getting application")
+
+	objects, err := s.client.ListObjects(appPrefix, 0)
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error checking if the catalog application exists")
+	}
+	if len(objects) == 0 {
+		return nil, nerrors.NewNotFoundError("Application not found")
+	}
+
+	files := make([]*entities.FileInfo, 0, len(objects))
+	for _, object := range objects {
+		if isReservedFile(strings.TrimPrefix(object.Key, appPrefix)) {
+			continue
+		}
+		data, err := s.client.GetObject(object.Key)
+		if err != nil {
+			log.Err(err).Str("key", object.Key).Msg("error reading object")
+			return nil, nerrors.NewInternalErrorFrom(err, "Error reading file")
+		}
+		files = append(files, &entities.FileInfo{
+			Path: strings.TrimPrefix(object.Key, appPrefix),
+			Data: data,
+		})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+
+	for _, file := range files {
+		file.Path = fmt.Sprintf("./%s/%s", name, file.Path)
+	}
+	return files, nil
+}
+
+// GetApplicationStream returns the application archive. The tgz is the precomputed one, the other formats
+// (or the tgz of the applications stored without it) are generated while they are read downloading the objects
+// one by one.
+func (s *s3StorageManager) GetApplicationStream(repo string, name string, version string, format entities.DownloadFormat) (io.ReadCloser, error) {
+	if err := checkArchiveFormat(format); err != nil {
+		return nil, err
+	}
+	appPrefix := s.getAppPrefix(repo, name, version)
+	objects, err := s.client.ListObjects(appPrefix, 0)
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error checking if the catalog application exists")
+	}
+	if len(objects) == 0 {
+		return nil, nerrors.NewNotFoundError("Application not found")
+	}
+
+	keys := make(map[string]bool, len(objects))
+	for _, object := range objects {
+		keys[strings.TrimPrefix(object.Key, appPrefix)] = true
+	}
+	if format == entities.DownloadFormatTgz && keys[artifactFile] && keys[artifactDigestFile] {
+		return s.getArtifact(appPrefix)
+	}
+
+	entries := make([]archiveEntry, 0, len(objects))
+	for _, object := range objects {
+		if isReservedFile(strings.TrimPrefix(object.Key, appPrefix)) {
+			continue
+		}
+		key := object.Key
+		entries = append(entries, archiveEntry{
+			Path: strings.TrimPrefix(key, appPrefix),
+			Size: object.Size,
+			Open: func() (io.ReadCloser, error) {
+				return s.client.GetObjectStream(key)
+			},
+		})
+	}
+	return streamArchive(format, name, entries, func() {}), nil
+}
+
+// getArtifact returns the precomputed tgz of the application verifying its digest while it is read. The tgz is
+// streamed from the object storage, it is not loaded in memory.
+func (s *s3StorageManager) getArtifact(appPrefix string) (io.ReadCloser, error) {
+	digest, err := s.client.GetObject(appPrefix + artifactDigestFile)
+	if err != nil {
+		log.Err(err).Str("prefix", appPrefix).Msg("error reading artifact digest")
+		return nil, nerrors.NewInternalErrorFrom(err, "Error reading file")
+	}
+	artifact, err := s.client.GetObjectStream(appPrefix + artifactFile)
+	if err != nil {
+		log.Err(err).Str("prefix", appPrefix).Msg("error reading artifact")
+		return nil, nerrors.NewInternalErrorFrom(err, "Error reading file")
+	}
+	return newDigestReader(artifact, strings.TrimSpace(string(digest))), nil
+}
@@ -17,45 +17,234 @@
 package storage
 
 import (
-	"archive/tar"
-	"bytes"
-	"compress/gzip"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/napptive/catalog-manager/internal/pkg/entities"
 	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/xid"
 	"github.com/rs/zerolog/log"
 )
 
 type StorageManager interface {
 	// StoreApplication save all files in their corresponding path
 	StoreApplication(repo string, name string, version string, files []*entities.FileInfo) error
-	// GetApplication returns the application files
-	GetApplication(repo string, name string, version string, compressed bool) ([]*entities.FileInfo, error)
+	// GetApplication returns the application files, or a single file with the application archive in the given format
+	GetApplication(repo string, name string, version string, format entities.DownloadFormat) ([]*entities.FileInfo, error)
+	// GetApplicationStream returns a reader with the application archive in the given format. The archive may be
+	// generated while it is read, so the reader must be closed.
+	GetApplicationStream(repo string, name string, version string, format entities.DownloadFormat) (io.ReadCloser, error)
 	// RemoveApplication removes an application, returns an error if it does not exist
 	RemoveApplication(repo string, name string, version string) error
 	// ApplicationExists checks if an application exists
 	ApplicationExists(repo string, name string, version string) (bool, error)
+	// GetApplicationUpdateTime returns the time when the files of an application tag were stored
+	GetApplicationUpdateTime(repo string, name string, version string) (time.Time, error)
 	// CreateRepository creates a directory to storage a repository
 	CreateRepository(name string) error
 	// RepositoryExists checks if a repository exists
 	RepositoryExists(name string) (bool, error)
 	// RemoveRepository removes the repository directory. Be careful using this function
 	RemoveRepository(name string) error
+	// GetRepositoryUsage returns the size of the application files of each tag stored in a repository
+	GetRepositoryUsage(name string) ([]*entities.TagUsage, error)
+	// ListRepositories returns the names of the repositories stored
+	ListRepositories() ([]string, error)
+	// ListApplications returns the application tags stored in a repository
+	ListApplications(repo string) ([]*entities.ApplicationID, error)
+	// StoreApplicationVisibility stores the visibility of an application so the metadata can be rebuilt from the storage
+	StoreApplicationVisibility(repo string, name string, isPrivate bool) error
+	// GetApplicationVisibility returns the visibility stored of an application, nil if it was not stored
+	GetApplicationVisibility(repo string, name string) (*bool, error)
+	// StoreQuotaOverride stores the quota override of a namespace, it is shared by all the replicas
+	StoreQuotaOverride(namespace string, quota entities.Quota) error
+	// GetQuotaOverride returns the quota override of a namespace, nil if it has no override
+	GetQuotaOverride(namespace string) (*entities.Quota, error)
+	// RemoveQuotaOverride removes the quota override of a namespace, returns an error if it does not exist
+	RemoveQuotaOverride(namespace string) error
+	// ListQuotaOverrides returns the quota overrides indexed by namespace
+	ListQuotaOverrides() (map[string]entities.Quota, error)
+	// GetEncryptionKeys returns the content of the encryption keys file, nil if it was not stored
+	GetEncryptionKeys() ([]byte, error)
+	// UpdateEncryptionKeys replaces the content of the encryption keys file with the one returned by update, that
+	// receives the current content (nil if it was not stored). The update is exclusive among all the replicas, so
+	// the keys added by the others are never overwritten.
+	UpdateEncryptionKeys(update func(current []byte) ([]byte, error)) error
+}
+
+// stagingDirectory with the name of the directory (under basePath) where the applications are written
+// before moving them to their final location. It starts with a dot to avoid collisions with the namespaces.
+const stagingDirectory = ".staging"
+
+// stagingLeftoverAge with the age of the staging entries that are considered leftovers of interrupted pushes. The
+// younger ones may belong to pushes in progress in other replicas that share the volume.
+const stagingLeftoverAge = time.Hour
+
+// dirLock with the lock of an application directory and the number of goroutines using it
+type dirLock struct {
+	sync.RWMutex
+	users int
+}
+
+// dirLocks with the locks of the application directories, they are removed once they are not used
+type dirLocks struct {
+	sync.Mutex
+	locks map[string]*dirLock
+}
+
+// acquire returns the lock of a directory, creating it if it does not exist
+func (l *dirLocks) acquire(dir string) *dirLock {
+	l.Lock()
+	defer l.Unlock()
+	lock, exists := l.locks[dir]
+	if !exists {
+		lock = &dirLock{}
+		l.locks[dir] = lock
+	}
+	lock.users++
+	return lock
+}
+
+// release removes the lock of a directory if it is no longer used
+func (l *dirLocks) release(dir string, lock *dirLock) {
+	l.Lock()
+	defer l.Unlock()
+	lock.users--
+	if lock.users == 0 {
+		delete(l.locks, dir)
+	}
+}
+
+// lock locks a directory for writing and returns the function that unlocks it
+func (l *dirLocks) lock(dir string) func() {
+	dir = filepath.Clean(dir)
+	lock := l.acquire(dir)
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		l.release(dir, lock)
+	}
+}
+
+// rLock locks a directory for reading and returns the function that unlocks it
+func (l *dirLocks) rLock(dir string) func() {
+	dir = filepath.Clean(dir)
+	lock := l.acquire(dir)
+	lock.RLock()
+	return func() {
+		lock.RUnlock()
+		l.release(dir, lock)
+	}
 }
 
 // StorageManager is a struct to manage all the storage operations
 type storageManager struct {
 	// basePath with the path where the repo storage is
 	basePath string
+	// swapLocks protect the readers of each application tag while a new version is moved into place
+	swapLocks *dirLocks
+	// keysLock serializes the updates of the encryption keys in this process
+	keysLock *sync.Mutex
 }
 
+// NewStorageManager returns a StorageManager that stores the applications in basePath.
+// The leftovers of interrupted pushes are removed.
 func NewStorageManager(basePath string) StorageManager {
-	return &storageManager{basePath: basePath}
+	manager := newStorageManager(basePath)
+	return &manager
+}
+
+// newStorageManager creates the storage manager removing the leftovers of the staging directory
+func newStorageManager(basePath string) storageManager {
+	manager := storageManager{
+		basePath:  basePath,
+		swapLocks: &dirLocks{locks: make(map[string]*dirLock)},
+		keysLock:  &sync.Mutex{},
+	}
+	manager.removeStagingLeftovers(time.Now().Add(-stagingLeftoverAge))
+	return manager
+}
+
+// removeStagingLeftovers removes the staging entries modified before the given time
+func (s *storageManager) removeStagingLeftovers(before time.Time) {
+	entries, err := os.ReadDir(s.getStagingDirectory())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Err(err).Str("basePath", s.basePath).Msg("error cleaning the staging directory")
+		}
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.ModTime().Before(before) {
+			continue
+		}
+		log.Info().Str("entry", entry.Name()).Msg("removing the leftover of an interrupted push")
+		if err = s.removeDirectory(filepath.Join(s.getStagingDirectory(), entry.Name())); err != nil {
+			log.Err(err).Str("basePath", s.basePath).Msg("error cleaning the staging directory")
+		}
+	}
+}
+
+// getStagingDirectory returns the directory where the pushed applications are written
+func (s *storageManager) getStagingDirectory() string {
+	return filepath.Join(s.basePath, stagingDirectory)
+}
+
+// createStagingDirectory creates a new empty directory to write an application
+func (s *storageManager) createStagingDirectory() (string, error) {
+	dir := filepath.Join(s.getStagingDirectory(), xid.New().String())
+	if err := s.createDirectory(dir); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// swapDirectory moves the staging directory to target. If target exists, both directories are
+// exchanged atomically (when supported by the OS) and the previous content is removed.
+// Readers holding the lock of the target never see a partially written application.
+func (s *storageManager) swapDirectory(staging string, target string) error {
+	if err := s.createDirectory(filepath.Dir(target)); err != nil {
+		return err
+	}
+
+	defer s.swapLocks.lock(target)()
+
+	if _, err := os.Stat(target); err != nil {
+		if !os.IsNotExist(err) {
+			return nerrors.FromError(err)
+		}
+		if err = os.Rename(staging, target); err != nil {
+			return nerrors.FromError(err)
+		}
+		return nil
+	}
+
+	if err := exchangeDirectories(staging, target); err != nil {
+		// Fallback, the tag is missing between both renames
+		log.Debug().Err(err).Str("target", target).Msg("atomic exchange not available, using rename")
+		old := staging + ".old"
+		if err = os.Rename(target, old); err != nil {
+			return nerrors.FromError(err)
+		}
+		if err = os.Rename(staging, target); err != nil {
+			// restore the previous version
+			_ = os.Rename(old, target)
+			return nerrors.FromError(err)
+		}
+		staging = old
+	}
+	// staging contains the previous version
+	if err := s.removeDirectory(staging); err != nil {
+		log.Err(err).Str("target", target).Msg("error removing the previous version")
+	}
+	return nil
 }
 
 // getAppDirectory compose the application directory
@@ -120,53 +309,213 @@ func (s *storageManager) RemoveRepository(name string) error {
 	return nil
 }
 
-// StoreApplication save all files in their corresponding path
+// GetRepositoryUsage returns the size of the application files of each tag stored in a repository.
+// The precomputed tgz is not included.
+func (s *storageManager) GetRepositoryUsage(name string) ([]*entities.TagUsage, error) {
+	tags, err := s.listTags(name)
+	if err != nil {
+		log.Err(err).Str("name", name).Msg("error getting repository usage")
+		return nil, err
+	}
+	for _, tag := range tags {
+		if tag.Bytes, err = s.getApplicationSize(s.getAppDirectory(name, tag.ApplicationName, tag.Tag)); err != nil {
+			log.Err(err).Str("name", name).Msg("error getting repository usage")
+			return nil, err
+		}
+	}
+	return tags, nil
+}
+
+// ListRepositories returns the names of the repositories stored. The internal directories are skipped.
+func (s *storageManager) ListRepositories() ([]string, error) {
+	entries, err := os.ReadDir(s.basePath)
+	if err != nil {
+		log.Err(err).Str("basePath", s.basePath).Msg("error listing repositories")
+		return nil, nerrors.FromError(err)
+	}
+	repositories := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			repositories = append(repositories, entry.Name())
+		}
+	}
+	return repositories, nil
+}
+
+// ListApplications returns the application tags stored in a repository
+func (s *storageManager) ListApplications(repo string) ([]*entities.ApplicationID, error) {
+	tags, err := s.listTags(repo)
+	if err != nil {
+		log.Err(err).Str("repo", repo).Msg("error listing applications")
+		return nil, err
+	}
+	applications := make([]*entities.ApplicationID, 0, len(tags))
+	for _, tag := range tags {
+		applications = append(applications, &entities.ApplicationID{Namespace: repo, ApplicationName: tag.ApplicationName, Tag: tag.Tag})
+	}
+	return applications, nil
+}
+
+// listTags returns the tags stored in a repository without their size
+func (s *storageManager) listTags(name string) ([]*entities.TagUsage, error) {
+	tags := make([]*entities.TagUsage, 0)
+	apps, err := os.ReadDir(filepath.Join(s.basePath, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return tags, nil
+		}
+		return nil, nerrors.FromError(err)
+	}
+	for _, app := range apps {
+		if !app.IsDir() {
+			continue
+		}
+		versions, err := os.ReadDir(filepath.Join(s.basePath, name, app.Name()))
+		if err != nil {
+			return nil, nerrors.FromError(err)
+		}
+		for _, version := range versions {
+			if version.IsDir() {
+				tags = append(tags, &entities.TagUsage{ApplicationName: app.Name(), Tag: version.Name()})
+			}
+		}
+	}
+	return tags, nil
+}
+
+// getApplicationSize returns the size of the files of an application directory
+func (s *storageManager) getApplicationSize(dir string) (int64, error) {
+	defer s.swapLocks.rLock(dir)()
+
+	var size int64
+	if err := filepath.WalkDir(dir, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		relativePath, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+		if isReservedFile(filepath.ToSlash(relativePath)) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	}); err != nil {
+		return 0, nerrors.FromError(err)
+	}
+	return size, nil
+}
+
+// StoreApplication save all files in their corresponding path. The files and the precomputed tgz are written
+// in a staging directory that replaces the previous version once all of them are stored.
 func (s *storageManager) StoreApplication(repo string, name string, version string, files []*entities.FileInfo) error {
-	// 1.- Remove the old application
 	// baseUrl/repo/application/tag
-	dir := fmt.Sprintf("%s/%s/%s/%s", s.basePath, repo, name, version)
-	if err := s.removeDirectory(dir); err != nil {
-		log.Err(err).Str("application", dir).Msg("Error storing application, unable to delete old one")
+	dir := s.getAppDirectory(repo, name, version)
+
+	if err := checkReservedPaths(files); err != nil {
 		return err
 	}
 
-	// 2.- Create the application directory
-	if err := s.createDirectory(dir); err != nil {
-		log.Err(err).Str("application", dir).Msg("Error storing application, unable to create directory")
+	// 1.- Create the staging directory
+	staging, err := s.createStagingDirectory()
+	if err != nil {
+		log.Err(err).Str("application", dir).Msg("Error storing application, unable to create staging directory")
 		return err
 	}
 
-	// 3.- Create the files and storage them
+	// 2.- Create the files and storage them
+	if err = s.writeFiles(staging, files); err != nil {
+		log.Err(err).Str("application", dir).Msg("Error storing application file")
+		_ = s.removeDirectory(staging)
+		return err
+	}
+
+	// 3.- Create the artifact served in the compressed downloads
+	if err = s.writeArtifact(staging, name, files); err != nil {
+		log.Err(err).Str("application", dir).Msg("Error storing application artifact")
+		_ = s.removeDirectory(staging)
+		return err
+	}
+
+	// 4.- Replace the old application
+	if err = s.swapDirectory(staging, dir); err != nil {
+		log.Err(err).Str("application", dir).Msg("Error storing application, unable to replace old one")
+		_ = s.removeDirectory(staging)
+		return err
+	}
+
+	return nil
+}
+
+// writeFiles stores the application files in dir
+func (s *storageManager) writeFiles(dir string, files []*entities.FileInfo) error {
 	for _, appFile := range files {
-		// Check if the file is in a new directory
-		splited := strings.Split(appFile.Path, "/")
+		// The paths are sanitized by the handler, this avoids writing outside dir in any case
+		filePath := filepath.Join(dir, filepath.FromSlash(appFile.Path))
+		if !strings.HasPrefix(filePath, dir+string(filepath.Separator)) {
+			return nerrors.NewFailedPreconditionError("invalid application file path [%s]", appFile.Path)
+		}
 		// create directory
-		if len(splited) > 1 {
-			pp := splited[:len(splited)-1]
-			if err := s.createDirectory(fmt.Sprintf("%s/%s", dir, strings.Join(pp, "/"))); err != nil {
-				return err
-			}
+		if err := s.createDirectory(filepath.Dir(filePath)); err != nil {
+			return err
 		}
-		file, err := os.Create(fmt.Sprintf("%s/%s", dir, appFile.Path))
-		if err != nil {
-			log.Err(err).Str("application", dir).Msg("Error storing application file, unable to create the file")
-			// TODO: remove all stored
-			return nerrors.FromError(err)
+		if err := writeFileSync(filePath, appFile.Data); err != nil {
+			return err
 		}
-		defer file.Close()
+	}
+	return nil
+}
 
-		if _, err = file.Write(appFile.Data); err != nil {
-			log.Err(err).Str("application", dir).Msg("Error storing application file, unable to save the file")
-			// TODO: when get/list applications are implemented,
-			// test all cases where the add metadata fails and see if it should be rolled back
-			return nerrors.FromError(err)
-		}
+// writeArtifact stores in dir the tgz of the application files and its digest
+func (s *storageManager) writeArtifact(dir string, name string, files []*entities.FileInfo) error {
+	data, digest, err := buildArtifact(name, files)
+	if err != nil {
+		return err
+	}
+	if err = writeFileSync(filepath.Join(dir, artifactFile), data); err != nil {
+		return err
+	}
+	return writeFileSync(filepath.Join(dir, artifactDigestFile), []byte(digest))
+}
 
-		if err := file.Sync(); err != nil {
-			return nerrors.FromError(err)
+// openArtifact opens the precomputed tgz of an application verifying its digest while it is read.
+// Returns nil if the application was stored without artifact.
+func (s *storageManager) openArtifact(dir string) (io.ReadCloser, error) {
+	defer s.swapLocks.rLock(dir)()
+
+	digest, err := os.ReadFile(filepath.Join(dir, artifactDigestFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
 		}
+		return nil, nerrors.FromError(err)
+	}
+	file, err := os.Open(filepath.Join(dir, artifactFile))
+	if err != nil {
+		return nil, nerrors.FromError(err)
+	}
+	return newDigestReader(file, strings.TrimSpace(string(digest))), nil
+}
+
+// writeFileSync creates a file and flushes its content to disk
+func writeFileSync(filePath string, data []byte) error {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return nerrors.FromError(err)
 	}
+	defer file.Close()
 
+	if _, err = file.Write(data); err != nil {
+		return nerrors.FromError(err)
+	}
+	if err = file.Sync(); err != nil {
+		return nerrors.FromError(err)
+	}
 	return nil
 }
 
@@ -184,6 +533,19 @@ func (s *storageManager) ApplicationExists(repo string, name string, version str
 	return true, nil
 }
 
+// GetApplicationUpdateTime returns the time when the files of an application tag were stored, the tag directory
+// is replaced on each push
+func (s *storageManager) GetApplicationUpdateTime(repo string, name string, version string) (time.Time, error) {
+	info, err := os.Stat(s.getAppDirectory(repo, name, version))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return time.Time{}, nerrors.NewNotFoundError("Application not found")
+		}
+		return time.Time{}, nerrors.NewInternalErrorFrom(err, "unable to get the application update time")
+	}
+	return info.ModTime(), nil
+}
+
 // RemoveApplication removes an application, returns an error if it does not exist
 func (s *storageManager) RemoveApplication(repo string, name string, version string) error {
 	appName := s.getAppDirectory(repo, name, version)
@@ -197,7 +559,10 @@ func (s *storageManager) RemoveApplication(repo string, name string, version str
 		return nerrors.NewNotFoundError("unable to delete application")
 	}
 
-	if err := s.removeDirectory(appName); err != nil {
+	unlock := s.swapLocks.lock(appName)
+	err = s.removeDirectory(appName)
+	unlock()
+	if err != nil {
 		log.Err(err).Str("appName", appName).Msg("error deleting application")
 		return nerrors.NewInternalErrorFrom(err, "unable to delete application")
 	}
@@ -208,8 +573,16 @@ func (s *storageManager) RemoveApplication(repo string, name string, version str
 	return nil
 }
 
-// GetApplication returns the application files
-func (s *storageManager) GetApplication(repo string, name string, version string, compressed bool) ([]*entities.FileInfo, error) {
+// GetApplication returns the application files, or a single file with the application archive in the given format
+func (s *storageManager) GetApplication(repo string, name string, version string, format entities.DownloadFormat) ([]*entities.FileInfo, error) {
+
+	if format.IsArchive() {
+		stream, err := s.GetApplicationStream(repo, name, version, format)
+		if err != nil {
+			return nil, err
+		}
+		return readStream(name, format, stream)
+	}
 
 	// Find the application directory
 	path := fmt.Sprintf("%s/%s/%s/%s", s.basePath, repo, name, version)
@@ -224,70 +597,104 @@ func (s *storageManager) GetApplication(repo string, name string, version string
 		return nil, nerrors.NewNotFoundError("Application not found")
 	}
 
-	if compressed {
-		return s.loadAppFileTgz(name, path)
-	}
-
-	return s.loadAppFile(path, fmt.Sprintf("./%s", name))
-}
+	defer s.swapLocks.rLock(path)()
 
-func (s *storageManager) loadAppFileTgz(name string, path string) ([]*entities.FileInfo, error) {
-	var buf bytes.Buffer
-
-	// Remove '//' in the path.
-	// The path could be composed with two slash.
-	// This makes impossible to remove the repository path when creating the tgz.
-	// If we delete it, we avoid this issue
-	path = strings.Replace(path, "//", "/", -1)
-
-	zr := gzip.NewWriter(&buf)
-	tw := tar.NewWriter(zr)
-
-	// walk through every file in the folder
-	if wErr := filepath.Walk(path, func(file string, fi os.FileInfo, err error) error {
-		// generate tar header
-		header, nErr := tar.FileInfoHeader(fi, file)
-		if nErr != nil {
-			return nErr
+	files, err := s.loadAppFile(path, fmt.Sprintf("./%s", name))
+	if err != nil {
+		return nil, err
+	}
+	// the artifact is not part of the application
+	appFiles := make([]*entities.FileInfo, 0, len(files))
+	for _, file := range files {
+		if !isReservedFile(strings.TrimPrefix(file.Path, fmt.Sprintf("./%s/", name))) {
+			appFiles = append(appFiles, file)
 		}
+	}
+	return appFiles, nil
+}
 
-		// remove repo path
-		header.Name = filepath.ToSlash(fmt.Sprintf("./%s%s", name, strings.Replace(file, path, "", -1)))
+// GetApplicationStream returns the application archive. The tgz is the precomputed one, the other formats
+// (or the tgz of the applications stored without it) are generated while they are read. All the files are opened
+// before returning, so the stream contains the version read even if a new one replaces it in the meantime.
+func (s *storageManager) GetApplicationStream(repo string, name string, version string, format entities.DownloadFormat) (io.ReadCloser, error) {
+	if err := checkArchiveFormat(format); err != nil {
+		return nil, err
+	}
+	exists, err := s.ApplicationExists(repo, name, version)
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "error checking if the catalog application exists")
+	}
+	if !exists {
+		return nil, nerrors.NewNotFoundError("Application not found")
+	}
 
-		// write header
-		if nErr := tw.WriteHeader(header); nErr != nil {
-			return nErr
+	dir := s.getAppDirectory(repo, name, version)
+	if format == entities.DownloadFormatTgz {
+		artifact, err := s.openArtifact(dir)
+		if err != nil {
+			log.Err(err).Str("repo", repo).Str("name", name).Str("version", version).Msg("error opening application artifact")
+			return nil, nerrors.NewInternalErrorFrom(err, "Error getting application")
 		}
-		// if not a dir, write file content
-		if !fi.IsDir() {
-			data, nErr := os.Open(file)
-			if nErr != nil {
-				return err
-			}
-			if _, nErr := io.Copy(tw, data); nErr != nil {
-				return nErr
-			}
+		if artifact != nil {
+			return artifact, nil
 		}
-		return nil
-	}); wErr != nil {
-		log.Error().Err(wErr).Msg("error getting application")
-		return nil, nerrors.NewInternalError("Error getting application")
+	}
 
+	entries, release, err := s.openAppFiles(dir)
+	if err != nil {
+		log.Err(err).Str("repo", repo).Str("name", name).Str("version", version).Msg("error getting application")
+		return nil, err
 	}
+	return streamArchive(format, name, entries, release), nil
+}
 
-	// produce tar
-	if nErr := tw.Close(); nErr != nil {
-		return nil, nerrors.NewInternalErrorFrom(nErr, "Error closing tar")
+// openAppFiles opens all the files of an application directory holding the swap lock, so they belong to the same
+// version. The open files are still readable after a new version replaces the directory. Returns the archive entries
+// and the function that closes the files.
+func (s *storageManager) openAppFiles(dir string) ([]archiveEntry, func(), error) {
+	defer s.swapLocks.rLock(dir)()
+
+	entries := make([]archiveEntry, 0)
+	opened := make([]*os.File, 0)
+	release := func() {
+		for _, file := range opened {
+			file.Close()
+		}
 	}
-	// produce gzip
-	if nErr := zr.Close(); nErr != nil {
-		return nil, nerrors.NewInternalErrorFrom(nErr, "Error closing tgz")
+	if err := filepath.WalkDir(dir, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		relativePath, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+		if isReservedFile(filepath.ToSlash(relativePath)) {
+			return nil
+		}
+		file, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+		opened = append(opened, file)
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		entries = append(entries, archiveEntry{
+			Path: filepath.ToSlash(relativePath),
+			Size: info.Size(),
+			Open: func() (io.ReadCloser, error) {
+				// the file is closed by release
+				return io.NopCloser(file), nil
+			},
+		})
+		return nil
+	}); err != nil {
+		release()
+		return nil, nil, nerrors.NewInternalErrorFrom(err, "Error getting application")
 	}
-
-	return []*entities.FileInfo{&entities.FileInfo{
-		Path: fmt.Sprintf("./%s.tgz", name),
-		Data: buf.Bytes(),
-	}}, nil
+	return entries, release, nil
 }
 
 // loadAppFile gets the content of application files
@@ -339,14 +746,28 @@ func (s *storageManager) checkEmptyDirs(path string) (bool, error) {
 	return false, err // Either not empty or error, suits both cases
 }
 
+// checkNoTags checks if an application directory does not contain any tag
+func (s *storageManager) checkNoTags(path string) (bool, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return false, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
 // cleanApplicationDirectory checks if application directory is empty and removes it and
 // check if repository directory is empty and removes it
 func (s *storageManager) cleanApplicationDirectory(repo string, name string) error {
 
 	// - check if the application removed was the unique version for this application
-	// basePath/repository/app
+	// basePath/repository/app, the visibility file is removed with the last version
 	appPath := fmt.Sprintf("%s/%s/%s", s.basePath, repo, name)
-	last, err := s.checkEmptyDirs(appPath)
+	last, err := s.checkNoTags(appPath)
 	if err != nil {
 		return nerrors.FromError(err)
 	}
@@ -16,17 +16,69 @@
 package storage
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
 	"fmt"
+	"io"
 	"os"
+	"path"
+	"time"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/napptive/catalog-manager/internal/pkg/entities"
 	"github.com/napptive/catalog-manager/internal/pkg/utils"
+	"github.com/napptive/nerrors/pkg/nerrors"
 	"github.com/onsi/ginkgo"
 	"github.com/onsi/gomega"
 	"github.com/rs/zerolog/log"
 	"syreclabs.com/go/faker"
 )
 
+// extractArchive returns the content of the files of a zip or tar.zst archive indexed by clean path
+func extractArchive(format entities.DownloadFormat, data []byte) (map[string][]byte, error) {
+	files := make(map[string][]byte, 0)
+	if format == entities.DownloadFormatZip {
+		reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range reader.File {
+			content, err := file.Open()
+			if err != nil {
+				return nil, err
+			}
+			files[file.Name], err = io.ReadAll(content)
+			content.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return files, nil
+	}
+	decoder, err := zstd.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer decoder.Close()
+	reader := tar.NewReader(decoder)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if files[path.Clean(header.Name)], err = io.ReadAll(reader); err != nil {
+			return nil, err
+		}
+	}
+}
+
 var _ = ginkgo.Describe("Storage test", func() {
 
 	if !utils.RunIntegrationTests("storage") {
@@ -111,7 +163,7 @@ var _ = ginkgo.Describe("Storage test", func() {
 		err := manager.StoreApplication(repo, appName, "latest", files)
 		gomega.Expect(err).Should(gomega.Succeed())
 
-		returned, err := manager.GetApplication(repo, appName, "latest", false)
+		returned, err := manager.GetApplication(repo, appName, "latest", entities.DownloadFormatNone)
 		gomega.Expect(err).Should(gomega.Succeed())
 		gomega.Expect(returned).ShouldNot(gomega.BeNil())
 		gomega.Expect(returned).ShouldNot(gomega.BeEmpty())
@@ -190,7 +242,7 @@ var _ = ginkgo.Describe("Storage test", func() {
 		err := manager.StoreApplication(repo, appName, version, files)
 		gomega.Expect(err).Should(gomega.Succeed())
 
-		entity, err := manager.(*storageManager).loadAppFileTgz(appName, fmt.Sprintf("%s/%s/%s/%s", basePath, repo, appName, version))
+		entity, err := manager.GetApplication(repo, appName, version, entities.DownloadFormatTgz)
 		gomega.Expect(err).Should(gomega.Succeed())
 		gomega.Expect(entity).ShouldNot(gomega.BeNil())
 
@@ -204,4 +256,306 @@ var _ = ginkgo.Describe("Storage test", func() {
 		gomega.Expect(err).Should(gomega.Succeed())
 
 	})
+
+	ginkgo.It("should replace a version without leaving files of the previous one", func() {
+		manager := NewStorageManager(basePath)
+		repo := faker.Name().FirstName()
+		appName := faker.App().Name()
+		err := manager.StoreApplication(repo, appName, "latest", []*entities.FileInfo{
+			{Path: "app_config.yaml", Data: []byte("old")},
+			{Path: "component.yaml", Data: []byte("component")}})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		err = manager.StoreApplication(repo, appName, "latest", []*entities.FileInfo{
+			{Path: "app_config.yaml", Data: []byte("new")}})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		returned, err := manager.GetApplication(repo, appName, "latest", entities.DownloadFormatNone)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(returned).Should(gomega.ConsistOf(
+			&entities.FileInfo{Path: "./" + appName + "/app_config.yaml", Data: []byte("new")}))
+	})
+
+	ginkgo.It("should keep the previous version if the new one cannot be stored", func() {
+		manager := NewStorageManager(basePath)
+		repo := faker.Name().FirstName()
+		appName := faker.App().Name()
+		err := manager.StoreApplication(repo, appName, "latest", []*entities.FileInfo{
+			{Path: "app_config.yaml", Data: []byte("old")}})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		// components is created as a file and then used as a directory
+		err = manager.StoreApplication(repo, appName, "latest", []*entities.FileInfo{
+			{Path: "app_config.yaml", Data: []byte("new")},
+			{Path: "components", Data: []byte("file")},
+			{Path: "components/component.yaml", Data: []byte("component")}})
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+
+		returned, err := manager.GetApplication(repo, appName, "latest", entities.DownloadFormatNone)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(returned).Should(gomega.ConsistOf(
+			&entities.FileInfo{Path: "./" + appName + "/app_config.yaml", Data: []byte("old")}))
+
+		entries, err := os.ReadDir(fmt.Sprintf("%s/%s", basePath, stagingDirectory))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(entries).Should(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should remove the staging leftovers when it starts", func() {
+		leftover := fmt.Sprintf("%s/%s/interrupted", basePath, stagingDirectory)
+		err := os.MkdirAll(leftover, 0755)
+		gomega.Expect(err).Should(gomega.Succeed())
+		old := time.Now().Add(-2 * stagingLeftoverAge)
+		gomega.Expect(os.Chtimes(leftover, old, old)).Should(gomega.Succeed())
+		inProgress := fmt.Sprintf("%s/%s/in-progress", basePath, stagingDirectory)
+		err = os.MkdirAll(inProgress, 0755)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		_ = NewStorageManager(basePath)
+		_, err = os.Stat(leftover)
+		gomega.Expect(os.IsNotExist(err)).Should(gomega.BeTrue())
+		// it may belong to a push of another replica
+		_, err = os.Stat(inProgress)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(os.RemoveAll(inProgress)).Should(gomega.Succeed())
+	})
+
+	ginkgo.It("should only block the readers of the tag that is replaced", func() {
+		manager := newStorageManager(basePath)
+		unlock := manager.swapLocks.lock(manager.getAppDirectory("repo", "app", "v1"))
+		done := make(chan bool)
+		go func() {
+			manager.swapLocks.rLock(manager.getAppDirectory("repo", "app", "v2"))()
+			done <- true
+		}()
+		gomega.Eventually(done).Should(gomega.Receive())
+		unlock()
+		gomega.Expect(manager.swapLocks.locks).Should(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should not write files outside the application directory", func() {
+		manager := NewStorageManager(basePath)
+		repo := faker.Name().FirstName()
+		appName := faker.App().Name()
+		err := manager.StoreApplication(repo, appName, "latest", []*entities.FileInfo{
+			{Path: "app_config.yaml", Data: []byte("appconf")},
+			{Path: "../../escaped.yaml", Data: []byte("escaped")}})
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+
+		exists, err := manager.ApplicationExists(repo, appName, "latest")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(exists).Should(gomega.BeFalse())
+	})
+
+	ginkgo.It("should stream the application that was stored when the stream was opened", func() {
+		manager := NewStorageManager(basePath)
+		repo := faker.Name().FirstName()
+		appName := faker.App().Name()
+		err := manager.StoreApplication(repo, appName, "latest", []*entities.FileInfo{
+			{Path: "app_config.yaml", Data: []byte("old")}})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		stream, err := manager.GetApplicationStream(repo, appName, "latest", entities.DownloadFormatTgz)
+		gomega.Expect(err).Should(gomega.Succeed())
+		err = manager.StoreApplication(repo, appName, "latest", []*entities.FileInfo{
+			{Path: "app_config.yaml", Data: []byte("new")}})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		streamed, err := readStream(appName, entities.DownloadFormatTgz, stream)
+		gomega.Expect(err).Should(gomega.Succeed())
+		expected, err := compressFiles(appName, entities.DownloadFormatTgz, []*entities.FileInfo{
+			{Path: "app_config.yaml", Data: []byte("old")}})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(streamed).Should(gomega.Equal(expected))
+	})
+
+	ginkgo.It("should keep streaming a generated archive if the application is replaced while it is read", func() {
+		manager := NewStorageManager(basePath)
+		repo := faker.Name().FirstName()
+		appName := faker.App().Name()
+		err := manager.StoreApplication(repo, appName, "latest", []*entities.FileInfo{
+			{Path: "app_config.yaml", Data: []byte("old")},
+			{Path: "components/component1.yaml", Data: []byte("component1")}})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		stream, err := manager.GetApplicationStream(repo, appName, "latest", entities.DownloadFormatZip)
+		gomega.Expect(err).Should(gomega.Succeed())
+		err = manager.StoreApplication(repo, appName, "latest", []*entities.FileInfo{
+			{Path: "app_config.yaml", Data: []byte("new")}})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		streamed, err := readStream(appName, entities.DownloadFormatZip, stream)
+		gomega.Expect(err).Should(gomega.Succeed())
+		extracted, err := extractArchive(entities.DownloadFormatZip, streamed[0].Data)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(extracted).Should(gomega.Equal(map[string][]byte{
+			appName + "/app_config.yaml":            []byte("old"),
+			appName + "/components/component1.yaml": []byte("component1")}))
+	})
+
+	ginkgo.It("should return the application in zip and tar.zst formats", func() {
+		manager := NewStorageManager(basePath)
+		repo := faker.Name().FirstName()
+		appName := faker.App().Name()
+		files := []*entities.FileInfo{
+			{Path: "components/component1.yaml", Data: []byte("component1")},
+			{Path: "app_config.yaml", Data: []byte("appconf")}}
+		err := manager.StoreApplication(repo, appName, "latest", files)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		for _, format := range []entities.DownloadFormat{entities.DownloadFormatZip, entities.DownloadFormatTarZstd} {
+			returned, err := manager.GetApplication(repo, appName, "latest", format)
+			gomega.Expect(err).Should(gomega.Succeed())
+			expected, err := compressFiles(appName, format, files)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(returned).Should(gomega.Equal(expected))
+			gomega.Expect(returned[0].Path).Should(gomega.Equal(format.FileName(appName)))
+
+			extracted, err := extractArchive(format, returned[0].Data)
+			gomega.Expect(err).Should(gomega.Succeed())
+			gomega.Expect(extracted).Should(gomega.HaveKeyWithValue(appName+"/app_config.yaml", []byte("appconf")))
+			gomega.Expect(extracted).Should(gomega.HaveKeyWithValue(appName+"/components/component1.yaml", []byte("component1")))
+		}
+	})
+
+	ginkgo.It("should serve the same precomputed tgz for the same content", func() {
+		manager := NewStorageManager(basePath)
+		appName := faker.App().Name()
+		files := []*entities.FileInfo{
+			{Path: "components/component1.yaml", Data: []byte("component1")},
+			{Path: "app_config.yaml", Data: []byte("appconf")}}
+		repos := []string{faker.Name().FirstName(), faker.Name().FirstName() + "2"}
+		for _, repo := range repos {
+			err := manager.StoreApplication(repo, appName, "latest", files)
+			gomega.Expect(err).Should(gomega.Succeed())
+		}
+
+		first, err := manager.GetApplication(repos[0], appName, "latest", entities.DownloadFormatTgz)
+		gomega.Expect(err).Should(gomega.Succeed())
+		second, err := manager.GetApplication(repos[1], appName, "latest", entities.DownloadFormatTgz)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(first).Should(gomega.Equal(second))
+
+		artifact, digest, err := buildArtifact(appName, []*entities.FileInfo{files[1], files[0]})
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(first[0].Data).Should(gomega.Equal(artifact))
+		stored, err := os.ReadFile(fmt.Sprintf("%s/%s/%s/latest/%s", basePath, repos[0], appName, artifactDigestFile))
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(string(stored)).Should(gomega.Equal(digest))
+
+		// the artifact is not returned as an application file
+		returned, err := manager.GetApplication(repos[0], appName, "latest", entities.DownloadFormatNone)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(len(returned)).Should(gomega.Equal(2))
+	})
+
+	ginkgo.It("should reject an artifact that does not match its digest", func() {
+		manager := NewStorageManager(basePath)
+		repo := faker.Name().FirstName()
+		appName := faker.App().Name()
+		err := manager.StoreApplication(repo, appName, "latest", []*entities.FileInfo{
+			{Path: "app_config.yaml", Data: []byte("appconf")}})
+		gomega.Expect(err).Should(gomega.Succeed())
+		err = os.WriteFile(fmt.Sprintf("%s/%s/%s/latest/%s", basePath, repo, appName, artifactFile), []byte("corrupted"), 0644)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		_, err = manager.GetApplication(repo, appName, "latest", entities.DownloadFormatTgz)
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+
+		err = manager.StoreApplication(repo, appName, "latest", []*entities.FileInfo{
+			{Path: artifactFile, Data: []byte("appconf")}})
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+	})
+
+	ginkgo.It("should return the size of each tag of a repository", func() {
+		manager := NewStorageManager(basePath)
+		repo := faker.Name().FirstName()
+		err := manager.StoreApplication(repo, "app", "v1", []*entities.FileInfo{
+			{Path: "app_config.yaml", Data: []byte("appconf")},
+			{Path: "components/component1.yaml", Data: []byte("component1")}})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		usage, err := manager.GetRepositoryUsage(repo)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(usage).Should(gomega.ConsistOf(&entities.TagUsage{ApplicationName: "app", Tag: "v1", Bytes: 17}))
+
+		usage, err = manager.GetRepositoryUsage(repo + "-missing")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(usage).Should(gomega.BeEmpty())
+	})
+
+	ginkgo.It("should list the repositories and applications stored", func() {
+		manager := NewStorageManager(basePath)
+		repo := faker.Name().FirstName()
+		err := manager.StoreApplication(repo, "app", "v1", []*entities.FileInfo{
+			{Path: "app_config.yaml", Data: []byte("appconf")}})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		repositories, err := manager.ListRepositories()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(repositories).Should(gomega.ContainElement(repo))
+		gomega.Expect(repositories).ShouldNot(gomega.ContainElement(stagingDirectory))
+
+		applications, err := manager.ListApplications(repo)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(applications).Should(gomega.ConsistOf(
+			&entities.ApplicationID{Namespace: repo, ApplicationName: "app", Tag: "v1"}))
+	})
+
+	ginkgo.It("should store the visibility next to the application tags", func() {
+		manager := NewStorageManager(basePath)
+		repo := faker.Name().FirstName()
+		err := manager.StoreApplication(repo, "app", "v1", []*entities.FileInfo{
+			{Path: "app_config.yaml", Data: []byte("appconf")}})
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		private, err := manager.GetApplicationVisibility(repo, "app")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(private).Should(gomega.BeNil())
+
+		err = manager.StoreApplicationVisibility(repo, "app", true)
+		gomega.Expect(err).Should(gomega.Succeed())
+		private, err = manager.GetApplicationVisibility(repo, "app")
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(*private).Should(gomega.BeTrue())
+
+		applications, err := manager.ListApplications(repo)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(len(applications)).Should(gomega.Equal(1))
+
+		err = manager.RemoveApplication(repo, "app", "v1")
+		gomega.Expect(err).Should(gomega.Succeed())
+		exists, err := manager.RepositoryExists(repo)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(exists).Should(gomega.BeFalse())
+	})
+
+	ginkgo.It("should share the quota overrides between the managers of the same volume", func() {
+		manager := NewStorageManager(basePath)
+		replica := NewStorageManager(basePath)
+		namespace := "quota-" + faker.Name().FirstName()
+		quota := entities.Quota{MaxBytes: 1024, MaxApplications: 2}
+		err := manager.StoreQuotaOverride(namespace, quota)
+		gomega.Expect(err).Should(gomega.Succeed())
+
+		stored, err := replica.GetQuotaOverride(namespace)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(*stored).Should(gomega.Equal(quota))
+		overrides, err := replica.ListQuotaOverrides()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(overrides).Should(gomega.HaveKeyWithValue(namespace, quota))
+		repositories, err := replica.ListRepositories()
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(repositories).ShouldNot(gomega.ContainElement(quotasDirectory))
+
+		err = replica.RemoveQuotaOverride(namespace)
+		gomega.Expect(err).Should(gomega.Succeed())
+		stored, err = manager.GetQuotaOverride(namespace)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(stored).Should(gomega.BeNil())
+		err = manager.RemoveQuotaOverride(namespace)
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.NotFound))
+		err = manager.StoreQuotaOverride("../escaped", quota)
+		gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.InvalidArgument))
+	})
 })
@@ -0,0 +1,94 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/rs/zerolog/log"
+)
+
+// visibilityFile with the name of the file, stored next to the tags of an application, with the application
+// visibility. The visibility is part of the metadata, this copy allows to rebuild the metadata from the storage.
+const visibilityFile = ".visibility"
+
+// applicationVisibility with the content of the visibility file
+type applicationVisibility struct {
+	// Private with a flag to indicate the application scope
+	Private bool
+}
+
+// encodeVisibility returns the content of the visibility file
+func encodeVisibility(isPrivate bool) ([]byte, error) {
+	data, err := json.Marshal(applicationVisibility{Private: isPrivate})
+	if err != nil {
+		return nil, nerrors.NewInternalErrorFrom(err, "unable to encode the application visibility")
+	}
+	return data, nil
+}
+
+// decodeVisibility parses the content of the visibility file
+func decodeVisibility(data []byte) (*bool, error) {
+	var visibility applicationVisibility
+	if err := json.Unmarshal(data, &visibility); err != nil {
+		return nil, nerrors.NewDataLossErrorFrom(err, "unable to read the application visibility")
+	}
+	return &visibility.Private, nil
+}
+
+// getVisibilityPath returns the path of the visibility file of an application
+func (s *storageManager) getVisibilityPath(repo string, name string) string {
+	return filepath.Join(s.basePath, repo, name, visibilityFile)
+}
+
+// StoreApplicationVisibility stores the visibility of an application. The file is replaced atomically.
+func (s *storageManager) StoreApplicationVisibility(repo string, name string, isPrivate bool) error {
+	data, err := encodeVisibility(isPrivate)
+	if err != nil {
+		return err
+	}
+	visibilityPath := s.getVisibilityPath(repo, name)
+	if err = s.createDirectory(filepath.Dir(visibilityPath)); err != nil {
+		return err
+	}
+	tmp := visibilityPath + ".tmp"
+	if err = writeFileSync(tmp, data); err != nil {
+		log.Err(err).Str("repo", repo).Str("name", name).Msg("error storing application visibility")
+		return err
+	}
+	if err = os.Rename(tmp, visibilityPath); err != nil {
+		log.Err(err).Str("repo", repo).Str("name", name).Msg("error storing application visibility")
+		_ = os.Remove(tmp)
+		return nerrors.FromError(err)
+	}
+	return nil
+}
+
+// GetApplicationVisibility returns the visibility stored of an application, nil if it was not stored
+func (s *storageManager) GetApplicationVisibility(repo string, name string) (*bool, error) {
+	data, err := os.ReadFile(s.getVisibilityPath(repo, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, nerrors.FromError(err)
+	}
+	return decodeVisibility(data)
+}
@@ -0,0 +1,113 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package utils
+
+import (
+	"archive/tar"
+	"fmt"
+	"path"
+	"strings"
+	"unicode"
+
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/nerrors/pkg/nerrors"
+)
+
+// checkFilePath returns the normalised path of an application file or the reason why it is rejected
+func checkFilePath(filePath string) (string, string) {
+	if strings.IndexFunc(filePath, unicode.IsControl) != -1 {
+		return "", "contains control characters"
+	}
+	if strings.Contains(filePath, "\\") {
+		return "", "contains backslashes"
+	}
+	if path.IsAbs(filePath) {
+		return "", "absolute path"
+	}
+	if len(filePath) > 1 && filePath[1] == ':' && unicode.IsLetter(rune(filePath[0])) {
+		return "", "volume name"
+	}
+	if strings.HasPrefix(filePath, "~") {
+		return "", "home directory reference"
+	}
+	for _, element := range strings.Split(filePath, "/") {
+		if element == ".." {
+			return "", "parent directory reference"
+		}
+	}
+	cleaned := path.Clean(filePath)
+	if cleaned == "." || cleaned == "" {
+		return "", "empty path"
+	}
+	return cleaned, ""
+}
+
+// SanitizeFilePaths normalises the paths of the application files and checks that all of them are relative
+// paths inside the application directory. Empty entries (without path and data) are skipped.
+// A FailedPrecondition error listing all the offending files is returned if any path is unsafe, duplicated
+// or used both as a file and as a directory.
+func SanitizeFilePaths(files []*entities.FileInfo) ([]*entities.FileInfo, error) {
+	sanitized := make([]*entities.FileInfo, 0, len(files))
+	offending := make([]string, 0)
+	paths := make(map[string]bool, len(files))
+
+	for _, file := range files {
+		if file.Path == "" && len(file.Data) == 0 {
+			continue
+		}
+		cleaned, reason := checkFilePath(file.Path)
+		if reason == "" && paths[cleaned] {
+			reason = "duplicated path"
+		}
+		if reason != "" {
+			offending = append(offending, fmt.Sprintf("%q: %s", file.Path, reason))
+			continue
+		}
+		paths[cleaned] = true
+		sanitized = append(sanitized, &entities.FileInfo{Path: cleaned, Data: file.Data})
+	}
+
+	// a file cannot be the parent directory of other file
+	for _, file := range sanitized {
+		for dir := path.Dir(file.Path); dir != "."; dir = path.Dir(dir) {
+			if paths[dir] {
+				offending = append(offending, fmt.Sprintf("%q: conflicts with file %q", file.Path, dir))
+				break
+			}
+		}
+	}
+
+	if len(offending) > 0 {
+		return nil, nerrors.NewFailedPreconditionError("invalid application file paths: %s", strings.Join(offending, ", "))
+	}
+	return sanitized, nil
+}
+
+// CheckArchiveEntry checks an entry of an archive that is unpacked into application files. The symbolic and hard
+// links are rejected, as well as the devices and pipes, so the files of an application can only be regular ones.
+// The directories and the other entries without content are accepted and must be skipped by the caller.
+func CheckArchiveEntry(header *tar.Header) error {
+	switch header.Typeflag {
+	case tar.TypeSymlink:
+		return nerrors.NewFailedPreconditionError("invalid archive entry %q: symbolic link to %q", header.Name, header.Linkname)
+	case tar.TypeLink:
+		return nerrors.NewFailedPreconditionError("invalid archive entry %q: hard link to %q", header.Name, header.Linkname)
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		return nerrors.NewFailedPreconditionError("invalid archive entry %q: special file", header.Name)
+	}
+	return nil
+}
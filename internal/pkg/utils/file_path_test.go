@@ -0,0 +1,137 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package utils
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+
+	"github.com/napptive/catalog-manager/internal/pkg/entities"
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("File path sanitization test", func() {
+
+	ginkgo.It("should normalise the valid paths", func() {
+		files := []*entities.FileInfo{
+			{Path: "./app/app_config.yaml", Data: []byte("config")},
+			{Path: "app//components/./component.yaml", Data: []byte("component")},
+			{Path: "app/.hidden", Data: []byte("hidden")},
+			{},
+		}
+		sanitized, err := SanitizeFilePaths(files)
+		gomega.Expect(err).Should(gomega.Succeed())
+		gomega.Expect(sanitized).Should(gomega.Equal([]*entities.FileInfo{
+			{Path: "app/app_config.yaml", Data: []byte("config")},
+			{Path: "app/components/component.yaml", Data: []byte("component")},
+			{Path: "app/.hidden", Data: []byte("hidden")},
+		}))
+	})
+
+	ginkgo.It("should reject hostile paths", func() {
+		hostile := []string{
+			"../../other-ns/app/tag/x.yaml",
+			"app/../../x.yaml",
+			"app/..",
+			"/etc/passwd",
+			"C:/Windows/x.yaml",
+			"..\\..\\x.yaml",
+			"~/.ssh/authorized_keys",
+			"app/x.yaml\x00.txt",
+			"app/\nx.yaml",
+			".",
+			"./",
+		}
+		for _, filePath := range hostile {
+			_, err := SanitizeFilePaths([]*entities.FileInfo{
+				{Path: "app_config.yaml", Data: []byte("config")},
+				{Path: filePath, Data: []byte("data")},
+			})
+			gomega.Expect(err).ShouldNot(gomega.Succeed(), filePath)
+			gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.FailedPrecondition))
+		}
+	})
+
+	ginkgo.It("should reject duplicated paths", func() {
+		_, err := SanitizeFilePaths([]*entities.FileInfo{
+			{Path: "app/app_config.yaml", Data: []byte("first")},
+			{Path: "./app/app_config.yaml", Data: []byte("second")},
+		})
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+		gomega.Expect(err.Error()).Should(gomega.ContainSubstring("duplicated path"))
+	})
+
+	ginkgo.It("should reject files used as directories", func() {
+		_, err := SanitizeFilePaths([]*entities.FileInfo{
+			{Path: "app/components", Data: []byte("file")},
+			{Path: "app/components/component.yaml", Data: []byte("component")},
+		})
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+		gomega.Expect(err.Error()).Should(gomega.ContainSubstring("conflicts with file"))
+	})
+
+	ginkgo.It("should list all the offending files", func() {
+		_, err := SanitizeFilePaths([]*entities.FileInfo{
+			{Path: "../first.yaml", Data: []byte("first")},
+			{Path: "app_config.yaml", Data: []byte("config")},
+			{Path: "/second.yaml", Data: []byte("second")},
+		})
+		gomega.Expect(err).ShouldNot(gomega.Succeed())
+		gomega.Expect(err.Error()).Should(gomega.ContainSubstring("../first.yaml"))
+		gomega.Expect(err.Error()).Should(gomega.ContainSubstring("/second.yaml"))
+		gomega.Expect(err.Error()).ShouldNot(gomega.ContainSubstring("app_config.yaml"))
+	})
+
+	ginkgo.It("should reject the links of a hostile archive", func() {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		entries := []*tar.Header{
+			{Name: "app/", Typeflag: tar.TypeDir, Mode: 0755},
+			{Name: "app/app_config.yaml", Typeflag: tar.TypeReg, Mode: 0644, Size: 6},
+			{Name: "app/passwd", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd", Mode: 0777},
+			{Name: "app/config", Typeflag: tar.TypeLink, Linkname: "app/app_config.yaml", Mode: 0644},
+			{Name: "app/pipe", Typeflag: tar.TypeFifo, Mode: 0644},
+		}
+		for _, header := range entries {
+			gomega.Expect(tw.WriteHeader(header)).Should(gomega.Succeed())
+			if header.Size > 0 {
+				_, err := tw.Write([]byte("config"))
+				gomega.Expect(err).Should(gomega.Succeed())
+			}
+		}
+		gomega.Expect(tw.Close()).Should(gomega.Succeed())
+
+		accepted := make([]string, 0)
+		tr := tar.NewReader(&buf)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			gomega.Expect(err).Should(gomega.Succeed())
+			if err = CheckArchiveEntry(header); err != nil {
+				gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.FailedPrecondition))
+				continue
+			}
+			accepted = append(accepted, header.Name)
+		}
+		gomega.Expect(accepted).Should(gomega.Equal([]string{"app/", "app/app_config.yaml"}))
+	})
+})
@@ -32,8 +32,8 @@ import (
 )
 
 const (
-	// defaultVersion with the version ofa an application if it is no filled
-	defaultVersion = "latest"
+	// ReadmeFile with the name of the readme file
+	ReadmeFile = "readme.md"
 )
 
 // metadataGKV with a map associating group/version with the object kind. This map contains all the version of a metadata
@@ -83,6 +83,35 @@ func IsMetadata(data []byte) (bool, *entities.ApplicationMetadata, error) {
 	return false, nil, nil
 }
 
+// GetApplicationMetadataFile checks the YAML files and returns the application metadata yaml file
+func GetApplicationMetadataFile(files []*entities.FileInfo) ([]byte, *entities.ApplicationMetadata, error) {
+	var data []byte
+	var appMetadata *entities.ApplicationMetadata
+	for _, file := range files {
+		// the files must have .yaml extension
+		if IsYamlFile(strings.ToLower(file.Path)) {
+			// 2.- Get Metadata
+			isMetadata, metadataObj, err := IsMetadata(file.Data)
+			if err != nil {
+				log.Error().Err(err).Str("file", file.Path).Msg("Error looking for the metadata file")
+				return nil, nil, nerrors.NewInternalError("error in %s file [%s]", file.Path, err.Error())
+			}
+			if isMetadata {
+				data = file.Data
+				appMetadata = metadataObj
+			} else {
+				// validate YAML file to avoid errors
+				_, gkvErr := GetGvk(file.Data)
+				if gkvErr != nil {
+					log.Error().Err(gkvErr).Str("file", file.Path).Msg("Error checking YAML file")
+					return nil, nil, nerrors.NewInternalError("error in %s file [%s]", file.Path, gkvErr.Error())
+				}
+			}
+		}
+	}
+	return data, appMetadata, nil
+}
+
 // GenerateRandomString is a method to generate a random string with a determinate length
 func GenerateRandomString(length int) (string, error) {
 	b := make([]byte, length)
@@ -98,6 +127,8 @@ func GenerateRandomString(length int) (string, error) {
 // DecomposeApplicationID extracts the catalog URL, namespace, and application name
 // from an application identifier in the form of:
 // [catalogURL/]namespace/appName[:tag]
+// The tag is latest if it is not filled. It is returned as requested, see ResolveTag to resolve the latest and stable
+// tags or a version constraint.
 func DecomposeApplicationID(applicationID string) (string, *entities.ApplicationID, error) {
 	var version string
 	var applicationName string
@@ -120,12 +151,12 @@ func DecomposeApplicationID(applicationID string) (string, *entities.Application
 	sp := strings.Split(elements[len(elements)-1], ":")
 	if len(sp) == 1 {
 		applicationName = sp[0]
-		version = defaultVersion
+		version = LatestTag
 	} else if len(sp) == 2 {
 		applicationName = sp[0]
 		version = sp[1]
 		if strings.Trim(version, " ") == "" {
-			version = defaultVersion
+			version = LatestTag
 		}
 	} else {
 		return "", nil, nerrors.NewFailedPreconditionError(
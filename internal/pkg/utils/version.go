@@ -0,0 +1,379 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/napptive/nerrors/pkg/nerrors"
+)
+
+const (
+	// LatestTag resolves to the highest released version if no tag is named latest
+	LatestTag = "latest"
+	// StableTag resolves to the highest released version from 1.0.0 if no tag is named stable
+	StableTag = "stable"
+)
+
+// versionRegex matches the semantic versions, the minor and patch numbers may be omitted and the v prefix is accepted
+var versionRegex = regexp.MustCompile(`^v?(0|[1-9]\d*)(?:\.(0|[1-9]\d*))?(?:\.(0|[1-9]\d*))?` +
+	`(?:-([0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?(?:\+[0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*)?$`)
+
+// partialVersionRegex matches the versions of the constraints, where the numbers may be wildcards
+var partialVersionRegex = regexp.MustCompile(`^v?(\d+|[xX*])(?:\.(\d+|[xX*]))?(?:\.(\d+|[xX*]))?` +
+	`(?:-([0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?(?:\+[0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*)?$`)
+
+// operatorSpacesRegex matches the spaces between an operator and its version
+var operatorSpacesRegex = regexp.MustCompile(`(>=|<=|>|<|=|\^|~)\s+`)
+
+// Version with a semantic version
+type Version struct {
+	Major uint64
+	Minor uint64
+	Patch uint64
+	// Prerelease with the dot separated identifiers of the pre-release, empty for released versions
+	Prerelease []string
+}
+
+// ParseVersion parses a tag as a semantic version, e.g. 1.2.3, v1.2 or 2.0.0-rc.1
+func ParseVersion(tag string) (*Version, error) {
+	parts := versionRegex.FindStringSubmatch(tag)
+	if parts == nil {
+		return nil, nerrors.NewInvalidArgumentError("%s is not a semantic version", tag)
+	}
+	version := &Version{}
+	numbers := []*uint64{&version.Major, &version.Minor, &version.Patch}
+	for i, number := range numbers {
+		if parts[i+1] == "" {
+			continue
+		}
+		value, err := strconv.ParseUint(parts[i+1], 10, 64)
+		if err != nil {
+			return nil, nerrors.NewInvalidArgumentErrorFrom(err, "%s is not a semantic version", tag)
+		}
+		*number = value
+	}
+	if parts[4] != "" {
+		version.Prerelease = strings.Split(parts[4], ".")
+	}
+	return version, nil
+}
+
+// IsRelease checks if the version is not a pre-release
+func (v *Version) IsRelease() bool {
+	return len(v.Prerelease) == 0
+}
+
+// String returns the version as MAJOR.MINOR.PATCH[-PRERELEASE]
+func (v *Version) String() string {
+	version := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if !v.IsRelease() {
+		version = fmt.Sprintf("%s-%s", version, strings.Join(v.Prerelease, "."))
+	}
+	return version
+}
+
+// Compare returns -1, 0 or 1 if the version precedes, is equal or follows the other one. The pre-releases
+// precede their version.
+func (v *Version) Compare(other *Version) int {
+	if result := compareNumbers(v.Major, other.Major); result != 0 {
+		return result
+	}
+	if result := compareNumbers(v.Minor, other.Minor); result != 0 {
+		return result
+	}
+	if result := compareNumbers(v.Patch, other.Patch); result != 0 {
+		return result
+	}
+	switch {
+	case v.IsRelease() && other.IsRelease():
+		return 0
+	case v.IsRelease():
+		return 1
+	case other.IsRelease():
+		return -1
+	}
+	for i := 0; i < len(v.Prerelease) && i < len(other.Prerelease); i++ {
+		if result := comparePrerelease(v.Prerelease[i], other.Prerelease[i]); result != 0 {
+			return result
+		}
+	}
+	return compareNumbers(uint64(len(v.Prerelease)), uint64(len(other.Prerelease)))
+}
+
+// compareNumbers returns -1, 0 or 1 if a is lower, equal or greater than b
+func compareNumbers(a uint64, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// comparePrerelease compares two pre-release identifiers, the numeric ones are compared as numbers and precede the
+// alphanumeric ones
+func comparePrerelease(a string, b string) int {
+	aNumber, aErr := strconv.ParseUint(a, 10, 64)
+	bNumber, bErr := strconv.ParseUint(b, 10, 64)
+	switch {
+	case aErr == nil && bErr == nil:
+		return compareNumbers(aNumber, bNumber)
+	case aErr == nil:
+		return -1
+	case bErr == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// versionComparison compares a version with the version of a constraint
+type versionComparison struct {
+	// operator with one of =, >, >=, < or <=
+	operator string
+	// version to compare with
+	version *Version
+}
+
+// check returns if the version satisfies the comparison
+func (c *versionComparison) check(version *Version) bool {
+	result := version.Compare(c.version)
+	switch c.operator {
+	case ">":
+		return result > 0
+	case ">=":
+		return result >= 0
+	case "<":
+		return result < 0
+	case "<=":
+		return result <= 0
+	}
+	return result == 0
+}
+
+// VersionConstraint with a set of version ranges, e.g. ^1.2, ~1.2.3, >=1.0 <2.0, 1.x or 1.2 || 2.x
+type VersionConstraint struct {
+	// ranges with the alternative ranges, each one with the comparisons a version must satisfy
+	ranges [][]*versionComparison
+}
+
+// ParseVersionConstraint parses a version constraint. The alternative ranges are separated by ||, and the comparators
+// of a range by commas or spaces. The comparators are:
+//   - ^1.2.3 for the versions that do not change the first non zero number, >=1.2.3 <2.0.0
+//   - ~1.2.3 for the versions that only change the patch number, >=1.2.3 <1.3.0
+//   - =, >, >=, < and <= to compare with a version
+//   - 1.2, 1.2.x or 1.2.* for the versions that start with the given numbers, >=1.2.0 <1.3.0
+func ParseVersionConstraint(constraint string) (*VersionConstraint, error) {
+	result := &VersionConstraint{}
+	for _, alternative := range strings.Split(constraint, "||") {
+		alternative = operatorSpacesRegex.ReplaceAllString(strings.TrimSpace(alternative), "$1")
+		comparators := strings.FieldsFunc(alternative, func(r rune) bool {
+			return r == ',' || r == ' '
+		})
+		if len(comparators) == 0 {
+			return nil, nerrors.NewInvalidArgumentError("%s is not a version constraint", constraint)
+		}
+		comparisons := make([]*versionComparison, 0)
+		for _, comparator := range comparators {
+			parsed, err := parseComparator(comparator)
+			if err != nil {
+				return nil, nerrors.NewInvalidArgumentErrorFrom(err, "%s is not a version constraint", constraint)
+			}
+			comparisons = append(comparisons, parsed...)
+		}
+		result.ranges = append(result.ranges, comparisons)
+	}
+	return result, nil
+}
+
+// parseComparator converts a comparator into the comparisons that delimit its range
+func parseComparator(comparator string) ([]*versionComparison, error) {
+	operator := ""
+	for _, candidate := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(comparator, candidate) {
+			operator = candidate
+			break
+		}
+	}
+	parts := partialVersionRegex.FindStringSubmatch(strings.TrimPrefix(comparator, operator))
+	if parts == nil {
+		return nil, nerrors.NewInvalidArgumentError("invalid comparator %s", comparator)
+	}
+	// numbers with the major, minor and patch numbers until the first one omitted or wildcard
+	numbers := make([]uint64, 0, 3)
+	for _, part := range parts[1:4] {
+		if part == "" || strings.ContainsAny(part, "xX*") {
+			break
+		}
+		value, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return nil, nerrors.NewInvalidArgumentErrorFrom(err, "invalid comparator %s", comparator)
+		}
+		numbers = append(numbers, value)
+	}
+	lower := versionFromNumbers(numbers)
+	if len(numbers) == 3 && parts[4] != "" {
+		lower.Prerelease = strings.Split(parts[4], ".")
+	}
+
+	switch operator {
+	case "^":
+		// the first non zero number of the given ones cannot change
+		position := 0
+		for position < len(numbers)-1 && numbers[position] == 0 {
+			position++
+		}
+		return boundedRange(lower, numbers, position), nil
+	case "~":
+		if len(numbers) < 2 {
+			return boundedRange(lower, numbers, 0), nil
+		}
+		return boundedRange(lower, numbers, 1), nil
+	case ">":
+		if len(numbers) == 3 {
+			return []*versionComparison{{operator: ">", version: lower}}, nil
+		}
+		// greater than all the versions that start with the given numbers
+		return []*versionComparison{{operator: ">=", version: nextVersion(numbers, len(numbers)-1)}}, nil
+	case ">=":
+		return []*versionComparison{{operator: ">=", version: lower}}, nil
+	case "<":
+		return []*versionComparison{{operator: "<", version: lower}}, nil
+	case "<=":
+		if len(numbers) == 3 {
+			return []*versionComparison{{operator: "<=", version: lower}}, nil
+		}
+		return []*versionComparison{{operator: "<", version: nextVersion(numbers, len(numbers)-1)}}, nil
+	}
+	if len(numbers) == 3 {
+		return []*versionComparison{{operator: "=", version: lower}}, nil
+	}
+	return boundedRange(lower, numbers, len(numbers)-1), nil
+}
+
+// versionFromNumbers returns the version with the given numbers, the missing ones are zero
+func versionFromNumbers(numbers []uint64) *Version {
+	padded := append(append(make([]uint64, 0, 3), numbers...), 0, 0, 0)
+	return &Version{Major: padded[0], Minor: padded[1], Patch: padded[2]}
+}
+
+// nextVersion returns the version that increments the number in the given position and sets the next ones to zero
+func nextVersion(numbers []uint64, position int) *Version {
+	next := append(make([]uint64, 0, 3), numbers[:position+1]...)
+	next[position]++
+	return versionFromNumbers(next)
+}
+
+// boundedRange returns the comparisons of the versions from lower that keep the numbers until the given position.
+// All the versions match if there are no numbers.
+func boundedRange(lower *Version, numbers []uint64, position int) []*versionComparison {
+	if len(numbers) == 0 {
+		return []*versionComparison{{operator: ">=", version: lower}}
+	}
+	return []*versionComparison{
+		{operator: ">=", version: lower},
+		{operator: "<", version: nextVersion(numbers, position)},
+	}
+}
+
+// Check returns if the version satisfies the constraint. The pre-releases only satisfy a range that has a comparator
+// with a pre-release of the same major, minor and patch numbers.
+func (c *VersionConstraint) Check(version *Version) bool {
+	for _, comparisons := range c.ranges {
+		if c.checkRange(comparisons, version) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRange returns if the version satisfies all the comparisons of a range
+func (c *VersionConstraint) checkRange(comparisons []*versionComparison, version *Version) bool {
+	allowPrerelease := version.IsRelease()
+	for _, comparison := range comparisons {
+		if !comparison.check(version) {
+			return false
+		}
+		bound := comparison.version
+		if !bound.IsRelease() && bound.Major == version.Major && bound.Minor == version.Minor && bound.Patch == version.Patch {
+			allowPrerelease = true
+		}
+	}
+	return allowPrerelease
+}
+
+// CheckTag returns an error if a tag cannot be pushed because it would shadow the resolution of the requested tags:
+// the stable tag and the version constraints that are not versions, as ^1.2, >=1.0 or 1.x, are reserved.
+// The latest tag is accepted as it is the default tag of the pushed applications.
+func CheckTag(tag string) error {
+	if tag == StableTag {
+		return nerrors.NewInvalidArgumentError("%s is a reserved tag", tag)
+	}
+	if _, err := ParseVersion(tag); err == nil {
+		return nil
+	}
+	if _, err := ParseVersionConstraint(tag); err == nil {
+		return nerrors.NewInvalidArgumentError("%s is a version constraint, it cannot be used as a tag", tag)
+	}
+	return nil
+}
+
+// ResolveTag returns the tag that a requested tag refers to among the tags of an application:
+//   - the requested tag if it exists.
+//   - the highest released version for latest, and the highest released version from 1.0.0 for stable.
+//   - the highest version that satisfies the requested tag if it is a version constraint.
+//
+// The tags that are not semantic versions are ignored. It returns false if no tag matches.
+func ResolveTag(requested string, tags []string) (string, bool) {
+	for _, tag := range tags {
+		if tag == requested {
+			return tag, true
+		}
+	}
+
+	var accept func(version *Version) bool
+	switch requested {
+	case LatestTag:
+		accept = func(version *Version) bool { return version.IsRelease() }
+	case StableTag:
+		accept = func(version *Version) bool { return version.IsRelease() && version.Major >= 1 }
+	default:
+		constraint, err := ParseVersionConstraint(requested)
+		if err != nil {
+			return "", false
+		}
+		accept = constraint.Check
+	}
+
+	resolved := ""
+	var highest *Version
+	for _, tag := range tags {
+		version, err := ParseVersion(tag)
+		if err != nil || !accept(version) {
+			continue
+		}
+		if highest == nil || version.Compare(highest) > 0 {
+			resolved = tag
+			highest = version
+		}
+	}
+	return resolved, highest != nil
+}
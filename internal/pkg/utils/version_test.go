@@ -0,0 +1,173 @@
+/**
+ * Copyright 2023 Napptive
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *      https://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package utils
+
+import (
+	"github.com/napptive/nerrors/pkg/nerrors"
+	"github.com/onsi/ginkgo"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Version tests", func() {
+
+	ginkgo.Context("parsing versions", func() {
+
+		ginkgo.It("should parse the semantic versions", func() {
+			var testCases = map[string]string{
+				"1.2.3":          "1.2.3",
+				"v1.2.3":         "1.2.3",
+				"1.2":            "1.2.0",
+				"1":              "1.0.0",
+				"2.0.0-rc.1":     "2.0.0-rc.1",
+				"1.0.0+build.12": "1.0.0",
+			}
+			for tag, expected := range testCases {
+				version, err := ParseVersion(tag)
+				gomega.Expect(err).Should(gomega.Succeed(), tag)
+				gomega.Expect(version.String()).Should(gomega.Equal(expected))
+			}
+		})
+
+		ginkgo.It("should not parse other tags", func() {
+			for _, tag := range []string{"latest", "stable", "1.2.3.4", "01.2", "1.2-", ""} {
+				_, err := ParseVersion(tag)
+				gomega.Expect(err).ShouldNot(gomega.Succeed(), tag)
+			}
+		})
+
+		ginkgo.It("should sort the versions by precedence", func() {
+			sorted := []string{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2",
+				"1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.2.0", "1.10.0", "2.0.0"}
+			for i := 0; i < len(sorted)-1; i++ {
+				lower, err := ParseVersion(sorted[i])
+				gomega.Expect(err).Should(gomega.Succeed())
+				higher, err := ParseVersion(sorted[i+1])
+				gomega.Expect(err).Should(gomega.Succeed())
+				gomega.Expect(lower.Compare(higher)).Should(gomega.Equal(-1), sorted[i])
+				gomega.Expect(higher.Compare(lower)).Should(gomega.Equal(1), sorted[i])
+				gomega.Expect(lower.Compare(lower)).Should(gomega.Equal(0), sorted[i])
+			}
+		})
+	})
+
+	ginkgo.Context("checking constraints", func() {
+
+		ginkgo.It("should check the versions against the constraints", func() {
+			var testCases = map[string]struct {
+				matching    []string
+				notMatching []string
+			}{
+				"^1.2":           {[]string{"1.2.0", "1.9.9"}, []string{"1.1.9", "2.0.0", "1.3.0-rc.1"}},
+				"^0.2.3":         {[]string{"0.2.3", "0.2.9"}, []string{"0.3.0", "0.2.2"}},
+				"^0.0.3":         {[]string{"0.0.3"}, []string{"0.0.4"}},
+				"~1.2.3":         {[]string{"1.2.3", "1.2.9"}, []string{"1.3.0", "1.2.2"}},
+				"~1":             {[]string{"1.0.0", "1.9.0"}, []string{"2.0.0"}},
+				">=1.0 <2.0":     {[]string{"1.0.0", "1.9.9"}, []string{"0.9.9", "2.0.0"}},
+				">= 1.0, < 2.0":  {[]string{"1.5.0"}, []string{"2.1.0"}},
+				">1.2":           {[]string{"1.3.0"}, []string{"1.2.9"}},
+				"<=1.2":          {[]string{"1.2.9"}, []string{"1.3.0"}},
+				"1.2.x":          {[]string{"1.2.0", "1.2.9"}, []string{"1.3.0"}},
+				"1.2":            {[]string{"1.2.5"}, []string{"1.20.0"}},
+				"=1.2.3":         {[]string{"1.2.3"}, []string{"1.2.4"}},
+				"*":              {[]string{"0.0.1", "9.0.0"}, []string{"1.0.0-rc.1"}},
+				"1.x || >=3":     {[]string{"1.4.0", "3.1.0"}, []string{"2.0.0"}},
+				">=2.0.0-beta.1": {[]string{"2.0.0-beta.2", "2.0.0", "2.1.0"}, []string{"2.0.0-alpha", "2.1.0-beta.1"}},
+			}
+			for expression, testCase := range testCases {
+				constraint, err := ParseVersionConstraint(expression)
+				gomega.Expect(err).Should(gomega.Succeed(), expression)
+				for _, tag := range testCase.matching {
+					version, err := ParseVersion(tag)
+					gomega.Expect(err).Should(gomega.Succeed())
+					gomega.Expect(constraint.Check(version)).Should(gomega.BeTrue(), "%s should satisfy %s", tag, expression)
+				}
+				for _, tag := range testCase.notMatching {
+					version, err := ParseVersion(tag)
+					gomega.Expect(err).Should(gomega.Succeed())
+					gomega.Expect(constraint.Check(version)).Should(gomega.BeFalse(), "%s should not satisfy %s", tag, expression)
+				}
+			}
+		})
+
+		ginkgo.It("should not parse invalid constraints", func() {
+			for _, expression := range []string{"", "latest", "^", ">=1.0 ||", "1.2.3.4", "~>1.2"} {
+				_, err := ParseVersionConstraint(expression)
+				gomega.Expect(err).ShouldNot(gomega.Succeed(), expression)
+			}
+		})
+	})
+
+	ginkgo.Context("checking tags", func() {
+		ginkgo.It("should accept the versions and the other tags", func() {
+			for _, tag := range []string{"latest", "dev", "1.2", "v1.2.3", "2.0.0-rc.1", "release-1.0"} {
+				gomega.Expect(CheckTag(tag)).Should(gomega.Succeed(), tag)
+			}
+		})
+
+		ginkgo.It("should reject the reserved tags and the constraints", func() {
+			for _, tag := range []string{"stable", "^1.2", ">=1.0", "1.x", "~1.2", "*"} {
+				err := CheckTag(tag)
+				gomega.Expect(nerrors.FromError(err).Code).Should(gomega.Equal(nerrors.InvalidArgument), tag)
+			}
+		})
+	})
+
+	ginkgo.Context("resolving tags", func() {
+
+		tags := []string{"dev", "0.9.0", "v1.0.0", "1.2.0", "1.10.1", "2.0.0-rc.1"}
+
+		ginkgo.It("should resolve the requested tags", func() {
+			var testCases = map[string]string{
+				"dev":          "dev",
+				"1.2.0":        "1.2.0",
+				"latest":       "1.10.1",
+				"stable":       "1.10.1",
+				"^1.0":         "1.10.1",
+				"~1.2":         "1.2.0",
+				"<1":           "0.9.0",
+				"1.0":          "v1.0.0",
+				">=2.0.0-rc.0": "2.0.0-rc.1",
+			}
+			for requested, expected := range testCases {
+				resolved, found := ResolveTag(requested, tags)
+				gomega.Expect(found).Should(gomega.BeTrue(), requested)
+				gomega.Expect(resolved).Should(gomega.Equal(expected), requested)
+			}
+		})
+
+		ginkgo.It("should prefer the tags named latest and stable", func() {
+			resolved, found := ResolveTag(LatestTag, append(tags, LatestTag))
+			gomega.Expect(found).Should(gomega.BeTrue())
+			gomega.Expect(resolved).Should(gomega.Equal(LatestTag))
+		})
+
+		ginkgo.It("should only resolve stable to versions from 1.0.0", func() {
+			_, found := ResolveTag(StableTag, []string{"0.1.0", "0.2.0", "1.0.0-rc.1"})
+			gomega.Expect(found).Should(gomega.BeFalse())
+			resolved, found := ResolveTag(LatestTag, []string{"0.1.0", "0.2.0", "1.0.0-rc.1"})
+			gomega.Expect(found).Should(gomega.BeTrue())
+			gomega.Expect(resolved).Should(gomega.Equal("0.2.0"))
+		})
+
+		ginkgo.It("should not resolve the tags that do not match", func() {
+			for _, requested := range []string{"prod", "^3", "~0.8"} {
+				_, found := ResolveTag(requested, tags)
+				gomega.Expect(found).Should(gomega.BeFalse(), requested)
+			}
+		})
+	})
+})